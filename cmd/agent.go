@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// agentCmd represents the agent command
+	agentCmd = &cobra.Command{
+		Use:   "agent --template <source:destination[:mode]>... [-- <command> [<arg...>]]",
+		Short: "Render files from templates of secrets, and keep them up to date",
+		Long: `Render files from templates of secrets, and keep them up to date.
+
+Templates use Go template syntax, with two functions:
+
+	{{ secret "service" "key" }}   the value of a key
+	{{ service "service" }}        all keys of a service, as a map
+
+Templates are rendered again every --interval, and files whose content
+changed are replaced atomically. When a command is given, chamber runs it
+once the files have been rendered, and restarts it when any file changes, or
+sends it --signal instead. Without a command, --pid-file names a process to
+signal. --once renders the files and exits, e.g. in an init container.`,
+		Example: `
+	$ cat app.conf.tmpl
+	[database]
+	password = {{ secret "app" "db_password" }}
+	{{ range $key, $value := service "features" }}{{ $key }} = {{ $value }}
+	{{ end }}
+	$ chamber agent --template app.conf.tmpl:/etc/app/app.conf --signal HUP -- ./server --config /etc/app/app.conf`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			dashIx := cmd.ArgsLenAtDash()
+			if dashIx == -1 {
+				return cobra.NoArgs(cmd, args)
+			}
+			if dashIx != 0 {
+				return errors.New("please only give the command to run after '--'. See usage")
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
+		RunE: runAgent,
+	}
+	agentTemplates []string
+	agentInterval  time.Duration
+	agentOnce      bool
+	agentSignal    string
+	agentPIDFile   string
+)
+
+func init() {
+	agentCmd.Flags().StringArrayVarP(&agentTemplates, "template", "t", nil, "template to render, as source:destination with an optional octal file mode, e.g. app.tmpl:/etc/app.conf:0640; may be repeated")
+	agentCmd.Flags().DurationVar(&agentInterval, "interval", time.Minute, "how often to render the templates again")
+	agentCmd.Flags().BoolVar(&agentOnce, "once", false, "render the templates once and exit")
+	agentCmd.Flags().StringVar(&agentSignal, "signal", "", "signal to send when a file changes, instead of restarting the command")
+	agentCmd.Flags().StringVar(&agentPIDFile, "pid-file", "", "file holding the pid of a process to send --signal to, when no command is given")
+	agentCmd.MarkFlagRequired("template")
+	RootCmd.AddCommand(agentCmd)
+}
+
+// agentTemplate is a template and the file it is rendered to
+type agentTemplate struct {
+	Source      string
+	Destination string
+	Mode        os.FileMode
+}
+
+// parseAgentTemplate parses source:destination[:mode]
+func parseAgentTemplate(spec string) (agentTemplate, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return agentTemplate{}, fmt.Errorf("invalid template %q: must be source:destination[:mode]", spec)
+	}
+	t := agentTemplate{Source: parts[0], Destination: parts[1], Mode: 0600}
+	if len(parts) == 3 {
+		mode, err := strconv.ParseUint(parts[2], 8, 32)
+		if err != nil || mode > 0777 {
+			return agentTemplate{}, fmt.Errorf("invalid mode in template %q: must be octal, like 0640", spec)
+		}
+		t.Mode = os.FileMode(mode)
+	}
+	return t, nil
+}
+
+// templateAgent renders templates, only writing the files whose content
+// changed since they were last rendered
+type templateAgent struct {
+	store     store.Store
+	templates []agentTemplate
+	rendered  map[string][]byte
+}
+
+// render renders every template, and reports whether any file changed
+func (a *templateAgent) render() (bool, error) {
+	// services are only fetched once per round, so that templates agree
+	services := map[string]map[string]string{}
+	serviceFunc := func(service string) (map[string]string, error) {
+		if secrets, ok := services[service]; ok {
+			return secrets, nil
+		}
+		rawSecrets, err := a.store.ListRaw(service)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list store contents for %s: %w", service, err)
+		}
+		secrets := map[string]string{}
+		for _, rawSecret := range rawSecrets {
+			secrets[key(rawSecret.Key)] = rawSecret.Value
+		}
+		services[service] = secrets
+		return secrets, nil
+	}
+	funcs := template.FuncMap{
+		"service": serviceFunc,
+		"secret": func(service, k string) (string, error) {
+			secrets, err := serviceFunc(service)
+			if err != nil {
+				return "", err
+			}
+			v, ok := secrets[k]
+			if !ok {
+				return "", fmt.Errorf("%s has no key %s", service, k)
+			}
+			return v, nil
+		},
+	}
+
+	changed := false
+	for _, t := range a.templates {
+		source, err := os.ReadFile(t.Source)
+		if err != nil {
+			return false, fmt.Errorf("Failed to read template: %w", err)
+		}
+		tmpl, err := template.New(filepath.Base(t.Source)).Funcs(funcs).Option("missingkey=error").Parse(string(source))
+		if err != nil {
+			return false, fmt.Errorf("Failed to parse template: %w", err)
+		}
+		buf := &bytes.Buffer{}
+		if err := tmpl.Execute(buf, nil); err != nil {
+			return false, fmt.Errorf("Failed to render template: %w", err)
+		}
+
+		if previous, ok := a.rendered[t.Destination]; ok && bytes.Equal(previous, buf.Bytes()) {
+			continue
+		}
+		if err := writeFileAtomically(t.Destination, buf.Bytes(), t.Mode); err != nil {
+			return false, fmt.Errorf("Failed to write %s: %w", t.Destination, err)
+		}
+		a.rendered[t.Destination] = buf.Bytes()
+		changed = true
+	}
+	return changed, nil
+}
+
+// writeFileAtomically replaces path with data, so that readers never see a
+// partly written file
+func writeFileAtomically(path string, data []byte, mode os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func runAgent(cmd *cobra.Command, args []string) error {
+	templates := make([]agentTemplate, 0, len(agentTemplates))
+	for _, spec := range agentTemplates {
+		t, err := parseAgentTemplate(spec)
+		if err != nil {
+			return err
+		}
+		templates = append(templates, t)
+	}
+	if agentInterval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+
+	var sig os.Signal
+	if agentSignal != "" {
+		var err error
+		if sig, err = parseSignal(agentSignal); err != nil {
+			return fmt.Errorf("Invalid --signal: %w", err)
+		}
+	}
+	if agentPIDFile != "" && (len(args) > 0 || sig == nil) {
+		return errors.New("--pid-file requires --signal, and cannot be used with a command")
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "agent").
+				Set("chamber-version", chamberVersion).
+				Set("templates", len(templates)).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+
+	agent := &templateAgent{store: secretStore, templates: templates, rendered: map[string][]byte{}}
+	if _, err := agent.render(); err != nil {
+		return err
+	}
+	if agentOnce {
+		return nil
+	}
+
+	changes := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(agentInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			changed, err := agent.render()
+			if err != nil {
+				// keep the last good files, and try again later
+				fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+				continue
+			}
+			if changed {
+				fmt.Fprintf(os.Stderr, "chamber: rendered files changed\n")
+				changes <- struct{}{}
+			}
+		}
+	}()
+
+	if len(args) == 0 {
+		for range changes {
+			if agentPIDFile != "" {
+				if err := signalPIDFile(agentPIDFile, sig); err != nil {
+					fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+				}
+			}
+		}
+	}
+
+	if sig != nil {
+		signals := make(chan os.Signal)
+		go func() {
+			for range changes {
+				signals <- sig
+			}
+		}()
+		status, err := runChild(args[0], args[1:], os.Environ(), childOptions{Signals: signals})
+		if err != nil {
+			return err
+		}
+		os.Exit(status)
+	}
+
+	for {
+		restart := make(chan struct{})
+		go func() {
+			<-changes
+			close(restart)
+		}()
+		status, err := runChild(args[0], args[1:], os.Environ(), childOptions{Restart: restart})
+		if errors.Is(err, errRestart) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		os.Exit(status)
+	}
+}
+
+// signalPIDFile sends sig to the process whose pid is in path
+func signalPIDFile(path string, sig os.Signal) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read pid file: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("Invalid pid in %s: %w", path, err)
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(sig)
+}
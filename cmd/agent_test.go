@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAgentTemplate(t *testing.T) {
+	tmpl, err := parseAgentTemplate("app.tmpl:/etc/app.conf")
+	assert.NoError(t, err)
+	assert.Equal(t, agentTemplate{Source: "app.tmpl", Destination: "/etc/app.conf", Mode: 0600}, tmpl)
+
+	tmpl, err = parseAgentTemplate("app.tmpl:/etc/app.conf:0644")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), tmpl.Mode)
+
+	for _, spec := range []string{"app.tmpl", ":/etc/app.conf", "app.tmpl:", "a:b:0999", "a:b:c:d"} {
+		_, err := parseAgentTemplate(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestTemplateAgentRender(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "app.tmpl")
+	destination := filepath.Join(dir, "app.conf")
+	err := os.WriteFile(source, []byte(`password={{ secret "app" "db_password" }}
+{{ range $k, $v := service "features" }}{{ $k }}={{ $v }}
+{{ end }}`), 0600)
+	assert.NoError(t, err)
+
+	s := newFakeStore(map[string]map[string]string{
+		"app":      {"db_password": "hunter22"},
+		"features": {"beta": "on", "dark_mode": "off"},
+	})
+	agent := &templateAgent{
+		store:     s,
+		templates: []agentTemplate{{Source: source, Destination: destination, Mode: 0600}},
+		rendered:  map[string][]byte{},
+	}
+
+	changed, err := agent.render()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	data, err := os.ReadFile(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, "password=hunter22\nbeta=on\ndark_mode=off\n", string(data))
+
+	changed, err = agent.render()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	s.Write(store.SecretId{Service: "app", Key: "db_password"}, "hunter23")
+	changed, err = agent.render()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	data, err = os.ReadFile(destination)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "password=hunter23")
+
+	err = os.WriteFile(source, []byte(`{{ secret "app" "missing" }}`), 0600)
+	assert.NoError(t, err)
+	_, err = agent.render()
+	assert.Error(t, err)
+	data, err = os.ReadFile(destination)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "password=hunter23", "a failed render keeps the last file")
+}
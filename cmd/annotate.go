@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// UsageTagKey is the tag holding a key's usage annotation, which is
+	// consumed by exec --strict-from-metadata
+	UsageTagKey = "chamber:usage"
+
+	UsageRequired = "required"
+	UsageOptional = "optional"
+	UsageNone     = "none"
+)
+
+// annotateCmd represents the annotate command
+var annotateCmd = &cobra.Command{
+	Use:   "annotate <service> <key> <required|optional|none>",
+	Short: "Declare whether a secret is required or optional for its service",
+	Long: `Declare whether a secret is required or optional for its service.
+
+The annotation is stored as a tag on the secret, and is what
+exec --strict-from-metadata validates against. "none" removes it.`,
+	Args: cobra.ExactArgs(3),
+	RunE: annotate,
+}
+
+func init() {
+	RootCmd.AddCommand(annotateCmd)
+}
+
+func annotate(cmd *cobra.Command, args []string) error {
+	service := utils.NormalizeService(args[0])
+	if err := validateService(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+
+	key := utils.NormalizeKey(args[1])
+	if err := validateKey(key); err != nil {
+		return fmt.Errorf("Failed to validate key: %w", err)
+	}
+
+	usage := args[2]
+	switch usage {
+	case UsageRequired, UsageOptional, UsageNone:
+	default:
+		return fmt.Errorf("Invalid usage '%s'; must be one of %s, %s or %s", usage, UsageRequired, UsageOptional, UsageNone)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "annotate").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("key", key).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+
+	secretId := store.SecretId{
+		Service: service,
+		Key:     key,
+	}
+
+	if usage == UsageNone {
+		return secretStore.DeleteTags(secretId, []string{UsageTagKey})
+	}
+	return secretStore.WriteTags(secretId, map[string]string{UsageTagKey: usage})
+}
+
+// readUsage returns the usage annotation of every annotated key in service,
+// keyed by secret key. Backends have no call listing the tags of several
+// secrets, so this makes one ReadTags call per key; they are made
+// DefaultConcurrency at a time, retrying those the backend throttles.
+func readUsage(s store.Store, service string) (map[string]string, error) {
+	secrets, err := s.List(service, false)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(secrets))
+	tags := make([]map[string]string, len(secrets))
+	for i, secret := range secrets {
+		keys[i] = key(secret.Meta.Key)
+	}
+	errs := runPool(DefaultConcurrency, len(keys), func(i int) error {
+		var err error
+		tags[i], err = s.ReadTags(store.SecretId{Service: service, Key: keys[i]})
+		return err
+	})
+
+	usage := map[string]string{}
+	for i, k := range keys {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("Failed to read tags for %s: %w", k, errs[i])
+		}
+		if u, ok := tags[i][UsageTagKey]; ok && u != UsageNone {
+			usage[k] = u
+		}
+	}
+	return usage, nil
+}
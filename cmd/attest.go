@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+)
+
+// AttestationKeyEnvVar holds the key used to sign startup attestations. It is
+// only read from the environment so that it never shows up in process lists.
+const AttestationKeyEnvVar = "CHAMBER_ATTESTATION_KEY"
+
+// attestation records what an exec'd process was started with. It never
+// contains secret values.
+type attestation struct {
+	ChamberVersion string               `json:"chamber_version"`
+	Timestamp      time.Time            `json:"timestamp"`
+	Host           string               `json:"host"`
+	Backend        string               `json:"backend"`
+	Command        string               `json:"command"`
+	Services       []attestationService `json:"services"`
+}
+
+type attestationService struct {
+	Service string           `json:"service"`
+	Keys    []attestationKey `json:"keys"`
+}
+
+type attestationKey struct {
+	Key     string `json:"key"`
+	Version int    `json:"version"`
+}
+
+// signedAttestation is the document written to the sink. Signature is an
+// HMAC-SHA256 of the JSON encoding of Attestation.
+type signedAttestation struct {
+	Attestation json.RawMessage `json:"attestation"`
+	Signature   string          `json:"signature"`
+}
+
+// buildAttestation collects key names and versions for services. It uses
+// List rather than ListRaw, since only List returns versions.
+func buildAttestation(s store.Store, services []string, command string) (attestation, error) {
+	host, _ := os.Hostname()
+	a := attestation{
+		ChamberVersion: chamberVersion,
+		Timestamp:      time.Now().UTC(),
+		Host:           host,
+		Backend:        backend,
+		Command:        command,
+		Services:       []attestationService{},
+	}
+
+	for _, service := range services {
+		secrets, err := s.List(utils.NormalizeService(service), false)
+		if err != nil {
+			return attestation{}, fmt.Errorf("Failed to list store contents for service %s: %w", service, err)
+		}
+		sort.Sort(ByName(secrets))
+		as := attestationService{Service: service, Keys: []attestationKey{}}
+		for _, secret := range secrets {
+			as.Keys = append(as.Keys, attestationKey{
+				Key:     key(secret.Meta.Key),
+				Version: secret.Meta.Version,
+			})
+		}
+		a.Services = append(a.Services, as)
+	}
+	return a, nil
+}
+
+func signAttestation(a attestation, signingKey []byte) ([]byte, error) {
+	payload, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write(payload)
+
+	return json.Marshal(signedAttestation{
+		Attestation: payload,
+		Signature:   "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil)),
+	})
+}
+
+// writeAttestation signs a and writes it to sink, which is one of stdout,
+// stderr, an s3://bucket/prefix URL, or a file path.
+func writeAttestation(sink string, a attestation) error {
+	signingKey := os.Getenv(AttestationKeyEnvVar)
+	if signingKey == "" {
+		return fmt.Errorf("$%s must be set to sign attestations", AttestationKeyEnvVar)
+	}
+
+	doc, err := signAttestation(a, []byte(signingKey))
+	if err != nil {
+		return err
+	}
+	doc = append(doc, '\n')
+
+	switch {
+	case sink == "stdout" || sink == "-":
+		_, err = os.Stdout.Write(doc)
+	case sink == "stderr":
+		_, err = os.Stderr.Write(doc)
+	case strings.HasPrefix(sink, "s3://"):
+		err = putAttestationS3(sink, a, doc)
+	default:
+		var f *os.File
+		if f, err = os.OpenFile(sink, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600); err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(f, bytes.NewReader(doc))
+	}
+	return err
+}
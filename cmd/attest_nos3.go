@@ -0,0 +1,9 @@
+//go:build nos3
+
+package cmd
+
+import "errors"
+
+func putAttestationS3(sink string, a attestation, doc []byte) error {
+	return errors.New("chamber was built without S3 support (nos3)")
+}
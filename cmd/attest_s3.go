@@ -0,0 +1,46 @@
+//go:build !nos3
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/segmentio/chamber/v2/store"
+)
+
+func putAttestationS3(sink string, a attestation, doc []byte) error {
+	u, err := url.Parse(sink)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return errors.New("attestation sink must name a bucket, e.g. s3://bucket/prefix")
+	}
+
+	session, region, err := store.NewSession(numRetries)
+	if err != nil {
+		return err
+	}
+	svc := s3.New(session, &aws.Config{Region: region})
+
+	objectKey := strings.Trim(u.Path, "/")
+	if objectKey != "" {
+		objectKey += "/"
+	}
+	objectKey += fmt.Sprintf("%s-%s.json", a.Timestamp.Format("20060102T150405Z"), a.Host)
+
+	_, err = svc.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(u.Host),
+		Key:                  aws.String(objectKey),
+		Body:                 bytes.NewReader(doc),
+		ContentType:          aws.String("application/json"),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAes256),
+	})
+	return err
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAttestation(t *testing.T) {
+	a := attestation{
+		ChamberVersion: "test",
+		Timestamp:      time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		Host:           "host",
+		Backend:        SSMBackend,
+		Command:        "server",
+		Services: []attestationService{
+			{Service: "app", Keys: []attestationKey{{Key: "db_password", Version: 3}}},
+		},
+	}
+
+	doc, err := signAttestation(a, []byte("secret"))
+	assert.Nil(t, err)
+
+	var signed signedAttestation
+	assert.Nil(t, json.Unmarshal(doc, &signed))
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(signed.Attestation)
+	assert.Equal(t, "hmac-sha256:"+hex.EncodeToString(mac.Sum(nil)), signed.Signature)
+
+	var decoded attestation
+	assert.Nil(t, json.Unmarshal(signed.Attestation, &decoded))
+	assert.Equal(t, a, decoded)
+}
@@ -0,0 +1,375 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// auditMaxSince is how far back CloudTrail keeps the event history audit
+// looks up
+const auditMaxSince = 90 * 24 * time.Hour
+
+// The actions audit reports
+const (
+	auditRead   = "read"
+	auditWrite  = "write"
+	auditDelete = "delete"
+)
+
+// auditActions maps the API calls of each backend to what they do to secrets.
+// Calls only describing secrets, without their values, are left out.
+var auditActions = map[string]map[string]string{
+	"ssm.amazonaws.com": {
+		"GetParameter":            auditRead,
+		"GetParameters":           auditRead,
+		"GetParametersByPath":     auditRead,
+		"GetParameterHistory":     auditRead,
+		"PutParameter":            auditWrite,
+		"LabelParameterVersion":   auditWrite,
+		"UnlabelParameterVersion": auditWrite,
+		"AddTagsToResource":       auditWrite,
+		"RemoveTagsFromResource":  auditWrite,
+		"DeleteParameter":         auditDelete,
+		"DeleteParameters":        auditDelete,
+	},
+	"secretsmanager.amazonaws.com": {
+		"GetSecretValue":               auditRead,
+		"CreateSecret":                 auditWrite,
+		"PutSecretValue":               auditWrite,
+		"UpdateSecret":                 auditWrite,
+		"RestoreSecret":                auditWrite,
+		"TagResource":                  auditWrite,
+		"UntagResource":                auditWrite,
+		"DeleteSecret":                 auditDelete,
+		"RemoveRegionsFromReplication": auditDelete,
+	},
+}
+
+var (
+	// auditCmd represents the audit command
+	auditCmd = &cobra.Command{
+		Use:   "audit <service> [<key>]",
+		Short: "Report who read, wrote or deleted the secrets of a service",
+		Long: `Report who read, wrote or deleted the secrets of a service, or one of its
+keys, from the CloudTrail event history of the account and region.
+
+The event history covers the last 90 days. Reading every key of a service at
+once, as exec and export do, is reported with the key *. Secrets Manager keeps
+all the keys of a service in one secret, so its events are always reported with
+the key *. Failed calls are reported with their error, since denied attempts
+matter too. The S3 backends aren't supported, as CloudTrail only logs reads of
+S3 objects in trails with data events.`,
+		Example: `
+	$ chamber audit app db_password --since 7d
+	$ chamber audit app --since 12h
+	$ chamber audit app --action write,delete --output json`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: runAudit,
+	}
+	auditSince  string
+	auditFilter []string
+)
+
+func init() {
+	auditCmd.Flags().StringVar(&auditSince, "since", "30d", "how far back to look, as days like 30d or a duration like 12h; at most 90d")
+	auditCmd.Flags().StringSliceVar(&auditFilter, "action", nil, "only report these actions: read, write or delete")
+	RootCmd.AddCommand(auditCmd)
+}
+
+// auditTrail is the part of the CloudTrail API audit uses
+type auditTrail interface {
+	LookupEventsPages(*cloudtrail.LookupEventsInput, func(*cloudtrail.LookupEventsOutput, bool) bool) error
+}
+
+// newAuditTrail returns the CloudTrail client audit looks events up with
+var newAuditTrail = func() (auditTrail, error) {
+	session, region, err := store.NewSession(numRetries)
+	if err != nil {
+		return nil, err
+	}
+	return cloudtrail.New(session, &aws.Config{Region: region}), nil
+}
+
+// auditEvent is a call to the backend touching a secret
+type auditEvent struct {
+	Time     time.Time `json:"time" yaml:"time"`
+	User     string    `json:"user" yaml:"user"`
+	Action   string    `json:"action" yaml:"action"`
+	Key      string    `json:"key" yaml:"key"`
+	Event    string    `json:"event" yaml:"event"`
+	SourceIP string    `json:"source_ip,omitempty" yaml:"source_ip,omitempty"`
+	Error    string    `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// auditTarget recognizes the events touching a service, or one of its keys,
+// by the names the backend knows them under
+type auditTarget struct {
+	source  string
+	service string
+	key     string
+	// name is the name of the parameter or secret holding the service, or
+	// its path when using paths
+	name  string
+	paths bool
+}
+
+// newAuditTarget returns the target for service and key in backend. key is
+// empty to audit every key of the service.
+func newAuditTarget(backend, service, key string) (auditTarget, error) {
+	switch backend {
+	case SSMBackend:
+		_, noPaths := os.LookupEnv("CHAMBER_NO_PATHS")
+		t := auditTarget{source: "ssm.amazonaws.com", service: service, key: key, name: service, paths: !noPaths}
+		if t.paths {
+			if prefix := strings.Trim(os.Getenv(store.PrefixEnvVar), "/"); prefix != "" {
+				t.name = "/" + prefix + "/" + service
+			} else {
+				t.name = "/" + service
+			}
+		}
+		return t, nil
+	case SecretsManagerBackend:
+		return auditTarget{source: "secretsmanager.amazonaws.com", service: service, key: key, name: service}, nil
+	default:
+		return auditTarget{}, fmt.Errorf("audit isn't supported by the %s backend", backend)
+	}
+}
+
+// cloudTrailRecord is the part of a CloudTrail event audit reads
+type cloudTrailRecord struct {
+	EventName    string `json:"eventName"`
+	UserIdentity struct {
+		Arn string `json:"arn"`
+	} `json:"userIdentity"`
+	SourceIPAddress   string `json:"sourceIPAddress"`
+	ErrorCode         string `json:"errorCode"`
+	RequestParameters struct {
+		Name       string   `json:"name"`
+		Names      []string `json:"names"`
+		Path       string   `json:"path"`
+		Recursive  bool     `json:"recursive"`
+		ResourceID string   `json:"resourceId"`
+		SecretID   string   `json:"secretId"`
+	} `json:"requestParameters"`
+}
+
+// secretsManagerSuffix is the random suffix Secrets Manager adds to the ARNs
+// of secrets
+var secretsManagerSuffix = regexp.MustCompile(`-[A-Za-z0-9]{6}$`)
+
+// nameFromArn returns the name of the parameter or secret an ARN points to,
+// or name itself if it isn't an ARN
+func nameFromArn(name string) string {
+	if !strings.HasPrefix(name, "arn:") {
+		return name
+	}
+	parts := strings.SplitN(name, ":", 6)
+	if len(parts) < 6 {
+		return name
+	}
+	resource := parts[5]
+	if strings.HasPrefix(resource, "parameter") {
+		return strings.TrimPrefix(resource, "parameter")
+	}
+	if _, secret, ok := strings.Cut(resource, "secret:"); ok {
+		return secretsManagerSuffix.ReplaceAllString(secret, "")
+	}
+	return name
+}
+
+// keyOf returns the key of the service a parameter name is, if it is one
+func (t auditTarget) keyOf(name string) (string, bool) {
+	name = nameFromArn(name)
+	if t.source == "secretsmanager.amazonaws.com" {
+		return "*", name == t.name
+	}
+	sep := "."
+	if t.paths {
+		sep = "/"
+	}
+	k := strings.TrimPrefix(name, t.name+sep)
+	if k == name || k == "" || strings.Contains(k, "/") {
+		return "", false
+	}
+	k = utils.NormalizeKey(k)
+	if t.key != "" && k != t.key {
+		return "", false
+	}
+	return k, true
+}
+
+// match returns the event a CloudTrail event is for the target, if it touches
+// it
+func (t auditTarget) match(event *cloudtrail.Event) (auditEvent, bool) {
+	var record cloudTrailRecord
+	if err := json.Unmarshal([]byte(aws.StringValue(event.CloudTrailEvent)), &record); err != nil {
+		return auditEvent{}, false
+	}
+	action, ok := auditActions[t.source][record.EventName]
+	if !ok {
+		return auditEvent{}, false
+	}
+
+	params := record.RequestParameters
+	var keys []string
+	for _, name := range append([]string{params.Name, params.ResourceID, params.SecretID}, params.Names...) {
+		if name == "" {
+			continue
+		}
+		if k, ok := t.keyOf(name); ok {
+			keys = append(keys, k)
+		}
+	}
+	if t.paths && params.Path != "" {
+		path := strings.TrimSuffix(params.Path, "/")
+		if path == t.name || (params.Recursive && strings.HasPrefix(t.name, path+"/")) || (params.Recursive && path == "") {
+			keys = append(keys, "*")
+		}
+	}
+	if len(keys) == 0 {
+		return auditEvent{}, false
+	}
+
+	user := record.UserIdentity.Arn
+	if user == "" {
+		user = aws.StringValue(event.Username)
+	}
+	return auditEvent{
+		Time:     aws.TimeValue(event.EventTime),
+		User:     user,
+		Action:   action,
+		Key:      strings.Join(keys, ","),
+		Event:    record.EventName,
+		SourceIP: record.SourceIPAddress,
+		Error:    record.ErrorCode,
+	}, true
+}
+
+// lookupAudit returns the events touching target between start and end,
+// oldest first, keeping only actions if any are given
+func lookupAudit(trail auditTrail, target auditTarget, start, end time.Time, actions []string) ([]auditEvent, error) {
+	events := []auditEvent{}
+	input := &cloudtrail.LookupEventsInput{
+		LookupAttributes: []*cloudtrail.LookupAttribute{{
+			AttributeKey:   aws.String(cloudtrail.LookupAttributeKeyEventSource),
+			AttributeValue: aws.String(target.source),
+		}},
+		StartTime: aws.Time(start),
+		EndTime:   aws.Time(end),
+	}
+	err := trail.LookupEventsPages(input, func(page *cloudtrail.LookupEventsOutput, last bool) bool {
+		for _, e := range page.Events {
+			event, ok := target.match(e)
+			if ok && auditWanted(event.Action, actions) {
+				events = append(events, event)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up CloudTrail events: %w", err)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events, nil
+}
+
+// auditWanted reports whether action is one of actions, or actions is empty
+func auditWanted(action string, actions []string) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return len(actions) == 0
+}
+
+func runAudit(cmd *cobra.Command, args []string) error {
+	service := utils.NormalizeService(args[0])
+	if err := validateService(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+	key := ""
+	if len(args) == 2 {
+		key = utils.NormalizeKey(args[1])
+		if err := validateKey(key); err != nil {
+			return fmt.Errorf("Failed to validate key: %w", err)
+		}
+	}
+	since, err := parseRetention(auditSince)
+	if err != nil {
+		return fmt.Errorf("Invalid --since: %w", err)
+	}
+	if since > auditMaxSince {
+		return errors.New("--since can be at most 90d, as far back as the CloudTrail event history goes")
+	}
+	for _, action := range auditFilter {
+		if action != auditRead && action != auditWrite && action != auditDelete {
+			return fmt.Errorf("Invalid --action %q: must be read, write or delete", action)
+		}
+	}
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	resolveBackend()
+	target, err := newAuditTarget(backend, service, key)
+	if err != nil {
+		return err
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "audit").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("key", key).
+				Set("since", auditSince).
+				Set("backend", backend),
+		})
+	}
+
+	trail, err := newAuditTrail()
+	if err != nil {
+		return fmt.Errorf("Failed to create CloudTrail client: %w", err)
+	}
+	now := time.Now()
+	events, err := lookupAudit(trail, target, now.Add(-since), now, auditFilter)
+	if err != nil {
+		return err
+	}
+
+	if structured {
+		return writeStructured(os.Stdout, events)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+	fmt.Fprintln(w, "Date\tUser\tAction\tKey\tEvent\tSource IP\tError")
+	for _, event := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			event.Time.Local().Format(ShortTimeFormat),
+			event.User,
+			event.Action,
+			event.Key,
+			event.Event,
+			event.SourceIP,
+			event.Error,
+		)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTrail serves events over two pages
+type fakeTrail struct {
+	events []*cloudtrail.Event
+	input  *cloudtrail.LookupEventsInput
+}
+
+func (f *fakeTrail) LookupEventsPages(input *cloudtrail.LookupEventsInput, fn func(*cloudtrail.LookupEventsOutput, bool) bool) error {
+	f.input = input
+	half := len(f.events) / 2
+	if fn(&cloudtrail.LookupEventsOutput{Events: f.events[:half]}, false) {
+		fn(&cloudtrail.LookupEventsOutput{Events: f.events[half:]}, true)
+	}
+	return nil
+}
+
+func trailEvent(t *testing.T, at time.Time, name string, params map[string]interface{}) *cloudtrail.Event {
+	record, err := json.Marshal(map[string]interface{}{
+		"eventName":         name,
+		"userIdentity":      map[string]string{"arn": "arn:aws:iam::123456789012:user/alice"},
+		"sourceIPAddress":   "203.0.113.7",
+		"requestParameters": params,
+	})
+	require.NoError(t, err)
+	return &cloudtrail.Event{EventTime: aws.Time(at), EventName: aws.String(name), CloudTrailEvent: aws.String(string(record))}
+}
+
+func TestLookupAuditSSM(t *testing.T) {
+	t.Setenv("CHAMBER_PREFIX", "")
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	trail := &fakeTrail{events: []*cloudtrail.Event{
+		trailEvent(t, now.Add(-time.Minute), "DeleteParameters", map[string]interface{}{"names": []string{"/app/db_password", "/other/db_password"}}),
+		trailEvent(t, now.Add(-time.Hour), "GetParametersByPath", map[string]interface{}{"path": "/app/", "recursive": false}),
+		trailEvent(t, now.Add(-2*time.Hour), "PutParameter", map[string]interface{}{"name": "/app/DB_PASSWORD"}),
+		trailEvent(t, now.Add(-3*time.Hour), "GetParameter", map[string]interface{}{"name": "arn:aws:ssm:us-east-1:123456789012:parameter/app/api_key"}),
+		trailEvent(t, now.Add(-4*time.Hour), "GetParameter", map[string]interface{}{"name": "/app/nested/db_password"}),
+		trailEvent(t, now.Add(-5*time.Hour), "DescribeParameters", map[string]interface{}{}),
+	}}
+
+	target, err := newAuditTarget(SSMBackend, "app", "")
+	require.NoError(t, err)
+	events, err := lookupAudit(trail, target, now.Add(-24*time.Hour), now, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ssm.amazonaws.com", aws.StringValue(trail.input.LookupAttributes[0].AttributeValue))
+
+	var got [][3]string
+	for _, e := range events {
+		got = append(got, [3]string{e.Action, e.Key, e.Event})
+	}
+	assert.Equal(t, [][3]string{
+		{auditRead, "api_key", "GetParameter"},
+		{auditWrite, "db_password", "PutParameter"},
+		{auditRead, "*", "GetParametersByPath"},
+		{auditDelete, "db_password", "DeleteParameters"},
+	}, got)
+	assert.Equal(t, "arn:aws:iam::123456789012:user/alice", events[0].User)
+
+	target, err = newAuditTarget(SSMBackend, "app", "db_password")
+	require.NoError(t, err)
+	events, err = lookupAudit(trail, target, now.Add(-24*time.Hour), now, []string{auditWrite, auditDelete})
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+}
+
+func TestAuditTargetPrefix(t *testing.T) {
+	t.Setenv("CHAMBER_PREFIX", "/team/")
+	target, err := newAuditTarget(SSMBackend, "app", "")
+	require.NoError(t, err)
+	k, ok := target.keyOf("/team/app/db_password")
+	assert.True(t, ok)
+	assert.Equal(t, "db_password", k)
+	_, ok = target.keyOf("/app/db_password")
+	assert.False(t, ok)
+}
+
+func TestAuditTargetSecretsManager(t *testing.T) {
+	target, err := newAuditTarget(SecretsManagerBackend, "app", "db_password")
+	require.NoError(t, err)
+	k, ok := target.keyOf("arn:aws:secretsmanager:us-east-1:123456789012:secret:app-AbC123")
+	assert.True(t, ok)
+	assert.Equal(t, "*", k)
+	_, ok = target.keyOf("application")
+	assert.False(t, ok)
+
+	_, err = newAuditTarget(S3Backend, "app", "")
+	assert.Error(t, err)
+}
+
+func TestRunAuditResolvesBackend(t *testing.T) {
+	t.Setenv(BackendEnvVar, "ssm")
+	t.Setenv("CHAMBER_PREFIX", "")
+	defer func(previous func() (auditTrail, error), previousBackend string) {
+		newAuditTrail, backend = previous, previousBackend
+	}(newAuditTrail, backend)
+	// as left by a command that didn't get a secret store
+	backend = ""
+	trail := &fakeTrail{events: []*cloudtrail.Event{
+		trailEvent(t, time.Now().Add(-time.Hour), "GetParameter", map[string]interface{}{"name": "/app/db_password"}),
+	}}
+	newAuditTrail = func() (auditTrail, error) { return trail, nil }
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stdout = w
+	err = runAudit(auditCmd, []string{"app"})
+	os.Stdout = stdout
+	w.Close()
+	require.NoError(t, err)
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	assert.Equal(t, SSMBackend, backend)
+	assert.Equal(t, "ssm.amazonaws.com", aws.StringValue(trail.input.LookupAttributes[0].AttributeValue))
+	assert.Contains(t, string(out), "db_password")
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// backendCmd represents the backend command
+	backendCmd = &cobra.Command{
+		Use:   "backend",
+		Short: "inspect the active backend",
+	}
+
+	// backendInfoCmd represents the backend info command
+	backendInfoCmd = &cobra.Command{
+		Use:   "info",
+		Short: "print the features the active backend supports, as JSON",
+		Long: `Print the features the active backend supports, as JSON, so scripts can
+check for them instead of failing part way through an operation.`,
+		Example: `
+	$ chamber backend info
+	{
+	  "backend": "ssm",
+	  "capabilities": {
+	    "history": true,
+	    "labels": true,
+	    "tags": true,
+	    "expiry": true,
+	    "binary": false,
+	    "max_value_size": 4096,
+	    "concurrent_writes": true
+	  }
+	}`,
+		Args: cobra.NoArgs,
+		RunE: backendInfoRun,
+	}
+)
+
+// BackendInfo describes the active backend
+type BackendInfo struct {
+	Backend      string             `json:"backend"`
+	Capabilities store.Capabilities `json:"capabilities"`
+}
+
+func init() {
+	backendCmd.AddCommand(backendInfoCmd)
+	RootCmd.AddCommand(backendCmd)
+}
+
+func backendInfoRun(cmd *cobra.Command, args []string) error {
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(BackendInfo{
+		Backend:      strings.ToLower(backend),
+		Capabilities: secretStore.Capabilities(),
+	})
+}
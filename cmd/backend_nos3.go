@@ -0,0 +1,21 @@
+//go:build nos3
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/segmentio/chamber/v2/store"
+)
+
+const s3BackendEnabled = false
+
+var errS3BackendDisabled = errors.New("chamber was built without the S3 backends (nos3)")
+
+func newS3Store(numRetries int, bucket string) (store.Store, error) {
+	return nil, errS3BackendDisabled
+}
+
+func newS3KMSStore(numRetries int, bucket string, kmsKeyAlias string) (store.Store, error) {
+	return nil, errS3BackendDisabled
+}
@@ -0,0 +1,15 @@
+//go:build nosecretsmanager
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/segmentio/chamber/v2/store"
+)
+
+const secretsManagerBackendEnabled = false
+
+func newSecretsManagerStore(numRetries int) (store.Store, error) {
+	return nil, errors.New("chamber was built without the Secrets Manager backend (nosecretsmanager)")
+}
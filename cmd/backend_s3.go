@@ -0,0 +1,17 @@
+//go:build !nos3
+
+package cmd
+
+import "github.com/segmentio/chamber/v2/store"
+
+// s3BackendEnabled reports whether the S3 and S3-KMS backends are compiled in.
+// Build with -tags nos3 to leave them out.
+const s3BackendEnabled = true
+
+func newS3Store(numRetries int, bucket string) (store.Store, error) {
+	return store.NewS3StoreWithBucket(numRetries, bucket)
+}
+
+func newS3KMSStore(numRetries int, bucket string, kmsKeyAlias string) (store.Store, error) {
+	return store.NewS3KMSStore(numRetries, bucket, kmsKeyAlias)
+}
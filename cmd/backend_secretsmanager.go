@@ -0,0 +1,13 @@
+//go:build !nosecretsmanager
+
+package cmd
+
+import "github.com/segmentio/chamber/v2/store"
+
+// secretsManagerBackendEnabled reports whether the Secrets Manager backend is
+// compiled in. Build with -tags nosecretsmanager to leave it out.
+const secretsManagerBackendEnabled = true
+
+func newSecretsManagerStore(numRetries int) (store.Store, error) {
+	return store.NewSecretsManagerStore(numRetries)
+}
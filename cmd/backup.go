@@ -0,0 +1,619 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	slashpath "path"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// backupArchiveVersion is the version of the backup archive format. Version 2
+// added the metadata and history of secrets.
+const backupArchiveVersion = 2
+
+// backupBundleFormat is the format of the archives encrypted into bundles
+const backupBundleFormat = "backup"
+
+var (
+	backupCmd = &cobra.Command{
+		Use:   "backup [<service-prefix>]",
+		Short: "Snapshot the secrets of every service under a prefix",
+		Long: `Snapshot the latest value of every secret of every service under a prefix,
+or of every service with --all, into a JSON archive. With several --region
+flags, each region is read concurrently into its own section of the archive,
+so that regions can be compared.
+
+--history also keeps the metadata and tags of each secret and every version
+kept of it, so that chamber restore --from can bring them back. The archive
+holds plaintext values unless --encrypt encrypts it with KMS, as export
+--encrypt does; --gzip compresses it first.
+
+chamber writes neither tar archives nor zstd or age encryption itself; pipe the
+archive through zstd and age instead, and back through them into chamber
+restore --from -.`,
+		Example: `
+	$ chamber backup --all --history --gzip --encrypt kms:alias/chamber-backup -o backup.json.gz.kms
+	$ chamber restore --from backup.json.gz.kms app-prod
+	$ chamber backup --all --history | zstd | age -r age1example > backup.json.zst.age
+	$ age -d -i key.txt backup.json.zst.age | zstd -d | chamber restore --from - app-prod`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if backupAll {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.MaximumNArgs(1)(cmd, args)
+		},
+		RunE: backupRun,
+	}
+	backupRegions    []string
+	backupOutputFile string
+	backupAll        bool
+	backupHistory    bool
+	backupGzip       bool
+	backupEncrypt    string
+)
+
+// backupArchive is the document written by chamber backup
+type backupArchive struct {
+	Version        int            `json:"version"`
+	ChamberVersion string         `json:"chamber_version"`
+	Created        time.Time      `json:"created"`
+	Prefix         string         `json:"prefix"`
+	Regions        []backupRegion `json:"regions"`
+}
+
+// backupRegion holds the secrets of one region, keyed by service then key.
+// Region is empty when the region configured in the environment was used.
+// Metadata is only kept with --history.
+type backupRegion struct {
+	Region   string                               `json:"region,omitempty"`
+	Services map[string]map[string]string         `json:"services"`
+	Metadata map[string]map[string]backupMetadata `json:"metadata,omitempty"`
+}
+
+// backupMetadata describes the latest version of a secret, and the versions
+// kept before it
+type backupMetadata struct {
+	Version   int               `json:"version"`
+	Created   time.Time         `json:"created"`
+	CreatedBy string            `json:"created_by"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	History   []backupVersion   `json:"history,omitempty"`
+}
+
+// backupVersion is a version of a secret, in the history of its metadata
+type backupVersion struct {
+	Version   int       `json:"version"`
+	Value     string    `json:"value"`
+	Created   time.Time `json:"created"`
+	CreatedBy string    `json:"created_by"`
+}
+
+func init() {
+	backupCmd.Flags().StringSliceVar(&backupRegions, "region", nil, "region to snapshot; may be repeated to snapshot several regions concurrently (SSM backend only)")
+	backupCmd.Flags().StringVarP(&backupOutputFile, "output-file", "o", "", "file to write the archive to (default is standard output)")
+	backupCmd.Flags().BoolVar(&backupAll, "all", false, "snapshot every service, as when no prefix is given")
+	backupCmd.Flags().BoolVar(&backupHistory, "history", false, "also keep the metadata and tags of each secret and every version kept of it")
+	backupCmd.Flags().BoolVar(&backupGzip, "gzip", false, "compress the archive with gzip")
+	backupCmd.Flags().StringVar(&backupEncrypt, "encrypt", "", "encrypt the archive for a recipient, kms:<key-id>, which chamber restore --from decrypts")
+	RootCmd.AddCommand(backupCmd)
+}
+
+func backupRun(cmd *cobra.Command, args []string) error {
+	prefix := ""
+	if len(args) == 1 {
+		prefix = utils.NormalizeService(args[0])
+	}
+	var encryptKeyID string
+	if backupEncrypt != "" {
+		var err error
+		if _, encryptKeyID, err = parseBundleRecipient(backupEncrypt); err != nil {
+			return fmt.Errorf("Invalid --encrypt: %w", err)
+		}
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "backup").
+				Set("chamber-version", chamberVersion).
+				Set("prefix", prefix).
+				Set("regions", backupRegions).
+				Set("history", backupHistory).
+				Set("encrypt", backupEncrypt != "").
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+
+	// manifests are backed up with the secrets they describe
+	stores := map[string]store.Store{"": withManifests(secretStore)}
+	if len(backupRegions) > 0 {
+		if backend != SSMBackend {
+			return errors.New("--region is only supported by the SSM backend")
+		}
+		stores = map[string]store.Store{}
+		for _, region := range backupRegions {
+			s, err := store.NewSSMStoreInRegion(numRetries, minThrottleDelay, region)
+			if err != nil {
+				return fmt.Errorf("Failed to get secret store for %s: %w", region, err)
+			}
+			stores[region] = withManifests(readableStore(s))
+		}
+	}
+
+	archive, err := buildBackup(stores, prefix, backupHistory)
+	if err != nil {
+		return err
+	}
+	data, err := encodeBackup(archive, backupGzip)
+	if err != nil {
+		return err
+	}
+	if encryptKeyID != "" {
+		svc, err := newBundleKMS()
+		if err != nil {
+			return fmt.Errorf("Failed to create KMS client: %w", err)
+		}
+		bundle, err := sealBundle(svc, encryptKeyID, backupBundleFormat, data)
+		if err != nil {
+			return err
+		}
+		if data, err = json.Marshal(bundle); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	}
+
+	var out io.Writer = os.Stdout
+	if backupOutputFile != "" {
+		f, err := os.OpenFile(backupOutputFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("Failed to open output file for writing: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// encodeBackup encodes an archive as JSON, compressed with gzip if asked
+func encodeBackup(archive backupArchive, compress bool) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(archive); err != nil {
+		return nil, err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// buildBackup snapshots prefix from every store concurrently. stores is keyed
+// by region; regions appear in the archive sorted by name.
+func buildBackup(stores map[string]store.Store, prefix string, history bool) (backupArchive, error) {
+	regions := make([]string, 0, len(stores))
+	for region := range stores {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	sections := make([]backupRegion, len(regions))
+	errs := make([]error, len(regions))
+	var wg sync.WaitGroup
+	for i, region := range regions {
+		wg.Add(1)
+		go func(i int, region string) {
+			defer wg.Done()
+			services, err := snapshotServices(stores[region], prefix)
+			sections[i] = backupRegion{Region: region, Services: services}
+			if err == nil && history {
+				sections[i].Metadata, err = snapshotMetadata(stores[region], services)
+			}
+			errs[i] = err
+		}(i, region)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			if regions[i] == "" {
+				return backupArchive{}, fmt.Errorf("Failed to snapshot secrets: %w", err)
+			}
+			return backupArchive{}, fmt.Errorf("Failed to snapshot secrets in %s: %w", regions[i], err)
+		}
+	}
+
+	return backupArchive{
+		Version:        backupArchiveVersion,
+		ChamberVersion: chamberVersion,
+		Created:        time.Now().UTC(),
+		Prefix:         prefix,
+		Regions:        sections,
+	}, nil
+}
+
+// snapshotServices reads the latest value of every secret of every service
+// under prefix
+func snapshotServices(s store.Store, prefix string) (map[string]map[string]string, error) {
+	services, err := listUntrashedServices(s, prefix, false)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := map[string]map[string]string{}
+	for _, service := range services {
+		rawSecrets, err := s.ListRaw(service)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list store contents for %s: %w", service, err)
+		}
+		secrets := map[string]string{}
+		for _, rawSecret := range rawSecrets {
+			secrets[key(rawSecret.Key)] = rawSecret.Value
+		}
+		snapshot[service] = secrets
+	}
+	return snapshot, nil
+}
+
+// snapshotMetadata reads the metadata, tags and history of every secret of
+// services, as read by snapshotServices
+func snapshotMetadata(s store.Store, services map[string]map[string]string) (map[string]map[string]backupMetadata, error) {
+	capabilities := s.Capabilities()
+	snapshot := map[string]map[string]backupMetadata{}
+	for service := range services {
+		secrets, err := s.List(service, false)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list store contents for %s: %w", service, err)
+		}
+		metadata := map[string]backupMetadata{}
+		for _, secret := range secrets {
+			id := store.SecretId{Service: service, Key: key(secret.Meta.Key)}
+			m := backupMetadata{
+				Version:   secret.Meta.Version,
+				Created:   secret.Meta.Created,
+				CreatedBy: secret.Meta.CreatedBy,
+			}
+			if capabilities.Tags {
+				if m.Tags, err = s.ReadTags(id); err != nil {
+					return nil, fmt.Errorf("Failed to read tags of %s/%s: %w", service, id.Key, err)
+				}
+			}
+			if capabilities.History {
+				if m.History, err = snapshotHistory(s, id); err != nil {
+					return nil, err
+				}
+			}
+			metadata[id.Key] = m
+		}
+		snapshot[service] = metadata
+	}
+	return snapshot, nil
+}
+
+// snapshotHistory reads every version kept of id, oldest first
+func snapshotHistory(s store.Store, id store.SecretId) ([]backupVersion, error) {
+	events, err := s.History(id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read history of %s/%s: %w", id.Service, id.Key, err)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Version < events[j].Version
+	})
+	versions := make([]backupVersion, 0, len(events))
+	for _, event := range events {
+		secret, err := s.Read(id, event.Version)
+		if errors.Is(err, store.ErrSecretNotFound) {
+			// no longer kept
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read version %d of %s/%s: %w", event.Version, id.Service, id.Key, err)
+		}
+		versions = append(versions, backupVersion{
+			Version:   event.Version,
+			Value:     *secret.Value,
+			Created:   event.Time,
+			CreatedBy: event.User,
+		})
+	}
+	return versions, nil
+}
+
+// readBackup decodes an archive written by chamber backup, decrypting and
+// decompressing it as needed
+func readBackup(data []byte) (backupArchive, error) {
+	var archive backupArchive
+	if bundle, err := readBundle(data); err == nil {
+		if bundle.Format != backupBundleFormat {
+			return archive, fmt.Errorf("Failed to restore bundle: it holds a %s export rather than a backup; use chamber import --decrypt", bundle.Format)
+		}
+		svc, err := newBundleKMS()
+		if err != nil {
+			return archive, fmt.Errorf("Failed to create KMS client: %w", err)
+		}
+		if data, err = openBundle(svc, bundle); err != nil {
+			return archive, err
+		}
+	}
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return archive, fmt.Errorf("Failed to decompress backup: %w", err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return archive, fmt.Errorf("Failed to decompress backup: %w", err)
+		}
+	}
+	if err := json.Unmarshal(data, &archive); err != nil || archive.Version == 0 {
+		return archive, errors.New("input is not an archive written by chamber backup")
+	}
+	if archive.Version > backupArchiveVersion {
+		return archive, fmt.Errorf("unsupported backup version %d; upgrade chamber to restore it", archive.Version)
+	}
+	return archive, nil
+}
+
+// restoredSecret is a secret restore --from writes: its latest value, or
+// every version kept in the archive, oldest first
+type restoredSecret struct {
+	id     store.SecretId
+	values []string
+	tags   map[string]string
+}
+
+// selectBackupRegion returns the section of archive for region, which may
+// only be left empty if the archive has a single section
+func selectBackupRegion(archive backupArchive, region string) (backupRegion, error) {
+	var regions []string
+	for _, section := range archive.Regions {
+		if section.Region == region || (region == "" && len(archive.Regions) == 1) {
+			return section, nil
+		}
+		regions = append(regions, section.Region)
+	}
+	if region == "" {
+		return backupRegion{}, fmt.Errorf("The backup has sections for several regions; pick one with --region: %s", strings.Join(regions, ", "))
+	}
+	return backupRegion{}, fmt.Errorf("The backup has no section for %s", region)
+}
+
+// planRestore returns the secrets of section to restore: those of services
+// matching one of services and keys matching one of keys, or all of them if
+// either is empty. Older versions are only restored with history.
+func planRestore(section backupRegion, serviceGlobs, keyGlobs []string, history bool) []restoredSecret {
+	matches := func(globs []string, name string) bool {
+		for _, glob := range globs {
+			// errors were caught by validating the globs
+			if ok, _ := slashpath.Match(glob, name); ok {
+				return true
+			}
+		}
+		return len(globs) == 0
+	}
+
+	services := make([]string, 0, len(section.Services))
+	for service := range section.Services {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var planned []restoredSecret
+	for _, service := range services {
+		if !matches(serviceGlobs, service) {
+			continue
+		}
+		secrets := section.Services[service]
+		for _, k := range sortedKeys(secrets) {
+			if !matches(keyGlobs, k) {
+				continue
+			}
+			restored := restoredSecret{id: store.SecretId{Service: service, Key: k}, values: []string{secrets[k]}}
+			if m, ok := section.Metadata[service][k]; ok {
+				restored.tags = m.Tags
+				if history && len(m.History) > 0 {
+					restored.values = restored.values[:0]
+					for _, v := range m.History {
+						restored.values = append(restored.values, v.Value)
+					}
+				}
+			}
+			planned = append(planned, restored)
+		}
+	}
+	return planned
+}
+
+// resolveRestore drops the planned secrets whose value is already in the
+// store, and resolves those with a different value with policy, as import
+// --on-conflict does. Every service is resolved before anything is written,
+// so that aborting leaves the store untouched. Secrets restored over an
+// existing one only get their latest value.
+func resolveRestore(s store.Store, planned []restoredSecret, policy string, in io.Reader, out io.Writer) ([]restoredSecret, error) {
+	byService := map[string][]restoredSecret{}
+	var services []string
+	for _, restored := range planned {
+		if _, ok := byService[restored.id.Service]; !ok {
+			services = append(services, restored.id.Service)
+		}
+		byService[restored.id.Service] = append(byService[restored.id.Service], restored)
+	}
+
+	var resolved []restoredSecret
+	for _, service := range services {
+		existing, err := s.ListRaw(service)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list store contents for %s: %w", service, err)
+		}
+		current := map[string]string{}
+		for _, rawSecret := range existing {
+			current[key(rawSecret.Key)] = rawSecret.Value
+		}
+		incoming := map[string]string{}
+		for _, restored := range byService[service] {
+			latest := restored.values[len(restored.values)-1]
+			if v, ok := current[restored.id.Key]; !ok || v != latest {
+				incoming[restored.id.Key] = latest
+			}
+		}
+		kept, err := resolveImportConflicts(existing, incoming, policy, in, out)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to restore %s: %w", service, err)
+		}
+		for _, restored := range byService[service] {
+			if _, ok := kept[restored.id.Key]; !ok {
+				continue
+			}
+			if _, ok := current[restored.id.Key]; ok {
+				restored.values = restored.values[len(restored.values)-1:]
+			}
+			resolved = append(resolved, restored)
+		}
+	}
+	return resolved, nil
+}
+
+// writeRestored writes the resolved secrets, and their tags on backends
+// supporting them, one at a time on backends that would lose concurrent writes
+func writeRestored(s store.Store, resolved []restoredSecret, concurrency int) error {
+	withTags := s.Capabilities().Tags
+	names := make([]string, len(resolved))
+	for i, restored := range resolved {
+		names[i] = restored.id.Service + "/" + restored.id.Key
+	}
+	errs := runPool(writeConcurrency(s, concurrency), len(resolved), func(i int) error {
+		restored := resolved[i]
+		for _, value := range restored.values {
+			if err := s.Write(restored.id, value); err != nil {
+				return err
+			}
+		}
+		if withTags && len(restored.tags) > 0 {
+			return s.WriteTags(restored.id, restored.tags)
+		}
+		return nil
+	})
+	return poolError("restore", names, errs)
+}
+
+// restoreBackup restores the secrets of services, or of every service, from
+// the archive given with restore --from
+func restoreBackup(services []string) error {
+	for i, service := range services {
+		services[i] = utils.NormalizeService(service)
+		if err := validateServiceGlob(services[i]); err != nil {
+			return fmt.Errorf("Failed to validate service: %w", err)
+		}
+	}
+	for _, glob := range restoreKeys {
+		if _, err := slashpath.Match(glob, ""); err != nil {
+			return fmt.Errorf("Invalid --keys glob %s: %w", glob, err)
+		}
+	}
+	policy := restoreOnConflict
+	if restoreOverwrite {
+		policy = ConflictReplace
+	}
+	if policy == "skip" {
+		policy = ConflictKeep
+	}
+	switch policy {
+	case ConflictReplace, ConflictKeep, ConflictAbort, ConflictPrompt:
+	default:
+		return fmt.Errorf("Unsupported conflict policy: %s", policy)
+	}
+	if policy == ConflictPrompt && (restoreFrom == "-" || restoreDryRun) {
+		return errors.New("--on-conflict prompt cannot be used when restoring from standard input or with --dry-run")
+	}
+
+	var data []byte
+	var err error
+	if restoreFrom == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(restoreFrom)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read backup: %w", err)
+	}
+	archive, err := readBackup(data)
+	if err != nil {
+		return err
+	}
+	section, err := selectBackupRegion(archive, restoreRegion)
+	if err != nil {
+		return err
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "restore").
+				Set("chamber-version", chamberVersion).
+				Set("services", services).
+				Set("from-backup", true).
+				Set("history", restoreHistory).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	secretStore = withManifests(secretStore)
+	planned := planRestore(section, services, restoreKeys, restoreHistory)
+	resolved, err := resolveRestore(secretStore, planned, policy, bufio.NewReader(os.Stdin), os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	if restoreDryRun {
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+		fmt.Fprintln(w, "Service\tKey\tVersions")
+		for _, restored := range resolved {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", restored.id.Service, restored.id.Key, len(restored.values))
+		}
+		w.Flush()
+		fmt.Fprintf(os.Stderr, "Would restore %d of the %d secrets selected in the backup\n", len(resolved), len(planned))
+		return nil
+	}
+	if err := writeRestored(secretStore, resolved, restoreConcurrency); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Restored %d of the %d secrets selected in the backup\n", len(resolved), len(planned))
+	return nil
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildBackup(t *testing.T) {
+	east := newFakeStore(map[string]map[string]string{
+		"app":    {"db_password": "hunter22"},
+		"worker": {"api_key": "abc"},
+		"other":  {"token": "xyz"},
+	})
+	west := newFakeStore(map[string]map[string]string{
+		"app": {"db_password": "hunter2"},
+	})
+
+	archive, err := buildBackup(map[string]store.Store{"us-west-2": west, "us-east-1": east}, "", false)
+	assert.NoError(t, err)
+	assert.Equal(t, backupArchiveVersion, archive.Version)
+	assert.Equal(t, []backupRegion{
+		{
+			Region: "us-east-1",
+			Services: map[string]map[string]string{
+				"app":    {"db_password": "hunter22"},
+				"other":  {"token": "xyz"},
+				"worker": {"api_key": "abc"},
+			},
+		},
+		{
+			Region: "us-west-2",
+			Services: map[string]map[string]string{
+				"app": {"db_password": "hunter2"},
+			},
+		},
+	}, archive.Regions)
+
+	archive, err = buildBackup(map[string]store.Store{"": east}, "w", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []backupRegion{
+		{Services: map[string]map[string]string{"worker": {"api_key": "abc"}}},
+	}, archive.Regions)
+}
+
+func TestBackupHistoryRoundTrip(t *testing.T) {
+	s := store.NewMemoryStore()
+	dbPassword := store.SecretId{Service: "app", Key: "db_password"}
+	require.NoError(t, s.Write(dbPassword, "v1"))
+	require.NoError(t, s.Write(dbPassword, "v2"))
+	require.NoError(t, s.WriteTags(dbPassword, map[string]string{"owner": "team"}))
+	require.NoError(t, s.Write(store.SecretId{Service: "app", Key: "api_key"}, "abc"))
+	require.NoError(t, s.Write(store.SecretId{Service: "worker", Key: "token"}, "xyz"))
+
+	archive, err := buildBackup(map[string]store.Store{"": s}, "", true)
+	require.NoError(t, err)
+	m := archive.Regions[0].Metadata["app"]["db_password"]
+	assert.Equal(t, 2, m.Version)
+	assert.Equal(t, map[string]string{"owner": "team"}, m.Tags)
+	require.Len(t, m.History, 2)
+	assert.Equal(t, "v1", m.History[0].Value)
+
+	for _, compress := range []bool{false, true} {
+		data, err := encodeBackup(archive, compress)
+		require.NoError(t, err)
+		assert.Equal(t, compress, !bytes.HasPrefix(data, []byte("{")))
+		read, err := readBackup(data)
+		require.NoError(t, err)
+		assert.Equal(t, archive.Regions[0].Services, read.Regions[0].Services)
+	}
+
+	section, err := selectBackupRegion(archive, "")
+	require.NoError(t, err)
+	planned := planRestore(section, []string{"app"}, nil, true)
+	require.Len(t, planned, 2)
+
+	restored := store.NewMemoryStore()
+	resolved, err := resolveRestore(restored, planned, ConflictAbort, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, writeRestored(restored, resolved, 2))
+	events, err := restored.History(dbPassword)
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+	tags, err := restored.ReadTags(dbPassword)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"owner": "team"}, tags)
+	_, err = restored.Read(store.SecretId{Service: "worker", Key: "token"}, -1)
+	assert.ErrorIs(t, err, store.ErrSecretNotFound)
+}
+
+func TestResolveRestore(t *testing.T) {
+	section := backupRegion{Services: map[string]map[string]string{
+		"app": {"db_password": "hunter2", "api_key": "abc", "token": "xyz"},
+	}}
+	s := store.NewMemoryStore()
+	require.NoError(t, s.Write(store.SecretId{Service: "app", Key: "api_key"}, "abc"))
+	require.NoError(t, s.Write(store.SecretId{Service: "app", Key: "db_password"}, "changed"))
+
+	planned := planRestore(section, nil, []string{"db_*", "api_*", "token"}, false)
+	require.Len(t, planned, 3)
+
+	_, err := resolveRestore(s, planned, ConflictAbort, nil, nil)
+	assert.Error(t, err)
+
+	resolved, err := resolveRestore(s, planned, ConflictKeep, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, resolved, 1)
+	assert.Equal(t, "token", resolved[0].id.Key)
+
+	resolved, err = resolveRestore(s, planned, ConflictReplace, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, resolved, 2)
+
+	assert.Len(t, planRestore(section, []string{"other"}, nil, false), 0)
+	assert.Len(t, planRestore(section, nil, []string{"db_*"}, false), 1)
+}
+
+func TestReadBackup(t *testing.T) {
+	svc := &fakeKMS{keys: map[string][]byte{}}
+	newKMS := newBundleKMS
+	newBundleKMS = func() (bundleKMS, error) { return svc, nil }
+	defer func() { newBundleKMS = newKMS }()
+
+	archive := backupArchive{Version: backupArchiveVersion, Regions: []backupRegion{
+		{Region: "us-east-1", Services: map[string]map[string]string{"app": {"db_password": "hunter2"}}},
+		{Region: "us-west-2", Services: map[string]map[string]string{}},
+	}}
+	data, err := encodeBackup(archive, true)
+	require.NoError(t, err)
+	bundle, err := sealBundle(svc, "alias/backup", backupBundleFormat, data)
+	require.NoError(t, err)
+	sealed, err := json.Marshal(bundle)
+	require.NoError(t, err)
+
+	read, err := readBackup(sealed)
+	require.NoError(t, err)
+	_, err = selectBackupRegion(read, "")
+	assert.Error(t, err)
+	section, err := selectBackupRegion(read, "us-east-1")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", section.Services["app"]["db_password"])
+
+	export, err := sealBundle(svc, "alias/backup", "json", []byte(`{"db_password":"hunter2"}`))
+	require.NoError(t, err)
+	sealed, err = json.Marshal(export)
+	require.NoError(t, err)
+	_, err = readBackup(sealed)
+	assert.Error(t, err)
+	_, err = readBackup([]byte(`{"db_password":"hunter2"}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,515 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// browseMask stands in for values until they are revealed, the same length
+// whatever the value so as not to give its length away
+const browseMask = "********"
+
+var (
+	// browseCmd represents the browse command
+	browseCmd = &cobra.Command{
+		Use:   "browse [service]",
+		Short: "Browse, edit and delete secrets in a terminal UI",
+		Long: `Browse, edit and delete secrets in a terminal UI.
+
+Services are listed first, or the keys of the service given. Values are
+masked until revealed, and deleting asks for confirmation.
+
+	up/down, j/k    move
+	enter           open the service or secret
+	esc, left       go back
+	r               reveal or hide the value
+	e               edit the value, typed masked
+	d               delete the secret
+	h               show the history of the secret
+	q, ctrl-c       quit`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runBrowse,
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(browseCmd)
+}
+
+// browseView is a screen of the browser
+type browseView int
+
+const (
+	browseServices browseView = iota
+	browseKeys
+	browseSecret
+	browseHistory
+)
+
+// browseMode is what typed keys do
+type browseMode int
+
+const (
+	browseNavigate browseMode = iota
+	browseEditing
+	browseConfirmDelete
+)
+
+// browser is the state of the terminal UI. It's driven one key at a time by
+// handle, and drawn by render, so that it can be tested without a terminal.
+type browser struct {
+	store store.Store
+
+	view     browseView
+	mode     browseMode
+	services []string
+	service  string
+	secrets  []store.Secret
+	history  []store.ChangeEvent
+	// cursors is the selected line of each view
+	cursors  [browseHistory + 1]int
+	revealed bool
+	input    []rune
+	status   string
+	quit     bool
+}
+
+func newBrowser(s store.Store) (*browser, error) {
+	b := &browser{
+		store: s,
+	}
+	return b, b.loadServices()
+}
+
+func runBrowse(cmd *cobra.Command, args []string) error {
+	service := ""
+	if len(args) == 1 {
+		service = utils.NormalizeService(args[0])
+		if err := validateService(service); err != nil {
+			return fmt.Errorf("Failed to validate service: %w", err)
+		}
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "browse").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	b, err := newBrowser(secretStore)
+	if err != nil {
+		return err
+	}
+	if service != "" {
+		if err := b.openService(service); err != nil {
+			return err
+		}
+	}
+
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return fmt.Errorf("browse needs a terminal: %w", err)
+	}
+	defer restore()
+	// draw on the alternate screen, with the cursor hidden, so that the
+	// terminal is left as it was
+	fmt.Fprint(os.Stdout, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(os.Stdout, "\x1b[?25h\x1b[?1049l")
+
+	in := bufio.NewReader(os.Stdin)
+	for !b.quit {
+		var screen strings.Builder
+		b.render(&screen, terminalHeight(int(os.Stdout.Fd())))
+		// the terminal doesn't return the carriage in raw mode
+		fmt.Fprint(os.Stdout, "\x1b[H\x1b[2J"+strings.ReplaceAll(screen.String(), "\n", "\r\n"))
+
+		k, err := readBrowseKey(in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		b.handle(k)
+	}
+	return nil
+}
+
+// readBrowseKey reads a key typed in raw mode, naming those that aren't
+// characters
+func readBrowseKey(in *bufio.Reader) (string, error) {
+	r, _, err := in.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch r {
+	case '\r', '\n':
+		return "enter", nil
+	case 0x7f, 0x08:
+		return "backspace", nil
+	case 0x03:
+		return "ctrl-c", nil
+	case 0x1b:
+		// the rest of an escape sequence is sent along with it; a lone
+		// escape is the key itself
+		if in.Buffered() < 2 {
+			return "esc", nil
+		}
+		if next, _ := in.Peek(1); next[0] != '[' && next[0] != 'O' {
+			return "esc", nil
+		}
+		seq := make([]byte, 2)
+		if _, err := io.ReadFull(in, seq); err != nil {
+			return "", err
+		}
+		switch seq[1] {
+		case 'A':
+			return "up", nil
+		case 'B':
+			return "down", nil
+		case 'C':
+			return "right", nil
+		case 'D':
+			return "left", nil
+		}
+		return "", nil
+	}
+	return string(r), nil
+}
+
+// handle acts on a key typed
+func (b *browser) handle(k string) {
+	if k == "ctrl-c" {
+		b.quit = true
+		return
+	}
+	switch b.mode {
+	case browseEditing:
+		b.handleEditing(k)
+		return
+	case browseConfirmDelete:
+		b.mode = browseNavigate
+		if k == "y" || k == "Y" {
+			b.deleteSecret()
+		} else {
+			b.status = "not deleted"
+		}
+		return
+	}
+
+	b.status = ""
+	switch k {
+	case "q":
+		b.quit = true
+	case "up", "k":
+		b.move(-1)
+	case "down", "j":
+		b.move(1)
+	case "enter", "right":
+		b.open()
+	case "esc", "left", "backspace":
+		b.back()
+	case "r":
+		if b.view == browseSecret {
+			b.revealed = !b.revealed
+		}
+	case "e":
+		if b.selected() != nil && (b.view == browseKeys || b.view == browseSecret) {
+			b.mode = browseEditing
+			b.input = nil
+		}
+	case "d":
+		if b.selected() != nil && (b.view == browseKeys || b.view == browseSecret) {
+			b.mode = browseConfirmDelete
+		}
+	case "h":
+		if b.view == browseKeys || b.view == browseSecret {
+			b.openHistory()
+		}
+	}
+}
+
+func (b *browser) handleEditing(k string) {
+	switch k {
+	case "enter":
+		b.mode = browseNavigate
+		b.writeSecret(string(b.input))
+		b.input = nil
+	case "esc":
+		b.mode = browseNavigate
+		b.input = nil
+		b.status = "not changed"
+	case "backspace":
+		if len(b.input) > 0 {
+			b.input = b.input[:len(b.input)-1]
+		}
+	default:
+		if r, size := utf8.DecodeRuneInString(k); size == len(k) && unicode.IsPrint(r) {
+			b.input = append(b.input, r)
+		}
+	}
+}
+
+// lines is how many lines the current view lists
+func (b *browser) lines() int {
+	switch b.view {
+	case browseServices:
+		return len(b.services)
+	case browseKeys:
+		return len(b.secrets)
+	case browseHistory:
+		return len(b.history)
+	}
+	return 0
+}
+
+func (b *browser) move(by int) {
+	c := b.cursors[b.view] + by
+	if c >= b.lines() {
+		c = b.lines() - 1
+	}
+	if c < 0 {
+		c = 0
+	}
+	b.cursors[b.view] = c
+}
+
+// selected returns the secret selected in the list of keys
+func (b *browser) selected() *store.Secret {
+	c := b.cursors[browseKeys]
+	if c >= len(b.secrets) {
+		return nil
+	}
+	return &b.secrets[c]
+}
+
+func (b *browser) selectedId() store.SecretId {
+	return store.SecretId{Service: b.service, Key: key(b.selected().Meta.Key)}
+}
+
+func (b *browser) open() {
+	switch b.view {
+	case browseServices:
+		if len(b.services) > 0 {
+			if err := b.openService(b.services[b.cursors[browseServices]]); err != nil {
+				b.status = err.Error()
+			}
+		}
+	case browseKeys:
+		if b.selected() != nil {
+			b.view = browseSecret
+			b.revealed = false
+		}
+	}
+}
+
+func (b *browser) back() {
+	switch b.view {
+	case browseKeys:
+		b.view = browseServices
+		if err := b.loadServices(); err != nil {
+			b.status = err.Error()
+		}
+	case browseSecret:
+		b.view = browseKeys
+		b.revealed = false
+	case browseHistory:
+		b.view = browseSecret
+	}
+}
+
+func (b *browser) loadServices() error {
+	services, err := listUntrashedServices(b.store, "", false)
+	if err != nil {
+		return fmt.Errorf("Failed to list services: %w", err)
+	}
+	sort.Strings(services)
+	b.services = services
+	b.move(0)
+	return nil
+}
+
+// openService lists the secrets of service
+func (b *browser) openService(service string) error {
+	secrets, err := b.store.List(service, true)
+	if err != nil {
+		return fmt.Errorf("Failed to list store contents for %s: %w", service, err)
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Meta.Key < secrets[j].Meta.Key })
+	if service != b.service {
+		b.cursors[browseKeys] = 0
+	}
+	b.service, b.secrets, b.view = service, secrets, browseKeys
+	b.move(0)
+	return nil
+}
+
+func (b *browser) openHistory() {
+	if b.selected() == nil {
+		return
+	}
+	if !b.store.Capabilities().History {
+		b.status = fmt.Sprintf("the %s backend keeps no history", strings.ToLower(backend))
+		return
+	}
+	history, err := b.store.History(b.selectedId())
+	if err != nil {
+		b.status = fmt.Sprintf("Failed to read history: %s", err)
+		return
+	}
+	b.history, b.view, b.cursors[browseHistory] = history, browseHistory, 0
+}
+
+func (b *browser) writeSecret(value string) {
+	id := b.selectedId()
+	secretStore, err := withKMSKey(b.store, id.Service, "")
+	if err == nil {
+		err = secretStore.Write(id, value)
+	}
+	if err != nil {
+		b.status = fmt.Sprintf("Failed to write %s: %s", id.Key, err)
+		return
+	}
+	b.status = fmt.Sprintf("wrote %s", id.Key)
+	view := b.view
+	if err := b.openService(id.Service); err != nil {
+		b.status = err.Error()
+		return
+	}
+	b.view = view
+}
+
+func (b *browser) deleteSecret() {
+	id := b.selectedId()
+	if err := b.store.Delete(id); err != nil {
+		b.status = fmt.Sprintf("Failed to delete %s: %s", id.Key, err)
+		return
+	}
+	b.status = fmt.Sprintf("deleted %s", id.Key)
+	if err := b.openService(id.Service); err != nil {
+		b.status = err.Error()
+	}
+}
+
+// render draws the current view, fitting lists within height lines
+func (b *browser) render(w io.Writer, height int) {
+	title := "chamber browse"
+	switch b.view {
+	case browseKeys:
+		title += ": " + b.service
+	case browseSecret, browseHistory:
+		title += ": " + b.service + "/" + key(b.selected().Meta.Key)
+	}
+	fmt.Fprintf(w, "%s\n\n", title)
+
+	var lines []string
+	switch b.view {
+	case browseServices:
+		lines = append(lines, b.services...)
+		if len(lines) == 0 {
+			lines = append(lines, "no services")
+		}
+	case browseKeys:
+		for _, secret := range b.secrets {
+			lines = append(lines, fmt.Sprintf("%-30s v%-4d %s  %s", key(secret.Meta.Key), secret.Meta.Version,
+				secret.Meta.Created.Local().Format(ShortTimeFormat), secret.Meta.CreatedBy))
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "no secrets")
+		}
+	case browseSecret:
+		meta := b.selected().Meta
+		value := browseMask
+		if b.revealed {
+			value = sanitizeTerminal(aws.StringValue(b.selected().Value))
+		}
+		lines = append(lines,
+			fmt.Sprintf("version:   %d", meta.Version),
+			fmt.Sprintf("modified:  %s by %s", meta.Created.Local().Format(ShortTimeFormat), meta.CreatedBy),
+			"",
+		)
+		for i, line := range strings.Split(value, "\n") {
+			if i == 0 {
+				line = "value:     " + line
+			} else {
+				line = "           " + line
+			}
+			lines = append(lines, line)
+		}
+	case browseHistory:
+		for _, event := range b.history {
+			lines = append(lines, fmt.Sprintf("v%-4d %-8s %s  %s", event.Version, event.Type,
+				event.Time.Local().Format(ShortTimeFormat), event.User))
+		}
+	}
+
+	// the title, a blank line on each side of the list, and the footer
+	rows := height - 4
+	if rows < 1 {
+		rows = 1
+	}
+	selectable := b.view != browseSecret && b.lines() > 0
+	start := 0
+	if selectable && b.cursors[b.view] >= rows {
+		start = b.cursors[b.view] - rows + 1
+	}
+	for i := start; i < len(lines) && i < start+rows; i++ {
+		prefix := "  "
+		if selectable && i == b.cursors[b.view] {
+			prefix = "> "
+		}
+		fmt.Fprintf(w, "%s%s\n", prefix, lines[i])
+	}
+
+	fmt.Fprintln(w)
+	switch {
+	case b.mode == browseEditing:
+		fmt.Fprintf(w, "new value for %s: %s  (enter to write, esc to cancel)\n", key(b.selected().Meta.Key), strings.Repeat("*", len(b.input)))
+	case b.mode == browseConfirmDelete:
+		fmt.Fprintf(w, "delete %s/%s? (y/N)\n", b.service, key(b.selected().Meta.Key))
+	case b.status != "":
+		fmt.Fprintln(w, b.status)
+	default:
+		fmt.Fprintln(w, browseHelp[b.view])
+	}
+}
+
+var browseHelp = map[browseView]string{
+	browseServices: "up/down move  enter open  q quit",
+	browseKeys:     "up/down move  enter view  e edit  d delete  h history  esc back  q quit",
+	browseSecret:   "r reveal  e edit  d delete  h history  esc back  q quit",
+	browseHistory:  "up/down move  esc back  q quit",
+}
+
+// sanitizeTerminal replaces the control characters of s but newlines and
+// tabs, so that values can't send escape sequences to the terminal
+func sanitizeTerminal(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) {
+			return r
+		}
+		return '?'
+	}, s)
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBrowser(t *testing.T) (*browser, store.Store) {
+	s := store.NewMemoryStore()
+	require.NoError(t, s.Write(store.SecretId{Service: "app", Key: "api_key"}, "abc123"))
+	require.NoError(t, s.Write(store.SecretId{Service: "app", Key: "db_password"}, "hunter2"))
+	require.NoError(t, s.Write(store.SecretId{Service: "web", Key: "token"}, "xyz"))
+	b, err := newBrowser(s)
+	require.NoError(t, err)
+	return b, s
+}
+
+// browseScreen renders b as a 24 line terminal would show it
+func browseScreen(b *browser) string {
+	var screen strings.Builder
+	b.render(&screen, 24)
+	return screen.String()
+}
+
+func TestBrowseNavigate(t *testing.T) {
+	b, _ := newTestBrowser(t)
+	assert.Contains(t, browseScreen(b), "> app\n  web\n")
+
+	b.handle("down")
+	b.handle("down")
+	assert.Contains(t, browseScreen(b), "  app\n> web\n")
+	b.handle("up")
+	b.handle("enter")
+	assert.Equal(t, browseKeys, b.view)
+	screen := browseScreen(b)
+	assert.Contains(t, screen, "chamber browse: app\n")
+	assert.Contains(t, screen, "> api_key")
+	assert.NotContains(t, screen, "abc123")
+
+	b.handle("j")
+	b.handle("enter")
+	screen = browseScreen(b)
+	assert.Contains(t, screen, "chamber browse: app/db_password\n")
+	assert.Contains(t, screen, "value:     "+browseMask)
+	assert.NotContains(t, screen, "hunter2")
+
+	b.handle("r")
+	assert.Contains(t, browseScreen(b), "value:     hunter2")
+	b.handle("esc")
+	b.handle("enter")
+	assert.NotContains(t, browseScreen(b), "hunter2", "values are masked again once left")
+
+	b.handle("esc")
+	b.handle("esc")
+	assert.Equal(t, browseServices, b.view)
+	b.handle("q")
+	assert.True(t, b.quit)
+}
+
+func TestBrowseEdit(t *testing.T) {
+	b, s := newTestBrowser(t)
+	require.NoError(t, b.openService("app"))
+
+	b.handle("e")
+	for _, k := range []string{"n", "e", "w", "x", "backspace"} {
+		b.handle(k)
+	}
+	screen := browseScreen(b)
+	assert.Contains(t, screen, "new value for api_key: ***  (")
+	b.handle("enter")
+	assert.Equal(t, "wrote api_key", b.status)
+
+	secret, err := s.Read(store.SecretId{Service: "app", Key: "api_key"}, -1)
+	require.NoError(t, err)
+	assert.Equal(t, "new", *secret.Value)
+	assert.Equal(t, 2, b.selected().Meta.Version)
+
+	b.handle("e")
+	b.handle("x")
+	b.handle("esc")
+	assert.Equal(t, "not changed", b.status)
+	secret, err = s.Read(store.SecretId{Service: "app", Key: "api_key"}, -1)
+	require.NoError(t, err)
+	assert.Equal(t, "new", *secret.Value)
+}
+
+func TestBrowseDelete(t *testing.T) {
+	b, s := newTestBrowser(t)
+	require.NoError(t, b.openService("app"))
+	b.handle("down")
+	b.handle("enter")
+
+	b.handle("d")
+	assert.Contains(t, browseScreen(b), "delete app/db_password? (y/N)")
+	b.handle("n")
+	assert.Equal(t, "not deleted", b.status)
+	_, err := s.Read(store.SecretId{Service: "app", Key: "db_password"}, -1)
+	assert.NoError(t, err)
+
+	b.handle("d")
+	b.handle("y")
+	assert.Equal(t, "deleted db_password", b.status)
+	assert.Equal(t, browseKeys, b.view)
+	assert.Len(t, b.secrets, 1)
+	_, err = s.Read(store.SecretId{Service: "app", Key: "db_password"}, -1)
+	assert.Error(t, err)
+}
+
+func TestBrowseHistory(t *testing.T) {
+	b, s := newTestBrowser(t)
+	require.NoError(t, s.Write(store.SecretId{Service: "app", Key: "api_key"}, "def456"))
+	require.NoError(t, b.openService("app"))
+
+	b.handle("h")
+	assert.Equal(t, browseHistory, b.view)
+	screen := browseScreen(b)
+	assert.Contains(t, screen, "v1    Created")
+	assert.Contains(t, screen, "v2    Updated")
+	assert.NotContains(t, screen, "def456")
+	b.handle("esc")
+	assert.Equal(t, browseSecret, b.view)
+}
+
+func TestBrowseScrolls(t *testing.T) {
+	s := store.NewMemoryStore()
+	for _, k := range []string{"a", "b", "c", "d", "e", "f"} {
+		require.NoError(t, s.Write(store.SecretId{Service: "app", Key: k}, k))
+	}
+	b, err := newBrowser(s)
+	require.NoError(t, err)
+	require.NoError(t, b.openService("app"))
+	for i := 0; i < 4; i++ {
+		b.handle("down")
+	}
+
+	var screen strings.Builder
+	b.render(&screen, 7)
+	assert.NotContains(t, screen.String(), "  b ")
+	assert.Contains(t, screen.String(), "  d ")
+	assert.Contains(t, screen.String(), "> e ")
+}
+
+func TestReadBrowseKey(t *testing.T) {
+	in := bufio.NewReader(strings.NewReader("j\x1b[A\x1b[B\r\x7f\x03é\x1b"))
+	var keys []string
+	for {
+		k, err := readBrowseKey(in)
+		if err != nil {
+			break
+		}
+		keys = append(keys, k)
+	}
+	assert.Equal(t, []string{"j", "up", "down", "enter", "backspace", "ctrl-c", "é", "esc"}, keys)
+}
+
+func TestSanitizeTerminal(t *testing.T) {
+	assert.Equal(t, "line\n?[31mred\tx", sanitizeTerminal("line\n\x1b[31mred\tx"))
+}
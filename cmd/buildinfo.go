@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// buildinfoCmd represents the buildinfo command
+var buildinfoCmd = &cobra.Command{
+	Use:   "buildinfo",
+	Short: "print details about how this binary was built",
+	Args:  cobra.NoArgs,
+	RunE:  buildinfoRun,
+}
+
+var buildinfoJSON bool
+
+// BuildInfo describes a chamber binary, for packagers that compile slimmed
+// builds with the nos3 and nosecretsmanager build tags.
+type BuildInfo struct {
+	Version   string            `json:"version"`
+	GoVersion string            `json:"go_version"`
+	Platform  string            `json:"platform"`
+	Backends  []string          `json:"backends"`
+	Settings  map[string]string `json:"settings"`
+}
+
+func init() {
+	buildinfoCmd.Flags().BoolVar(&buildinfoJSON, "json", false, "print build information as JSON")
+	RootCmd.AddCommand(buildinfoCmd)
+}
+
+// GetBuildInfo returns information about the running binary
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   chamberVersion,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Backends:  EnabledBackends(),
+		Settings:  map[string]string{},
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "-tags", "-trimpath", "CGO_ENABLED", "vcs.revision", "vcs.time", "vcs.modified":
+				info.Settings[setting.Key] = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+func buildinfoRun(cmd *cobra.Command, args []string) error {
+	info := GetBuildInfo()
+
+	if buildinfoJSON {
+		return json.NewEncoder(os.Stdout).Encode(info)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+	fmt.Fprintf(w, "Version\t%s\n", info.Version)
+	fmt.Fprintf(w, "Go\t%s\n", info.GoVersion)
+	fmt.Fprintf(w, "Platform\t%s\n", info.Platform)
+	fmt.Fprintf(w, "Backends\t%s\n", strings.ToLower(strings.Join(info.Backends, ", ")))
+	for _, k := range sortedKeys(info.Settings) {
+		fmt.Fprintf(w, "%s\t%s\n", k, info.Settings[k])
+	}
+	w.Flush()
+	return nil
+}
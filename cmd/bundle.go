@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/segmentio/chamber/v2/store"
+)
+
+// bundleVersion is the version of the encrypted bundle format
+const bundleVersion = 1
+
+// bundleEncryptionContext binds the data keys of bundles to their use, so
+// that KMS refuses to decrypt them for anything else
+var bundleEncryptionContext = map[string]*string{"chamber": aws.String("bundle")}
+
+// encryptedBundle is an export encrypted with --encrypt. The export is
+// encrypted with AES-256-GCM under a data key generated by KMS, which is
+// kept encrypted alongside it.
+type encryptedBundle struct {
+	ChamberBundle int    `json:"chamber_bundle"`
+	Scheme        string `json:"scheme"`
+	KeyID         string `json:"key_id"`
+	// Format is the export format of the plaintext
+	Format       string `json:"format"`
+	EncryptedKey []byte `json:"encrypted_key"`
+	Nonce        []byte `json:"nonce"`
+	Ciphertext   []byte `json:"ciphertext"`
+}
+
+// bundleKMS is the part of the KMS API bundles use
+type bundleKMS interface {
+	GenerateDataKey(*kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(*kms.DecryptInput) (*kms.DecryptOutput, error)
+}
+
+// newBundleKMS returns the KMS client bundles are encrypted with
+var newBundleKMS = func() (bundleKMS, error) {
+	session, region, err := store.NewSession(numRetries)
+	if err != nil {
+		return nil, err
+	}
+	return kms.New(session, &aws.Config{Region: region}), nil
+}
+
+// parseBundleRecipient splits the value of --encrypt into its scheme and key
+func parseBundleRecipient(spec string) (string, string, error) {
+	scheme, recipient, ok := strings.Cut(spec, ":")
+	if !ok || recipient == "" {
+		return "", "", fmt.Errorf("invalid recipient %q: must be kms:<key-id>", spec)
+	}
+	switch scheme {
+	case "kms":
+		return scheme, recipient, nil
+	case "age":
+		return "", "", errors.New("age recipients are not supported, since chamber doesn't include an age implementation; use kms:<key-id>")
+	default:
+		return "", "", fmt.Errorf("unsupported encryption scheme %q: must be kms", scheme)
+	}
+}
+
+// sealBundle encrypts plaintext, an export in format, for the KMS key keyID
+func sealBundle(svc bundleKMS, keyID, format string, plaintext []byte) (*encryptedBundle, error) {
+	dataKey, err := svc.GenerateDataKey(&kms.GenerateDataKeyInput{
+		KeyId:             aws.String(keyID),
+		KeySpec:           aws.String(kms.DataKeySpecAes256),
+		EncryptionContext: bundleEncryptionContext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate data key: %w", err)
+	}
+	gcm, err := newBundleCipher(dataKey.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	b := &encryptedBundle{
+		ChamberBundle: bundleVersion,
+		Scheme:        "kms",
+		KeyID:         keyID,
+		Format:        format,
+		EncryptedKey:  dataKey.CiphertextBlob,
+		Nonce:         nonce,
+	}
+	b.Ciphertext = gcm.Seal(nil, nonce, plaintext, b.additionalData())
+	return b, nil
+}
+
+// openBundle decrypts b, returning the export it holds
+func openBundle(svc bundleKMS, b *encryptedBundle) ([]byte, error) {
+	if b.ChamberBundle != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", b.ChamberBundle)
+	}
+	if b.Scheme != "kms" {
+		return nil, fmt.Errorf("unsupported encryption scheme %q", b.Scheme)
+	}
+	dataKey, err := svc.Decrypt(&kms.DecryptInput{
+		KeyId:             aws.String(b.KeyID),
+		CiphertextBlob:    b.EncryptedKey,
+		EncryptionContext: bundleEncryptionContext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decrypt data key: %w", err)
+	}
+	gcm, err := newBundleCipher(dataKey.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid bundle nonce")
+	}
+	plaintext, err := gcm.Open(nil, b.Nonce, b.Ciphertext, b.additionalData())
+	if err != nil {
+		return nil, errors.New("Failed to decrypt bundle: it was altered or encrypted with another key")
+	}
+	return plaintext, nil
+}
+
+// readBundle parses an encrypted bundle
+func readBundle(data []byte) (*encryptedBundle, error) {
+	var b encryptedBundle
+	if err := json.Unmarshal(data, &b); err != nil || b.ChamberBundle == 0 {
+		return nil, errors.New("input is not an encrypted bundle written by chamber export --encrypt")
+	}
+	return &b, nil
+}
+
+// additionalData authenticates the fields describing the ciphertext, so that
+// they can't be changed either
+func (b *encryptedBundle) additionalData() []byte {
+	return []byte(fmt.Sprintf("chamber-bundle/%d/%s/%s", b.ChamberBundle, b.Scheme, b.Format))
+}
+
+func newBundleCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
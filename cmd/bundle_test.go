@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKMS hands out data keys, "encrypting" them by remembering them
+type fakeKMS struct {
+	keys map[string][]byte
+}
+
+func (f *fakeKMS) GenerateDataKey(input *kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error) {
+	if aws.StringValue(input.EncryptionContext["chamber"]) != "bundle" {
+		return nil, errors.New("missing encryption context")
+	}
+	key := make([]byte, 32)
+	rand.Read(key)
+	blob := make([]byte, 16)
+	rand.Read(blob)
+	f.keys[aws.StringValue(input.KeyId)+string(blob)] = key
+	return &kms.GenerateDataKeyOutput{Plaintext: key, CiphertextBlob: blob}, nil
+}
+
+func (f *fakeKMS) Decrypt(input *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	key, ok := f.keys[aws.StringValue(input.KeyId)+string(input.CiphertextBlob)]
+	if !ok || aws.StringValue(input.EncryptionContext["chamber"]) != "bundle" {
+		return nil, errors.New("InvalidCiphertextException")
+	}
+	return &kms.DecryptOutput{Plaintext: key}, nil
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	svc := &fakeKMS{keys: map[string][]byte{}}
+	plaintext := []byte(`{"db_password":"secret"}`)
+
+	bundle, err := sealBundle(svc, "alias/chamber", "json", plaintext)
+	require.NoError(t, err)
+	assert.NotContains(t, string(bundle.Ciphertext), "secret")
+
+	data, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	read, err := readBundle(data)
+	require.NoError(t, err)
+	opened, err := openBundle(svc, read)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, opened)
+
+	t.Run("altered ciphertext", func(t *testing.T) {
+		altered := *read
+		altered.Ciphertext = append([]byte{}, read.Ciphertext...)
+		altered.Ciphertext[0] ^= 1
+		_, err := openBundle(svc, &altered)
+		assert.Error(t, err)
+	})
+	t.Run("altered format", func(t *testing.T) {
+		altered := *read
+		altered.Format = "yaml"
+		_, err := openBundle(svc, &altered)
+		assert.Error(t, err)
+	})
+	t.Run("another key", func(t *testing.T) {
+		altered := *read
+		altered.KeyID = "alias/other"
+		_, err := openBundle(svc, &altered)
+		assert.Error(t, err)
+	})
+}
+
+func TestReadBundle(t *testing.T) {
+	_, err := readBundle([]byte(`{"db_password":"secret"}`))
+	assert.Error(t, err)
+	_, err = readBundle([]byte("DB_PASSWORD=secret"))
+	assert.Error(t, err)
+}
+
+func TestParseBundleRecipient(t *testing.T) {
+	scheme, key, err := parseBundleRecipient("kms:arn:aws:kms:us-east-1:123456789012:key/abcd")
+	assert.NoError(t, err)
+	assert.Equal(t, "kms", scheme)
+	assert.Equal(t, "arn:aws:kms:us-east-1:123456789012:key/abcd", key)
+
+	for _, spec := range []string{"age:age1abc", "kms:", "alias/chamber", "gpg:me"} {
+		_, _, err := parseBundleRecipient(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// cleanCmd represents the clean command
+	cleanCmd = &cobra.Command{
+		Use:   "clean <service...>",
+		Short: "Prune old versions of secrets, and delete keys nobody reads",
+		Long: `Prune the versions of the secrets of services beyond the latest
+--keep-versions, and delete keys that weren't read for --unread-days.
+
+Parameter Store can't delete single versions: it deletes the oldest version of
+a parameter itself once there are 100, but refuses to write new versions when
+that oldest version is labeled. Pruning removes the labels of old versions, so
+that writes don't break and Parameter Store can delete them.
+
+Reads are found in the CloudTrail event history, as chamber audit does, so
+--unread-days can be at most 90 and needs the SSM or Secrets Manager backend.
+Keys written within --unread-days are kept, and so are all the keys of a
+service read as a whole, as exec and export do.
+
+What would be done is always listed first; --dry-run stops there, and deleting
+keys asks for confirmation unless --yes is given.`,
+		Example: `
+	$ chamber clean app --keep-versions 20 --dry-run
+	$ chamber clean app worker --unread-days 90`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runClean,
+	}
+	cleanKeepVersions int
+	cleanUnreadDays   int
+	cleanDryRun       bool
+	cleanYes          bool
+)
+
+func init() {
+	cleanCmd.Flags().IntVar(&cleanKeepVersions, "keep-versions", 0, "prune the versions of each secret beyond this many latest ones")
+	cleanCmd.Flags().IntVar(&cleanUnreadDays, "unread-days", 0, "delete keys that weren't read nor written for this many days, at most 90")
+	cleanCmd.Flags().BoolVar(&cleanDryRun, "dry-run", false, "list what would be pruned and deleted without changing anything")
+	cleanCmd.Flags().BoolVar(&cleanYes, "yes", false, "delete unread keys without asking for confirmation")
+	RootCmd.AddCommand(cleanCmd)
+}
+
+// cleanPlan is what clean does to a service
+type cleanPlan struct {
+	service string
+	prune   []prunedKey
+	// unread are the keys that weren't read nor written recently
+	unread []string
+}
+
+// prunedKey is a key with versions beyond those kept
+type prunedKey struct {
+	key      string
+	versions int
+}
+
+// planPrune returns the secrets of a service with more versions than keep,
+// and how many more
+func planPrune(s store.Store, service string, secrets []store.Secret, keep int) ([]prunedKey, error) {
+	var prune []prunedKey
+	for _, secret := range secrets {
+		k := key(secret.Meta.Key)
+		events, err := s.History(store.SecretId{Service: service, Key: k})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read history of %s/%s: %w", service, k, err)
+		}
+		if len(events) > keep {
+			prune = append(prune, prunedKey{key: k, versions: len(events) - keep})
+		}
+	}
+	return prune, nil
+}
+
+// findUnread returns the keys of secrets written before cutoff that aren't
+// among read. A read of the key * reads every key.
+func findUnread(secrets []store.Secret, read map[string]bool, cutoff time.Time) []string {
+	if read["*"] {
+		return nil
+	}
+	var unread []string
+	for _, secret := range secrets {
+		k := key(secret.Meta.Key)
+		if pruneProtected[k] || read[k] || !secret.Meta.Created.Before(cutoff) {
+			continue
+		}
+		unread = append(unread, k)
+	}
+	return unread
+}
+
+// readKeys returns the keys of service read since start, according to the
+// CloudTrail event history
+func readKeys(trail auditTrail, service string, start, end time.Time) (map[string]bool, error) {
+	target, err := newAuditTarget(backend, service, "")
+	if err != nil {
+		return nil, err
+	}
+	events, err := lookupAudit(trail, target, start, end, []string{auditRead})
+	if err != nil {
+		return nil, err
+	}
+	read := map[string]bool{}
+	for _, event := range events {
+		// even denied reads show that the key is still wanted
+		for _, k := range strings.Split(event.Key, ",") {
+			read[k] = true
+		}
+	}
+	return read, nil
+}
+
+// writeCleanPlans lists what clean does to each service
+func writeCleanPlans(out io.Writer, plans []cleanPlan, keep, unreadDays int) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', 0)
+	fmt.Fprintln(w, "Service\tKey\tAction")
+	for _, plan := range plans {
+		for _, p := range plan.prune {
+			fmt.Fprintf(w, "%s\t%s\tprune %d versions older than the latest %d\n", plan.service, p.key, p.versions, keep)
+		}
+		for _, k := range plan.unread {
+			fmt.Fprintf(w, "%s\t%s\tdelete: not read for %d days\n", plan.service, k, unreadDays)
+		}
+	}
+	return w.Flush()
+}
+
+func runClean(cmd *cobra.Command, args []string) error {
+	if cleanKeepVersions < 0 || cleanUnreadDays < 0 {
+		return errors.New("--keep-versions and --unread-days cannot be negative")
+	}
+	if cleanKeepVersions == 0 && cleanUnreadDays == 0 {
+		return errors.New("Nothing to clean: give --keep-versions, --unread-days or both")
+	}
+	if time.Duration(cleanUnreadDays)*24*time.Hour > auditMaxSince {
+		return errors.New("--unread-days can be at most 90, as far back as the CloudTrail event history goes")
+	}
+	services := make([]string, 0, len(args))
+	for _, arg := range args {
+		service := utils.NormalizeService(arg)
+		if err := validateService(service); err != nil {
+			return fmt.Errorf("Failed to validate service: %w", err)
+		}
+		services = append(services, service)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "clean").
+				Set("chamber-version", chamberVersion).
+				Set("services", services).
+				Set("keep-versions", cleanKeepVersions).
+				Set("unread-days", cleanUnreadDays).
+				Set("dry-run", cleanDryRun).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	pruner, canPrune := store.Unwrap(secretStore).(store.VersionPruner)
+	if cleanKeepVersions > 0 && !canPrune {
+		return fmt.Errorf("The %s backend does not support pruning versions", backend)
+	}
+	var trail auditTrail
+	if cleanUnreadDays > 0 {
+		if _, err := newAuditTarget(backend, "", ""); err != nil {
+			return err
+		}
+		if trail, err = newAuditTrail(); err != nil {
+			return fmt.Errorf("Failed to create CloudTrail client: %w", err)
+		}
+	}
+
+	now := time.Now()
+	cutoff := now.Add(-time.Duration(cleanUnreadDays) * 24 * time.Hour)
+	var plans []cleanPlan
+	var unread int
+	for _, service := range services {
+		secrets, err := secretStore.List(service, false)
+		if err != nil {
+			return fmt.Errorf("Failed to list store contents for %s: %w", service, err)
+		}
+		plan := cleanPlan{service: service}
+		if cleanKeepVersions > 0 {
+			if plan.prune, err = planPrune(secretStore, service, secrets, cleanKeepVersions); err != nil {
+				return err
+			}
+		}
+		if cleanUnreadDays > 0 {
+			read, err := readKeys(trail, service, cutoff, now)
+			if err != nil {
+				return err
+			}
+			plan.unread = findUnread(secrets, read, cutoff)
+			unread += len(plan.unread)
+		}
+		plans = append(plans, plan)
+	}
+
+	if err := writeCleanPlans(os.Stdout, plans, cleanKeepVersions, cleanUnreadDays); err != nil {
+		return err
+	}
+	if cleanDryRun {
+		return nil
+	}
+
+	for _, plan := range plans {
+		for _, p := range plan.prune {
+			if _, err := pruner.PruneVersions(store.SecretId{Service: plan.service, Key: p.key}, cleanKeepVersions); err != nil {
+				return fmt.Errorf("Failed to prune versions of %s/%s: %w", plan.service, p.key, err)
+			}
+		}
+	}
+	if unread == 0 {
+		return nil
+	}
+	if !cleanYes {
+		fmt.Fprintf(os.Stderr, "Delete the %d unread keys listed, including all versions? [y/N] ", unread)
+		ok, err := readConfirmation(os.Stdin)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("Deletion aborted")
+		}
+	}
+	for _, plan := range plans {
+		if err := store.DeleteBatch(secretStore, plan.service, plan.unread); err != nil {
+			return fmt.Errorf("Failed to delete unread keys of %s: %w", plan.service, err)
+		}
+	}
+	return nil
+}
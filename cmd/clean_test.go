@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanPrune(t *testing.T) {
+	s := store.NewMemoryStore()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, s.Write(store.SecretId{Service: "app", Key: "db_password"}, "v"))
+	}
+	require.NoError(t, s.Write(store.SecretId{Service: "app", Key: "api_key"}, "v"))
+	secrets, err := s.List("app", false)
+	require.NoError(t, err)
+
+	prune, err := planPrune(s, "app", secrets, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []prunedKey{{key: "db_password", versions: 2}}, prune)
+
+	var out bytes.Buffer
+	require.NoError(t, writeCleanPlans(&out, []cleanPlan{{service: "app", prune: prune, unread: []string{"api_key"}}}, 3, 90))
+	assert.Contains(t, out.String(), "db_password\tprune 2 versions older than the latest 3")
+	assert.Contains(t, out.String(), "api_key\t\tdelete: not read for 90 days")
+}
+
+func TestFindUnread(t *testing.T) {
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	cutoff := now.Add(-90 * 24 * time.Hour)
+	secret := func(k string, created time.Time) store.Secret {
+		return store.Secret{Meta: store.SecretMetadata{Key: "/app/" + k, Created: created}}
+	}
+	secrets := []store.Secret{
+		secret("read", cutoff.Add(-time.Hour)),
+		secret("unread", cutoff.Add(-time.Hour)),
+		secret("recent", cutoff.Add(time.Hour)),
+		secret(ManifestKey, cutoff.Add(-time.Hour)),
+	}
+	assert.Equal(t, []string{"unread"}, findUnread(secrets, map[string]bool{"read": true}, cutoff))
+	assert.Empty(t, findUnread(secrets, map[string]bool{"*": true}, cutoff))
+}
+
+func TestReadKeys(t *testing.T) {
+	t.Setenv("CHAMBER_PREFIX", "")
+	previous := backend
+	backend = SSMBackend
+	defer func() { backend = previous }()
+
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	trail := &fakeTrail{events: []*cloudtrail.Event{
+		trailEvent(t, now.Add(-time.Hour), "GetParameters", map[string]interface{}{"names": []string{"/app/a", "/app/b"}}),
+		trailEvent(t, now.Add(-time.Hour), "PutParameter", map[string]interface{}{"name": "/app/c"}),
+	}}
+	read, err := readKeys(trail, "app", now.Add(-24*time.Hour), now)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"a": true, "b": true}, read)
+
+	backend = S3Backend
+	_, err = readKeys(trail, "app", now.Add(-24*time.Hour), now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+const copyDestinationHelp = `The destination is a service, keeping the name of the key, or a service and
+a new name for the key. A destination with a slash is read as a service and
+key, so end nested services with a slash to keep the name of the key, like
+team/api/.`
+
+var (
+	// copyCmd represents the cp command
+	copyCmd = &cobra.Command{
+		Use:     "cp <src-service/key> <dst-service[/newkey]>",
+		Aliases: []string{"copy"},
+		Short:   "Copy a secret to another service or key",
+		Long: `Copy a secret to another service or key.
+
+` + copyDestinationHelp,
+		Example: `
+	$ chamber cp app-dev/db_password app-staging
+	$ chamber cp app-dev/db_password team/api/
+	$ chamber cp app-dev/db_password app-dev/old_db_password`,
+		Args: cobra.ExactArgs(2),
+		RunE: runCopy,
+	}
+
+	// moveCmd represents the mv command
+	moveCmd = &cobra.Command{
+		Use:     "mv <src-service/key> <dst-service[/newkey]>",
+		Aliases: []string{"move"},
+		Short:   "Move a secret to another service or key",
+		Long: `Move a secret to another service or key, deleting it from where it was once
+it is copied.
+
+` + copyDestinationHelp,
+		Example: `
+	$ chamber mv app/db_password app-prod --preserve-history`,
+		Args: cobra.ExactArgs(2),
+		RunE: runCopy,
+	}
+
+	copyOverwrite       bool
+	copyPreserveHistory bool
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{copyCmd, moveCmd} {
+		cmd.Flags().BoolVar(&copyOverwrite, "overwrite", false, "Replace the destination if it already exists")
+		cmd.Flags().BoolVar(&copyPreserveHistory, "preserve-history", false, "Copy every version kept of the secret, oldest first, rather than only the latest; needs a backend keeping history")
+		RootCmd.AddCommand(cmd)
+	}
+}
+
+func runCopy(cmd *cobra.Command, args []string) error {
+	move := cmd.Name() == "mv"
+	src, err := parseSecretPath(args[0])
+	if err != nil {
+		return fmt.Errorf("Invalid source: %w", err)
+	}
+	dst, err := parseCopyDestination(args[1], src.Key)
+	if err != nil {
+		return fmt.Errorf("Invalid destination: %w", err)
+	}
+	if src == dst {
+		return errors.New("The source and destination are the same secret")
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", cmd.Name()).
+				Set("chamber-version", chamberVersion).
+				Set("service", src.Service).
+				Set("key", src.Key).
+				Set("destination-service", dst.Service).
+				Set("preserve-history", copyPreserveHistory).
+				Set("backend", backend),
+		})
+	}
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	if copyPreserveHistory && !secretStore.Capabilities().History {
+		return fmt.Errorf("--preserve-history needs a backend keeping history, which %s doesn't", backend)
+	}
+	if err := copySecret(secretStore, src, dst, copyOverwrite, copyPreserveHistory); err != nil {
+		return err
+	}
+	if move {
+		if err := secretStore.Delete(src); err != nil {
+			return fmt.Errorf("Copied %s/%s to %s/%s, but failed to delete it: %w", src.Service, src.Key, dst.Service, dst.Key, err)
+		}
+	}
+	return nil
+}
+
+// parseSecretPath parses service/key, the service being everything before
+// the last slash
+func parseSecretPath(arg string) (store.SecretId, error) {
+	i := strings.LastIndex(arg, "/")
+	if i <= 0 || i == len(arg)-1 {
+		return store.SecretId{}, fmt.Errorf("%q must be a service and key, like app-dev/db_password", arg)
+	}
+	return normalizeSecretId(arg[:i], arg[i+1:])
+}
+
+// parseCopyDestination parses the destination of cp and mv, which is a
+// service, keeping key, when it has no slash or ends with one, and a service
+// and key otherwise
+func parseCopyDestination(arg, key string) (store.SecretId, error) {
+	if !strings.Contains(arg, "/") {
+		return normalizeSecretId(arg, key)
+	}
+	if strings.HasSuffix(arg, "/") {
+		return normalizeSecretId(strings.TrimSuffix(arg, "/"), key)
+	}
+	return parseSecretPath(arg)
+}
+
+func normalizeSecretId(service, key string) (store.SecretId, error) {
+	id := store.SecretId{Service: utils.NormalizeService(service), Key: utils.NormalizeKey(key)}
+	if err := validateService(id.Service); err != nil {
+		return id, fmt.Errorf("Failed to validate service: %w", err)
+	}
+	if err := validateKey(id.Key); err != nil {
+		return id, fmt.Errorf("Failed to validate key: %w", err)
+	}
+	return id, nil
+}
+
+// copySecret writes the latest value of src to dst, or with history every
+// version kept of it, oldest first. The versions are written anew, so they
+// record who copied them and when rather than who wrote them. Tags are copied
+// on backends supporting them.
+func copySecret(s store.Store, src, dst store.SecretId, overwrite, history bool) error {
+	latest, err := s.Read(src, -1)
+	if err != nil {
+		return fmt.Errorf("Failed to read %s/%s: %w", src.Service, src.Key, err)
+	}
+	if !overwrite {
+		_, err := s.Read(dst, -1)
+		if err == nil {
+			return fmt.Errorf("%s/%s already exists; pass --overwrite to replace it", dst.Service, dst.Key)
+		}
+		if !errors.Is(err, store.ErrSecretNotFound) {
+			return fmt.Errorf("Failed to read %s/%s: %w", dst.Service, dst.Key, err)
+		}
+	}
+
+	values := []string{*latest.Value}
+	if history {
+		kept, err := keptValues(s, src)
+		if err != nil {
+			return err
+		}
+		if len(kept) > 0 {
+			values = kept
+		}
+	}
+	for _, value := range values {
+		if err := s.Write(dst, value); err != nil {
+			return fmt.Errorf("Failed to write %s/%s: %w", dst.Service, dst.Key, err)
+		}
+	}
+
+	if s.Capabilities().Tags {
+		tags, err := s.ReadTags(src)
+		if err != nil {
+			return fmt.Errorf("Failed to read tags of %s/%s: %w", src.Service, src.Key, err)
+		}
+		if len(tags) > 0 {
+			if err := s.WriteTags(dst, tags); err != nil {
+				return fmt.Errorf("Failed to write tags of %s/%s: %w", dst.Service, dst.Key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// keptValues returns the value of every version kept of id, oldest first
+func keptValues(s store.Store, id store.SecretId) ([]string, error) {
+	events, err := s.History(id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read history of %s/%s: %w", id.Service, id.Key, err)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Version < events[j].Version
+	})
+	values := make([]string, 0, len(events))
+	for _, event := range events {
+		secret, err := s.Read(id, event.Version)
+		if errors.Is(err, store.ErrSecretNotFound) {
+			// no longer kept
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read version %d of %s/%s: %w", event.Version, id.Service, id.Key, err)
+		}
+		values = append(values, *secret.Value)
+	}
+	return values, nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCopyDestination(t *testing.T) {
+	src, err := parseSecretPath("team/api/DB_Password")
+	require.NoError(t, err)
+	assert.Equal(t, store.SecretId{Service: "team/api", Key: "db_password"}, src)
+
+	for arg, expected := range map[string]store.SecretId{
+		"app-staging":         {Service: "app-staging", Key: "db_password"},
+		"team/api/":           {Service: "team/api", Key: "db_password"},
+		"app-dev/old_db_pass": {Service: "app-dev", Key: "old_db_pass"},
+	} {
+		dst, err := parseCopyDestination(arg, src.Key)
+		assert.NoError(t, err, arg)
+		assert.Equal(t, expected, dst, arg)
+	}
+
+	for _, arg := range []string{"db_password", "/db_password", "app/", "app/bad key"} {
+		_, err := parseSecretPath(arg)
+		assert.Error(t, err, arg)
+	}
+}
+
+func TestCopySecret(t *testing.T) {
+	s := store.NewMemoryStore()
+	src := store.SecretId{Service: "app", Key: "db_password"}
+	dst := store.SecretId{Service: "app-prod", Key: "db_password"}
+	require.NoError(t, s.Write(src, "v1"))
+	require.NoError(t, s.Write(src, "v2"))
+	require.NoError(t, s.WriteTags(src, map[string]string{"owner": "payments"}))
+
+	require.NoError(t, copySecret(s, src, dst, false, true))
+	events, err := s.History(dst)
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+	first, err := s.Read(dst, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", *first.Value)
+	tags, err := s.ReadTags(dst)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"owner": "payments"}, tags)
+
+	assert.Error(t, copySecret(s, src, dst, false, false), "destination exists")
+	require.NoError(t, copySecret(s, src, dst, true, false))
+	latest, err := s.Read(dst, -1)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", *latest.Value)
+	assert.Equal(t, 3, latest.Meta.Version)
+
+	assert.Error(t, copySecret(s, store.SecretId{Service: "app", Key: "missing"}, dst, true, false))
+}
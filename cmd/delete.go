@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	analytics "github.com/segmentio/analytics-go/v3"
 	"github.com/segmentio/chamber/v2/store"
@@ -13,14 +17,41 @@ import (
 var deleteCmd = &cobra.Command{
 	Use:   "delete <service> <key>",
 	Short: "Delete a secret, including all versions",
-	Args:  cobra.ExactArgs(2),
-	RunE:  delete,
+	Long: `Delete a secret, including all versions.
+
+--all deletes every key of the service instead, after asking for confirmation
+unless --force is given, in batches on backends that support it.
+
+--soft, the default when $` + SoftDeleteEnvVar + ` is true, moves secrets to the
+` + TrashService + ` namespace instead, keeping their latest value until chamber
+restore brings them back or chamber purge deletes them once the retention
+period has passed.`,
+	Example: `
+	$ chamber delete app-dev db_password
+	$ chamber delete preview-1234 --all --force
+	$ chamber delete --soft app-prod db_password
+	$ chamber restore app-prod db_password`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if deleteAll {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(2)(cmd, args)
+	},
+	RunE: delete,
 }
 
-var exactKey bool
+var (
+	exactKey    bool
+	deleteAll   bool
+	deleteForce bool
+	deleteSoft  bool
+)
 
 func init() {
 	deleteCmd.Flags().BoolVar(&exactKey, "exact-key", false, "Prevent normalization of the provided key in order to delete any keys that match the exact provided casing.")
+	deleteCmd.Flags().BoolVar(&deleteAll, "all", false, "Delete every key of the service")
+	deleteCmd.Flags().BoolVar(&deleteForce, "force", false, "With --all, delete without asking for confirmation")
+	deleteCmd.Flags().BoolVar(&deleteSoft, "soft", false, "Move secrets to the trash, from which chamber restore brings them back, rather than deleting them; the default when $"+SoftDeleteEnvVar+" is true")
 	RootCmd.AddCommand(deleteCmd)
 }
 
@@ -29,6 +60,10 @@ func delete(cmd *cobra.Command, args []string) error {
 	if err := validateService(service); err != nil {
 		return fmt.Errorf("Failed to validate service: %w", err)
 	}
+	soft := softDelete(cmd)
+	if deleteAll {
+		return deleteService(service, soft)
+	}
 
 	key := args[1]
 	if !exactKey {
@@ -48,6 +83,7 @@ func delete(cmd *cobra.Command, args []string) error {
 				Set("chamber-version", chamberVersion).
 				Set("service", service).
 				Set("key", key).
+				Set("soft", soft).
 				Set("backend", backend),
 		})
 	}
@@ -55,10 +91,83 @@ func delete(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("Failed to get secret store: %w", err)
 	}
+	// manifests are deleted like any key
+	secretStore = withManifests(secretStore)
 	secretId := store.SecretId{
 		Service: service,
 		Key:     key,
 	}
 
+	if soft {
+		return trashSecret(secretStore, secretId)
+	}
 	return secretStore.Delete(secretId)
 }
+
+// deleteService deletes every key of service, or moves them to the trash
+// with soft, once confirmed
+func deleteService(service string, soft bool) error {
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "delete").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("all", true).
+				Set("soft", soft).
+				Set("backend", backend),
+		})
+	}
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	// manifests are deleted like any key
+	secretStore = withManifests(secretStore)
+	secrets, err := secretStore.List(service, false)
+	if err != nil {
+		return fmt.Errorf("Failed to list store contents: %w", err)
+	}
+	keys := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		keys = append(keys, key(secret.Meta.Key))
+	}
+	if len(keys) == 0 {
+		fmt.Fprintf(os.Stderr, "%s has no secrets to delete\n", service)
+		return nil
+	}
+
+	if !deleteForce {
+		ok, err := confirmDeleteAll(os.Stdin, os.Stderr, service, keys)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("Delete aborted")
+		}
+	}
+	if soft {
+		for _, k := range keys {
+			if err := trashSecret(secretStore, store.SecretId{Service: service, Key: k}); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(os.Stdout, "Moved %d secrets of %s to the trash\n", len(keys), service)
+		return nil
+	}
+	if err := store.DeleteBatch(secretStore, service, keys); err != nil {
+		return fmt.Errorf("Failed to delete secrets of %s: %w", service, err)
+	}
+	fmt.Fprintf(os.Stdout, "Successfully deleted %d secrets of %s\n", len(keys), service)
+	return nil
+}
+
+// confirmDeleteAll asks whether to delete every key of a service, reading the
+// answer from in
+func confirmDeleteAll(in io.Reader, out io.Writer, service string, keys []string) (bool, error) {
+	fmt.Fprintf(out, "--all deletes the %d keys of %s, including all versions: %s\nDelete them? [y/N] ",
+		len(keys), service, strings.Join(keys, ", "))
+	return readConfirmation(in)
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmDeleteAll(t *testing.T) {
+	for answer, expected := range map[string]bool{"y\n": true, "YES\n": true, "n\n": false, "\n": false} {
+		out := &bytes.Buffer{}
+		ok, err := confirmDeleteAll(strings.NewReader(answer), out, "preview-1", []string{"a", "b"})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, ok, answer)
+		assert.Contains(t, out.String(), "the 2 keys of preview-1")
+	}
+
+	_, err := confirmDeleteAll(strings.NewReader(""), &bytes.Buffer{}, "preview-1", []string{"a"})
+	assert.Error(t, err)
+}
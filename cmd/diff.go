@@ -0,0 +1,334 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// diffCmd represents the diff command
+	diffCmd = &cobra.Command{
+		Use:   "diff <service> [<other service>] [--file <file>]",
+		Short: "Compare the secrets of a service with another service, or a dotenv, JSON or YAML file, without printing values",
+		Long: `Compare the secrets of a service with a dotenv, JSON or YAML file, or with
+another service, without printing values.
+
+Keys are reported as missing when they are in the file but not in the store,
+extra when they are in the store but not in the file, and changed when their
+values differ. Dotenv files are compared by variable name, as written by
+chamber export --format dotenv; JSON and YAML files by key.
+
+Two services, such as the staging and production environments of an app, are
+compared key by key: every key is reported as only in one of them, changed or
+identical.`,
+		Example: `
+	$ chamber diff service --file .env.production
+	Key           Status
+	DB_HOST       changed
+	NEW_API_KEY   missing
+	OLD_TOKEN     extra
+
+	$ chamber diff app/staging app/prod --exit-code
+	Key           Status
+	db_host       changed
+	db_user       identical
+	feature_flag  only in app/staging`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if diffFile != "" {
+				return cobra.ExactArgs(1)(cmd, args)
+			}
+			if len(args) != 2 {
+				return errors.New("diff needs two services, or a service and --file")
+			}
+			return nil
+		},
+		RunE: runDiff,
+	}
+	diffFile     string
+	diffFormat   string
+	diffExitCode bool
+)
+
+// Statuses of a key compared by diff
+const (
+	diffMissing = "missing"
+	diffExtra   = "extra"
+	diffChanged = "changed"
+	// only for services
+	diffIdentical = "identical"
+)
+
+func init() {
+	diffCmd.Flags().StringVarP(&diffFile, "file", "f", "", "file to compare the service with")
+	diffCmd.Flags().StringVar(&diffFormat, "format", "auto", "format of the file: dotenv, json or yaml; auto picks json or yaml from the file extension and dotenv otherwise")
+	diffCmd.Flags().BoolVar(&diffExitCode, "exit-code", false, "exit with status 1 when there are differences, e.g. to fail a CI job")
+	RootCmd.AddCommand(diffCmd)
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	service := utils.NormalizeService(args[0])
+	if err := validateServiceWithLabel(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+
+	if len(args) == 2 {
+		other := utils.NormalizeService(args[1])
+		if err := validateServiceWithLabel(other); err != nil {
+			return fmt.Errorf("Failed to validate service: %w", err)
+		}
+		return runDiffServices(service, other)
+	}
+
+	format := strings.ToLower(diffFormat)
+	if format == "auto" {
+		format = diffFileFormat(diffFile)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "diff").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("format", format).
+				Set("backend", backend),
+		})
+	}
+
+	f, err := os.Open(diffFile)
+	if err != nil {
+		return fmt.Errorf("Failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	var fromFile map[string]string
+	switch format {
+	case "dotenv":
+		fromFile, err = parseDotenv(f)
+	case "json", "yaml":
+		// JSON is a subset of YAML
+		err = yaml.NewDecoder(f).Decode(&fromFile)
+	default:
+		return fmt.Errorf("Unsupported file format: %s", diffFormat)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to decode %s: %w", diffFile, err)
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	rawSecrets, err := secretStore.ListRaw(service)
+	if err != nil {
+		return fmt.Errorf("Failed to list store contents: %w", err)
+	}
+
+	fromStore := map[string]string{}
+	for _, rawSecret := range rawSecrets {
+		k := key(rawSecret.Key)
+		if format == "dotenv" {
+			k = strings.ToUpper(sanitizeKey(k))
+		}
+		fromStore[k] = rawSecret.Value
+	}
+
+	differences := diffSecrets(fromStore, fromFile)
+	if len(differences) == 0 {
+		fmt.Fprintf(os.Stderr, "%s matches %s\n", service, diffFile)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+	fmt.Fprintln(w, "Key\tStatus")
+	for _, k := range sortedKeys(differences) {
+		fmt.Fprintf(w, "%s\t%s\n", k, differences[k])
+	}
+	w.Flush()
+
+	if diffExitCode {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// runDiffServices compares the secrets of two services
+func runDiffServices(service, other string) error {
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "diff").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("other-service", other).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	values := make([]map[string]string, 2)
+	for i, s := range []string{service, other} {
+		rawSecrets, err := secretStore.ListRaw(s)
+		if err != nil {
+			return fmt.Errorf("Failed to list store contents for service %s: %w", s, err)
+		}
+		values[i] = map[string]string{}
+		for _, rawSecret := range rawSecrets {
+			values[i][key(rawSecret.Key)] = rawSecret.Value
+		}
+	}
+
+	statuses := diffServices(service, other, values[0], values[1])
+	differ := false
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+	fmt.Fprintln(w, "Key\tStatus")
+	for _, k := range sortedKeys(statuses) {
+		fmt.Fprintf(w, "%s\t%s\n", k, statuses[k])
+		differ = differ || statuses[k] != diffIdentical
+	}
+	w.Flush()
+
+	if !differ {
+		fmt.Fprintf(os.Stderr, "%s matches %s\n", service, other)
+		return nil
+	}
+	if diffExitCode {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// diffServices returns the status of every key of two services: only in one
+// of them, changed or identical
+func diffServices(service, other string, values, otherValues map[string]string) map[string]string {
+	statuses := map[string]string{}
+	for k, v := range values {
+		otherValue, ok := otherValues[k]
+		switch {
+		case !ok:
+			statuses[k] = "only in " + service
+		case otherValue != v:
+			statuses[k] = diffChanged
+		default:
+			statuses[k] = diffIdentical
+		}
+	}
+	for k := range otherValues {
+		if _, ok := values[k]; !ok {
+			statuses[k] = "only in " + other
+		}
+	}
+	return statuses
+}
+
+// diffFileFormat guesses the format of a file from its extension. Dotenv
+// files are commonly named .env.<environment>, so anything that isn't JSON or
+// YAML is taken to be dotenv.
+func diffFileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	default:
+		return "dotenv"
+	}
+}
+
+// diffSecrets returns the status of every key that differs between the store
+// and the file
+func diffSecrets(fromStore, fromFile map[string]string) map[string]string {
+	differences := map[string]string{}
+	for k, v := range fromFile {
+		stored, ok := fromStore[k]
+		switch {
+		case !ok:
+			differences[k] = diffMissing
+		case stored != v:
+			differences[k] = diffChanged
+		}
+	}
+	for k := range fromStore {
+		if _, ok := fromFile[k]; !ok {
+			differences[k] = diffExtra
+		}
+	}
+	return differences
+}
+
+// parseDotenv reads KEY=value lines. Blank lines, comments and an export
+// prefix are ignored. Values may be single quoted, taken literally, or double
+// quoted, with the escapes written by chamber export --format dotenv.
+func parseDotenv(r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		k, v, ok := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNo)
+		}
+		v = strings.TrimSpace(v)
+
+		switch {
+		case len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'':
+			v = v[1 : len(v)-1]
+		case len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"':
+			v = doubleQuoteUnescape(v[1 : len(v)-1])
+		default:
+			if i := strings.Index(v, " #"); i != -1 {
+				v = strings.TrimSpace(v[:i])
+			}
+		}
+		values[k] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// doubleQuoteUnescape reverses doubleQuoteEscape
+func doubleQuoteUnescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
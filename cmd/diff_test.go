@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDotenv(t *testing.T) {
+	in := strings.Join([]string{
+		"# production settings",
+		"",
+		"DB_HOST=db.example.com",
+		"export DB_USER = root",
+		`DB_PASSWORD="hunter\"22\$\n"`,
+		`SINGLE='it\s $literal'`,
+		"PORT=5432 # default",
+		"EMPTY=",
+	}, "\n")
+
+	values, err := parseDotenv(strings.NewReader(in))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"DB_HOST":     "db.example.com",
+		"DB_USER":     "root",
+		"DB_PASSWORD": "hunter\"22$\n",
+		"SINGLE":      `it\s $literal`,
+		"PORT":        "5432",
+		"EMPTY":       "",
+	}, values)
+
+	_, err = parseDotenv(strings.NewReader("DB_HOST"))
+	assert.EqualError(t, err, "line 1: expected KEY=value")
+}
+
+func TestParseDotenvReadsExport(t *testing.T) {
+	params := map[string]string{"foo": "bar", "baz": `"$qux"` + "\n!`"}
+	buf := &bytes.Buffer{}
+	assert.NoError(t, exportAsEnvFile(params, buf))
+
+	values, err := parseDotenv(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"FOO": "bar", "BAZ": params["baz"]}, values)
+}
+
+func TestDiffSecrets(t *testing.T) {
+	fromStore := map[string]string{"same": "1", "changed": "old", "extra": "x"}
+	fromFile := map[string]string{"same": "1", "changed": "new", "missing": "y"}
+
+	assert.Equal(t, map[string]string{
+		"changed": diffChanged,
+		"extra":   diffExtra,
+		"missing": diffMissing,
+	}, diffSecrets(fromStore, fromFile))
+}
+
+func TestDiffFileFormat(t *testing.T) {
+	assert.Equal(t, "dotenv", diffFileFormat(".env.production"))
+	assert.Equal(t, "dotenv", diffFileFormat("config/.env"))
+	assert.Equal(t, "json", diffFileFormat("secrets.JSON"))
+	assert.Equal(t, "yaml", diffFileFormat("secrets.yml"))
+}
+
+func TestDiffServices(t *testing.T) {
+	statuses := diffServices("app/staging", "app/prod",
+		map[string]string{"db_host": "staging.db", "db_user": "app", "feature_flag": "on"},
+		map[string]string{"db_host": "prod.db", "db_user": "app", "replica_host": "replica.db"})
+	assert.Equal(t, map[string]string{
+		"db_host":      "changed",
+		"db_user":      "identical",
+		"feature_flag": "only in app/staging",
+		"replica_host": "only in app/prod",
+	}, statuses)
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// direnvStdlib defines use_chamber for direnv, which sources the files of
+// ~/.config/direnv/lib before every .envrc
+const direnvStdlib = `# use chamber <service...>
+#
+# Loads the secrets of services with chamber. They are cached in the direnv
+# layout directory, readable only by you, for $CHAMBER_DIRENV_CACHE_MINUTES
+# minutes (60 by default), so that the backend isn't called every time the
+# environment is loaded; 0 disables the cache. Run "direnv reload" after
+# removing .direnv/chamber-* to fetch them again sooner.
+use_chamber() {
+  local minutes=${CHAMBER_DIRENV_CACHE_MINUTES:-60}
+  local dir cache out
+  if [[ $minutes -eq 0 ]]; then
+    out=$(chamber direnv "$@") || { log_error "chamber: failed to load $*"; return 1; }
+    eval "$out"
+    return
+  fi
+  dir=$(direnv_layout_dir)
+  cache="$dir/chamber-$(printf '%s\n' "$*" | cksum | cut -d ' ' -f 1)"
+  if [[ -z $(find "$cache" -mmin "-$minutes" 2>/dev/null) ]]; then
+    out=$(chamber direnv "$@") || { log_error "chamber: failed to load $*"; return 1; }
+    mkdir -p "$dir"
+    (umask 077 && printf '%s\n' "$out" > "$cache")
+  else
+    log_status "chamber: using secrets of $* cached less than ${minutes}m ago"
+  fi
+  source "$cache"
+}
+`
+
+var (
+	// direnvCmd represents the direnv command
+	direnvCmd = &cobra.Command{
+		Use:   "direnv [<service...>]",
+		Short: "Print the secrets of services for a direnv .envrc",
+		Long: `Print the secrets of services as export statements for a direnv .envrc,
+named as with chamber exec. When services share a key, the last one wins.
+
+--stdlib instead prints a use_chamber function to save in
+~/.config/direnv/lib/chamber.sh, so that an .envrc only needs "use chamber
+<service...>". It caches the secrets so that the backend isn't called every
+time direnv loads the environment.`,
+		Example: `
+	$ chamber direnv --stdlib > ~/.config/direnv/lib/chamber.sh
+	$ echo 'use chamber app-dev' >> .envrc
+	$ direnv allow`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if direnvStdlibOnly {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
+		RunE: runDirenv,
+	}
+	direnvStdlibOnly bool
+)
+
+func init() {
+	direnvCmd.Flags().BoolVar(&direnvStdlibOnly, "stdlib", false, "print the use_chamber function for direnv's lib directory instead of secrets")
+	RootCmd.AddCommand(direnvCmd)
+}
+
+func runDirenv(cmd *cobra.Command, args []string) error {
+	if direnvStdlibOnly {
+		_, err := io.WriteString(os.Stdout, direnvStdlib)
+		return err
+	}
+
+	services := make([]string, 0, len(args))
+	for _, arg := range args {
+		service := utils.NormalizeService(arg)
+		if err := validateServiceWithLabel(service); err != nil {
+			return fmt.Errorf("Failed to validate service: %w", err)
+		}
+		services = append(services, service)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "direnv").
+				Set("chamber-version", chamberVersion).
+				Set("services", services).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	secretStore = withValueTransforms(secretStore)
+
+	params := map[string]string{}
+	for _, service := range services {
+		rawSecrets, err := secretStore.ListRaw(service)
+		if err != nil {
+			return fmt.Errorf("Failed to list store contents for service %s: %w", service, err)
+		}
+		for _, rawSecret := range rawSecrets {
+			params[key(rawSecret.Key)] = rawSecret.Value
+		}
+	}
+	return writeDirenvBlock(os.Stdout, services, params)
+}
+
+// writeDirenvBlock writes params as export statements for an .envrc
+func writeDirenvBlock(w io.Writer, services []string, params map[string]string) error {
+	// values are single quoted, which bash sources as is
+	escapeSpecials = false
+	out, err := buildEnvOutput(params)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "# secrets of %s, from chamber\n", strings.Join(services, ", ")); err != nil {
+		return err
+	}
+	for _, line := range out {
+		if _, err := fmt.Fprintf(w, "export %s\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDirenvBlock(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := writeDirenvBlock(buf, []string{"app", "dev"}, map[string]string{
+		"db_password": "it's $secret",
+		"db-user":     "app",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `# secrets of app, dev, from chamber
+export DB_USER=app
+export DB_PASSWORD='it'"'"'s $secret'
+`, buf.String())
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// DockerCredentialServiceEnvVar names the service holding registry
+// credentials, since docker runs credential helpers without flags
+const DockerCredentialServiceEnvVar = "CHAMBER_DOCKER_CREDENTIAL_SERVICE"
+
+// dockerCredentialsNotFound is the exact message docker expects when a
+// helper has no credentials for a registry
+const dockerCredentialsNotFound = "credentials not found in native keychain"
+
+var (
+	// dockerCredentialCmd represents the docker-credential command
+	dockerCredentialCmd = &cobra.Command{
+		Use:   "docker-credential <get|store|erase|list>",
+		Short: "Act as a docker credential helper, keeping registry credentials in a service",
+		Long: `Act as a docker credential helper, keeping registry credentials in a service
+rather than in ~/.docker/config.json.
+
+The credentials of each registry are stored as JSON in a key named after its
+server URL, like ghcr.io for https://ghcr.io. docker runs credential helpers
+as docker-credential-<name>, so install a script like this one on the PATH as
+docker-credential-chamber:
+
+	#!/bin/sh
+	exec chamber docker-credential "$@"
+
+and set "credsStore": "chamber" in ~/.docker/config.json. The service is
+given with --service, or $` + DockerCredentialServiceEnvVar + `.`,
+		Example: `
+	$ export ` + DockerCredentialServiceEnvVar + `=docker-registries
+	$ echo "$GHCR_TOKEN" | docker login ghcr.io -u octocat --password-stdin`,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"get", "store", "erase", "list"},
+		RunE:      runDockerCredential,
+	}
+	dockerCredentialService string
+)
+
+func init() {
+	dockerCredentialCmd.Flags().StringVar(&dockerCredentialService, "service", "", "service holding the registry credentials; defaults to $"+DockerCredentialServiceEnvVar)
+	RootCmd.AddCommand(dockerCredentialCmd)
+}
+
+// dockerCredentials are the credentials of a registry, as exchanged with
+// docker and stored in a key
+type dockerCredentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+func runDockerCredential(cmd *cobra.Command, args []string) error {
+	service := dockerCredentialService
+	if service == "" {
+		service = os.Getenv(DockerCredentialServiceEnvVar)
+	}
+	if service == "" {
+		return fmt.Errorf("no service given; set --service or $%s", DockerCredentialServiceEnvVar)
+	}
+	service = utils.NormalizeService(service)
+	if err := validateService(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+
+	action := args[0]
+	switch action {
+	case "get", "store", "erase", "list":
+	default:
+		return fmt.Errorf("Unsupported action: %s", action)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "docker-credential").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("action", action).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+
+	switch action {
+	case "get":
+		serverURL, err := readDockerServerURL(os.Stdin)
+		if err != nil {
+			return err
+		}
+		creds, err := getDockerCredentials(secretStore, service, serverURL)
+		if errors.Is(err, store.ErrSecretNotFound) {
+			// docker only recognizes this message on stdout
+			fmt.Fprintln(os.Stdout, dockerCredentialsNotFound)
+			os.Exit(1)
+		}
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(os.Stdout).Encode(creds)
+	case "store":
+		var creds dockerCredentials
+		if err := json.NewDecoder(os.Stdin).Decode(&creds); err != nil {
+			return fmt.Errorf("Failed to read credentials: %w", err)
+		}
+		return storeDockerCredentials(secretStore, service, creds)
+	case "erase":
+		serverURL, err := readDockerServerURL(os.Stdin)
+		if err != nil {
+			return err
+		}
+		id := store.SecretId{Service: service, Key: dockerCredentialKey(serverURL)}
+		if err := secretStore.Delete(id); err != nil && !errors.Is(err, store.ErrSecretNotFound) {
+			return fmt.Errorf("Failed to delete credentials: %w", err)
+		}
+		return nil
+	default:
+		registries, err := listDockerCredentials(secretStore, service)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(os.Stdout).Encode(registries)
+	}
+}
+
+// readDockerServerURL reads the server URL docker sends for get and erase
+func readDockerServerURL(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read server URL: %w", err)
+	}
+	serverURL := strings.TrimSpace(string(data))
+	if serverURL == "" {
+		return "", errors.New("no server URL given")
+	}
+	return serverURL, nil
+}
+
+var dockerKeyReplacer = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// dockerCredentialKey names the key holding the credentials of serverURL.
+// The scheme is ignored, since docker sends registries both with and
+// without one.
+func dockerCredentialKey(serverURL string) string {
+	k := strings.ToLower(serverURL)
+	if i := strings.Index(k, "://"); i != -1 {
+		k = k[i+3:]
+	}
+	k = strings.Trim(k, "/")
+	return strings.Trim(dockerKeyReplacer.ReplaceAllString(k, "_"), "_")
+}
+
+func getDockerCredentials(s store.Store, service, serverURL string) (dockerCredentials, error) {
+	secret, err := s.Read(store.SecretId{Service: service, Key: dockerCredentialKey(serverURL)}, -1)
+	if err != nil {
+		return dockerCredentials{}, err
+	}
+	var creds dockerCredentials
+	if err := json.Unmarshal([]byte(*secret.Value), &creds); err != nil {
+		return dockerCredentials{}, fmt.Errorf("Failed to parse credentials for %s: %w", serverURL, err)
+	}
+	// answer for the registry that was asked about
+	creds.ServerURL = serverURL
+	return creds, nil
+}
+
+func storeDockerCredentials(s store.Store, service string, creds dockerCredentials) error {
+	if creds.ServerURL == "" {
+		return errors.New("no server URL given")
+	}
+	value, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	if err := s.Write(store.SecretId{Service: service, Key: dockerCredentialKey(creds.ServerURL)}, string(value)); err != nil {
+		return fmt.Errorf("Failed to write credentials: %w", err)
+	}
+	return nil
+}
+
+// listDockerCredentials maps the server URL of every registry with
+// credentials to its username. Keys that don't hold credentials are skipped.
+func listDockerCredentials(s store.Store, service string) (map[string]string, error) {
+	rawSecrets, err := s.ListRaw(service)
+	if err != nil && !errors.Is(err, store.ErrSecretNotFound) {
+		return nil, fmt.Errorf("Failed to list store contents: %w", err)
+	}
+	registries := map[string]string{}
+	for _, rawSecret := range rawSecrets {
+		var creds dockerCredentials
+		if json.Unmarshal([]byte(rawSecret.Value), &creds) != nil || creds.ServerURL == "" {
+			continue
+		}
+		registries[creds.ServerURL] = creds.Username
+	}
+	return registries, nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerCredentialKey(t *testing.T) {
+	cases := map[string]string{
+		"https://index.docker.io/v1/": "index.docker.io_v1",
+		"ghcr.io":                     "ghcr.io",
+		"https://ghcr.io":             "ghcr.io",
+		"123456789012.dkr.ecr.us-east-1.amazonaws.com": "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+		"Registry.Example.com:5000/team":               "registry.example.com_5000_team",
+	}
+	for serverURL, expected := range cases {
+		t.Run(serverURL, func(t *testing.T) {
+			k := dockerCredentialKey(serverURL)
+			assert.Equal(t, expected, k)
+			assert.NoError(t, validateKey(k))
+		})
+	}
+}
+
+func TestDockerCredentialsRoundTrip(t *testing.T) {
+	s := store.NewMemoryStore()
+
+	_, err := getDockerCredentials(s, "registries", "ghcr.io")
+	assert.ErrorIs(t, err, store.ErrSecretNotFound)
+
+	require.NoError(t, storeDockerCredentials(s, "registries", dockerCredentials{
+		ServerURL: "https://ghcr.io",
+		Username:  "octocat",
+		Secret:    "ghp_abc",
+	}))
+	require.NoError(t, s.Write(store.SecretId{Service: "registries", Key: "unrelated"}, "not json"))
+
+	creds, err := getDockerCredentials(s, "registries", "ghcr.io")
+	require.NoError(t, err)
+	assert.Equal(t, dockerCredentials{ServerURL: "ghcr.io", Username: "octocat", Secret: "ghp_abc"}, creds)
+
+	registries, err := listDockerCredentials(s, "registries")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"https://ghcr.io": "octocat"}, registries)
+
+	assert.Error(t, storeDockerCredentials(s, "registries", dockerCredentials{Username: "octocat"}))
+}
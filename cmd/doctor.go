@@ -0,0 +1,481 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/sts"
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// The outcomes of a doctor check
+const (
+	doctorOK   = "ok"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+	doctorSkip = "skip"
+)
+
+// doctorProbeService is listed to check the backend is reachable when no
+// service is given; it needn't exist
+const doctorProbeService = "chamber-doctor"
+
+var (
+	// doctorCmd represents the doctor command
+	doctorCmd = &cobra.Command{
+		Use:   "doctor [service]",
+		Short: "Diagnose configuration and permission problems",
+		Long: `Diagnose configuration and permission problems with the active backend.
+
+Doctor checks the region, the credentials, that the backend is reachable,
+that the KMS key secrets are encrypted with is accessible and, where
+iam:SimulatePrincipalPolicy is allowed, that the caller is allowed the
+actions chamber needs on the service. Each problem is printed with how to
+fix it, and doctor exits with status 1 if any check fails.`,
+		Example: `
+	$ chamber doctor app-dev
+	Check        Status  Detail
+	region       ok      us-east-1
+	credentials  ok      arn:aws:sts::123456789012:assumed-role/developer/alice
+	backend      ok      ssm reachable
+	kms key      fail    alias/parameter_store_key: NotFoundException: Alias ... is not found.
+	permissions  ok      11 actions allowed
+
+	kms key: create the key alias, or set CHAMBER_KMS_KEY_ALIAS to the alias of an existing key`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runDoctor,
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(doctorCmd)
+}
+
+// doctorCheck is the outcome of one check, with how to fix it when it
+// didn't pass
+type doctorCheck struct {
+	Name   string
+	Status string
+	Detail string
+	Fix    string
+}
+
+// callerSTS, doctorIAM and doctorKMS are the parts of the AWS APIs doctor
+// uses
+type callerSTS interface {
+	GetCallerIdentity(*sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error)
+}
+
+type doctorIAM interface {
+	SimulatePrincipalPolicy(*iam.SimulatePrincipalPolicyInput) (*iam.SimulatePolicyResponse, error)
+}
+
+type doctorKMS interface {
+	DescribeKey(*kms.DescribeKeyInput) (*kms.DescribeKeyOutput, error)
+}
+
+// awsClients are the AWS clients doctor and whoami use
+type awsClients struct {
+	region string
+	sts    callerSTS
+	iam    doctorIAM
+	kms    doctorKMS
+}
+
+// newAWSClients returns the AWS clients doctor and whoami use
+var newAWSClients = func() (*awsClients, error) {
+	session, region, err := store.NewSession(numRetries)
+	if err != nil {
+		return nil, err
+	}
+	config := &aws.Config{Region: region}
+	return &awsClients{
+		region: aws.StringValue(region),
+		sts:    sts.New(session, config),
+		iam:    iam.New(session, config),
+		kms:    kms.New(session, config),
+	}, nil
+}
+
+// doctorAction is an action chamber needs on a resource
+type doctorAction struct {
+	Action   string
+	Resource string
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	service := ""
+	if len(args) == 1 {
+		service = utils.NormalizeService(args[0])
+		if err := validateService(service); err != nil {
+			return fmt.Errorf("Failed to validate service: %w", err)
+		}
+	}
+
+	secretStore, storeErr := getSecretStore()
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "doctor").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("backend", backend),
+		})
+	}
+
+	var checks []doctorCheck
+	if backend == NullBackend {
+		checks = append(checks, doctorCheck{Name: "backend", Status: doctorOK, Detail: "null backend, nothing to check"})
+		return reportDoctor(os.Stdout, checks)
+	}
+
+	clients, err := newAWSClients()
+	if err != nil {
+		checks = append(checks, doctorCheck{
+			Name:   "aws config",
+			Status: doctorFail,
+			Detail: err.Error(),
+			Fix:    "fix the AWS config and credentials files, or unset AWS_PROFILE if it names a missing profile",
+		})
+		return reportDoctor(os.Stdout, checks)
+	}
+
+	checks = append(checks, checkDoctorRegion(clients.region))
+	credentials, caller := checkDoctorCredentials(clients.sts)
+	checks = append(checks, credentials)
+	checks = append(checks, checkDoctorBackend(secretStore, storeErr, service))
+
+	keyID := doctorKMSKey()
+	keyArn := ""
+	if keyID == "" {
+		checks = append(checks, doctorCheck{Name: "kms key", Status: doctorSkip, Detail: "the backend encrypts with its own key"})
+	} else {
+		var check doctorCheck
+		check, keyArn = checkDoctorKMSKey(clients.kms, keyID)
+		checks = append(checks, check)
+	}
+
+	if caller == "" || storeErr != nil {
+		checks = append(checks, doctorCheck{Name: "permissions", Status: doctorSkip, Detail: "needs working credentials and backend"})
+	} else {
+		actions := doctorActions(backend, caller, clients.region, service, backendS3Bucket(), keyArn)
+		checks = append(checks, checkDoctorPermissions(clients.iam, caller, actions))
+	}
+	return reportDoctor(os.Stdout, checks)
+}
+
+// reportDoctor prints checks and their remediation, exiting with status 1
+// if any failed
+func reportDoctor(w io.Writer, checks []doctorCheck) error {
+	if err := writeDoctorChecks(w, checks); err != nil {
+		return err
+	}
+	for _, check := range checks {
+		if check.Status == doctorFail {
+			os.Exit(1)
+		}
+	}
+	return nil
+}
+
+// writeDoctorChecks writes checks as a table, followed by how to fix those
+// that didn't pass
+func writeDoctorChecks(w io.Writer, checks []doctorCheck) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, '\t', 0)
+	fmt.Fprintln(tw, "Check\tStatus\tDetail")
+	for _, check := range checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", check.Name, check.Status, check.Detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	first := true
+	for _, check := range checks {
+		if check.Fix == "" {
+			continue
+		}
+		if first {
+			fmt.Fprintln(w)
+			first = false
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s\n", check.Name, check.Fix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkDoctorRegion(region string) doctorCheck {
+	if region == "" {
+		return doctorCheck{
+			Name:   "region",
+			Status: doctorFail,
+			Detail: "no region configured",
+			Fix:    fmt.Sprintf("set %s or AWS_REGION, or a region in the AWS config profile", store.RegionEnvVar),
+		}
+	}
+	return doctorCheck{Name: "region", Status: doctorOK, Detail: region}
+}
+
+// checkDoctorCredentials checks the credentials work, returning the ARN of
+// the caller if they do
+func checkDoctorCredentials(svc callerSTS) (doctorCheck, string) {
+	identity, err := svc.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		fix := "configure credentials, e.g. with aws configure, aws sso login, or AWS_PROFILE"
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && (aerr.Code() == "ExpiredToken" || aerr.Code() == "ExpiredTokenException") {
+			fix = "the session expired; refresh it, e.g. with aws sso login or by assuming the role again"
+		}
+		return doctorCheck{Name: "credentials", Status: doctorFail, Detail: err.Error(), Fix: fix}, ""
+	}
+	caller := aws.StringValue(identity.Arn)
+	return doctorCheck{Name: "credentials", Status: doctorOK, Detail: caller}, caller
+}
+
+// checkDoctorBackend checks the backend is configured and reachable, by
+// listing service
+func checkDoctorBackend(s store.Store, storeErr error, service string) doctorCheck {
+	name := strings.ToLower(backend)
+	if storeErr != nil {
+		return doctorCheck{
+			Name:   "backend",
+			Status: doctorFail,
+			Detail: storeErr.Error(),
+			Fix:    fmt.Sprintf("set --backend or %s to ssm, secretsmanager, s3 or s3-kms, with the options it needs", BackendEnvVar),
+		}
+	}
+	if service == "" {
+		service = doctorProbeService
+	}
+	if _, err := s.List(service, false); err != nil {
+		fix := "check the network can reach AWS, and --https-proxy and --ca-bundle if a proxy is in the way"
+		if isAccessDenied(err) {
+			fix = fmt.Sprintf("allow listing the secrets of %s; see the permissions check", service)
+		}
+		return doctorCheck{Name: "backend", Status: doctorFail, Detail: fmt.Sprintf("%s: %s", name, err), Fix: fix}
+	}
+	return doctorCheck{Name: "backend", Status: doctorOK, Detail: name + " reachable"}
+}
+
+// doctorKMSKey returns the KMS key the backend encrypts with, or nothing if
+// it doesn't use a customer managed key
+func doctorKMSKey() string {
+	switch backend {
+	case SSMBackend:
+		if fromEnv, ok := os.LookupEnv(KMSKeyEnvVar); ok {
+			if !strings.HasPrefix(fromEnv, "alias/") {
+				return "alias/" + fromEnv
+			}
+			return fromEnv
+		}
+		return store.DefaultKeyID
+	case S3KMSBackend:
+		return s3KMSKeyAlias()
+	}
+	return ""
+}
+
+// checkDoctorKMSKey checks keyID exists and can be used, returning its ARN
+func checkDoctorKMSKey(svc doctorKMS, keyID string) (doctorCheck, string) {
+	out, err := svc.DescribeKey(&kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		fix := fmt.Sprintf("create the key alias, or set %s to the alias of an existing key", KMSKeyEnvVar)
+		if isAccessDenied(err) {
+			fix = fmt.Sprintf("allow kms:DescribeKey, kms:Encrypt and kms:Decrypt on %s in the key policy or IAM policy", keyID)
+		}
+		return doctorCheck{Name: "kms key", Status: doctorFail, Detail: fmt.Sprintf("%s: %s", keyID, err), Fix: fix}, ""
+	}
+	meta := out.KeyMetadata
+	if meta == nil {
+		return doctorCheck{Name: "kms key", Status: doctorOK, Detail: keyID}, ""
+	}
+	if !aws.BoolValue(meta.Enabled) {
+		return doctorCheck{
+			Name:   "kms key",
+			Status: doctorFail,
+			Detail: fmt.Sprintf("%s is %s", keyID, strings.ToLower(aws.StringValue(meta.KeyState))),
+			Fix:    fmt.Sprintf("enable the key, or cancel its deletion, in KMS; or set %s to another key", KMSKeyEnvVar),
+		}, aws.StringValue(meta.Arn)
+	}
+	return doctorCheck{Name: "kms key", Status: doctorOK, Detail: keyID}, aws.StringValue(meta.Arn)
+}
+
+// doctorActions returns the actions chamber needs for backend on service,
+// or all services when it's empty
+func doctorActions(backend, caller, region, service, bucket, keyArn string) []doctorAction {
+	parsed, err := arn.Parse(caller)
+	if err != nil {
+		return nil
+	}
+	partition, account := parsed.Partition, parsed.AccountID
+	if keyArn == "" {
+		keyArn = "*"
+	}
+	var actions []doctorAction
+	add := func(resource string, names ...string) {
+		for _, name := range names {
+			actions = append(actions, doctorAction{Action: name, Resource: resource})
+		}
+	}
+
+	switch backend {
+	case SSMBackend:
+		parameter := "*"
+		if service != "" {
+			if _, ok := os.LookupEnv("CHAMBER_NO_PATHS"); ok {
+				parameter = service + ".*"
+			} else {
+				prefix := strings.Trim(os.Getenv(store.PrefixEnvVar), "/")
+				if prefix != "" {
+					prefix += "/"
+				}
+				parameter = prefix + service + "/*"
+			}
+		}
+		resource := fmt.Sprintf("arn:%s:ssm:%s:%s:parameter/%s", partition, region, account, parameter)
+		add(resource, "ssm:GetParameter", "ssm:GetParameters", "ssm:GetParametersByPath", "ssm:GetParameterHistory",
+			"ssm:PutParameter", "ssm:DeleteParameter")
+		add("*", "ssm:DescribeParameters")
+		add(keyArn, "kms:Encrypt", "kms:Decrypt")
+	case SecretsManagerBackend:
+		secret := "*"
+		if service != "" {
+			secret = service + "-*"
+		}
+		resource := fmt.Sprintf("arn:%s:secretsmanager:%s:%s:secret:%s", partition, region, account, secret)
+		add(resource, "secretsmanager:GetSecretValue", "secretsmanager:PutSecretValue", "secretsmanager:CreateSecret",
+			"secretsmanager:DescribeSecret")
+		add("*", "secretsmanager:ListSecrets")
+	case S3Backend, S3KMSBackend:
+		if bucket == "" {
+			return nil
+		}
+		objects := "*"
+		if service != "" {
+			objects = service + "/*"
+		}
+		add(fmt.Sprintf("arn:%s:s3:::%s", partition, bucket), "s3:ListBucket")
+		add(fmt.Sprintf("arn:%s:s3:::%s/%s", partition, bucket, objects), "s3:GetObject", "s3:PutObject", "s3:DeleteObject")
+		if backend == S3KMSBackend {
+			add(keyArn, "kms:Encrypt", "kms:Decrypt", "kms:GenerateDataKey")
+		}
+	}
+	return actions
+}
+
+// principalArn returns the IAM principal policies can be simulated for from
+// the ARN of the caller, or nothing if there isn't one
+func principalArn(caller string) string {
+	parsed, err := arn.Parse(caller)
+	if err != nil {
+		return ""
+	}
+	switch parsed.Service {
+	case "iam":
+		if strings.HasPrefix(parsed.Resource, "user/") || strings.HasPrefix(parsed.Resource, "role/") {
+			return caller
+		}
+	case "sts":
+		// arn:aws:sts::<account>:assumed-role/<role>/<session>
+		parts := strings.Split(parsed.Resource, "/")
+		if len(parts) == 3 && parts[0] == "assumed-role" {
+			parsed.Service = "iam"
+			parsed.Resource = "role/" + parts[1]
+			return parsed.String()
+		}
+	}
+	return ""
+}
+
+// checkDoctorPermissions simulates the policies of the caller to check it's
+// allowed actions. Simulation being denied only warns, since many users
+// aren't allowed it.
+func checkDoctorPermissions(svc doctorIAM, caller string, actions []doctorAction) doctorCheck {
+	principal := principalArn(caller)
+	if principal == "" {
+		return doctorCheck{Name: "permissions", Status: doctorSkip, Detail: "can't simulate policies for " + caller}
+	}
+	if len(actions) == 0 {
+		return doctorCheck{Name: "permissions", Status: doctorSkip, Detail: "nothing to check for this backend"}
+	}
+
+	// simulate the actions on each resource together
+	var resources []string
+	byResource := map[string][]string{}
+	for _, a := range actions {
+		if _, ok := byResource[a.Resource]; !ok {
+			resources = append(resources, a.Resource)
+		}
+		byResource[a.Resource] = append(byResource[a.Resource], a.Action)
+	}
+
+	var denied []string
+	for _, resource := range resources {
+		input := &iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(principal),
+			ActionNames:     aws.StringSlice(byResource[resource]),
+			ResourceArns:    aws.StringSlice([]string{resource}),
+		}
+		for {
+			out, err := svc.SimulatePrincipalPolicy(input)
+			if err != nil {
+				fix := "allow iam:SimulatePrincipalPolicy on " + principal + " to check permissions"
+				var aerr awserr.Error
+				if errors.As(err, &aerr) && aerr.Code() == iam.ErrCodeNoSuchEntityException {
+					// the path of a role isn't in the ARN of its sessions
+					fix = "the role may have a path, which can't be told from the session; check its permissions in the IAM console"
+				}
+				return doctorCheck{Name: "permissions", Status: doctorWarn, Detail: "couldn't simulate policies: " + err.Error(), Fix: fix}
+			}
+			for _, result := range out.EvaluationResults {
+				if aws.StringValue(result.EvalDecision) != iam.PolicyEvaluationDecisionTypeAllowed {
+					denied = append(denied, fmt.Sprintf("%s on %s", aws.StringValue(result.EvalActionName), resource))
+				}
+			}
+			if !aws.BoolValue(out.IsTruncated) {
+				break
+			}
+			input.Marker = out.Marker
+		}
+	}
+
+	if len(denied) > 0 {
+		return doctorCheck{
+			Name:   "permissions",
+			Status: doctorFail,
+			Detail: fmt.Sprintf("%d of %d actions denied", len(denied), len(actions)),
+			Fix:    fmt.Sprintf("allow %s for %s", strings.Join(denied, ", "), principal),
+		}
+	}
+	return doctorCheck{Name: "permissions", Status: doctorOK, Detail: fmt.Sprintf("%d actions allowed", len(actions))}
+}
+
+// isAccessDenied reports whether err is AWS refusing a request for lack of
+// permissions
+func isAccessDenied(err error) bool {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+	switch aerr.Code() {
+	case "AccessDenied", "AccessDeniedException", "UnauthorizedOperation":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSTS struct {
+	arn string
+	err error
+}
+
+func (f *fakeSTS) GetCallerIdentity(*sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &sts.GetCallerIdentityOutput{Arn: aws.String(f.arn)}, nil
+}
+
+// fakeIAM allows every action but those in denied
+type fakeIAM struct {
+	denied     map[string]bool
+	err        error
+	principals []string
+}
+
+func (f *fakeIAM) SimulatePrincipalPolicy(input *iam.SimulatePrincipalPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.principals = append(f.principals, aws.StringValue(input.PolicySourceArn))
+	out := &iam.SimulatePolicyResponse{}
+	for _, action := range aws.StringValueSlice(input.ActionNames) {
+		decision := iam.PolicyEvaluationDecisionTypeAllowed
+		if f.denied[action] {
+			decision = iam.PolicyEvaluationDecisionTypeImplicitDeny
+		}
+		out.EvaluationResults = append(out.EvaluationResults, &iam.EvaluationResult{
+			EvalActionName: aws.String(action),
+			EvalDecision:   aws.String(decision),
+		})
+	}
+	return out, nil
+}
+
+type fakeDoctorKMS struct {
+	keys map[string]*kms.KeyMetadata
+}
+
+func (f *fakeDoctorKMS) DescribeKey(input *kms.DescribeKeyInput) (*kms.DescribeKeyOutput, error) {
+	meta, ok := f.keys[aws.StringValue(input.KeyId)]
+	if !ok {
+		return nil, awserr.New(kms.ErrCodeNotFoundException, "Alias is not found.", nil)
+	}
+	return &kms.DescribeKeyOutput{KeyMetadata: meta}, nil
+}
+
+func TestPrincipalArn(t *testing.T) {
+	for caller, expected := range map[string]string{
+		"arn:aws:sts::123456789012:assumed-role/developer/alice": "arn:aws:iam::123456789012:role/developer",
+		"arn:aws:iam::123456789012:user/alice":                   "arn:aws:iam::123456789012:user/alice",
+		"arn:aws:iam::123456789012:root":                         "",
+		"arn:aws:sts::123456789012:federated-user/alice":         "",
+		"not an arn": "",
+	} {
+		assert.Equal(t, expected, principalArn(caller), caller)
+	}
+}
+
+func TestCheckDoctorCredentials(t *testing.T) {
+	check, caller := checkDoctorCredentials(&fakeSTS{arn: "arn:aws:iam::123456789012:user/alice"})
+	assert.Equal(t, doctorOK, check.Status)
+	assert.Equal(t, "arn:aws:iam::123456789012:user/alice", caller)
+
+	check, caller = checkDoctorCredentials(&fakeSTS{err: awserr.New("ExpiredToken", "The security token included in the request is expired", nil)})
+	assert.Equal(t, doctorFail, check.Status)
+	assert.Contains(t, check.Fix, "expired")
+	assert.Empty(t, caller)
+}
+
+func TestCheckDoctorKMSKey(t *testing.T) {
+	svc := &fakeDoctorKMS{keys: map[string]*kms.KeyMetadata{
+		"alias/chamber": {Arn: aws.String("arn:aws:kms:us-east-1:123456789012:key/abcd"), Enabled: aws.Bool(true)},
+		"alias/old":     {Arn: aws.String("arn:aws:kms:us-east-1:123456789012:key/ef01"), Enabled: aws.Bool(false), KeyState: aws.String(kms.KeyStatePendingDeletion)},
+	}}
+
+	check, keyArn := checkDoctorKMSKey(svc, "alias/chamber")
+	assert.Equal(t, doctorOK, check.Status)
+	assert.Equal(t, "arn:aws:kms:us-east-1:123456789012:key/abcd", keyArn)
+
+	check, _ = checkDoctorKMSKey(svc, "alias/old")
+	assert.Equal(t, doctorFail, check.Status)
+	assert.Contains(t, check.Detail, "pendingdeletion")
+
+	check, keyArn = checkDoctorKMSKey(svc, "alias/missing")
+	assert.Equal(t, doctorFail, check.Status)
+	assert.Contains(t, check.Fix, KMSKeyEnvVar)
+	assert.Empty(t, keyArn)
+}
+
+func TestDoctorActions(t *testing.T) {
+	caller := "arn:aws:sts::123456789012:assumed-role/developer/alice"
+	t.Setenv(store.PrefixEnvVar, "team")
+
+	actions := doctorActions(SSMBackend, caller, "us-east-1", "app", "", "arn:aws:kms:us-east-1:123456789012:key/abcd")
+	assert.Contains(t, actions, doctorAction{Action: "ssm:GetParametersByPath", Resource: "arn:aws:ssm:us-east-1:123456789012:parameter/team/app/*"})
+	assert.Contains(t, actions, doctorAction{Action: "kms:Decrypt", Resource: "arn:aws:kms:us-east-1:123456789012:key/abcd"})
+
+	actions = doctorActions(S3KMSBackend, caller, "us-east-1", "", "secrets", "")
+	assert.Contains(t, actions, doctorAction{Action: "s3:ListBucket", Resource: "arn:aws:s3:::secrets"})
+	assert.Contains(t, actions, doctorAction{Action: "s3:GetObject", Resource: "arn:aws:s3:::secrets/*"})
+	assert.Contains(t, actions, doctorAction{Action: "kms:GenerateDataKey", Resource: "*"})
+
+	assert.Empty(t, doctorActions(S3Backend, caller, "us-east-1", "app", "", ""))
+}
+
+func TestCheckDoctorPermissions(t *testing.T) {
+	caller := "arn:aws:sts::123456789012:assumed-role/developer/alice"
+	actions := []doctorAction{
+		{Action: "ssm:GetParametersByPath", Resource: "arn:aws:ssm:us-east-1:123456789012:parameter/app/*"},
+		{Action: "ssm:PutParameter", Resource: "arn:aws:ssm:us-east-1:123456789012:parameter/app/*"},
+		{Action: "ssm:DescribeParameters", Resource: "*"},
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		svc := &fakeIAM{}
+		check := checkDoctorPermissions(svc, caller, actions)
+		assert.Equal(t, doctorOK, check.Status)
+		assert.Equal(t, "3 actions allowed", check.Detail)
+		assert.Equal(t, []string{"arn:aws:iam::123456789012:role/developer", "arn:aws:iam::123456789012:role/developer"}, svc.principals)
+	})
+	t.Run("denied", func(t *testing.T) {
+		check := checkDoctorPermissions(&fakeIAM{denied: map[string]bool{"ssm:PutParameter": true}}, caller, actions)
+		assert.Equal(t, doctorFail, check.Status)
+		assert.Equal(t, "1 of 3 actions denied", check.Detail)
+		assert.Contains(t, check.Fix, "ssm:PutParameter on arn:aws:ssm:us-east-1:123456789012:parameter/app/*")
+	})
+	t.Run("simulation denied", func(t *testing.T) {
+		check := checkDoctorPermissions(&fakeIAM{err: awserr.New("AccessDenied", "not authorized", nil)}, caller, actions)
+		assert.Equal(t, doctorWarn, check.Status)
+		assert.Contains(t, check.Fix, "iam:SimulatePrincipalPolicy")
+	})
+	t.Run("root", func(t *testing.T) {
+		check := checkDoctorPermissions(&fakeIAM{}, "arn:aws:iam::123456789012:root", actions)
+		assert.Equal(t, doctorSkip, check.Status)
+	})
+}
+
+func TestCheckDoctorBackend(t *testing.T) {
+	check := checkDoctorBackend(store.NewMemoryStore(), nil, "app")
+	assert.Equal(t, doctorOK, check.Status)
+
+	check = checkDoctorBackend(nil, errors.New("Must set bucket for s3 backend"), "app")
+	assert.Equal(t, doctorFail, check.Status)
+	assert.Contains(t, check.Fix, BackendEnvVar)
+}
+
+func TestWriteDoctorChecks(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, writeDoctorChecks(&b, []doctorCheck{
+		{Name: "region", Status: doctorOK, Detail: "us-east-1"},
+		{Name: "kms key", Status: doctorFail, Detail: "alias/chamber: not found", Fix: "create the key alias"},
+	}))
+	assert.Equal(t, "Check\t\tStatus\tDetail\nregion\t\tok\tus-east-1\nkms key\t\tfail\talias/chamber: not found\n\nkms key: create the key alias\n", b.String())
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// DriftWebhookEnvVar holds the URL drift notifications are posted to, which
+// often embeds a credential
+const DriftWebhookEnvVar = "CHAMBER_DRIFT_WEBHOOK"
+
+var (
+	// driftCmd represents the drift command
+	driftCmd = &cobra.Command{
+		Use:   "drift [<service...>] --baseline <file>",
+		Short: "Detect changes to secrets made since a baseline was recorded",
+		Long: `Detect changes to secrets made since a baseline was recorded, such as edits
+made in the AWS console rather than through a reviewed change.
+
+The baseline records the version of every key of some services, without any
+values, so it can be committed alongside the code that manages them. Record
+it with --write-baseline, giving the services to track, and update it
+whenever secrets are changed on purpose. Checking it reports keys added,
+removed or updated since, and exits with status 1 when there are any, so
+it can run from cron. --notify webhook also posts the changes as JSON to the
+URL in $CHAMBER_DRIFT_WEBHOOK, with a text field that Slack and compatible
+chat tools display.`,
+		Example: `
+	$ chamber drift app global --baseline secrets-baseline.json --write-baseline
+	$ chamber drift --baseline secrets-baseline.json --notify webhook
+	~ app/db_password: version 3 -> 4
+	+ global/new_flag: added at version 1`,
+		RunE: runDrift,
+	}
+	driftBaseline      string
+	driftWriteBaseline bool
+	driftNotify        string
+)
+
+// driftBaselineFile records the versions of the keys of some services
+type driftBaselineFile struct {
+	Created  time.Time      `json:"created"`
+	Services []string       `json:"services"`
+	Versions map[string]int `json:"versions"`
+}
+
+// driftNotification is posted to the webhook when drift is found
+type driftNotification struct {
+	Text     string   `json:"text"`
+	Baseline string   `json:"baseline"`
+	Changes  []string `json:"changes"`
+}
+
+func init() {
+	driftCmd.Flags().StringVar(&driftBaseline, "baseline", "", "baseline file to check against, or to write")
+	driftCmd.Flags().BoolVar(&driftWriteBaseline, "write-baseline", false, "record the current versions of the services as the baseline")
+	driftCmd.Flags().StringVar(&driftNotify, "notify", "", "also report drift elsewhere; only webhook is supported")
+	driftCmd.MarkFlagRequired("baseline")
+	RootCmd.AddCommand(driftCmd)
+}
+
+func runDrift(cmd *cobra.Command, args []string) error {
+	if driftNotify != "" && driftNotify != "webhook" {
+		return fmt.Errorf("Unsupported --notify: %s", driftNotify)
+	}
+	webhook := os.Getenv(DriftWebhookEnvVar)
+	if driftNotify == "webhook" && webhook == "" {
+		return fmt.Errorf("$%s must be set to notify a webhook", DriftWebhookEnvVar)
+	}
+
+	services := make([]string, 0, len(args))
+	for _, arg := range args {
+		service := utils.NormalizeService(arg)
+		if err := validateService(service); err != nil {
+			return fmt.Errorf("Failed to validate service %s: %w", service, err)
+		}
+		services = append(services, service)
+	}
+
+	var baseline driftBaselineFile
+	if driftWriteBaseline {
+		if len(services) == 0 {
+			return errors.New("services to record must be given with --write-baseline")
+		}
+	} else {
+		data, err := os.ReadFile(driftBaseline)
+		if err != nil {
+			return fmt.Errorf("Failed to read baseline: %w", err)
+		}
+		if err := json.Unmarshal(data, &baseline); err != nil {
+			return fmt.Errorf("Failed to decode baseline: %w", err)
+		}
+		if len(services) > 0 {
+			return errors.New("services are read from the baseline, and can only be given with --write-baseline")
+		}
+		services = baseline.Services
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "drift").
+				Set("chamber-version", chamberVersion).
+				Set("services", services).
+				Set("write-baseline", driftWriteBaseline).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	current, err := secretVersions(secretStore, services)
+	if err != nil {
+		return err
+	}
+
+	if driftWriteBaseline {
+		data, err := json.MarshalIndent(driftBaselineFile{
+			Created:  time.Now().UTC(),
+			Services: services,
+			Versions: current,
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(driftBaseline, append(data, '\n'), 0644); err != nil {
+			return fmt.Errorf("Failed to write baseline: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "recorded %d keys of %s\n", len(current), strings.Join(services, ", "))
+		return nil
+	}
+
+	changes := diffVersions(baseline.Versions, current)
+	if len(changes) == 0 {
+		fmt.Fprintf(os.Stderr, "no drift from %s\n", driftBaseline)
+		return nil
+	}
+	for _, change := range changes {
+		fmt.Fprintln(os.Stdout, change)
+	}
+	if driftNotify == "webhook" {
+		if err := postDriftNotification(http.DefaultClient, webhook, driftBaseline, changes); err != nil {
+			return err
+		}
+	}
+	os.Exit(1)
+	return nil
+}
+
+// postDriftNotification posts changes to a webhook
+func postDriftNotification(client *http.Client, webhook, baseline string, changes []string) error {
+	text := fmt.Sprintf("chamber: %d secrets changed since %s was recorded:\n%s", len(changes), baseline, strings.Join(changes, "\n"))
+	body, err := json.Marshal(driftNotification{Text: text, Baseline: baseline, Changes: changes})
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// the URL often holds a credential, so leave it out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("Failed to notify webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Failed to notify webhook: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostDriftNotification(t *testing.T) {
+	var received driftNotification
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer webhook.Close()
+
+	changes := []string{"~ app/db_password: version 3 -> 4"}
+	err := postDriftNotification(webhook.Client(), webhook.URL, "baseline.json", changes)
+	assert.NoError(t, err)
+	assert.Equal(t, driftNotification{
+		Text:     "chamber: 1 secrets changed since baseline.json was recorded:\n~ app/db_password: version 3 -> 4",
+		Baseline: "baseline.json",
+		Changes:  changes,
+	}, received)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer failing.Close()
+	err = postDriftNotification(failing.Client(), failing.URL+"/T000/secret", "baseline.json", changes)
+	assert.EqualError(t, err, "Failed to notify webhook: 403 Forbidden: invalid_token")
+
+	err = postDriftNotification(http.DefaultClient, "http://127.0.0.1:1/T000/secret", "baseline.json", changes)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+}
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/sts"
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// ecsGenCmd represents the ecs-gen command
+	ecsGenCmd = &cobra.Command{
+		Use:   "ecs-gen <service...> --task-def <file>",
+		Short: "Rewrite an ECS task definition to load the secrets of services natively",
+		Long: `Rewrite an ECS task definition to load the secrets of services natively.
+
+Every key of the services is added to the secrets of the container, named as
+chamber exec would name its environment variable, with valueFrom set to the
+ARN of its SSM parameter. Later services take precedence, as with exec.
+Variables of the same name are removed from the environment of the
+container, so that plaintext values are not left behind.
+
+The task definition may be one to register, or the output of aws ecs
+describe-task-definition. The account and region of the ARNs are those of the
+current credentials, unless --account-id and --region are given. The task
+execution role must be allowed to read the parameters and decrypt them.`,
+		Example: `
+	$ chamber ecs-gen app global --task-def task-def.json --container web -o task-def.json
+	$ aws ecs register-task-definition --cli-input-json file://task-def.json`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runECSGen,
+	}
+	ecsGenTaskDef   string
+	ecsGenContainer string
+	ecsGenOutput    string
+	ecsGenAccountID string
+	ecsGenRegion    string
+)
+
+func init() {
+	ecsGenCmd.Flags().StringVar(&ecsGenTaskDef, "task-def", "", "task definition JSON file to rewrite")
+	ecsGenCmd.Flags().StringVar(&ecsGenContainer, "container", "", "container to add the secrets to; required when there are several")
+	ecsGenCmd.Flags().StringVarP(&ecsGenOutput, "output-file", "o", "", "file to write the task definition to, instead of stdout")
+	ecsGenCmd.Flags().StringVar(&ecsGenAccountID, "account-id", "", "account of the parameters, instead of the account of the current credentials")
+	ecsGenCmd.Flags().StringVar(&ecsGenRegion, "region", "", "region of the parameters, instead of the configured region")
+	ecsGenCmd.MarkFlagRequired("task-def")
+	RootCmd.AddCommand(ecsGenCmd)
+}
+
+func runECSGen(cmd *cobra.Command, args []string) error {
+	services := make([]string, 0, len(args))
+	for _, arg := range args {
+		service := utils.NormalizeService(arg)
+		if err := validateService(service); err != nil {
+			return fmt.Errorf("Failed to validate service %s: %w", service, err)
+		}
+		services = append(services, service)
+	}
+
+	data, err := os.ReadFile(ecsGenTaskDef)
+	if err != nil {
+		return fmt.Errorf("Failed to read task definition: %w", err)
+	}
+	var taskDef map[string]interface{}
+	if err := json.Unmarshal(data, &taskDef); err != nil {
+		return fmt.Errorf("Failed to decode task definition: %w", err)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "ecs-gen").
+				Set("chamber-version", chamberVersion).
+				Set("services", services).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	ssmStore, ok := store.Unwrap(secretStore).(*store.SSMStore)
+	if !ok {
+		return errors.New("ecs-gen is only supported by the SSM backend, since ECS reads secrets from SSM parameters")
+	}
+
+	partition, accountID, region, err := ecsGenLocation(ecsGenAccountID, ecsGenRegion)
+	if err != nil {
+		return err
+	}
+
+	secrets := map[string]string{}
+	for _, service := range services {
+		parameters, err := ssmStore.List(service, false)
+		if err != nil {
+			return fmt.Errorf("Failed to list store contents for service %s: %w", service, err)
+		}
+		for _, parameter := range parameters {
+			if key(parameter.Meta.Key) == ManifestKey {
+				continue
+			}
+			name := strings.ToUpper(sanitizeKey(key(parameter.Meta.Key)))
+			if err := validateShellName(name); err != nil {
+				return err
+			}
+			secrets[name] = arn.ARN{
+				Partition: partition,
+				Service:   "ssm",
+				Region:    region,
+				AccountID: accountID,
+				Resource:  "parameter/" + strings.TrimPrefix(ssmStore.Prefix()+parameter.Meta.Key, "/"),
+			}.String()
+		}
+	}
+
+	if err := addECSSecrets(taskDef, ecsGenContainer, secrets); err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(taskDef, "", "  ")
+	if err != nil {
+		return err
+	}
+	out = append(out, '\n')
+	if ecsGenOutput == "" {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+	if err := os.WriteFile(ecsGenOutput, out, 0644); err != nil {
+		return fmt.Errorf("Failed to write task definition: %w", err)
+	}
+	return nil
+}
+
+// ecsGenLocation returns the partition, account and region of parameter
+// ARNs, asking AWS for whatever was not given
+func ecsGenLocation(accountID, region string) (string, string, string, error) {
+	session, sessionRegion, err := store.NewSession(numRetries)
+	if err != nil {
+		return "", "", "", err
+	}
+	if region == "" {
+		region = aws.StringValue(session.Config.Region)
+		if region == "" {
+			region = aws.StringValue(sessionRegion)
+		}
+	}
+	if region == "" {
+		return "", "", "", errors.New("no region is configured; set --region")
+	}
+
+	partition := "aws"
+	if accountID == "" {
+		identity, err := sts.New(session, &aws.Config{Region: aws.String(region)}).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+		if err != nil {
+			return "", "", "", fmt.Errorf("Failed to get caller identity: %w", err)
+		}
+		callerARN, err := arn.Parse(aws.StringValue(identity.Arn))
+		if err != nil {
+			return "", "", "", err
+		}
+		partition, accountID = callerARN.Partition, aws.StringValue(identity.Account)
+	} else if strings.HasPrefix(region, "cn-") {
+		partition = "aws-cn"
+	} else if strings.HasPrefix(region, "us-gov-") {
+		partition = "aws-us-gov"
+	}
+	return partition, accountID, region, nil
+}
+
+// addECSSecrets adds secrets, by variable name, to the container of taskDef
+// named container, replacing existing secrets and environment variables of
+// the same names. taskDef may be wrapped in a taskDefinition object, as
+// described by the ECS API.
+func addECSSecrets(taskDef map[string]interface{}, container string, secrets map[string]string) error {
+	if wrapped, ok := taskDef["taskDefinition"].(map[string]interface{}); ok {
+		taskDef = wrapped
+	}
+	definitions, ok := taskDef["containerDefinitions"].([]interface{})
+	if !ok || len(definitions) == 0 {
+		return errors.New("task definition has no containerDefinitions")
+	}
+
+	var target map[string]interface{}
+	names := []string{}
+	for _, d := range definitions {
+		definition, ok := d.(map[string]interface{})
+		if !ok {
+			return errors.New("invalid containerDefinitions")
+		}
+		name, _ := definition["name"].(string)
+		names = append(names, name)
+		if name == container || (container == "" && len(definitions) == 1) {
+			target = definition
+		}
+	}
+	if target == nil {
+		if container == "" {
+			return fmt.Errorf("task definition has several containers, choose one with --container: %s", strings.Join(names, ", "))
+		}
+		return fmt.Errorf("task definition has no container %s", container)
+	}
+
+	environment := []interface{}{}
+	existing, _ := target["environment"].([]interface{})
+	for _, e := range existing {
+		if variable, ok := e.(map[string]interface{}); ok {
+			if _, replaced := secrets[fmt.Sprint(variable["name"])]; replaced {
+				continue
+			}
+		}
+		environment = append(environment, e)
+	}
+	if existing != nil {
+		target["environment"] = environment
+	}
+
+	kept := []interface{}{}
+	existing, _ = target["secrets"].([]interface{})
+	for _, s := range existing {
+		if secret, ok := s.(map[string]interface{}); ok {
+			if _, replaced := secrets[fmt.Sprint(secret["name"])]; replaced {
+				continue
+			}
+		}
+		kept = append(kept, s)
+	}
+	added := make([]string, 0, len(secrets))
+	for name := range secrets {
+		added = append(added, name)
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		kept = append(kept, map[string]interface{}{"name": name, "valueFrom": secrets[name]})
+	}
+	target["secrets"] = kept
+	return nil
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddECSSecrets(t *testing.T) {
+	secrets := map[string]string{
+		"DB_PASSWORD": "arn:aws:ssm:us-east-1:123456789012:parameter/app/db_password",
+		"API_KEY":     "arn:aws:ssm:us-east-1:123456789012:parameter/app/api_key",
+	}
+
+	t.Run("replaces environment variables and secrets of the same name", func(t *testing.T) {
+		var taskDef map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(`{
+			"family": "app",
+			"containerDefinitions": [{
+				"name": "web",
+				"environment": [{"name": "DB_PASSWORD", "value": "hunter22"}, {"name": "PORT", "value": "80"}],
+				"secrets": [{"name": "API_KEY", "valueFrom": "old"}, {"name": "OTHER", "valueFrom": "other"}]
+			}]
+		}`), &taskDef))
+
+		assert.NoError(t, addECSSecrets(taskDef, "", secrets))
+		out, err := json.Marshal(taskDef)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{
+			"family": "app",
+			"containerDefinitions": [{
+				"name": "web",
+				"environment": [{"name": "PORT", "value": "80"}],
+				"secrets": [
+					{"name": "OTHER", "valueFrom": "other"},
+					{"name": "API_KEY", "valueFrom": "arn:aws:ssm:us-east-1:123456789012:parameter/app/api_key"},
+					{"name": "DB_PASSWORD", "valueFrom": "arn:aws:ssm:us-east-1:123456789012:parameter/app/db_password"}
+				]
+			}]
+		}`, string(out))
+	})
+
+	t.Run("chooses a container of a described task definition", func(t *testing.T) {
+		var taskDef map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(`{"taskDefinition": {"containerDefinitions": [{"name": "web"}, {"name": "worker"}]}}`), &taskDef))
+
+		assert.EqualError(t, addECSSecrets(taskDef, "", secrets), "task definition has several containers, choose one with --container: web, worker")
+		assert.EqualError(t, addECSSecrets(taskDef, "db", secrets), "task definition has no container db")
+		assert.NoError(t, addECSSecrets(taskDef, "worker", secrets))
+
+		containers := taskDef["taskDefinition"].(map[string]interface{})["containerDefinitions"].([]interface{})
+		assert.NotContains(t, containers[0], "secrets")
+		assert.Len(t, containers[1].(map[string]interface{})["secrets"], 2)
+	})
+
+	t.Run("requires container definitions", func(t *testing.T) {
+		assert.Error(t, addECSSecrets(map[string]interface{}{}, "", secrets))
+	})
+}
@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	osexec "os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	editFormat string
+	editYes    bool
+
+	// editCmd represents the edit command
+	editCmd = &cobra.Command{
+		Use:   "edit <service>",
+		Short: "Edit the secrets of a service in $EDITOR",
+		Long: `Edit the secrets of a service in $EDITOR.
+
+The secrets are written to a temporary file, as YAML or dotenv, which is
+opened in $VISUAL or $EDITOR. Once the editor exits, keys added are created,
+keys whose value changed are updated and keys removed are deleted, after a
+summary of the changes, with values masked, is confirmed. Secrets Manager
+applies every change in a single write; other backends apply them one at a
+time and, if any change fails, roll back those already applied. If the edited
+file can't be parsed, the editor can be reopened on it to fix the mistake; the
+temporary file is always deleted once chamber exits.`,
+		Example: `
+	$ chamber edit app
+	$ EDITOR="code --wait" chamber edit app --format dotenv`,
+		Args: cobra.ExactArgs(1),
+		RunE: runEdit,
+	}
+)
+
+func init() {
+	editCmd.Flags().StringVar(&editFormat, "format", "yaml", "format to edit the secrets in: yaml or dotenv")
+	editCmd.Flags().BoolVar(&editYes, "yes", false, "apply the changes without asking for confirmation")
+	RootCmd.AddCommand(editCmd)
+}
+
+// runEditor opens path in the editor of the user, waiting for it to exit
+var runEditor = func(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	// the editor may be given with arguments, e.g. code --wait
+	name, args := shellCommand(defaultShell(), []string{editor, shellescape.Quote(path)})
+	c := osexec.Command(name, args...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("Failed to run editor %s: %w", editor, err)
+	}
+	return nil
+}
+
+func runEdit(cmd *cobra.Command, args []string) error {
+	service := utils.NormalizeService(args[0])
+	if err := validateService(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+	if editFormat != "yaml" && editFormat != "dotenv" {
+		return fmt.Errorf("Unsupported format: %s", editFormat)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "edit").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("format", editFormat).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	if secretStore, err = withKMSKey(secretStore, service, ""); err != nil {
+		return err
+	}
+
+	// a new service may not exist yet
+	existing, err := secretStore.ListRaw(service)
+	if err != nil && !errors.Is(err, store.ErrSecretNotFound) {
+		return fmt.Errorf("Failed to list store contents: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeEditBuffer(&buf, service, existing, editFormat); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp("", "chamber-edit-*."+editFormat)
+	if err != nil {
+		return fmt.Errorf("Failed to create temporary file: %w", err)
+	}
+	path := file.Name()
+	defer os.Remove(path)
+	_, err = file.Write(buf.Bytes())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to write temporary file: %w", err)
+	}
+
+	answers := bufio.NewReader(os.Stdin)
+	var changes []importChange
+	for {
+		if err := runEditor(path); err != nil {
+			return err
+		}
+		edited, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Failed to read edited secrets: %w", err)
+		}
+		if bytes.Equal(edited, buf.Bytes()) {
+			fmt.Fprintln(os.Stderr, "Edit cancelled, no changes made")
+			return nil
+		}
+		if changes, err = planEdit(existing, edited, editFormat); err == nil {
+			break
+		}
+		// rather than leave the secrets typed on disk, offer to fix the typo
+		fmt.Fprintf(os.Stderr, "%s\nEdit again? [y/N] ", err)
+		again, readErr := readConfirmation(answers)
+		if readErr != nil || !again {
+			return err
+		}
+	}
+	if !importChanges(changes) {
+		fmt.Fprintln(os.Stderr, "No changes made")
+		return nil
+	}
+
+	if err := writeImportPlan(os.Stderr, changes, false); err != nil {
+		return err
+	}
+	if !editYes {
+		fmt.Fprintf(os.Stderr, "Apply these changes to %s? [y/N] ", service)
+		ok, err := readConfirmation(answers)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("Edit aborted")
+		}
+	}
+
+	if err := applyEdit(secretStore, service, changes); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Applied %d changes to %s\n", countEditChanges(changes), service)
+	return nil
+}
+
+// writeEditBuffer writes the secrets of service to edit in format, after
+// comments explaining how. Keys chamber keeps for itself are left out.
+func writeEditBuffer(w io.Writer, service string, existing []store.RawSecret, format string) error {
+	values := make(map[string]string, len(existing))
+	for _, rawSecret := range existing {
+		if k := key(rawSecret.Key); !pruneProtected[k] {
+			values[k] = rawSecret.Value
+		}
+	}
+
+	fmt.Fprintf(w, "# Editing the secrets of %s. Add keys to create them, change values\n", service)
+	fmt.Fprintf(w, "# to update them and remove keys to delete them. Lines starting with #\n")
+	fmt.Fprintf(w, "# are ignored, and leaving the file unchanged cancels the edit.\n")
+	if format == "yaml" {
+		if len(values) == 0 {
+			return nil
+		}
+		return exportAsYaml(values, w)
+	}
+	for _, k := range sortedKeys(values) {
+		if _, err := fmt.Fprintf(w, "%s=\"%s\"\n", k, doubleQuoteEscape(values[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planEdit lists what the edited buffer does to the existing secrets
+func planEdit(existing []store.RawSecret, edited []byte, format string) ([]importChange, error) {
+	values, err := parseImport(edited, format)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse edited secrets: %w", err)
+	}
+	for k := range values {
+		if err := validateKey(k); err != nil {
+			return nil, fmt.Errorf("Failed to validate key %s: %w", k, err)
+		}
+		if pruneProtected[k] {
+			return nil, fmt.Errorf("%s is kept by chamber and cannot be edited", k)
+		}
+	}
+	return planImport(existing, values, values, true), nil
+}
+
+// applyEdit makes changes to the secrets of service. Backends holding a
+// service in one object make them all in a single write. Others change one
+// secret at a time, in order, so if a change fails, those already made are
+// undone.
+func applyEdit(s store.Store, service string, changes []importChange) error {
+	if w, ok := store.Unwrap(s).(store.BatchWriter); ok {
+		values := map[string]string{}
+		var deleted []string
+		for _, c := range changes {
+			switch c.Action {
+			case ImportCreate, ImportChange:
+				values[c.Key] = c.New
+			case ImportDelete:
+				deleted = append(deleted, c.Key)
+			}
+		}
+		if err := w.WriteBatch(service, values, deleted); err != nil {
+			return fmt.Errorf("Failed to apply changes: %w", err)
+		}
+		return nil
+	}
+
+	apply := func(c importChange) error {
+		id := store.SecretId{Service: service, Key: c.Key}
+		switch c.Action {
+		case ImportCreate, ImportChange:
+			return s.Write(id, c.New)
+		case ImportDelete:
+			return s.Delete(id)
+		}
+		return nil
+	}
+	undo := func(c importChange) error {
+		id := store.SecretId{Service: service, Key: c.Key}
+		switch c.Action {
+		case ImportCreate:
+			return s.Delete(id)
+		case ImportChange, ImportDelete:
+			return s.Write(id, c.Old)
+		}
+		return nil
+	}
+
+	var applied []importChange
+	for _, c := range changes {
+		if c.Action == ImportUntouched {
+			continue
+		}
+		err := apply(c)
+		if err == nil {
+			applied = append(applied, c)
+			continue
+		}
+		err = fmt.Errorf("Failed to apply changes to %s: %w", c.Key, err)
+
+		// undo the changes made, latest first
+		var undoErrs []string
+		for i := len(applied) - 1; i >= 0; i-- {
+			if undoErr := undo(applied[i]); undoErr != nil {
+				undoErrs = append(undoErrs, fmt.Sprintf("%s: %s", applied[i].Key, undoErr))
+			}
+		}
+		if len(undoErrs) > 0 {
+			return fmt.Errorf("%s; failed to roll back %d of %d changes: %s", err, len(undoErrs), len(applied), strings.Join(undoErrs, "; "))
+		}
+		return fmt.Errorf("%w; the %d changes made were rolled back", err, len(applied))
+	}
+	return nil
+}
+
+// countEditChanges counts the keys created, changed or deleted
+func countEditChanges(changes []importChange) int {
+	n := 0
+	for _, c := range changes {
+		if c.Action != ImportUntouched {
+			n++
+		}
+	}
+	return n
+}
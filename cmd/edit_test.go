@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditRoundTrip(t *testing.T) {
+	existing := []store.RawSecret{
+		{Key: "/app/db_password", Value: "hunter2"},
+		{Key: "/app/motd", Value: "line one\nline \"two\""},
+		{Key: "/app/" + ManifestKey, Value: "{}"},
+	}
+	for _, format := range []string{"yaml", "dotenv"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, writeEditBuffer(&buf, "app", existing, format))
+			assert.NotContains(t, buf.String(), ManifestKey)
+
+			changes, err := planEdit(existing, buf.Bytes(), format)
+			require.NoError(t, err)
+			assert.False(t, importChanges(changes), "an unchanged buffer changes nothing")
+		})
+	}
+}
+
+func TestEditParseFailure(t *testing.T) {
+	t.Setenv(BackendEnvVar, NullBackend)
+	defer func(previous string) { backend = previous }(backend)
+	defer func(previous func(string) error) { runEditor = previous }(runEditor)
+
+	var paths []string
+	runEditor = func(path string) error {
+		paths = append(paths, path)
+		return os.WriteFile(path, []byte("db_password: [unterminated\n"), 0600)
+	}
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	// reopen the editor once, then give up
+	_, err = w.WriteString("y\n")
+	require.NoError(t, err)
+	w.Close()
+	os.Stdin = r
+
+	err = runEdit(editCmd, []string{"app"})
+	assert.ErrorContains(t, err, "Failed to parse edited secrets")
+	require.Len(t, paths, 2)
+	assert.Equal(t, paths[0], paths[1], "the editor reopens on the same file")
+	assert.NoFileExists(t, paths[0], "the secrets typed are not left on disk")
+}
+
+func TestPlanEdit(t *testing.T) {
+	existing := []store.RawSecret{
+		{Key: "/app/db_password", Value: "hunter2"},
+		{Key: "/app/api_key", Value: "abc"},
+		{Key: "/app/" + ManifestKey, Value: "{}"},
+	}
+
+	changes, err := planEdit(existing, []byte("# comment\ndb_password: hunter3\ntoken: xyz\n"), "yaml")
+	require.NoError(t, err)
+	assert.Equal(t, []importChange{
+		{Key: "db_password", Action: ImportChange, Old: "hunter2", New: "hunter3"},
+		{Key: "token", Action: ImportCreate, New: "xyz"},
+		{Key: "api_key", Action: ImportDelete, Old: "abc"},
+	}, changes, "the manifest is never deleted")
+
+	_, err = planEdit(existing, []byte("db_password: [unclosed\n"), "yaml")
+	assert.Error(t, err)
+	_, err = planEdit(existing, []byte("bad key=x\n"), "dotenv")
+	assert.Error(t, err)
+	_, err = planEdit(existing, []byte(ManifestKey+": x\n"), "yaml")
+	assert.Error(t, err)
+}
+
+func TestApplyEdit(t *testing.T) {
+	setup := func(t *testing.T) store.Store {
+		s := store.NewMemoryStore()
+		require.NoError(t, s.Write(store.SecretId{Service: "app", Key: "db_password"}, "hunter2"))
+		require.NoError(t, s.Write(store.SecretId{Service: "app", Key: "api_key"}, "abc"))
+		return s
+	}
+	changes := []importChange{
+		{Key: "db_password", Action: ImportChange, Old: "hunter2", New: "hunter3"},
+		{Key: "token", Action: ImportCreate, New: "xyz"},
+		{Key: "api_key", Action: ImportDelete, Old: "abc"},
+	}
+	values := func(t *testing.T, s store.Store) map[string]string {
+		raw, err := s.ListRaw("app")
+		require.NoError(t, err)
+		values := map[string]string{}
+		for _, r := range raw {
+			values[key(r.Key)] = r.Value
+		}
+		return values
+	}
+
+	t.Run("applies", func(t *testing.T) {
+		s := setup(t)
+		require.NoError(t, applyEdit(s, "app", changes))
+		assert.Equal(t, map[string]string{"db_password": "hunter3", "token": "xyz"}, values(t, s))
+	})
+	t.Run("rolls back", func(t *testing.T) {
+		s := setup(t)
+		err := applyEdit(failingWriteStore{Store: s, failKey: "token"}, "app", changes)
+		assert.ErrorContains(t, err, "rolled back")
+		assert.Equal(t, map[string]string{"db_password": "hunter2", "api_key": "abc"}, values(t, s))
+	})
+	t.Run("writes once to batch writers", func(t *testing.T) {
+		s := &batchWriteStore{Store: setup(t)}
+		require.NoError(t, applyEdit(s, "app", changes))
+		assert.Equal(t, 1, s.writes)
+		assert.Equal(t, map[string]string{"db_password": "hunter3", "token": "xyz"}, values(t, s))
+	})
+}
+
+// batchWriteStore makes every change of a batch with the calls of the store
+// it wraps, counting the batches
+type batchWriteStore struct {
+	store.Store
+	writes int
+}
+
+func (s *batchWriteStore) WriteBatch(service string, values map[string]string, deleted []string) error {
+	s.writes++
+	for k, v := range values {
+		if err := s.Store.Write(store.SecretId{Service: service, Key: k}, v); err != nil {
+			return err
+		}
+	}
+	return store.DeleteBatch(s.Store, service, deleted)
+}
+
+func (s *batchWriteStore) Write(id store.SecretId, value string) error {
+	return errors.New("written one key at a time")
+}
@@ -5,9 +5,11 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/alessio/shellescape"
 	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
 	"github.com/segmentio/chamber/v2/utils"
 
 	"github.com/spf13/cobra"
@@ -26,12 +28,30 @@ var (
 	}
 	preserveCase   bool
 	escapeSpecials bool
+	// keyCollation orders keys in output; shared by list, env, export and exec,
+	// and bytewise unless --sort-keys is given
+	keyCollation string
+	// keyModified, when set, orders keys by when they were last modified,
+	// oldest first, before keyCollation; set by export --sort-by modified
+	keyModified map[string]time.Time
+	// yamlKeysSorted, when set, orders YAML keys like other formats rather
+	// than in yaml.v3's own order, which puts key2 before key10; set by
+	// export --sort-keys and --sort-by modified
+	yamlKeysSorted bool
+	// listSeparator, when set, joins the values of lists, like StringList
+	// parameters, instead of a comma; set by env and exec --list-separator
+	listSeparator string
 )
 
 func init() {
 	envCmd.Flags().SortFlags = false
 	envCmd.Flags().BoolVarP(&preserveCase, "preserve-case", "p", false, "preserve variable name case")
 	envCmd.Flags().BoolVarP(&escapeSpecials, "escape-strings", "e", false, "escape special characters in values")
+	envCmd.Flags().BoolVar(&interpolate, "interpolate", false, "resolve references to other keys of the same service, like {{ .db_user }}, in values")
+	envCmd.Flags().BoolVar(&recursive, "recursive", false, "load the services nested under the service too, like myapp/worker for myapp; deeper services take precedence")
+	envCmd.Flags().BoolVar(&expandJSON, "expand-json", false, "flatten secrets whose values are JSON objects into KEY_SUBKEY variables")
+	envCmd.Flags().StringVar(&keyCollation, "sort-keys", utils.CollationBytewise, sortKeysUsage)
+	envCmd.Flags().StringVar(&listSeparator, "list-separator", "", "join the values of lists, like SSM StringList parameters, with this rather than a comma")
 	RootCmd.AddCommand(envCmd)
 }
 
@@ -63,15 +83,30 @@ func exportEnv(cmd *cobra.Command, args []string) ([]string, error) {
 	if err := validateService(service); err != nil {
 		return nil, fmt.Errorf("Failed to validate service: %w", err)
 	}
+	if err := utils.ValidateCollation(keyCollation); err != nil {
+		return nil, fmt.Errorf("Invalid --sort-keys: %w", err)
+	}
 
 	secretStore, err := getSecretStore()
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get secret store: %w", err)
 	}
+	secretStore = withValueTransforms(secretStore)
 
-	rawSecrets, err := secretStore.ListRaw(service)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to list store contents: %w", err)
+	services := []string{service}
+	if recursive {
+		if services, err = withNestedServices(secretStore, services); err != nil {
+			return nil, err
+		}
+	}
+
+	var rawSecrets []store.RawSecret
+	for _, service := range services {
+		serviceSecrets, err := secretStore.ListRaw(service)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list store contents: %w", err)
+		}
+		rawSecrets = append(rawSecrets, serviceSecrets...)
 	}
 
 	if analyticsEnabled && analyticsClient != nil {
@@ -186,17 +221,25 @@ func doubleQuoteEscape(line string) string {
 	return line
 }
 
-// return the keys from params, sorted by keyname.
-// note that sort.Strings() is not case insensitive.
+// sortKeysUsage describes the --sort-keys flag of every command taking it
+const sortKeysUsage = "order keys in the output by this collation: bytewise, ignore-case or natural (key2 before key10); none depends on the locale"
+
+// return the keys from params, sorted by keyname with keyCollation.
+// by default keys are sorted bytewise, which is not case insensitive.
 // e.g. []string{"A", "b", "cat", "Dog", "dog"} will sort as:
-// []string{"A", "Dog", "b", "cat", "dog"}. That doesn't
-// really matter here but it may lead to surprises.
+// []string{"A", "Dog", "b", "cat", "dog"}. --sort-keys ignore-case
+// or natural pick another order.
 func sortedKeys(params map[string]string) []string {
 	keys := []string{}
 
 	for key := range params {
 		keys = append(keys, key)
 	}
-	sort.Strings(keys)
+	utils.SortKeys(keyCollation, keys)
+	if keyModified != nil {
+		sort.SliceStable(keys, func(i, j int) bool {
+			return keyModified[keys[i]].Before(keyModified[keys[j]])
+		})
+	}
 	return keys
 }
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Fail instead of warning when the command's environment and arguments take
+// more than this many bytes; zero only warns
+var maxEnvSize int
+
+// envSizeWarnRatio is the share of the platform limit from which exec warns
+const envSizeWarnRatio = 0.75
+
+// envLimits are the limits execve puts on the arguments and environment of a
+// command, as commonly configured. Zero means no limit.
+type envLimits struct {
+	// Total bounds the size of all arguments and variables, like ARG_MAX
+	Total int
+	// PerString bounds the size of any single variable, like MAX_ARG_STRLEN
+	PerString int
+}
+
+func platformEnvLimits() envLimits {
+	switch runtime.GOOS {
+	case "linux":
+		return envLimits{Total: 2 << 20, PerString: 128 << 10}
+	case "darwin":
+		return envLimits{Total: 1 << 20}
+	case "windows":
+		// per variable; the environment block as a whole is unbounded
+		return envLimits{PerString: 32767}
+	default:
+		return envLimits{}
+	}
+}
+
+// execSize returns how much of the execve limit argv and env use: every
+// string with its terminating NUL, plus a pointer to it
+func execSize(argv, env []string) int {
+	size := 0
+	for _, s := range append(append([]string{}, argv...), env...) {
+		size += len(s) + 1 + 8
+	}
+	return size
+}
+
+// largestVars names the n largest variables of env, largest first
+func largestVars(env []string, n int) []string {
+	sorted := append([]string{}, env...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	names := make([]string, 0, len(sorted))
+	for _, v := range sorted {
+		name, _, _ := strings.Cut(v, "=")
+		names = append(names, fmt.Sprintf("%s (%s)", name, formatBytes(len(v))))
+	}
+	return names
+}
+
+// checkEnvSize warns on out when argv and env come close to the limits, or
+// exceed a single variable limit, and fails when they exceed max
+func checkEnvSize(argv, env []string, limits envLimits, max int, out io.Writer) error {
+	size := execSize(argv, env)
+	if max > 0 && size > max {
+		return fmt.Errorf("command environment and arguments take %s, more than --max-env-size %s; largest variables: %s",
+			formatBytes(size), formatBytes(max), strings.Join(largestVars(env, 3), ", "))
+	}
+
+	if limits.Total > 0 && float64(size) > envSizeWarnRatio*float64(limits.Total) {
+		fmt.Fprintf(out, "warning: command environment and arguments take %s, close to the %s the OS allows; largest variables: %s\n",
+			formatBytes(size), formatBytes(limits.Total), strings.Join(largestVars(env, 3), ", "))
+	}
+	if limits.PerString > 0 {
+		for _, v := range env {
+			if len(v) >= limits.PerString {
+				name, _, _ := strings.Cut(v, "=")
+				fmt.Fprintf(out, "warning: variable %s takes %s, more than the %s the OS allows for a single variable\n",
+					name, formatBytes(len(v)), formatBytes(limits.PerString))
+			}
+		}
+	}
+	return nil
+}
+
+// formatBytes formats n with a binary unit, like 1.5 MiB
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
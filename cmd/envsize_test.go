@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckEnvSize(t *testing.T) {
+	env := []string{
+		"SMALL=1",
+		"BIG_JSON=" + strings.Repeat("x", 3000),
+		"MEDIUM=" + strings.Repeat("x", 1000),
+	}
+	argv := []string{"./server", "--port", "80"}
+	size := execSize(argv, env)
+
+	t.Run("no output below the limits", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		assert.NoError(t, checkEnvSize(argv, env, envLimits{Total: 100000, PerString: 10000}, 0, out))
+		assert.Empty(t, out.String())
+	})
+
+	t.Run("warns close to the total limit", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		assert.NoError(t, checkEnvSize(argv, env, envLimits{Total: size + 100}, 0, out))
+		assert.Contains(t, out.String(), "warning: command environment and arguments take 4.0 KiB")
+		assert.Contains(t, out.String(), "largest variables: BIG_JSON (2.9 KiB), MEDIUM (1007 B), SMALL (7 B)")
+	})
+
+	t.Run("warns about variables over the single variable limit", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		assert.NoError(t, checkEnvSize(argv, env, envLimits{PerString: 2048}, 0, out))
+		assert.Equal(t, "warning: variable BIG_JSON takes 2.9 KiB, more than the 2.0 KiB the OS allows for a single variable\n", out.String())
+	})
+
+	t.Run("fails above the maximum", func(t *testing.T) {
+		err := checkEnvSize(argv, env, envLimits{}, 2048, &bytes.Buffer{})
+		assert.EqualError(t, err, "command environment and arguments take 4.0 KiB, more than --max-env-size 2.0 KiB; largest variables: BIG_JSON (2.9 KiB), MEDIUM (1007 B), SMALL (7 B)")
+	})
+}
@@ -1,13 +1,25 @@
 package cmd
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	analytics "github.com/segmentio/analytics-go/v3"
 	"github.com/segmentio/chamber/v2/environ"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -17,12 +29,114 @@ var pristine bool
 // When true, enable strict mode, which checks that all secrets replace env vars with a special sentinel value
 var strict bool
 
-// Value to expect in strict mode
-var strictValue string
+// Values to expect in strict mode, literally or as regular expressions
+var (
+	strictValues       []string
+	strictValueRegexes []string
+)
+
+// Matches strictValues and strictValueRegexes; set when strict mode is engaged
+var strictPattern *regexp.Regexp
+
+// When true, enable strict mode where sentinels name the secret to substitute,
+// like chamber://service/key
+var strictTemplate bool
 
 // Default value to expect in strict mode
 const strictValueDefault = "chamberme"
 
+// Which inherited variables secrets may not overwrite: all of them with
+// --noclobber, only those listed with --noclobber-only, or all but those
+// matching --clobber-only
+var (
+	noclobber     bool
+	noclobberOnly []string
+	clobberOnly   []string
+)
+
+// Bounds on how long fetching secrets and running the command may take; zero
+// means no limit
+var (
+	backendTimeout   time.Duration
+	execTimeout      time.Duration
+	timeoutSignal    string
+	timeoutKillAfter time.Duration
+)
+
+// When true, services that don't exist are skipped with a warning
+var allowMissingService bool
+
+// When true, write secrets to files and export <KEY>_FILE variables instead
+var asFiles bool
+
+// When true, secret values are redacted from the command's output;
+// maskStderrOnly leaves stdout untouched for commands writing binary data
+var (
+	maskOutput     bool
+	maskStderrOnly bool
+)
+
+// When true, validate secrets against the usage annotations in the store
+// rather than against sentinel values in the environment
+var strictFromMetadata bool
+
+// When true, fail unless the secrets of every service with a manifest match it
+var strictFromManifest bool
+
+// When true, print the environment that would be injected instead of running the command
+var dryRun bool
+
+// When true, print secret values in --dry-run output rather than masking them
+var showValues bool
+
+// User and group to switch to before executing the command
+var execUser, execGroup string
+
+// Working directory and octal umask to run the command with; empty leaves
+// them unchanged
+var execChdir, execUmask string
+
+// Keys that must be provided by the requested services
+var (
+	requiredKeys     []string
+	requiredKeysFile string
+)
+
+// Keys to load at a given version, as service/key@version
+var keyPins []string
+
+// When true, secrets holding JSON objects are flattened into one variable per
+// field. Shared by exec, env and export.
+var expandJSON bool
+
+// When true, references between values like {{ .db_user }} are resolved.
+// Shared by exec, env and export.
+var interpolate bool
+
+// Where to write a signed startup attestation; empty disables attestations
+var attestSink string
+
+// ShellEnvVar names the shell used to run commands, as with --shell, when
+// --shell isn't given
+const ShellEnvVar = "CHAMBER_SHELL"
+
+// Shell to run the command with; empty runs it directly
+var execShell string
+
+// When true, rollout values are resolved to one of their candidates, chosen
+// from rolloutID
+var (
+	rollout   bool
+	rolloutID string
+)
+
+// ServicesEnvVar lists the services to load, separated by commas, when none
+// are given on the command line. Environment variables in it are expanded.
+const ServicesEnvVar = "CHAMBER_SERVICES"
+
+// maskedValue is printed in place of secret values unless --show-values is passed
+const maskedValue = "********"
+
 // execCmd represents the exec command
 var execCmd = &cobra.Command{
 	Use:   "exec <service...> -- <command> [<arg...>]",
@@ -32,15 +146,15 @@ var execCmd = &cobra.Command{
 		if dashIx == -1 {
 			return errors.New("please separate services and command with '--'. See usage")
 		}
-		if err := cobra.MinimumNArgs(1)(cmd, args[:dashIx]); err != nil {
-			return fmt.Errorf("at least one service must be specified: %w", err)
+		if err := cobra.MinimumNArgs(1)(cmd, args[:dashIx]); err != nil && os.Getenv(ServicesEnvVar) == "" {
+			return fmt.Errorf("at least one service must be specified, or $%s set: %w", ServicesEnvVar, err)
 		}
 		if err := cobra.MinimumNArgs(1)(cmd, args[dashIx:]); err != nil {
 			return fmt.Errorf("must specify command to run. See usage: %w", err)
 		}
 		return nil
 	},
-	RunE: execRun,
+	RunE: execRunReportingOutcome,
 	Example: `
 Given a secret store like this:
 
@@ -52,6 +166,44 @@ Given a secret store like this:
 	chamber: extra unfilled env var EXTRA
 	exit 1
 
+--strict reports every problem at once, optionally as JSON with --output json
+
+	$ DB_USERNAME=chamberme EXTRA=chamberme OTHER=chamberme chamber exec --strict --output json service -- env
+	{
+	  "problems": [
+	    {
+	      "type": "missing",
+	      "key": "EXTRA",
+	      "expected": "chamberme"
+	    },
+	    {
+	      "type": "missing",
+	      "key": "OTHER",
+	      "expected": "chamberme"
+	    }
+	  ]
+	}
+
+--strict-value and --strict-value-regex may be repeated to accept several values
+
+	$ DB_USERNAME=chamberme DB_PASSWORD=CHAMBER_SECRET chamber exec --strict --strict-value chamberme --strict-value-regex 'CHAMBER(.*)' service -- env
+	DB_USERNAME=root
+	DB_PASSWORD=hunter22
+
+--strict-template lets env vars name the secret to inject, mixing services
+
+	$ PGPASSWORD=chamber://db/password API_TOKEN=chamber://api/token chamber exec --strict-template db api -- env
+	PGPASSWORD=hunter22
+	API_TOKEN=abc123
+
+--dry-run shows what would be injected without running anything
+
+	$ DB_USERNAME=admin chamber exec --dry-run service -- env
+	Variable     Service  Value     Action
+	DB_PASSWORD  service  ********  new
+	DB_USERNAME  service  ********  clobbers existing value
+	would run: env
+
 --pristine takes effect after checking for --strict values
 
 	$ HOME=/tmp DB_USERNAME=chamberme DB_PASSWORD=chamberme chamber exec --strict --pristine service exec -- env
@@ -66,7 +218,49 @@ func init() {
 only inject secrets for which there is a corresponding env var with value
 <strict-value>, and fail if there are any env vars with that value missing
 from secrets`)
-	execCmd.Flags().StringVar(&strictValue, "strict-value", strictValueDefault, "value to expect in --strict mode")
+	execCmd.Flags().StringArrayVar(&strictValues, "strict-value", []string{strictValueDefault}, "value to expect in --strict mode; may be repeated to accept several values")
+	execCmd.Flags().StringArrayVar(&strictValueRegexes, "strict-value-regex", nil, "regular expression matching the whole of the values to expect in --strict mode, instead of "+strictValueDefault+"; may be repeated")
+	execCmd.Flags().BoolVar(&strictTemplate, "strict-template", false, `enable strict mode where env vars name the secret to inject, like
+PGPASSWORD=`+environ.StrictTemplatePrefix+`service/key; the service must be one of those requested`)
+	execCmd.Flags().BoolVar(&strictFromMetadata, "strict-from-metadata", false, `enable strict mode using the usage annotations stored with secrets
+(see chamber annotate): only inject annotated secrets, and fail if
+any required secret is missing or empty`)
+	execCmd.Flags().StringVar(&keyCollation, "sort-keys", utils.CollationBytewise, "report --strict problems ordered by key using this collation, rather than grouped by kind: bytewise, ignore-case or natural; also orders --dry-run output")
+	execCmd.Flags().BoolVar(&strictFromManifest, "strict-from-manifest", false, "fail if a service with a manifest (see chamber manifest) is missing a required key, or has a value of the wrong type")
+	execCmd.Flags().BoolVar(&noclobber, "noclobber", false, "keep the value of variables already set in the environment instead of overwriting them with secrets")
+	execCmd.Flags().StringSliceVar(&noclobberOnly, "noclobber-only", nil, "comma separated variables whose existing value is kept; secrets overwrite all others")
+	execCmd.Flags().StringSliceVar(&clobberOnly, "clobber-only", nil, "comma separated globs of variables secrets may overwrite; the existing value of all others is kept")
+	execCmd.Flags().DurationVar(&backendTimeout, "backend-timeout", 0, "fail if fetching secrets takes longer than this, e.g. 30s")
+	execCmd.Flags().DurationVar(&execTimeout, "timeout", 0, "stop the command if it runs longer than this, exiting with status 124")
+	execCmd.Flags().StringVar(&timeoutSignal, "timeout-signal", "TERM", "signal sent to the command when --timeout expires")
+	execCmd.Flags().DurationVar(&timeoutKillAfter, "kill-after", 10*time.Second, "send SIGKILL this long after --timeout-signal if the command is still running")
+	execCmd.Flags().BoolVar(&allowMissingService, "allow-missing-service", false, "warn about and skip requested services that don't exist or have no secrets, instead of failing")
+	execCmd.Flags().BoolVar(&watch, "watch", false, "restart the command when the secrets of its services change, logging the keys and versions that changed")
+	execCmd.Flags().DurationVar(&watchInterval, "watch-interval", time.Minute, "how often --watch checks for changes")
+	execCmd.Flags().IntVar(&maxEnvSize, "max-env-size", 0, "fail before running the command if its environment and arguments take more than this many bytes; by default chamber only warns when they come close to the OS limit")
+	execCmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the variables that would be injected, and where they come from, without running the command")
+	execCmd.Flags().BoolVar(&showValues, "show-values", false, "print secret values instead of masking them in --dry-run output")
+	execCmd.Flags().BoolVar(&rollout, "rollout", false, "resolve secrets holding weighted candidate values to one of them, chosen deterministically for this host")
+	execCmd.Flags().StringVar(&rolloutID, "rollout-id", "", "identity of this host for --rollout; defaults to the EC2 instance ID, or the hostname outside EC2")
+	execCmd.Flags().BoolVar(&recursive, "recursive", false, "load the services nested under each requested service too, like myapp/worker for myapp; deeper services take precedence")
+	execCmd.Flags().BoolVar(&expandJSON, "expand-json", false, "flatten secrets whose values are JSON objects into KEY_SUBKEY variables")
+	execCmd.Flags().StringVar(&listSeparator, "list-separator", "", "join the values of lists, like SSM StringList parameters, with this rather than a comma")
+	execCmd.Flags().BoolVar(&interpolate, "interpolate", false, "resolve references to other keys of the same service, like {{ .db_user }}, in values")
+	execCmd.Flags().StringSliceVar(&requiredKeys, "required", nil, "comma separated keys that must be present in the requested services; fail before running the command if any are missing")
+	execCmd.Flags().StringArrayVar(&keyPins, "pin", nil, "load a key at a given version, as service/key@version; may be repeated")
+	execCmd.Flags().StringVar(&requiredKeysFile, "required-file", "", "file listing required keys, one per line; blank lines and lines starting with # are ignored")
+	execCmd.Flags().StringVar(&attestSink, "attest", "", "write a signed startup attestation (services, key versions, no values) to stdout, stderr, a file or s3://bucket/prefix; signed with $"+AttestationKeyEnvVar)
+	execCmd.Flags().StringVar(&reportOutcome, "report-outcome", "", "report whether secrets were fetched, how long that took, whether the command started and its exit code, as a line of JSON written to stderr, stdout or appended to a file; also sent as an analytics event where analytics are enabled")
+	execCmd.Flags().Lookup("report-outcome").NoOptDefVal = "stderr"
+	execCmd.Flags().BoolVar(&asFiles, "as-files", false, "write each secret to a file on a tmpfs where available and set <KEY>_FILE to its path instead of <KEY>; files are removed when the command exits")
+	execCmd.Flags().BoolVar(&maskOutput, "mask-output", false, "replace injected secret values with *** in the command's stdout and stderr, e.g. for CI logs")
+	execCmd.Flags().BoolVar(&maskStderrOnly, "mask-stderr-only", false, "with --mask-output, only redact stderr and pass stdout through untouched, for commands writing binary data")
+	execCmd.Flags().StringVar(&execShell, "shell", "", "run the command with a shell, as in sh -c '<command> <args...>', so pipes and && can be used; --shell=<program> picks the shell, which defaults to sh, or cmd on Windows; $"+ShellEnvVar+" sets it too")
+	execCmd.Flags().Lookup("shell").NoOptDefVal = defaultShell()
+	execCmd.Flags().StringVar(&execUser, "user", "", "user name or uid to switch to after fetching secrets and before running the command; a uid without a passwd entry needs --group")
+	execCmd.Flags().StringVar(&execChdir, "chdir", "", "directory to change to before running the command, after switching --user")
+	execCmd.Flags().StringVar(&execUmask, "umask", "", "octal umask to run the command with, e.g. 027")
+	execCmd.Flags().StringVar(&execGroup, "group", "", "group name or gid to switch to after fetching secrets; defaults to the primary group of --user")
 	RootCmd.AddCommand(execCmd)
 }
 
@@ -74,6 +268,20 @@ func execRun(cmd *cobra.Command, args []string) error {
 	dashIx := cmd.ArgsLenAtDash()
 	services, command, commandArgs := args[:dashIx], args[dashIx], args[dashIx+1:]
 
+	if len(services) == 0 {
+		var err error
+		if services, err = servicesFromEnv(os.Getenv(ServicesEnvVar), os.LookupEnv); err != nil {
+			return err
+		}
+	}
+
+	if shell := os.Getenv(ShellEnvVar); !cmd.Flags().Changed("shell") && shell != "" {
+		execShell = shell
+	}
+	if execShell != "" {
+		command, commandArgs = shellCommand(execShell, args[dashIx:])
+	}
+
 	if analyticsEnabled && analyticsClient != nil {
 		analyticsClient.Enqueue(analytics.Track{
 			UserId: username,
@@ -86,33 +294,244 @@ func execRun(cmd *cobra.Command, args []string) error {
 		})
 	}
 
+	services, err := parseServicePins(services)
+	if err != nil {
+		return err
+	}
 	for _, service := range services {
+		if isServiceGlob(service) {
+			if err := validateServiceGlob(service); err != nil {
+				return err
+			}
+			continue
+		}
 		if err := validateServiceWithLabel(service); err != nil {
 			return fmt.Errorf("Failed to validate service: %w", err)
 		}
 	}
 
+	// problems are only reordered when asked to, and grouped by kind otherwise
+	sortProblems := cmd.Flags().Changed("sort-keys")
+	if err := utils.ValidateCollation(keyCollation); err != nil {
+		return fmt.Errorf("Invalid --sort-keys: %w", err)
+	}
+
+	if maskStderrOnly && !maskOutput {
+		return errors.New("--mask-stderr-only requires --mask-output")
+	}
+
+	var startDir string
+	if watch {
+		if execUser != "" || execGroup != "" {
+			return errors.New("--watch cannot be used with --user or --group, since chamber must keep its privileges to restart the command")
+		}
+		if watchInterval <= 0 {
+			return errors.New("--watch-interval must be positive")
+		}
+		if startDir, err = os.Getwd(); err != nil {
+			return fmt.Errorf("Failed to get working directory: %w", err)
+		}
+	}
+
+	umask := -1
+	if execUmask != "" {
+		if umask, err = parseUmask(execUmask); err != nil {
+			return err
+		}
+	}
+
+	stopWatchdog := func() {}
+	timeout := childTimeout{After: execTimeout, KillAfter: timeoutKillAfter}
+	if execTimeout > 0 {
+		if timeout.Signal, err = parseSignal(timeoutSignal); err != nil {
+			return fmt.Errorf("Invalid --timeout-signal: %w", err)
+		}
+	}
+
+	if backendTimeout > 0 {
+		// the store interface can't be cancelled, so give up on the whole
+		// process rather than on individual calls
+		watchdog := time.AfterFunc(backendTimeout, func() {
+			fmt.Fprintf(os.Stderr, "Error: timed out after %s fetching secrets\n", backendTimeout)
+			if reportOutcome != "" {
+				reportExecOutcome(fmt.Errorf("timed out after %s fetching secrets", backendTimeout))
+				postrun(cmd, args)
+			}
+			os.Exit(1)
+		})
+		// secrets have all been fetched by the time the command runs
+		defer watchdog.Stop()
+		stopWatchdog = func() { watchdog.Stop() }
+	}
+
+	if rollout && rolloutID == "" {
+		if rolloutID, err = defaultRolloutID(); err != nil {
+			return fmt.Errorf("Failed to identify host for --rollout: %w", err)
+		}
+		if verbose {
+			fmt.Fprintf(os.Stderr, "chamber: choosing rollout values for %s\n", rolloutID)
+		}
+	}
+
+	currentOutcome.startFetch(time.Now())
 	secretStore, err := getSecretStore()
 	if err != nil {
 		return fmt.Errorf("Failed to get secret store: %w", err)
 	}
+	services, unmatched, err := expandServiceGlobs(secretStore, services)
+	if err != nil {
+		return err
+	}
+	if len(unmatched) > 0 {
+		if !allowMissingService {
+			return fmt.Errorf("no services match %s", strings.Join(unmatched, ", "))
+		}
+		for _, pattern := range unmatched {
+			fmt.Fprintf(os.Stderr, "warning: no services match %s, skipping\n", pattern)
+		}
+	}
+	if recursive {
+		if services, err = withNestedServices(secretStore, services); err != nil {
+			return err
+		}
+	}
+
+	// before loading, so that changes made while loading cause a restart
+	var initialVersions map[string]int
+	if watch {
+		if initialVersions, err = secretVersions(secretStore, services); err != nil {
+			return err
+		}
+	}
+	// once globs are expanded, so that keys of matching services can be pinned
+	versions, err := parseKeyPins(keyPins, services)
+	if err != nil {
+		return err
+	}
+	// manifests are read from the store, rather than the values loaded
+	manifests := secretStore
+	if len(versions) > 0 {
+		secretStore = store.NewVersionPinnedStore(secretStore, versions)
+	}
+	secretStore = withValueTransforms(secretStore)
 	_, noPaths := os.LookupEnv("CHAMBER_NO_PATHS")
 
+	if strictFromManifest {
+		found, err := checkServiceManifests(manifests, secretStore, services, true)
+		if err != nil {
+			return err
+		}
+		if len(found) > 0 {
+			printManifestProblems(os.Stderr, found)
+			return fmt.Errorf("secrets of %d services do not match their manifests", len(found))
+		}
+	}
+
 	if pristine && verbose {
 		fmt.Fprintf(os.Stderr, "chamber: pristine mode engaged\n")
 	}
 
+	if allowMissingService {
+		present, missing, err := presentServices(secretStore, services)
+		if err != nil {
+			return fmt.Errorf("Failed to list store contents: %w", err)
+		}
+		for _, service := range missing {
+			fmt.Fprintf(os.Stderr, "warning: service %s does not exist or has no secrets, skipping\n", service)
+		}
+		if len(missing) > 0 {
+			fmt.Fprintf(os.Stderr, "chamber: loaded %d of %d services; missing: %s\n", len(present), len(services), strings.Join(missing, ", "))
+		}
+		services = present
+	}
+
+	// the global --output prints the problems found in strict mode
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+
+	strictModes := 0
+	for _, enabled := range []bool{strict, strictFromMetadata, strictTemplate} {
+		if enabled {
+			strictModes++
+		}
+	}
+	clobberPolicies := 0
+	for _, enabled := range []bool{noclobber, len(noclobberOnly) > 0, len(clobberOnly) > 0} {
+		if enabled {
+			clobberPolicies++
+		}
+	}
+	if clobberPolicies > 1 {
+		return errors.New("only one of --noclobber, --noclobber-only and --clobber-only can be used")
+	}
+	for _, glob := range clobberOnly {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return fmt.Errorf("Invalid --clobber-only glob %q: %w", glob, err)
+		}
+	}
+
+	if strictModes > 1 {
+		return errors.New("only one of --strict, --strict-from-metadata and --strict-template can be used")
+	}
+
+	// --mask-output hides the secret values read while loading the environment
+	var loadStore store.Store = secretStore
+	var recorder *recordingStore
+	if maskOutput {
+		recorder = newRecordingStore(secretStore)
+		loadStore = recorder
+	}
+
 	var env environ.Environ
-	if strict {
+	if strictFromMetadata {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "chamber: strict mode engaged using store metadata\n")
+		}
+		if !pristine {
+			env = environ.Environ(os.Environ())
+		}
+		if err := loadFromMetadata(&env, loadStore, services); err != nil {
+			return err
+		}
+	} else if strict || strictTemplate {
 		if verbose {
 			fmt.Fprintf(os.Stderr, "chamber: strict mode engaged\n")
 		}
-		var err error
+		literals := strictValues
+		if len(strictValueRegexes) > 0 && !cmd.Flags().Changed("strict-value") {
+			literals = nil
+		}
+		strictPattern, err = strictValuePattern(literals, strictValueRegexes)
+		if err != nil {
+			return err
+		}
 		env = environ.Environ(os.Environ())
-		if noPaths {
-			err = env.LoadStrictNoPaths(secretStore, strictValue, pristine, services...)
-		} else {
-			err = env.LoadStrict(secretStore, strictValue, pristine, services...)
+		switch {
+		case strictTemplate && noPaths:
+			err = env.LoadStrictTemplateNoPaths(loadStore, pristine, services...)
+		case strictTemplate:
+			err = env.LoadStrictTemplate(loadStore, pristine, services...)
+		case len(literals) == 1 && len(strictValueRegexes) == 0 && noPaths:
+			// a single literal value keeps errors readable
+			err = env.LoadStrictNoPaths(loadStore, literals[0], pristine, services...)
+		case len(literals) == 1 && len(strictValueRegexes) == 0:
+			err = env.LoadStrict(loadStore, literals[0], pristine, services...)
+		case noPaths:
+			err = env.LoadStrictMatchingNoPaths(loadStore, strictPattern, pristine, services...)
+		default:
+			err = env.LoadStrictMatching(loadStore, strictPattern, pristine, services...)
+		}
+		problems, isProblems := environ.StrictProblems(err)
+		if isProblems && sortProblems {
+			problems.SortByKey(func(a, b string) int { return utils.CompareKeys(keyCollation, a, b) })
+		}
+		if isProblems && structured {
+			if err := printStrictProblems(os.Stdout, problems); err != nil {
+				return err
+			}
+			return fmt.Errorf("strict mode found %d problems", len(problems.Problems))
 		}
 		if err != nil {
 			return err
@@ -126,23 +545,734 @@ func execRun(cmd *cobra.Command, args []string) error {
 			var err error
 			// TODO: these interfaces should look the same as Strict*, so move pristine in there
 			if noPaths {
-				err = env.LoadNoPaths(secretStore, service, &collisions)
+				err = env.LoadNoPaths(loadStore, service, &collisions)
 			} else {
-				err = env.Load(secretStore, service, &collisions)
+				err = env.Load(loadStore, service, &collisions)
 			}
 			if err != nil {
 				return fmt.Errorf("Failed to list store contents: %w", err)
 			}
 
 			for _, c := range collisions {
+				if keepsParentValue(c) {
+					continue
+				}
 				fmt.Fprintf(os.Stderr, "warning: service %s overwriting environment variable %s\n", service, c)
 			}
 		}
+		if !pristine {
+			parent := environ.Environ(os.Environ())
+			restoreParentValues(&env, parent.Map())
+		}
+	}
+
+	required := requiredKeys
+	if requiredKeysFile != "" {
+		fromFile, err := readRequiredKeys(requiredKeysFile)
+		if err != nil {
+			return fmt.Errorf("Failed to read required keys: %w", err)
+		}
+		required = append(required, fromFile...)
+	}
+
+	var sources map[string]string
+	if dryRun || len(required) > 0 || asFiles {
+		sources, err = envSources(secretStore, services, noPaths)
+		if err != nil {
+			return fmt.Errorf("Failed to list store contents: %w", err)
+		}
+	}
+
+	if missing := missingRequired(required, sources); len(missing) > 0 {
+		return fmt.Errorf("required secrets missing from %s: %s", strings.Join(services, ", "), strings.Join(missing, ", "))
+	}
+	currentOutcome.finishFetch(time.Now(), services)
+
+	if dryRun {
+		printDryRun(os.Stdout, environ.Environ(os.Environ()), env, sources)
+		fmt.Fprintf(os.Stdout, "would run: %s\n", strings.Join(append([]string{command}, commandArgs...), " "))
+		return nil
+	}
+
+	if attestSink != "" {
+		a, err := buildAttestation(secretStore, services, command)
+		if err != nil {
+			return fmt.Errorf("Failed to build attestation: %w", err)
+		}
+		if err := writeAttestation(attestSink, a); err != nil {
+			return fmt.Errorf("Failed to write attestation: %w", err)
+		}
 	}
 
 	if verbose {
 		fmt.Fprintf(os.Stdout, "info: With environment %s\n", strings.Join(env, ","))
 	}
 
+	stopWatchdog()
+
+	dropPrivs := execUser != "" || execGroup != ""
+	uid, gid, groups := -1, -1, []int(nil)
+	if dropPrivs {
+		uid, gid, groups, err = resolveCredential(execUser, execGroup)
+		if err != nil {
+			return fmt.Errorf("Failed to resolve user and group: %w", err)
+		}
+	}
+
+	var masked []string
+	if maskOutput {
+		// collected before --as-files moves values out of the environment
+		masked = recorder.loaded(env)
+	}
+
+	var secretsDir string
+	if asFiles {
+		secretsDir, err = os.MkdirTemp(secretFilesBaseDir(), "chamber-")
+		if err != nil {
+			return fmt.Errorf("Failed to create secrets directory: %w", err)
+		}
+		if err := materializeFiles(&env, sortedKeys(sources), secretsDir, uid, gid); err != nil {
+			os.RemoveAll(secretsDir)
+			return fmt.Errorf("Failed to write secret files: %w", err)
+		}
+	}
+
+	// after writing secret files, which have their own permissions
+	if umask != -1 {
+		if err := setUmask(umask); err != nil {
+			os.RemoveAll(secretsDir)
+			return fmt.Errorf("Failed to set umask: %w", err)
+		}
+	}
+
+	if dropPrivs {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "chamber: dropping privileges to uid %d gid %d\n", uid, gid)
+		}
+		if err := dropPrivileges(uid, gid, groups); err != nil {
+			os.RemoveAll(secretsDir)
+			return fmt.Errorf("Failed to drop privileges: %w", err)
+		}
+	}
+
+	// after dropping privileges, so that the directory must be accessible to
+	// the user running the command
+	if execChdir != "" {
+		if err := os.Chdir(execChdir); err != nil {
+			os.RemoveAll(secretsDir)
+			return fmt.Errorf("Failed to change directory: %w", err)
+		}
+	}
+
+	if err := checkEnvSize(append([]string{command}, commandArgs...), env, platformEnvLimits(), maxEnvSize, os.Stderr); err != nil {
+		os.RemoveAll(secretsDir)
+		return err
+	}
+
+	if asFiles || execTimeout > 0 || maskOutput || watch || reportOutcome != "" {
+		// the files can only be cleaned up, the command stopped or restarted,
+		// its output redacted and its outcome reported if chamber outlives
+		// the command
+		opts := childOptions{Timeout: timeout}
+		if watch {
+			opts.Restart = watchSecrets(secretStore, services, initialVersions, watchInterval, os.Stderr)
+		}
+		var redactors []*redactor
+		if maskOutput {
+			stderr := newRedactor(os.Stderr, masked)
+			opts.Stderr = stderr
+			redactors = append(redactors, stderr)
+			if !maskStderrOnly {
+				stdout := newRedactor(os.Stdout, masked)
+				opts.Stdout = stdout
+				redactors = append(redactors, stdout)
+			}
+		}
+		status, err := runChild(command, commandArgs, env, opts)
+		for _, r := range redactors {
+			r.Close()
+		}
+		os.RemoveAll(secretsDir)
+		if errors.Is(err, errRestart) {
+			currentOutcome.Started = true
+			return restartSelf(startDir)
+		}
+		if err != nil {
+			return err
+		}
+		if reportOutcome != "" {
+			currentOutcome.exited(status)
+			reportExecOutcome(nil)
+			postrun(cmd, args)
+		}
+		os.Exit(status)
+	}
+
 	return exec(command, commandArgs, env)
 }
+
+// servicesFromEnv splits the value of $CHAMBER_SERVICES into services,
+// expanding the environment variables in it with lookup. Variables that
+// aren't set are an error, rather than silently loading the wrong service.
+func servicesFromEnv(value string, lookup func(string) (string, bool)) ([]string, error) {
+	var unset []string
+	expanded := os.Expand(value, func(name string) string {
+		v, ok := lookup(name)
+		if !ok {
+			unset = append(unset, name)
+		}
+		return v
+	})
+	if len(unset) > 0 {
+		return nil, fmt.Errorf("$%s refers to unset variables: %s", ServicesEnvVar, strings.Join(unset, ", "))
+	}
+
+	var services []string
+	for _, service := range strings.Split(expanded, ",") {
+		if service = strings.TrimSpace(service); service != "" {
+			services = append(services, service)
+		}
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("$%s lists no services", ServicesEnvVar)
+	}
+	return services, nil
+}
+
+// defaultRolloutID identifies the host for --rollout by its EC2 instance ID,
+// which survives restarts and redeploys, or by its hostname outside EC2
+func defaultRolloutID() (string, error) {
+	if id, err := store.InstanceID(); err == nil {
+		return id, nil
+	}
+	return os.Hostname()
+}
+
+// parseUmask parses an octal umask like 027
+func parseUmask(s string) (int, error) {
+	umask, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || umask > 0777 {
+		return 0, fmt.Errorf("invalid umask %q: must be octal between 000 and 777", s)
+	}
+	return int(umask), nil
+}
+
+// defaultShell returns the shell used by --shell when none is named
+func defaultShell() string {
+	if runtime.GOOS == "windows" {
+		return "cmd"
+	}
+	return "sh"
+}
+
+// shellCommand returns the command and arguments running command, joined
+// into a single line, with shell
+func shellCommand(shell string, command []string) (string, []string) {
+	flag := "-c"
+	if name := strings.TrimSuffix(strings.ToLower(filepath.Base(shell)), ".exe"); name == "cmd" {
+		flag = "/C"
+	}
+	return shell, []string{flag, strings.Join(command, " ")}
+}
+
+// secretFilesBaseDir returns where --as-files creates its directory: a tmpfs
+// when one is available, so that secrets never reach a disk.
+func secretFilesBaseDir() string {
+	if fi, err := os.Stat("/dev/shm"); err == nil && fi.IsDir() {
+		return "/dev/shm"
+	}
+	return os.TempDir()
+}
+
+// materializeFiles moves the variables in names out of env into files in dir,
+// readable only by their owner, and sets <NAME>_FILE to each file's path.
+// Variables in names that are not set in env are skipped. When uid is not -1
+// the directory and files are handed over to uid and gid.
+func materializeFiles(env *environ.Environ, names []string, dir string, uid, gid int) error {
+	values := env.Map()
+	if uid != -1 {
+		if err := os.Chown(dir, uid, gid); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(value), 0400); err != nil {
+			return err
+		}
+		if uid != -1 {
+			if err := os.Chown(path, uid, gid); err != nil {
+				return err
+			}
+		}
+		env.Unset(name)
+		env.Set(name+"_FILE", path)
+	}
+	return nil
+}
+
+// resolveCredential turns --user and --group into numeric ids. Either may be a
+// name or a number. When only a user is given, its primary and supplementary
+// groups are used; when only a group is given, the current uid is kept. A uid
+// without a passwd entry needs a group.
+func resolveCredential(userSpec, groupSpec string) (uid int, gid int, groups []int, err error) {
+	uid, gid = os.Getuid(), os.Getgid()
+
+	if userSpec != "" {
+		u, err := lookupUser(userSpec, groupSpec != "")
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, nil, fmt.Errorf("unexpected uid %q for user %s", u.Uid, userSpec)
+		}
+		// a bare uid has no group, and --group gives one below
+		if u.Gid != "" {
+			if gid, err = strconv.Atoi(u.Gid); err != nil {
+				return 0, 0, nil, fmt.Errorf("unexpected gid %q for user %s", u.Gid, userSpec)
+			}
+		}
+		// supplementary groups are best effort; not every system can list them
+		if ids, err := u.GroupIds(); err == nil {
+			for _, id := range ids {
+				if g, err := strconv.Atoi(id); err == nil {
+					groups = append(groups, g)
+				}
+			}
+		}
+	}
+
+	if groupSpec != "" {
+		g, err := lookupGroup(groupSpec)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, nil, fmt.Errorf("unexpected gid %q for group %s", g.Gid, groupSpec)
+		}
+		groups = []int{gid}
+	}
+
+	if len(groups) == 0 {
+		groups = []int{gid}
+	}
+	return uid, gid, groups, nil
+}
+
+// lookupUser finds the user named or numbered spec. A uid without a passwd
+// entry has no primary group, so it can only be used along with --group.
+func lookupUser(spec string, hasGroup bool) (*user.User, error) {
+	if _, err := strconv.Atoi(spec); err == nil {
+		if u, err := user.LookupId(spec); err == nil {
+			return u, nil
+		}
+		if !hasGroup {
+			return nil, fmt.Errorf("uid %s has no passwd entry, so --group must be given", spec)
+		}
+		// a bare uid without a passwd entry is still usable with --group
+		return &user.User{Uid: spec}, nil
+	}
+	return user.Lookup(spec)
+}
+
+func lookupGroup(spec string) (*user.Group, error) {
+	if _, err := strconv.Atoi(spec); err == nil {
+		if g, err := user.LookupGroupId(spec); err == nil {
+			return g, nil
+		}
+		return &user.Group{Gid: spec}, nil
+	}
+	return user.LookupGroup(spec)
+}
+
+// withValueTransforms applies the value transformations requested with
+// --expand-json and --interpolate. JSON is expanded first, so that flattened
+// keys can be referenced.
+func withValueTransforms(s store.Store) store.Store {
+	// before expanding JSON, since rollout values are JSON objects
+	if rollout {
+		s = store.NewRolloutStore(s, rolloutID)
+	}
+	if expandJSON {
+		s = store.NewJSONExpandingStore(s)
+	}
+	if interpolate {
+		s = store.NewInterpolatingStore(s)
+	}
+	return s
+}
+
+// envSources maps each env var name that services would provide to the last
+// service providing it, matching the precedence used when loading.
+func envSources(s store.Store, services []string, noPaths bool) (map[string]string, error) {
+	sources := map[string]string{}
+	for _, service := range services {
+		var scratch environ.Environ
+		collisions := make([]string, 0)
+		var err error
+		if noPaths {
+			err = scratch.LoadNoPaths(s, service, &collisions)
+		} else {
+			err = scratch.Load(s, service, &collisions)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for k := range scratch.Map() {
+			sources[k] = service
+		}
+	}
+	return sources, nil
+}
+
+// recordingStore records the values of the secrets listed through it
+type recordingStore struct {
+	store.Store
+	values map[string]bool
+}
+
+func newRecordingStore(s store.Store) *recordingStore {
+	return &recordingStore{Store: s, values: map[string]bool{}}
+}
+
+// Unwrap returns the store s lists secrets from
+func (s *recordingStore) Unwrap() store.Store {
+	return s.Store
+}
+
+// ListRaw lists all secrets keys and values for a given service, recording
+// the values
+func (s *recordingStore) ListRaw(service string) ([]store.RawSecret, error) {
+	rawSecrets, err := s.Store.ListRaw(service)
+	for _, rawSecret := range rawSecrets {
+		s.values[rawSecret.Value] = true
+	}
+	return rawSecrets, err
+}
+
+// loaded returns the values of env that are values of secrets listed
+// through s. Values of the parent environment kept over secrets, as with
+// --noclobber, are left out.
+func (s *recordingStore) loaded(env environ.Environ) []string {
+	var values []string
+	for _, value := range env.Map() {
+		if s.values[value] {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// loadFromMetadata loads the secrets of services into env, skipping those
+// without a usage annotation. Every required secret that was not loaded, for
+// example because a label filtered it out, or that is empty, is reported.
+func loadFromMetadata(env *environ.Environ, s store.Store, services []string) error {
+	problems := []string{}
+	for _, service := range services {
+		name, _ := parseServiceLabel(service)
+		usage, err := readUsage(s, utils.NormalizeService(name))
+		if err != nil {
+			return fmt.Errorf("Failed to read usage annotations for %s: %w", service, err)
+		}
+
+		rawSecrets, err := s.ListRaw(utils.NormalizeService(service))
+		if err != nil {
+			return fmt.Errorf("Failed to list store contents: %w", err)
+		}
+
+		loaded := map[string]struct{}{}
+		for _, rawSecret := range rawSecrets {
+			k := key(rawSecret.Key)
+			u, ok := usage[k]
+			if !ok {
+				if verbose {
+					fmt.Fprintf(os.Stderr, "chamber: skipping %s from %s, which has no usage annotation\n", k, service)
+				}
+				continue
+			}
+			if u == UsageRequired && rawSecret.Value == "" {
+				continue
+			}
+			loaded[k] = struct{}{}
+			env.Set(envVarName(k), rawSecret.Value)
+		}
+
+		for k, u := range usage {
+			if _, ok := loaded[k]; !ok && u == UsageRequired {
+				problems = append(problems, fmt.Sprintf("%s/%s", service, k))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("required secrets missing or empty: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// keepsParentValue returns whether the inherited value of the variable name
+// must not be overwritten by secrets, according to the clobber flags
+func keepsParentValue(name string) bool {
+	switch {
+	case noclobber:
+		return true
+	case len(noclobberOnly) > 0:
+		for _, n := range noclobberOnly {
+			if envVarName(strings.TrimSpace(n)) == name {
+				return true
+			}
+		}
+		return false
+	case len(clobberOnly) > 0:
+		for _, glob := range clobberOnly {
+			if ok, _ := filepath.Match(strings.TrimSpace(glob), name); ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// restoreParentValues sets variables of env that keepsParentValue protects
+// back to their value in parent
+func restoreParentValues(env *environ.Environ, parent map[string]string) {
+	for name, value := range parent {
+		if keepsParentValue(name) {
+			env.Set(name, value)
+		}
+	}
+}
+
+// strictValuePattern compiles the values given to --strict-value and
+// --strict-value-regex into one regexp matching any of them in full
+func strictValuePattern(values, regexes []string) (*regexp.Regexp, error) {
+	alternatives := make([]string, 0, len(values)+len(regexes))
+	for _, value := range values {
+		alternatives = append(alternatives, regexp.QuoteMeta(value))
+	}
+	for _, value := range regexes {
+		if _, err := regexp.Compile(value); err != nil {
+			return nil, fmt.Errorf("Invalid --strict-value-regex %q: %w", value, err)
+		}
+		alternatives = append(alternatives, "(?:"+value+")")
+	}
+	return regexp.Compile("^(?:" + strings.Join(alternatives, "|") + ")$")
+}
+
+// isStrictSentinel returns whether value will be substituted in strict mode
+func isStrictSentinel(value string) bool {
+	if strictTemplate {
+		return strings.HasPrefix(value, environ.StrictTemplatePrefix)
+	}
+	return strict && strictPattern != nil && strictPattern.MatchString(value)
+}
+
+// strictProblem is the JSON representation of a problem found in strict mode
+type strictProblem struct {
+	Type     string `json:"type" yaml:"type"`
+	Key      string `json:"key" yaml:"key"`
+	Expected string `json:"expected" yaml:"expected"`
+	Actual   string `json:"actual,omitempty" yaml:"actual,omitempty"`
+}
+
+// strictProblemsOutput is the document printed by --strict --output json or
+// yaml
+type strictProblemsOutput struct {
+	Problems []strictProblem `json:"problems" yaml:"problems"`
+}
+
+// printStrictProblems writes problems to out in the format of --output
+func printStrictProblems(out io.Writer, problems environ.ErrStrictProblems) error {
+	list := make([]strictProblem, 0, len(problems.Problems))
+	for _, p := range problems.Problems {
+		switch p := p.(type) {
+		case environ.ErrStoreMissingKey:
+			list = append(list, strictProblem{Type: "missing", Key: p.Key, Expected: p.ValueExpected})
+		case environ.ErrStoreUnexpectedValue:
+			list = append(list, strictProblem{Type: "unexpected_value", Key: p.Key, Expected: p.ValueExpected, Actual: p.ValueActual})
+		case environ.ErrExpectedKeyUnnormalized:
+			list = append(list, strictProblem{Type: "unnormalized_key", Key: p.Key, Expected: p.ValueExpected})
+		case environ.ErrTemplateInvalid:
+			list = append(list, strictProblem{Type: "invalid_reference", Key: p.Key, Expected: p.Value})
+		case environ.ErrTemplateUnknownService:
+			list = append(list, strictProblem{Type: "unknown_service", Key: p.Key, Expected: p.Value})
+		}
+	}
+	return writeStructured(out, strictProblemsOutput{Problems: list})
+}
+
+// parseServicePins handles services of the form service@label, rewriting
+// them to the service:label form. Versions are per key, so a service can't be
+// pinned to one; SSM labels can't start with a number, so one is rejected.
+func parseServicePins(services []string) ([]string, error) {
+	parsed := make([]string, 0, len(services))
+	for _, service := range services {
+		i := strings.LastIndex(service, "@")
+		if i < 0 {
+			parsed = append(parsed, service)
+			continue
+		}
+		name, label := service[:i], service[i+1:]
+		if label == "" {
+			return nil, fmt.Errorf("Missing label after @ in service '%s'", service)
+		}
+		if label[0] >= '0' && label[0] <= '9' {
+			return nil, fmt.Errorf("Invalid label %s in service '%s': every key has its own versions, so pin keys with --pin %s/<key>@<version>", label, service, name)
+		}
+		parsed = append(parsed, name+":"+label)
+	}
+	return parsed, nil
+}
+
+// parseKeyPins handles pins of the form service/key@version, returning the
+// versions keyed by normalized service and key. Pinned services must be among
+// services, and can't have a label.
+func parseKeyPins(pins []string, services []string) (map[string]map[string]int, error) {
+	loaded := map[string]bool{}
+	for _, service := range services {
+		loaded[utils.NormalizeService(service)] = true
+	}
+
+	versions := map[string]map[string]int{}
+	for _, pin := range pins {
+		i := strings.LastIndex(pin, "@")
+		j := strings.LastIndex(pin, "/")
+		if i < 0 || j < 0 || j > i {
+			return nil, fmt.Errorf("Invalid --pin %s: must be service/key@version", pin)
+		}
+		service, k := utils.NormalizeService(pin[:j]), utils.NormalizeKey(pin[j+1:i])
+		version, err := strconv.Atoi(pin[i+1:])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("Invalid version in --pin %s", pin)
+		}
+		if !loaded[service] {
+			return nil, fmt.Errorf("Invalid --pin %s: service %s is not loaded, or has a label", pin, service)
+		}
+		if versions[service] == nil {
+			versions[service] = map[string]int{}
+		}
+		versions[service][k] = version
+	}
+	return versions, nil
+}
+
+// presentServices splits services into those that have secrets in s and those
+// that don't exist or are empty.
+func presentServices(s store.Store, services []string) (present []string, missing []string, err error) {
+	for _, service := range services {
+		rawSecrets, err := s.ListRaw(utils.NormalizeService(service))
+		if err != nil && !errors.Is(err, store.ErrSecretNotFound) {
+			return nil, nil, err
+		}
+		if len(rawSecrets) == 0 {
+			missing = append(missing, service)
+		} else {
+			present = append(present, service)
+		}
+	}
+	return present, missing, nil
+}
+
+// parseServiceLabel splits a service of the form service:label
+func parseServiceLabel(service string) (string, string) {
+	if i := strings.Index(service, ":"); i >= 0 {
+		return service[:i], service[i+1:]
+	}
+	return service, ""
+}
+
+// envVarName converts a secret key to the env var name exec uses for it
+func envVarName(k string) string {
+	return strings.Replace(strings.ToUpper(k), "-", "_", -1)
+}
+
+// readRequiredKeys reads a manifest of required keys, one per line.
+func readRequiredKeys(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keys := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	return keys, scanner.Err()
+}
+
+// missingRequired returns the required keys, as env var names, that none of
+// the services provide. Keys may be given in either secret or env var form.
+func missingRequired(required []string, sources map[string]string) []string {
+	missing := []string{}
+	seen := map[string]struct{}{}
+	for _, k := range required {
+		name := envVarName(strings.TrimSpace(k))
+		if name == "" {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		if _, ok := sources[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// printDryRun describes the differences between the parent environment and the
+// environment the child would receive.
+func printDryRun(out io.Writer, parent, env environ.Environ, sources map[string]string) {
+	parentMap := parent.Map()
+	envMap := env.Map()
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', 0)
+	fmt.Fprintln(w, "Variable\tService\tValue\tAction")
+	for _, k := range sortedKeys(envMap) {
+		service, ok := sources[k]
+		if !ok {
+			// inherited from the parent environment
+			continue
+		}
+		value := maskedValue
+		if showValues {
+			value = envMap[k]
+		}
+		action := "new"
+		if parentVal, ok := parentMap[k]; ok {
+			if isStrictSentinel(parentVal) {
+				action = "fills strict value"
+			} else if keepsParentValue(k) {
+				action = "keeps existing value"
+			} else {
+				action = "clobbers existing value"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", k, service, value, action)
+	}
+	w.Flush()
+
+	dropped := 0
+	for k := range parentMap {
+		if _, ok := envMap[k]; !ok {
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		fmt.Fprintf(out, "info: %d inherited variables would not be passed to the command\n", dropped)
+	}
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	osexec "os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// timedOutStatus is the exit status used when the command was stopped because
+// it ran past its timeout, like timeout(1)
+const timedOutStatus = 124
+
+// childTimeout bounds how long the command may run. After After, Signal is
+// sent to it, followed by SIGKILL if it is still running KillAfter later. A
+// zero After disables the timeout.
+type childTimeout struct {
+	After     time.Duration
+	Signal    os.Signal
+	KillAfter time.Duration
+}
+
+// restartGracePeriod is how long the command has to exit after being asked
+// to stop for a restart, before it is killed
+const restartGracePeriod = 10 * time.Second
+
+// errRestart is returned by runChild when the command was stopped to be
+// restarted
+var errRestart = errors.New("command stopped for a restart")
+
+// childOptions control how runChild runs the command
+type childOptions struct {
+	Timeout childTimeout
+	// Stdout and Stderr receive the command's output; they default to
+	// chamber's own
+	Stdout io.Writer
+	Stderr io.Writer
+	// Restart stops the command with SIGTERM when closed, and runChild then
+	// returns errRestart
+	Restart <-chan struct{}
+	// Signals are sent to the command, in addition to those chamber receives
+	Signals <-chan os.Signal
+}
+
+// parseSignal turns a signal name like TERM or SIGTERM into a signal
+func parseSignal(name string) (os.Signal, error) {
+	signals := map[string]syscall.Signal{
+		"HUP":  syscall.SIGHUP,
+		"INT":  syscall.SIGINT,
+		"QUIT": syscall.SIGQUIT,
+		"KILL": syscall.SIGKILL,
+		"TERM": syscall.SIGTERM,
+	}
+	sig, ok := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signal %s", name)
+	}
+	return sig, nil
+}
+
+// runChild runs the given command as a child process, forwarding signals to
+// it, and returns its exit status once it has terminated. It is used when
+// chamber has to outlive the command, for example to clean up after it.
+func runChild(command string, args []string, env []string, opts childOptions) (int, error) {
+	ecmd := osexec.Command(command, args...)
+	ecmd.Stdin = os.Stdin
+	ecmd.Stdout = os.Stdout
+	if opts.Stdout != nil {
+		ecmd.Stdout = opts.Stdout
+	}
+	ecmd.Stderr = os.Stderr
+	if opts.Stderr != nil {
+		ecmd.Stderr = opts.Stderr
+	}
+	ecmd.Env = env
+	timeout := opts.Timeout
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan)
+	defer signal.Stop(sigChan)
+
+	if err := ecmd.Start(); err != nil {
+		return 0, fmt.Errorf("Failed to start command: %w", err)
+	}
+
+	go func() {
+		for sig := range sigChan {
+			ecmd.Process.Signal(sig)
+		}
+	}()
+
+	timedOut := make(chan struct{})
+	if timeout.After > 0 {
+		timer := time.AfterFunc(timeout.After, func() {
+			close(timedOut)
+			fmt.Fprintf(os.Stderr, "chamber: command timed out after %s, sending %s\n", timeout.After, timeout.Signal)
+			ecmd.Process.Signal(timeout.Signal)
+			time.AfterFunc(timeout.KillAfter, func() {
+				ecmd.Process.Kill()
+			})
+		})
+		defer timer.Stop()
+	}
+
+	exited := make(chan struct{})
+	defer close(exited)
+	if opts.Signals != nil {
+		go func() {
+			for {
+				select {
+				case sig := <-opts.Signals:
+					ecmd.Process.Signal(sig)
+				case <-exited:
+					return
+				}
+			}
+		}()
+	}
+
+	restarting := make(chan struct{})
+	if opts.Restart != nil {
+		go func() {
+			select {
+			case <-opts.Restart:
+			case <-exited:
+				return
+			}
+			close(restarting)
+			if err := ecmd.Process.Signal(syscall.SIGTERM); err != nil {
+				ecmd.Process.Kill()
+			}
+			select {
+			case <-time.After(restartGracePeriod):
+				ecmd.Process.Kill()
+			case <-exited:
+			}
+		}()
+	}
+
+	if err := ecmd.Wait(); err != nil {
+		var exitErr *osexec.ExitError
+		if !errors.As(err, &exitErr) {
+			ecmd.Process.Signal(os.Kill)
+			return 0, fmt.Errorf("Failed to wait for command termination: %w", err)
+		}
+	}
+
+	select {
+	case <-restarting:
+		return 0, errRestart
+	case <-timedOut:
+		return timedOutStatus, nil
+	default:
+		return ecmd.ProcessState.ExitCode(), nil
+	}
+}
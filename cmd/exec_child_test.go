@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSignal(t *testing.T) {
+	for _, name := range []string{"TERM", "SIGTERM", "term"} {
+		sig, err := parseSignal(name)
+		assert.NoError(t, err)
+		assert.Equal(t, syscall.SIGTERM, sig)
+	}
+
+	_, err := parseSignal("SIGFOO")
+	assert.Error(t, err)
+}
+
+func TestRunChild(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh")
+	}
+
+	t.Run("returns the exit status of the command", func(t *testing.T) {
+		status, err := runChild("sh", []string{"-c", "exit 3"}, nil, childOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, status)
+	})
+
+	t.Run("stops the command when it times out", func(t *testing.T) {
+		start := time.Now()
+		status, err := runChild("sleep", []string{"10"}, nil, childOptions{Timeout: childTimeout{
+			After:     50 * time.Millisecond,
+			Signal:    syscall.SIGTERM,
+			KillAfter: time.Second,
+		}})
+		assert.NoError(t, err)
+		assert.Equal(t, timedOutStatus, status)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("writes output to the given writers", func(t *testing.T) {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		status, err := runChild("sh", []string{"-c", "echo out; echo err >&2"}, nil, childOptions{
+			Stdout: stdout,
+			Stderr: stderr,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, status)
+		assert.Equal(t, "out\n", stdout.String())
+		assert.Equal(t, "err\n", stderr.String())
+	})
+
+	t.Run("stops the command when asked to restart", func(t *testing.T) {
+		restart := make(chan struct{})
+		time.AfterFunc(50*time.Millisecond, func() { close(restart) })
+
+		start := time.Now()
+		_, err := runChild("sleep", []string{"10"}, nil, childOptions{Restart: restart})
+		assert.ErrorIs(t, err, errRestart)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("forwards the given signals to the command", func(t *testing.T) {
+		signals := make(chan os.Signal, 1)
+		time.AfterFunc(200*time.Millisecond, func() { signals <- syscall.SIGHUP })
+
+		stdout := &bytes.Buffer{}
+		status, err := runChild("sh", []string{"-c", "sleep 10 & trap 'kill $!; echo hup; exit 0' HUP; wait"}, nil, childOptions{
+			Stdout:  stdout,
+			Signals: signals,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, status)
+		assert.Equal(t, "hup\n", stdout.String())
+	})
+}
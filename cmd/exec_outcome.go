@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/spf13/cobra"
+)
+
+// Where to report the outcome of exec; empty disables reporting
+var reportOutcome string
+
+// The stages at which exec can fail, so that failing to fetch secrets can be
+// told apart from the command failing
+const (
+	outcomeFailedSecrets = "secrets"
+	outcomeFailedStart   = "start"
+	outcomeFailedCommand = "command"
+)
+
+// execOutcome describes how a run of exec ended
+type execOutcome struct {
+	Timestamp time.Time `json:"timestamp"`
+	Services  []string  `json:"services"`
+	Command   string    `json:"command"`
+	// how long fetching secrets took, including failed attempts
+	SecretFetchMillis int64 `json:"secret_fetch_ms"`
+	SecretsFetched    bool  `json:"secrets_fetched"`
+	Started           bool  `json:"started"`
+	// unset when the command didn't start, or was restarted by --watch
+	ExitCode *int `json:"exit_code,omitempty"`
+	// secrets, start or command; empty when the command exited successfully
+	Failed string `json:"failed,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	fetchStart time.Time
+}
+
+// currentOutcome is filled in as exec progresses
+var currentOutcome execOutcome
+
+// startFetch marks the start of fetching secrets
+func (o *execOutcome) startFetch(now time.Time) {
+	o.fetchStart = now
+}
+
+// finishFetch marks secrets as fetched for services
+func (o *execOutcome) finishFetch(now time.Time, services []string) {
+	o.Services = services
+	o.SecretsFetched = true
+	o.SecretFetchMillis = now.Sub(o.fetchStart).Milliseconds()
+}
+
+// exited records the exit status of the command
+func (o *execOutcome) exited(status int) {
+	o.Started = true
+	o.ExitCode = &status
+}
+
+// finish completes the outcome with the error exec failed with, if any
+func (o *execOutcome) finish(now time.Time, err error) {
+	o.Timestamp = now
+	if !o.SecretsFetched && !o.fetchStart.IsZero() {
+		o.SecretFetchMillis = now.Sub(o.fetchStart).Milliseconds()
+	}
+	if err != nil {
+		o.Error = err.Error()
+	}
+	switch {
+	case !o.SecretsFetched && err != nil:
+		o.Failed = outcomeFailedSecrets
+	case !o.Started && err != nil:
+		o.Failed = outcomeFailedStart
+	case err != nil, o.ExitCode != nil && *o.ExitCode != 0:
+		o.Failed = outcomeFailedCommand
+	}
+}
+
+// execRunReportingOutcome runs exec, reporting its outcome when asked to.
+// Outcomes of commands that ran are reported by execRun itself, since it
+// exits with their status.
+func execRunReportingOutcome(cmd *cobra.Command, args []string) error {
+	if reportOutcome == "" {
+		return execRun(cmd, args)
+	}
+	dashIx := cmd.ArgsLenAtDash()
+	currentOutcome = execOutcome{Command: args[dashIx], Services: args[:dashIx]}
+	err := execRun(cmd, args)
+	if !dryRun {
+		reportExecOutcome(err)
+	}
+	return err
+}
+
+// reportExecOutcome finishes currentOutcome and sends it to --report-outcome
+// and, when enabled, analytics. Failing to report is only a warning, so that
+// reporting never changes how exec behaves.
+func reportExecOutcome(err error) {
+	currentOutcome.finish(time.Now(), err)
+	if werr := writeExecOutcome(reportOutcome, currentOutcome); werr != nil {
+		fmt.Fprintf(os.Stderr, "warning: Failed to report outcome: %s\n", werr)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		properties := analytics.NewProperties().
+			Set("command", "exec").
+			Set("chamber-version", chamberVersion).
+			Set("services", currentOutcome.Services).
+			Set("backend", backend).
+			Set("secret-fetch-ms", currentOutcome.SecretFetchMillis).
+			Set("secrets-fetched", currentOutcome.SecretsFetched).
+			Set("started", currentOutcome.Started).
+			Set("failed", currentOutcome.Failed)
+		if currentOutcome.ExitCode != nil {
+			properties.Set("exit-code", *currentOutcome.ExitCode)
+		}
+		analyticsClient.Enqueue(analytics.Track{
+			UserId:     username,
+			Event:      "Exec Outcome",
+			Properties: properties,
+		})
+	}
+}
+
+// writeExecOutcome writes o as a line of JSON to stdout, stderr or appends it
+// to a file
+func writeExecOutcome(sink string, o execOutcome) error {
+	line, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	var w io.Writer
+	switch sink {
+	case "stdout", "-":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	default:
+		f, err := os.OpenFile(sink, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	_, err = w.Write(line)
+	return err
+}
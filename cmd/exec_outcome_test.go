@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecOutcomeFinish(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name       string
+		progress   func(o *execOutcome)
+		err        error
+		failed     string
+		fetchMs    int64
+		started    bool
+		exitStatus *int
+	}{
+		{
+			name:     "secrets failed",
+			progress: func(o *execOutcome) {},
+			err:      errors.New("Failed to list store contents"),
+			failed:   outcomeFailedSecrets,
+			fetchMs:  3000,
+		},
+		{
+			name: "command failed to start",
+			progress: func(o *execOutcome) {
+				o.finishFetch(start.Add(time.Second), []string{"app"})
+			},
+			err:     errors.New("Failed to start command"),
+			failed:  outcomeFailedStart,
+			fetchMs: 1000,
+		},
+		{
+			name: "command failed",
+			progress: func(o *execOutcome) {
+				o.finishFetch(start.Add(time.Second), []string{"app"})
+				o.exited(2)
+			},
+			failed:     outcomeFailedCommand,
+			fetchMs:    1000,
+			started:    true,
+			exitStatus: intPtr(2),
+		},
+		{
+			name: "command succeeded",
+			progress: func(o *execOutcome) {
+				o.finishFetch(start.Add(time.Second), []string{"app"})
+				o.exited(0)
+			},
+			fetchMs:    1000,
+			started:    true,
+			exitStatus: intPtr(0),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := execOutcome{}
+			o.startFetch(start)
+			tc.progress(&o)
+			o.finish(start.Add(3*time.Second), tc.err)
+
+			assert.Equal(t, tc.failed, o.Failed)
+			assert.Equal(t, tc.fetchMs, o.SecretFetchMillis)
+			assert.Equal(t, tc.started, o.Started)
+			assert.Equal(t, tc.exitStatus, o.ExitCode)
+			if tc.err != nil {
+				assert.Equal(t, tc.err.Error(), o.Error)
+			}
+		})
+	}
+}
+
+func TestWriteExecOutcomeAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outcomes.jsonl")
+	o := execOutcome{Services: []string{"app"}, Command: "server", SecretsFetched: true}
+	o.exited(0)
+
+	require.NoError(t, writeExecOutcome(path, o))
+	require.NoError(t, writeExecOutcome(path, o))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+	assert.Equal(t, "server", got["command"])
+	assert.Equal(t, true, got["started"])
+	assert.Equal(t, float64(0), got["exit_code"])
+	assert.NotContains(t, got, "failed")
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -0,0 +1,346 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/chamber/v2/environ"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintDryRun(t *testing.T) {
+	parent := environ.Environ([]string{"HOME=/tmp", "DB_USERNAME=admin"})
+	env := environ.Environ([]string{"HOME=/tmp", "DB_USERNAME=root", "DB_PASSWORD=hunter22"})
+	sources := map[string]string{"DB_USERNAME": "app", "DB_PASSWORD": "app"}
+
+	t.Run("values are masked by default", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		printDryRun(buf, parent, env, sources)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Len(t, lines, 3)
+		assert.Regexp(t, `^DB_PASSWORD\s+app\s+\*+\s+new$`, lines[1])
+		assert.Regexp(t, `^DB_USERNAME\s+app\s+\*+\s+clobbers existing value$`, lines[2])
+		assert.NotContains(t, buf.String(), "hunter22")
+	})
+
+	t.Run("values are shown with --show-values", func(t *testing.T) {
+		showValues = true
+		defer func() { showValues = false }()
+
+		buf := &bytes.Buffer{}
+		printDryRun(buf, parent, env, sources)
+		assert.Contains(t, buf.String(), "hunter22")
+	})
+
+	t.Run("dropped inherited variables are counted", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		printDryRun(buf, parent, environ.Environ([]string{"DB_PASSWORD=hunter22"}), sources)
+		assert.Contains(t, buf.String(), "info: 2 inherited variables would not be passed to the command")
+	})
+}
+
+func TestMissingRequired(t *testing.T) {
+	sources := map[string]string{"DB_USERNAME": "app", "DB_PASSWORD": "app"}
+
+	assert.Empty(t, missingRequired([]string{"db_username", "DB_PASSWORD"}, sources))
+	assert.Equal(t, []string{"API_KEY", "DB_HOST"}, missingRequired([]string{"db-host", "api_key", "db_username", "DB_HOST"}, sources))
+	assert.Empty(t, missingRequired(nil, sources))
+}
+
+func TestLoadFromMetadata(t *testing.T) {
+	cases := []struct {
+		name    string
+		secrets map[string]string
+		tags    map[string]map[string]string
+		env     map[string]string
+		err     string
+	}{
+		{
+			name:    "only annotated secrets are loaded",
+			secrets: map[string]string{"db_password": "hunter22", "log_level": "debug", "legacy": "x"},
+			tags: map[string]map[string]string{
+				"db_password": {UsageTagKey: UsageRequired},
+				"log_level":   {UsageTagKey: UsageOptional},
+			},
+			env: map[string]string{"DB_PASSWORD": "hunter22", "LOG_LEVEL": "debug"},
+		},
+		{
+			name:    "empty required secrets are reported",
+			secrets: map[string]string{"db_password": "", "api_key": "", "log_level": ""},
+			tags: map[string]map[string]string{
+				"db_password": {UsageTagKey: UsageRequired},
+				"api_key":     {UsageTagKey: UsageRequired},
+				"log_level":   {UsageTagKey: UsageOptional},
+			},
+			err: "required secrets missing or empty: app/api_key, app/db_password",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newFakeStore(map[string]map[string]string{"app": tc.secrets})
+			for k, tags := range tc.tags {
+				s.WriteTags(store.SecretId{Service: "app", Key: k}, tags)
+			}
+			env := environ.Environ{}
+			err := loadFromMetadata(&env, s, []string{"app"})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.env, env.Map())
+		})
+	}
+}
+
+func TestRecordingStoreLoaded(t *testing.T) {
+	recorder := newRecordingStore(newFakeStore(map[string]map[string]string{
+		"app": {"db_password": "hunter22", "db_user": "app"},
+	}))
+	env := environ.Environ([]string{"DB_USER=parent", "HOME=/tmp"})
+	var collisions []string
+	require.NoError(t, env.Load(recorder, "app", &collisions))
+	noclobber = true
+	defer func() { noclobber = false }()
+	restoreParentValues(&env, map[string]string{"DB_USER": "parent"})
+
+	assert.Equal(t, "parent", env.Map()["DB_USER"])
+	assert.ElementsMatch(t, []string{"hunter22"}, recorder.loaded(env))
+}
+
+func TestMaterializeFiles(t *testing.T) {
+	dir := t.TempDir()
+	env := environ.Environ([]string{"HOME=/tmp", "DB_PASSWORD=hunter22"})
+
+	err := materializeFiles(&env, []string{"DB_PASSWORD", "API_KEY"}, dir, -1, -1)
+	assert.NoError(t, err)
+
+	path := filepath.Join(dir, "DB_PASSWORD")
+	assert.Equal(t, map[string]string{"HOME": "/tmp", "DB_PASSWORD_FILE": path}, env.Map())
+
+	contents, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter22", string(contents))
+
+	fi, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0400), fi.Mode().Perm())
+}
+
+func TestPresentServices(t *testing.T) {
+	s := newFakeStore(map[string]map[string]string{
+		"app":    {"db_password": "hunter22"},
+		"worker": {},
+	})
+	present, missing, err := presentServices(s, []string{"app", "worker", "preview"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app"}, present)
+	assert.Equal(t, []string{"worker", "preview"}, missing)
+}
+
+func TestParseServicePins(t *testing.T) {
+	services, err := parseServicePins([]string{"Shared@prod", "worker"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Shared:prod", "worker"}, services)
+
+	_, err = parseServicePins([]string{"app@"})
+	assert.Error(t, err)
+
+	_, err = parseServicePins([]string{"app@3"})
+	assert.ErrorContains(t, err, "--pin app/<key>@<version>")
+}
+
+func TestParseKeyPins(t *testing.T) {
+	versions, err := parseKeyPins([]string{"app/db_password@3", "App/API_KEY@5", "team/worker/token@1"}, []string{"app", "team/worker"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]int{
+		"app":         {"db_password": 3, "api_key": 5},
+		"team/worker": {"token": 1},
+	}, versions)
+
+	for _, pin := range []string{"db_password@3", "app/db_password", "app/db_password@0", "app/db_password@latest", "other/token@1"} {
+		_, err = parseKeyPins([]string{pin}, []string{"app"})
+		assert.Error(t, err, pin)
+	}
+
+	// a labelled service is read at its label
+	_, err = parseKeyPins([]string{"app/db_password@3"}, []string{"app:prod"})
+	assert.Error(t, err)
+}
+
+func TestPrintStrictProblems(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := printStrictProblems(buf, environ.ErrStrictProblems{Problems: []error{
+		environ.ErrStoreUnexpectedValue{Key: "DB_PASSWORD", ValueExpected: "chamberme", ValueActual: "hunter2"},
+		environ.ErrStoreMissingKey{Key: "EXTRA", ValueExpected: "chamberme"},
+	}})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"problems": [
+		{"type": "unexpected_value", "key": "DB_PASSWORD", "expected": "chamberme", "actual": "hunter2"},
+		{"type": "missing", "key": "EXTRA", "expected": "chamberme"}
+	]}`, buf.String())
+}
+
+func TestStrictValuePattern(t *testing.T) {
+	pattern, err := strictValuePattern([]string{"chamberme", "x.y"}, []string{"CHAMBER(.*)"})
+	assert.NoError(t, err)
+	assert.True(t, pattern.MatchString("chamberme"))
+	assert.True(t, pattern.MatchString("x.y"))
+	assert.False(t, pattern.MatchString("xzy"), "--strict-value is literal")
+	assert.True(t, pattern.MatchString("CHAMBER_DB_PASSWORD"))
+	assert.False(t, pattern.MatchString("xchamberme"))
+	assert.False(t, pattern.MatchString("hunter22"))
+
+	_, err = strictValuePattern(nil, []string{"CHAMBER(.*"})
+	assert.Error(t, err)
+}
+
+func TestRestoreParentValues(t *testing.T) {
+	parent := map[string]string{"DB_HOST": "localhost", "DB_PORT": "5433", "LOG_LEVEL": "debug"}
+	cases := []struct {
+		name          string
+		noclobber     bool
+		noclobberOnly []string
+		clobberOnly   []string
+		out           map[string]string
+	}{
+		{
+			name: "secrets win by default",
+			out:  map[string]string{"DB_HOST": "db.internal", "DB_PORT": "5432", "LOG_LEVEL": "info"},
+		},
+		{
+			name:      "noclobber keeps every inherited value",
+			noclobber: true,
+			out:       map[string]string{"DB_HOST": "localhost", "DB_PORT": "5433", "LOG_LEVEL": "debug"},
+		},
+		{
+			name:          "noclobber-only keeps the listed variables",
+			noclobberOnly: []string{"log_level"},
+			out:           map[string]string{"DB_HOST": "db.internal", "DB_PORT": "5432", "LOG_LEVEL": "debug"},
+		},
+		{
+			name:        "clobber-only lets matching variables be overwritten",
+			clobberOnly: []string{"DB_*"},
+			out:         map[string]string{"DB_HOST": "db.internal", "DB_PORT": "5432", "LOG_LEVEL": "debug"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			noclobber, noclobberOnly, clobberOnly = tc.noclobber, tc.noclobberOnly, tc.clobberOnly
+			defer func() { noclobber, noclobberOnly, clobberOnly = false, nil, nil }()
+
+			env := environ.Environ([]string{"DB_HOST=db.internal", "DB_PORT=5432", "LOG_LEVEL=info"})
+			restoreParentValues(&env, parent)
+			assert.Equal(t, tc.out, env.Map())
+		})
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	cases := []struct {
+		shell   string
+		command []string
+		name    string
+		args    []string
+	}{
+		{"sh", []string{"echo $A && echo $B"}, "sh", []string{"-c", "echo $A && echo $B"}},
+		{"/bin/bash", []string{"./server", "|", "tee", "log"}, "/bin/bash", []string{"-c", "./server | tee log"}},
+		{"cmd", []string{"echo", "%A%"}, "cmd", []string{"/C", "echo %A%"}},
+		{"CMD.EXE", []string{"dir"}, "CMD.EXE", []string{"/C", "dir"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.shell, func(t *testing.T) {
+			name, args := shellCommand(tc.shell, tc.command)
+			assert.Equal(t, tc.name, name)
+			assert.Equal(t, tc.args, args)
+		})
+	}
+}
+
+func TestParseUmask(t *testing.T) {
+	umask, err := parseUmask("027")
+	assert.NoError(t, err)
+	assert.Equal(t, 0o027, umask)
+
+	umask, err = parseUmask("0")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, umask)
+
+	for _, s := range []string{"", "8", "1000", "-1", "rwx"} {
+		_, err := parseUmask(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestServicesFromEnv(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		v, ok := map[string]string{"ENVIRONMENT": "production", "EMPTY": ""}[name]
+		return v, ok
+	}
+
+	services, err := servicesFromEnv("global, app/$ENVIRONMENT,,${ENVIRONMENT}-db", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"global", "app/production", "production-db"}, services)
+
+	_, err = servicesFromEnv("global,app/$REGION/$STAGE", lookup)
+	assert.EqualError(t, err, "$CHAMBER_SERVICES refers to unset variables: REGION, STAGE")
+
+	_, err = servicesFromEnv("$EMPTY", lookup)
+	assert.EqualError(t, err, "$CHAMBER_SERVICES lists no services")
+}
+
+func TestResolveCredential(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on numeric uids")
+	}
+	current, err := user.Current()
+	require.NoError(t, err)
+	currentUid, currentGid := os.Getuid(), os.Getgid()
+
+	uid, gid, groups, err := resolveCredential("", "")
+	require.NoError(t, err)
+	assert.Equal(t, currentUid, uid)
+	assert.Equal(t, currentGid, gid)
+	assert.Equal(t, []int{currentGid}, groups)
+
+	for _, spec := range []string{current.Username, current.Uid} {
+		uid, gid, groups, err = resolveCredential(spec, "")
+		require.NoError(t, err, spec)
+		assert.Equal(t, currentUid, uid, spec)
+		assert.Equal(t, current.Gid, strconv.Itoa(gid), spec)
+		assert.NotEmpty(t, groups, spec)
+	}
+
+	// a group replaces the groups of the user
+	uid, gid, groups, err = resolveCredential(current.Uid, "987655")
+	require.NoError(t, err)
+	assert.Equal(t, currentUid, uid)
+	assert.Equal(t, 987655, gid)
+	assert.Equal(t, []int{987655}, groups)
+
+	// a uid without a passwd entry has no group of its own
+	_, _, _, err = resolveCredential("987654", "")
+	assert.ErrorContains(t, err, "--group must be given")
+	uid, gid, groups, err = resolveCredential("987654", strconv.Itoa(currentGid))
+	require.NoError(t, err)
+	assert.Equal(t, 987654, uid)
+	assert.Equal(t, currentGid, gid)
+	assert.Equal(t, []int{currentGid}, groups)
+
+	_, _, _, err = resolveCredential("no-such-chamber-user", "")
+	assert.Error(t, err)
+	_, _, _, err = resolveCredential("", "no-such-chamber-group")
+	assert.Error(t, err)
+}
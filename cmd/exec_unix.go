@@ -21,3 +21,21 @@ func exec(command string, args []string, env []string) error {
 	// Only returns if the execution fails.
 	return unix.Exec(argv0, argv, env)
 }
+
+// setUmask sets the umask inherited by the command
+func setUmask(umask int) error {
+	unix.Umask(umask)
+	return nil
+}
+
+// dropPrivileges switches the process to the given credentials. Groups must be
+// changed before the uid, since an unprivileged user can no longer change them.
+func dropPrivileges(uid, gid int, groups []int) error {
+	if err := unix.Setgroups(groups); err != nil {
+		return err
+	}
+	if err := unix.Setgid(gid); err != nil {
+		return err
+	}
+	return unix.Setuid(uid)
+}
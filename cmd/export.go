@@ -2,16 +2,25 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/base64"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/magiconair/properties"
 
 	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
 	"github.com/segmentio/chamber/v2/utils"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
@@ -22,18 +31,58 @@ var (
 	exportFormat string
 	exportOutput string
 
+	// metadata of the Secret written by the k8s-secret format
+	exportK8sName       string
+	exportK8sNamespace  string
+	exportK8sSecretType string
+
+	exportTemplate string
+	exportSortBy   string
+
+	exportWithMetadata    bool
+	exportAnnotateSource  bool
+	exportFailOnCollision bool
+	exportEncrypt         string
+	exportConcurrency     int
+
+	// exportSources, when set, maps each key to the service it was taken
+	// from, for the dotenv and json formats to record; set by
+	// --annotate-source
+	exportSources map[string]string
+
 	exportCmd = &cobra.Command{
 		Use:   "export <service...>",
 		Short: "Exports parameters in the specified format",
-		Args:  cobra.MinimumNArgs(1),
-		RunE:  runExport,
+		Long: `Exports parameters in the specified format.
+
+When several services are given, a key defined by more than one of them takes
+the value of the last one, and a warning is printed. With --recursive, the
+services nested under each service come after it, so deeper services win.
+--annotate-source records which service each key was taken from, and
+--fail-on-collision makes keys defined by more than one service an error.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runExport,
 	}
 )
 
 func init() {
 	exportCmd.Flags().SortFlags = false
-	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", "json", "Output format (json, yaml, java-properties, csv, tsv, dotenv, tfvars)")
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", "json", "Output format (json, yaml, java-properties, csv, tsv, dotenv, tfvars, k8s-secret, systemd, shell, powershell)")
 	exportCmd.Flags().StringVarP(&exportOutput, "output-file", "o", "", "Output file (default is standard output)")
+	exportCmd.Flags().BoolVar(&expandJSON, "expand-json", false, "Flatten secrets whose values are JSON objects into key_subkey parameters")
+	exportCmd.Flags().BoolVar(&recursive, "recursive", false, "Load the services nested under each service too, like myapp/worker for myapp; deeper services take precedence")
+	exportCmd.Flags().BoolVar(&interpolate, "interpolate", false, "Resolve references to other keys of the same service, like {{ .db_user }}, in values")
+	exportCmd.Flags().StringVar(&exportSortBy, "sort-by", "key", "Order keys by key, or by modified time, oldest first")
+	exportCmd.Flags().StringVar(&keyCollation, "sort-keys", utils.CollationBytewise, sortKeysUsage+"; keys modified at the same time with --sort-by modified stay in this order")
+	exportCmd.Flags().StringVar(&exportK8sName, "name", "", "Name of the Secret, for the k8s-secret format")
+	exportCmd.Flags().StringVar(&exportK8sNamespace, "namespace", "", "Namespace of the Secret, for the k8s-secret format; by default it is left to kubectl")
+	exportCmd.Flags().StringVar(&exportK8sSecretType, "secret-type", "Opaque", "Type of the Secret, for the k8s-secret format")
+	exportCmd.Flags().BoolVar(&exportWithMetadata, "with-metadata", false, "Export the version, modification time and user, and KMS key of each secret along with its value, for the json and yaml formats")
+	exportCmd.Flags().BoolVar(&exportAnnotateSource, "annotate-source", false, "Record the service each key was taken from, as comments in dotenv and a __source object in json")
+	exportCmd.Flags().BoolVar(&exportFailOnCollision, "fail-on-collision", false, "Fail when more than one service defines a key, rather than taking the last one")
+	exportCmd.Flags().IntVar(&exportConcurrency, "concurrency", DefaultConcurrency, "How many services to fetch at once; requests the backend throttles are retried after a pause")
+	exportCmd.Flags().StringVar(&exportEncrypt, "encrypt", "", "Encrypt the export into a bundle for a recipient, kms:<key-id>, which chamber import --decrypt reads")
+	exportCmd.Flags().StringVar(&exportTemplate, "template", "", "Render secrets through a Go template file instead of a format, e.g. app.properties.tmpl")
 
 	RootCmd.AddCommand(exportCmd)
 }
@@ -41,6 +90,42 @@ func init() {
 func runExport(cmd *cobra.Command, args []string) error {
 	var err error
 
+	if err := utils.ValidateCollation(keyCollation); err != nil {
+		return fmt.Errorf("Invalid --sort-keys: %w", err)
+	}
+	if exportSortBy != "key" && exportSortBy != "modified" {
+		return fmt.Errorf("Invalid --sort-by %q: must be key or modified", exportSortBy)
+	}
+	yamlKeysSorted = cmd.Flags().Changed("sort-keys") || exportSortBy == "modified"
+	if strings.ToLower(exportFormat) == "k8s-secret" && exportK8sName == "" {
+		return errors.New("--name is required for the k8s-secret format")
+	}
+	if exportWithMetadata {
+		if f := strings.ToLower(exportFormat); exportTemplate != "" || (f != "json" && f != "yaml") {
+			return errors.New("--with-metadata is only supported by the json and yaml formats")
+		}
+	}
+	if exportAnnotateSource {
+		if f := strings.ToLower(exportFormat); exportTemplate != "" || (f != "dotenv" && f != "json") {
+			return errors.New("--annotate-source is only supported by the dotenv and json formats")
+		}
+	}
+	var encryptKeyID string
+	if exportEncrypt != "" {
+		if _, encryptKeyID, err = parseBundleRecipient(exportEncrypt); err != nil {
+			return fmt.Errorf("Invalid --encrypt: %w", err)
+		}
+	}
+	var tmpl *template.Template
+	if exportTemplate != "" {
+		if cmd.Flags().Changed("format") {
+			return errors.New("--template and --format are mutually exclusive")
+		}
+		if tmpl, err = parseExportTemplate(exportTemplate); err != nil {
+			return err
+		}
+	}
+
 	if analyticsEnabled && analyticsClient != nil {
 		analyticsClient.Enqueue(analytics.Track{
 			UserId: username,
@@ -57,23 +142,101 @@ func runExport(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	params := make(map[string]string)
+	secretStore = withValueTransforms(secretStore)
+
+	services := make([]string, 0, len(args))
 	for _, service := range args {
 		service = utils.NormalizeService(service)
-		if err := validateService(service); err != nil {
+		if isServiceGlob(service) {
+			if err := validateServiceGlob(service); err != nil {
+				return err
+			}
+		} else if err := validateService(service); err != nil {
 			return fmt.Errorf("Failed to validate service %s: %w", service, err)
 		}
+		services = append(services, service)
+	}
+	services, unmatched, err := expandServiceGlobs(secretStore, services)
+	if err != nil {
+		return err
+	}
+	if len(unmatched) > 0 {
+		return fmt.Errorf("no services match %s", strings.Join(unmatched, ", "))
+	}
+	if recursive {
+		if services, err = withNestedServices(secretStore, services); err != nil {
+			return err
+		}
+	}
 
-		rawSecrets, err := secretStore.ListRaw(service)
+	// services are fetched concurrently, then merged in order
+	fetched := make([][]store.RawSecret, len(services))
+	errs := runPool(exportConcurrency, len(services), func(i int) error {
+		var err error
+		fetched[i], err = secretStore.ListRaw(services[i])
+		return err
+	})
+	for i, err := range errs {
 		if err != nil {
-			return fmt.Errorf("Failed to list store contents for service %s: %w", service, err)
+			return fmt.Errorf("Failed to list store contents for service %s: %w", services[i], err)
 		}
-		for _, rawSecret := range rawSecrets {
+	}
+
+	params := make(map[string]string)
+	// the service each key was taken from
+	sources := make(map[string]string)
+	// the services defining each key more than once
+	collisions := make(map[string][]string)
+	for i, service := range services {
+		for _, rawSecret := range fetched[i] {
 			k := key(rawSecret.Key)
 			if _, ok := params[k]; ok {
-				fmt.Fprintf(os.Stderr, "warning: parameter %s specified more than once (overridden by service %s)\n", k, service)
+				if len(collisions[k]) == 0 {
+					collisions[k] = []string{sources[k]}
+				}
+				collisions[k] = append(collisions[k], service)
+				if !exportFailOnCollision {
+					fmt.Fprintf(os.Stderr, "warning: parameter %s specified more than once (overridden by service %s)\n", k, service)
+				}
 			}
 			params[k] = rawSecret.Value
+			sources[k] = service
+		}
+	}
+
+	if exportFailOnCollision && len(collisions) > 0 {
+		return collisionError(collisions)
+	}
+	if exportAnnotateSource {
+		exportSources = sources
+	}
+
+	metadata := make(map[string]store.SecretMetadata)
+	if exportSortBy == "modified" || exportWithMetadata {
+		// raw secrets carry no metadata. Keys that aren't stored as such,
+		// like those expanded from JSON, have none.
+		listed := make([][]store.Secret, len(services))
+		errs := runPool(exportConcurrency, len(services), func(i int) error {
+			var err error
+			listed[i], err = secretStore.List(services[i], false)
+			return err
+		})
+		for i, service := range services {
+			if errs[i] != nil {
+				return fmt.Errorf("Failed to list store contents for service %s: %w", service, errs[i])
+			}
+			for _, secret := range listed[i] {
+				if k := key(secret.Meta.Key); sources[k] == service {
+					metadata[k] = secret.Meta
+				}
+			}
+		}
+	}
+	if exportSortBy == "modified" {
+		// keys without metadata have no time, and come first
+		keyModified = make(map[string]time.Time, len(metadata))
+		for k, meta := range metadata {
+			keyModified[k] = meta.Created
 		}
 	}
 
@@ -88,21 +251,50 @@ func runExport(cmd *cobra.Command, args []string) error {
 	w := bufio.NewWriter(file)
 	defer w.Flush()
 
-	switch strings.ToLower(exportFormat) {
+	// with --encrypt, the export is encrypted once complete
+	var out io.Writer = w
+	plaintext := &bytes.Buffer{}
+	if exportEncrypt != "" {
+		out = plaintext
+	}
+
+	format := strings.ToLower(exportFormat)
+	if tmpl != nil {
+		format = "template"
+	}
+	switch format {
+	case "template":
+		err = tmpl.Execute(out, params)
 	case "json":
-		err = exportAsJson(params, w)
+		if exportWithMetadata {
+			err = exportAsJsonWithMetadata(params, metadata, out)
+		} else {
+			err = exportAsJson(params, out)
+		}
 	case "yaml":
-		err = exportAsYaml(params, w)
+		if exportWithMetadata {
+			err = exportAsYamlWithMetadata(params, metadata, out)
+		} else {
+			err = exportAsYaml(params, out)
+		}
 	case "java-properties", "properties":
-		err = exportAsJavaProperties(params, w)
+		err = exportAsJavaProperties(params, out)
 	case "csv":
-		err = exportAsCsv(params, w)
+		err = exportAsCsv(params, out)
 	case "tsv":
-		err = exportAsTsv(params, w)
+		err = exportAsTsv(params, out)
 	case "dotenv":
-		err = exportAsEnvFile(params, w)
+		err = exportAsEnvFile(params, out)
 	case "tfvars":
-		err = exportAsTFvars(params, w)
+		err = exportAsTFvars(params, out)
+	case "k8s-secret":
+		err = exportAsK8sSecret(params, out)
+	case "systemd":
+		err = exportAsSystemd(params, out)
+	case "shell":
+		err = exportAsShell(params, out)
+	case "powershell":
+		err = exportAsPowerShell(params, out)
 	default:
 		err = fmt.Errorf("Unsupported export format: %s", exportFormat)
 	}
@@ -111,6 +303,20 @@ func runExport(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("Unable to export parameters: %w", err)
 	}
 
+	if exportEncrypt != "" {
+		svc, err := newBundleKMS()
+		if err != nil {
+			return fmt.Errorf("Failed to create KMS client: %w", err)
+		}
+		bundle, err := sealBundle(svc, encryptKeyID, format, plaintext.Bytes())
+		if err != nil {
+			return err
+		}
+		if err := json.NewEncoder(w).Encode(bundle); err != nil {
+			return fmt.Errorf("Unable to write bundle: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -129,7 +335,13 @@ func exportAsEnvFile(params map[string]string, w io.Writer) error {
 		return err
 	}
 
+	keys := sortedKeys(params)
 	for i := range out {
+		if service, ok := exportSources[keys[i]]; ok {
+			if _, err := fmt.Fprintf(w, "# from %s\n", service); err != nil {
+				return err
+			}
+		}
 		_, err := w.Write([]byte(fmt.Sprintln(out[i])))
 		if err != nil {
 			return err
@@ -139,25 +351,387 @@ func exportAsEnvFile(params map[string]string, w io.Writer) error {
 	return nil
 }
 
+// collisionError lists the keys defined by more than one service, and the
+// services defining them
+func collisionError(collisions map[string][]string) error {
+	keys := make([]string, 0, len(collisions))
+	for k := range collisions {
+		keys = append(keys, k)
+	}
+	utils.SortKeys(keyCollation, keys)
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("%s (%s)", k, strings.Join(collisions[k], ", ")))
+	}
+	return fmt.Errorf("keys defined by more than one service:\n%s", strings.Join(lines, "\n"))
+}
+
 func exportAsTFvars(params map[string]string, w io.Writer) error {
 	// Terraform Variables is like dotenv, but removes the TF_VAR and keeps lowercase
 	for _, k := range sortedKeys(params) {
 		key := sanitizeKey(strings.TrimPrefix(k, "tf_var_"))
+		if !hclIdentifier.MatchString(key) {
+			return fmt.Errorf("%q is not a valid Terraform variable name", key)
+		}
+
+		if _, err := fmt.Fprintf(w, "%s = %s\n", key, hclValue(params[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		w.Write([]byte(fmt.Sprintf(`%s = "%s"`+"\n", key, doubleQuoteEscape(params[k]))))
+// exportTemplateFuncs are the functions available to --template, besides
+// the builtin ones of Go templates
+var exportTemplateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"indent": func(spaces int, s string) string {
+		pad := strings.Repeat(" ", spaces)
+		return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+	},
+	"b64enc": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"quote": strconv.Quote,
+}
+
+// parseExportTemplate parses the template at path. Secrets are its data, so
+// that {{ .db_password }} is the value of db_password; keys that don't exist
+// are an error rather than an empty string.
+func parseExportTemplate(path string) (*template.Template, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(exportTemplateFuncs).Option("missingkey=error").Parse(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// systemdEscaper escapes the characters systemd unescapes in double quoted
+// values of an EnvironmentFile. Newlines are kept as is, since they are part
+// of the value inside quotes.
+var systemdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+
+func exportAsSystemd(params map[string]string, w io.Writer) error {
+	// systemd EnvironmentFile like:
+	// PARAM1="value1"
+	// PARAM2="value2"
+	// named as with dotenv, but without shell escapes systemd would keep
+	for _, k := range sortedKeys(params) {
+		name, err := exportVarName(k)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s=\"%s\"\n", name, systemdEscaper.Replace(params[k])); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+func exportAsShell(params map[string]string, w io.Writer) error {
+	// POSIX shell like:
+	// export PARAM1='value1'
+	// values are always single quoted, where nothing is special but the
+	// quote itself, so eval'ing the output never runs anything
+	for _, k := range sortedKeys(params) {
+		name, err := exportVarName(k)
+		if err != nil {
+			return err
+		}
+		value := "'" + strings.ReplaceAll(params[k], "'", `'\''`) + "'"
+		if _, err := fmt.Fprintf(w, "export %s=%s\n", name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// powerShellEscaper escapes the characters that are special in double quoted
+// PowerShell strings with backticks. PowerShell also takes typographic
+// double quotes as quotes.
+var powerShellEscaper = strings.NewReplacer("`", "``", `$`, "`$", `"`, "`\"", "\u201c", "`\u201c", "\u201d", "`\u201d", "\u201e", "`\u201e")
+
+func exportAsPowerShell(params map[string]string, w io.Writer) error {
+	// PowerShell like:
+	// $env:PARAM1 = "value1"
+	for _, k := range sortedKeys(params) {
+		name, err := exportVarName(k)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "$env:%s = \"%s\"\n", name, powerShellEscaper.Replace(params[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportVarName names the environment variable of key as the dotenv format
+// does
+func exportVarName(key string) (string, error) {
+	name := sanitizeKey(key)
+	if !preserveCase {
+		name = strings.ToUpper(name)
+	}
+	if err := validateShellName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// k8sSecret is a Kubernetes Secret manifest
+type k8sSecret struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sSecretMetadata `yaml:"metadata"`
+	Type       string            `yaml:"type"`
+	Data       *yaml.Node        `yaml:"data"`
+}
+
+type k8sSecretMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// k8sSecretKey matches the keys Kubernetes allows in the data of a Secret
+var k8sSecretKey = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+func exportAsK8sSecret(params map[string]string, w io.Writer) error {
+	// a mapping node keeps keys in order
+	data := &yaml.Node{Kind: yaml.MappingNode}
+	for _, k := range sortedKeys(params) {
+		if !k8sSecretKey.MatchString(k) {
+			return fmt.Errorf("%q is not a valid key for a Kubernetes Secret", k)
+		}
+		data.Content = append(data.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: base64.StdEncoding.EncodeToString([]byte(params[k]))})
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	return encoder.Encode(k8sSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   k8sSecretMetadata{Name: exportK8sName, Namespace: exportK8sNamespace},
+		Type:       exportK8sSecretType,
+		Data:       data,
+	})
+}
+
+// hclIdentifier matches the names HCL allows for variables
+var hclIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// hclTemplateEscaper keeps values from being read as HCL template sequences,
+// in quoted strings and heredocs alike
+var hclTemplateEscaper = strings.NewReplacer("${", "$${", "%{", "%%{")
+
+// hclValue writes value as an HCL string literal. Multi-line values ending
+// with a newline, like PEM files, are written as heredocs, which always end
+// with one; other values are quoted.
+func hclValue(value string) string {
+	if strings.HasSuffix(value, "\n") && !strings.ContainsRune(value, '\r') {
+		lines := strings.Split(strings.TrimSuffix(value, "\n"), "\n")
+		if len(lines) > 1 {
+			delimiter := "EOT"
+			for i := 1; containsLine(lines, delimiter); i++ {
+				delimiter = fmt.Sprintf("EOT%d", i)
+			}
+			return "<<" + delimiter + "\n" + hclTemplateEscaper.Replace(value) + delimiter
+		}
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range hclTemplateEscaper.Replace(value) {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// containsLine reports whether any of lines, trimmed, is line
+func containsLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if strings.TrimSpace(l) == line {
+			return true
+		}
+	}
+	return false
+}
+
 func exportAsJson(params map[string]string, w io.Writer) error {
 	// JSON like:
 	// {"param1":"value1","param2":"value2"}
-	// NOTE: json encoder does sorting by key
-	return json.NewEncoder(w).Encode(params)
+	// keys are written one by one, since the json encoder always sorts them
+	// bytewise
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	keys := sortedKeys(params)
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(params[k])
+		if err != nil {
+			return err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	if err := writeJSONSources(buf, keys); err != nil {
+		return err
+	}
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeJSONSources adds the __source object of --annotate-source to the
+// fields written to buf, mapping each key to the service it was taken from
+func writeJSONSources(buf *bytes.Buffer, keys []string) error {
+	if exportSources == nil {
+		return nil
+	}
+	if len(keys) > 0 {
+		buf.WriteByte(',')
+	}
+	buf.WriteString(`"__source":{`)
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+		service, err := json.Marshal(exportSources[k])
+		if err != nil {
+			return err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(service)
+	}
+	buf.WriteByte('}')
+	return nil
 }
 
 func exportAsYaml(params map[string]string, w io.Writer) error {
-	return yaml.NewEncoder(w).Encode(params)
+	if !yamlKeysSorted {
+		return yaml.NewEncoder(w).Encode(params)
+	}
+	// a mapping node keeps the order of keys, which the yaml encoder would
+	// otherwise sort its own way
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, k := range sortedKeys(params) {
+		doc.Content = append(doc.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: params[k]})
+	}
+	return yaml.NewEncoder(w).Encode(doc)
+}
+
+// exportedSecret is a secret exported with --with-metadata. Keys that aren't
+// stored as such, like those expanded from JSON, only have a value.
+type exportedSecret struct {
+	Value      string     `json:"value" yaml:"value"`
+	Version    int        `json:"version,omitempty" yaml:"version,omitempty"`
+	Modified   *time.Time `json:"modified,omitempty" yaml:"modified,omitempty"`
+	ModifiedBy string     `json:"modified_by,omitempty" yaml:"modified_by,omitempty"`
+	KMSKey     string     `json:"kms_key,omitempty" yaml:"kms_key,omitempty"`
+}
+
+func newExportedSecret(value string, meta store.SecretMetadata, ok bool) exportedSecret {
+	s := exportedSecret{Value: value}
+	if ok {
+		modified := meta.Created.UTC()
+		s.Version = meta.Version
+		s.Modified = &modified
+		s.ModifiedBy = meta.CreatedBy
+		s.KMSKey = meta.KMSKey
+	}
+	return s
+}
+
+func exportAsJsonWithMetadata(params map[string]string, metadata map[string]store.SecretMetadata, w io.Writer) error {
+	// JSON like:
+	// {"param1":{"value":"value1","version":2,"modified":"...","modified_by":"..."}}
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	keys := sortedKeys(params)
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+		meta, ok := metadata[k]
+		value, err := json.Marshal(newExportedSecret(params[k], meta, ok))
+		if err != nil {
+			return err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	if err := writeJSONSources(buf, keys); err != nil {
+		return err
+	}
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func exportAsYamlWithMetadata(params map[string]string, metadata map[string]store.SecretMetadata, w io.Writer) error {
+	if !yamlKeysSorted {
+		secrets := make(map[string]exportedSecret, len(params))
+		for k, v := range params {
+			meta, ok := metadata[k]
+			secrets[k] = newExportedSecret(v, meta, ok)
+		}
+		return yaml.NewEncoder(w).Encode(secrets)
+	}
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, k := range sortedKeys(params) {
+		meta, ok := metadata[k]
+		value := &yaml.Node{}
+		if err := value.Encode(newExportedSecret(params[k], meta, ok)); err != nil {
+			return err
+		}
+		doc.Content = append(doc.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k},
+			value)
+	}
+	return yaml.NewEncoder(w).Encode(doc)
 }
 
 func exportAsJavaProperties(params map[string]string, w io.Writer) error {
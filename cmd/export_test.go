@@ -2,9 +2,16 @@ package cmd
 
 import (
 	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -40,3 +47,313 @@ func TestExportDotenv(t *testing.T) {
 		})
 	}
 }
+
+func TestExportSortKeys(t *testing.T) {
+	defer func() { keyCollation, yamlKeysSorted = utils.CollationBytewise, false }()
+	params := map[string]string{"key10": "ten", "key2": "two", "Key1": "one", "b": "true"}
+
+	// without --sort-keys, YAML keeps the order of yaml.v3
+	buf := &bytes.Buffer{}
+	assert.NoError(t, exportAsYaml(params, buf))
+	assert.Equal(t, "Key1: one\nb: \"true\"\nkey2: two\nkey10: ten\n", buf.String())
+	yamlKeysSorted = true
+
+	tests := []struct {
+		collation string
+		json      string
+		yaml      string
+	}{
+		{
+			collation: utils.CollationBytewise,
+			json:      `{"Key1":"one","b":"true","key10":"ten","key2":"two"}` + "\n",
+			yaml:      "Key1: one\nb: \"true\"\nkey10: ten\nkey2: two\n",
+		},
+		{
+			collation: utils.CollationNatural,
+			json:      `{"Key1":"one","b":"true","key2":"two","key10":"ten"}` + "\n",
+			yaml:      "Key1: one\nb: \"true\"\nkey2: two\nkey10: ten\n",
+		},
+		{
+			collation: utils.CollationIgnoreCase,
+			json:      `{"b":"true","Key1":"one","key10":"ten","key2":"two"}` + "\n",
+			yaml:      "b: \"true\"\nKey1: one\nkey10: ten\nkey2: two\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.collation, func(t *testing.T) {
+			keyCollation = test.collation
+
+			buf := &bytes.Buffer{}
+			assert.NoError(t, exportAsJson(params, buf))
+			assert.Equal(t, test.json, buf.String())
+
+			buf.Reset()
+			assert.NoError(t, exportAsYaml(params, buf))
+			assert.Equal(t, test.yaml, buf.String())
+		})
+	}
+}
+
+func TestExportTFvars(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]string
+		output string
+	}{
+		{
+			name:   "simple string, and TF_VAR prefix removed",
+			params: map[string]string{"tf_var_region": "us-east-1"},
+			output: "region = \"us-east-1\"\n",
+		},
+		{
+			name:   "quotes, backslashes and shell specials",
+			params: map[string]string{"password": `a"b\c$d!e` + "`"},
+			output: `password = "a\"b\\c$d!e` + "`" + `"` + "\n",
+		},
+		{
+			name:   "template sequences are escaped",
+			params: map[string]string{"template": "${var.x} %{ if true }"},
+			output: `template = "$${var.x} %%{ if true }"` + "\n",
+		},
+		{
+			name:   "multi-line values ending with a newline use heredocs",
+			params: map[string]string{"tls_key": "-----BEGIN KEY-----\nabc\n-----END KEY-----\n"},
+			output: "tls_key = <<EOT\n-----BEGIN KEY-----\nabc\n-----END KEY-----\nEOT\n",
+		},
+		{
+			name:   "heredoc delimiters don't clash with lines",
+			params: map[string]string{"doc": "EOT\nEOT1\n"},
+			output: "doc = <<EOT2\nEOT\nEOT1\nEOT2\n",
+		},
+		{
+			name:   "other multi-line values are quoted",
+			params: map[string]string{"lines": "one\r\ntwo\tthree"},
+			output: `lines = "one\r\ntwo\tthree"` + "\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			assert.NoError(t, exportAsTFvars(test.params, buf))
+			assert.Equal(t, test.output, buf.String())
+		})
+	}
+
+	assert.Error(t, exportAsTFvars(map[string]string{"1st": "x"}, &bytes.Buffer{}))
+}
+
+func TestExportK8sSecret(t *testing.T) {
+	defer func(name, namespace, secretType string) {
+		exportK8sName, exportK8sNamespace, exportK8sSecretType = name, namespace, secretType
+	}(exportK8sName, exportK8sNamespace, exportK8sSecretType)
+
+	exportK8sName, exportK8sNamespace, exportK8sSecretType = "mysecret", "prod", "Opaque"
+	buf := &bytes.Buffer{}
+	assert.NoError(t, exportAsK8sSecret(map[string]string{"db_password": "p@ss", "API.KEY": "line1\nline2"}, buf))
+	assert.Equal(t, `apiVersion: v1
+kind: Secret
+metadata:
+  name: mysecret
+  namespace: prod
+type: Opaque
+data:
+  API.KEY: bGluZTEKbGluZTI=
+  db_password: cEBzcw==
+`, buf.String())
+
+	exportK8sNamespace, exportK8sSecretType = "", "kubernetes.io/basic-auth"
+	buf.Reset()
+	assert.NoError(t, exportAsK8sSecret(map[string]string{"username": "admin"}, buf))
+	assert.Equal(t, `apiVersion: v1
+kind: Secret
+metadata:
+  name: mysecret
+type: kubernetes.io/basic-auth
+data:
+  username: YWRtaW4=
+`, buf.String())
+
+	assert.Error(t, exportAsK8sSecret(map[string]string{"bad/key": "x"}, &bytes.Buffer{}))
+}
+
+func TestExportSystemd(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, exportAsSystemd(map[string]string{
+		"db-host":    "localhost",
+		"password":   `a"b\c$d` + "`e",
+		"tls.key":    "line1\nline2\n",
+		"empty":      "",
+		"with space": "x y",
+	}, buf))
+	assert.Equal(t, `DB_HOST="localhost"
+EMPTY=""
+PASSWORD="a\"b\\c\$d\`+"`"+`e"
+TLS_KEY="line1
+line2
+"
+WITH_SPACE="x y"
+`, buf.String())
+
+	assert.Error(t, exportAsSystemd(map[string]string{"1st": "x"}, &bytes.Buffer{}))
+}
+
+func TestExportShell(t *testing.T) {
+	params := map[string]string{
+		"db-host":  "localhost",
+		"password": `it's "$HOME"` + "`id`",
+		"tls.key":  "line1\nline2",
+	}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, exportAsShell(params, buf))
+	assert.Equal(t, `export DB_HOST='localhost'
+export PASSWORD='it'\''s "$HOME"`+"`id`"+`'
+export TLS_KEY='line1
+line2'
+`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, exportAsPowerShell(params, buf))
+	assert.Equal(t, `$env:DB_HOST = "localhost"
+$env:PASSWORD = "it's `+"`\"`$HOME`\"``id``"+`"
+$env:TLS_KEY = "line1
+line2"
+`, buf.String())
+
+	assert.Error(t, exportAsShell(map[string]string{"1st": "x"}, &bytes.Buffer{}))
+	assert.Error(t, exportAsPowerShell(map[string]string{"1st": "x"}, &bytes.Buffer{}))
+}
+
+func TestExportTemplate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.tmpl")
+	assert.NoError(t, os.WriteFile(path, []byte(`user={{ .db_user | upper }}
+password={{ quote .db_password }}
+auth={{ printf "%s:%s" .db_user .db_password | b64enc }}
+{{ range $k, $v := . }}{{ lower $k }};{{ end }}
+key: |
+{{ indent 2 .tls_key }}
+`), 0644))
+
+	tmpl, err := parseExportTemplate(path)
+	assert.NoError(t, err)
+	buf := &bytes.Buffer{}
+	assert.NoError(t, tmpl.Execute(buf, map[string]string{
+		"db_user":     "admin",
+		"db_password": `p"w`,
+		"tls_key":     "line1\nline2",
+	}))
+	assert.Equal(t, `user=ADMIN
+password="p\"w"
+auth=YWRtaW46cCJ3
+db_password;db_user;tls_key;
+key: |
+  line1
+  line2
+`, buf.String())
+
+	assert.Error(t, tmpl.Execute(&bytes.Buffer{}, map[string]string{"db_user": "admin"}), "missing keys are an error")
+
+	assert.NoError(t, os.WriteFile(path, []byte("{{ .unclosed"), 0644))
+	_, err = parseExportTemplate(path)
+	assert.Error(t, err)
+}
+
+func TestExportSortByModified(t *testing.T) {
+	defer func() { keyModified = nil }()
+	now := time.Now()
+	params := map[string]string{"a": "1", "b": "2", "c": "3", "expanded": "4"}
+	keyModified = map[string]time.Time{
+		"a": now,
+		"b": now.Add(-time.Hour),
+		"c": now.Add(-time.Hour),
+	}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, exportAsJson(params, buf))
+	assert.Equal(t, `{"expanded":"4","b":"2","c":"3","a":"1"}`+"\n", buf.String())
+}
+
+func TestExportDeterministic(t *testing.T) {
+	exporters := map[string]func(map[string]string, io.Writer) error{
+		"json":            exportAsJson,
+		"yaml":            exportAsYaml,
+		"java-properties": exportAsJavaProperties,
+		"csv":             exportAsCsv,
+		"tsv":             exportAsTsv,
+		"dotenv":          exportAsEnvFile,
+		"tfvars":          exportAsTFvars,
+		"systemd":         exportAsSystemd,
+		"shell":           exportAsShell,
+		"powershell":      exportAsPowerShell,
+	}
+	params := map[string]string{}
+	for i := 0; i < 50; i++ {
+		params[fmt.Sprintf("key_%d", i)] = fmt.Sprintf("value %d", i)
+	}
+	for name, export := range exporters {
+		t.Run(name, func(t *testing.T) {
+			first := &bytes.Buffer{}
+			assert.NoError(t, export(params, first))
+			for i := 0; i < 10; i++ {
+				buf := &bytes.Buffer{}
+				assert.NoError(t, export(params, buf))
+				assert.Equal(t, first.String(), buf.String())
+			}
+		})
+	}
+}
+
+func TestExportWithMetadata(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	params := map[string]string{"db_password": "secret", "config_port": "5432"}
+	metadata := map[string]store.SecretMetadata{
+		"db_password": {Key: "/app/db_password", Version: 3, Created: modified, CreatedBy: "arn:aws:iam::123456789012:user/alice", KMSKey: "alias/app"},
+	}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, exportAsJsonWithMetadata(params, metadata, buf))
+	assert.Equal(t, `{"config_port":{"value":"5432"},"db_password":{"value":"secret","version":3,"modified":"2024-05-01T12:00:00Z","modified_by":"arn:aws:iam::123456789012:user/alice","kms_key":"alias/app"}}`+"\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, exportAsYamlWithMetadata(params, metadata, buf))
+	assert.Equal(t, `config_port:
+    value: "5432"
+db_password:
+    value: secret
+    version: 3
+    modified: 2024-05-01T12:00:00Z
+    modified_by: arn:aws:iam::123456789012:user/alice
+    kms_key: alias/app
+`, buf.String())
+}
+
+func TestExportAnnotateSource(t *testing.T) {
+	defer func() { exportSources = nil }()
+	exportSources = map[string]string{"db_password": "app", "region": "shared"}
+	params := map[string]string{"db_password": "secret", "region": "us-east-1"}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, exportAsEnvFile(params, buf))
+	assert.Equal(t, `# from app
+DB_PASSWORD="secret"
+# from shared
+REGION="us-east-1"
+`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, exportAsJson(params, buf))
+	assert.Equal(t, `{"db_password":"secret","region":"us-east-1","__source":{"db_password":"app","region":"shared"}}`+"\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, exportAsJson(map[string]string{}, buf))
+	assert.Equal(t, `{"__source":{}}`+"\n", buf.String())
+}
+
+func TestCollisionError(t *testing.T) {
+	err := collisionError(map[string][]string{
+		"region":      {"shared", "app"},
+		"db_password": {"shared", "app", "app/worker"},
+	})
+	assert.EqualError(t, err, "keys defined by more than one service:\ndb_password (shared, app, app/worker)\nregion (shared, app)")
+}
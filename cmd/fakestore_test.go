@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/segmentio/chamber/v2/store"
+)
+
+// newFakeStore returns a MemoryStore holding secrets, for testing commands
+func newFakeStore(secrets map[string]map[string]string) *store.MemoryStore {
+	s := store.NewMemoryStore()
+	for service, keys := range secrets {
+		for k, v := range keys {
+			s.Write(store.SecretId{Service: service, Key: k}, v)
+		}
+	}
+	return s
+}
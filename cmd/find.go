@@ -1,74 +1,130 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 	"text/tabwriter"
 
 	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
 	"github.com/spf13/cobra"
 )
 
 // findCmd represents the find command
 var findCmd = &cobra.Command{
-	Use:   "find <secret name>",
+	Use:   "find <secret name> [<service prefix>]",
 	Short: "Find the given secret across all services",
-	Args:  cobra.ExactArgs(1),
-	RunE:  find,
+	Long: `Find the services with a key of the given name, across all services or
+those under a prefix, including nested paths.
+
+--by-value finds the secrets with the given value instead, and --in-values
+those whose value matches a regular expression, such as a leaked API key or
+part of one. Both decrypt every secret searched, which KMS charges for and may
+throttle, so services are fetched --concurrency at a time.`,
+	Example: `
+	$ chamber find db_password
+	$ chamber find 'AKIA[0-9A-Z]{16}' --in-values
+	$ chamber find 'sk_live_abc' --in-values team/`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: find,
+}
+
+// foundSecret is a match as find prints it with --output json or yaml. Key is
+// only set when finding by value.
+type foundSecret struct {
+	Service string `json:"service" yaml:"service"`
+	Key     string `json:"key,omitempty" yaml:"key,omitempty"`
 }
 
 var (
 	blankService   string
 	byValue        bool
+	inValues       bool
 	includeSecrets bool
 	matches        []store.SecretId
+
+	findConcurrency int
 )
 
 func init() {
 	findCmd.Flags().BoolVarP(&byValue, "by-value", "v", false, "Find parameters by value")
+	findCmd.Flags().BoolVar(&inValues, "in-values", false, "Find parameters whose value matches a regular expression")
+	findCmd.Flags().IntVar(&findConcurrency, "concurrency", DefaultConcurrency, "How many services to search at once with --by-value or --in-values")
 	RootCmd.AddCommand(findCmd)
 }
 
 func find(cmd *cobra.Command, args []string) error {
 	findSecret := args[0]
-
-	if byValue {
-		includeSecrets = false
-	} else {
-		includeSecrets = true
+	if byValue && inValues {
+		return errors.New("--by-value and --in-values can't be used together")
+	}
+	searchValues := byValue || inValues
+	match := func(value string) bool { return value == findSecret }
+	if inValues {
+		re, err := regexp.Compile(findSecret)
+		if err != nil {
+			return fmt.Errorf("Invalid --in-values pattern: %w", err)
+		}
+		match = re.MatchString
+	}
+	service := blankService
+	if len(args) == 2 {
+		service = utils.NormalizeService(args[1])
 	}
 
+	includeSecrets = !searchValues
+
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
 	secretStore, err := getSecretStore()
 	if err != nil {
 		return fmt.Errorf("Failed to get secret store: %w", err)
 	}
-	services, err := secretStore.ListServices(blankService, includeSecrets)
+	services, err := listUntrashedServices(secretStore, service, includeSecrets)
 	if err != nil {
 		return fmt.Errorf("Failed to list store contents: %w", err)
 	}
 
-	if byValue {
-		for _, service := range services {
-			allSecrets, err := secretStore.List(service, true)
-			if err == nil {
-				matches = append(matches, findValueMatch(allSecrets, findSecret)...)
+	if searchValues {
+		fmt.Fprintf(os.Stderr, "chamber: searching values decrypts every secret of %d services\n", len(services))
+		found, errs := findValueMatches(secretStore, services, match, findConcurrency)
+		for i, err := range errs {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "chamber: Failed to search service %s: %s\n", services[i], err)
 			}
 		}
+		matches = append(matches, found...)
 	} else {
 		matches = append(matches, findKeyMatch(services, findSecret)...)
 	}
 
+	if structured {
+		found := make([]foundSecret, 0, len(matches))
+		for _, match := range matches {
+			f := foundSecret{Service: match.Service}
+			if searchValues {
+				f.Key = match.Key
+			}
+			found = append(found, f)
+		}
+		return writeStructured(os.Stdout, found)
+	}
+
 	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
 	fmt.Fprint(w, "Service")
-	if byValue {
+	if searchValues {
 		fmt.Fprint(w, "\tKey")
 	}
 	fmt.Fprintln(w, "")
 
 	for _, match := range matches {
 		fmt.Fprintf(w, "%s", match.Service)
-		if byValue {
+		if searchValues {
 			fmt.Fprintf(w, "\t%s", match.Key)
 		}
 		fmt.Fprintln(w, "")
@@ -93,11 +149,30 @@ func findKeyMatch(services []string, searchTerm string) []store.SecretId {
 	return keyMatches
 }
 
-func findValueMatch(secrets []store.Secret, searchTerm string) []store.SecretId {
+// findValueMatches lists services concurrently, returning the secrets whose
+// value matches, in the order of services, and the error listing each service
+func findValueMatches(s store.Store, services []string, match func(string) bool, concurrency int) ([]store.SecretId, []error) {
+	found := make([][]store.SecretId, len(services))
+	errs := runPool(concurrency, len(services), func(i int) error {
+		secrets, err := s.List(services[i], true)
+		if err != nil {
+			return err
+		}
+		found[i] = findValueMatch(secrets, match)
+		return nil
+	})
+	var valueMatches []store.SecretId
+	for _, f := range found {
+		valueMatches = append(valueMatches, f...)
+	}
+	return valueMatches, errs
+}
+
+func findValueMatch(secrets []store.Secret, match func(string) bool) []store.SecretId {
 	valueMatches := []store.SecretId{}
 
 	for _, secret := range secrets {
-		if *secret.Value == searchTerm {
+		if secret.Value != nil && match(*secret.Value) {
 			valueMatches = append(valueMatches, store.SecretId{
 				Service: path(secret.Meta.Key),
 				Key:     key(secret.Meta.Key),
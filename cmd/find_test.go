@@ -2,11 +2,13 @@ package cmd
 
 import (
 	"fmt"
+	"regexp"
 	"testing"
 	"time"
 
 	"github.com/segmentio/chamber/v2/store"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFindFunctions(t *testing.T) {
@@ -218,9 +220,26 @@ func TestFindFunctions(t *testing.T) {
 
 	for _, test := range valueMatchTests {
 		t.Run(test.name, func(t *testing.T) {
-			result := findValueMatch(test.secrets, test.searchTerm)
+			searchTerm := test.searchTerm
+			result := findValueMatch(test.secrets, func(value string) bool { return value == searchTerm })
 			assert.Equal(t, test.output, result)
 		})
 	}
 
 }
+
+func TestFindValueMatches(t *testing.T) {
+	s := store.NewMemoryStore()
+	require.NoError(t, s.Write(store.SecretId{Service: "app", Key: "stripe_key"}, "sk_live_abc123"))
+	require.NoError(t, s.Write(store.SecretId{Service: "app", Key: "other"}, "value"))
+	require.NoError(t, s.Write(store.SecretId{Service: "team/api", Key: "stripe"}, "prefix sk_live_abc123"))
+	require.NoError(t, s.Write(store.SecretId{Service: "worker", Key: "stripe_key"}, "sk_live_def456"))
+
+	re := regexp.MustCompile(`sk_live_abc`)
+	found, errs := findValueMatches(s, []string{"app", "team/api", "worker"}, re.MatchString, 2)
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	assert.Equal(t, []store.SecretId{
+		{Service: "app", Key: "stripe_key"},
+		{Service: "team/api", Key: "stripe"},
+	}, found)
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/generator"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	generatorName   string
+	generatorParams []string
+	listGenerators  bool
+	generateLength  int
+	generateCharset string
+	generateEntropy int
+
+	// generateCmd represents the generate command
+	generateCmd = &cobra.Command{
+		Use:   "generate <service> <key>",
+		Short: "write a newly generated secret",
+		Long: `Write a newly generated secret, without it ever being shown.
+
+Built-in generators and their parameters:
+  random      length (32), charset (alnum), symbols (false)
+  hex         bytes (32)
+  uuid
+  passphrase  words (8), separator (-)
+  rsa         bits (4096)
+  ec          curve (P256, P384 or P521)
+  htpasswd    user, password
+
+Any other generator name runs the executable ` + generator.PluginPrefix + `<name> found on
+the PATH, passing parameters in ` + generator.ParamEnvPrefix + `<NAME> variables, and
+stores what it prints.
+
+--length and --charset set the parameters of the random generator; the
+charsets are ` + strings.Join(generator.CharsetNames(), ", ") + `. --entropy-min refuses
+to write values with fewer bits of entropy, which can only be told for the
+random, hex, uuid and passphrase generators.`,
+		Example: `  chamber generate app db_password --length 40 --charset alnum --entropy-min 128
+  chamber generate app db_password --generator passphrase --param words=10
+  chamber generate app signing_key --generator ec --param curve=P384`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if listGenerators {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(2)(cmd, args)
+		},
+		RunE: generate,
+	}
+)
+
+func init() {
+	generateCmd.Flags().StringVarP(&generatorName, "generator", "g", "random", "generator creating the value")
+	generateCmd.Flags().StringArrayVarP(&generatorParams, "param", "p", nil, "generator parameter as name=value; may be repeated")
+	generateCmd.Flags().BoolVar(&listGenerators, "list", false, "list the built-in generators")
+	generateCmd.Flags().IntVar(&generateLength, "length", 0, "length of the value of the random generator, as with --param length=")
+	generateCmd.Flags().StringVar(&generateCharset, "charset", "", "characters the random generator draws from: "+strings.Join(generator.CharsetNames(), ", "))
+	generateCmd.Flags().IntVar(&generateEntropy, "entropy-min", 0, "refuse to write a value with fewer bits of entropy than this, e.g. 128")
+	RootCmd.AddCommand(generateCmd)
+}
+
+func generate(cmd *cobra.Command, args []string) error {
+	if listGenerators {
+		for _, name := range generator.Builtins() {
+			fmt.Fprintln(os.Stdout, name)
+		}
+		return nil
+	}
+
+	service := utils.NormalizeService(args[0])
+	if err := validateService(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+
+	key := utils.NormalizeKey(args[1])
+	if err := validateKey(key); err != nil {
+		return fmt.Errorf("Failed to validate key: %w", err)
+	}
+
+	params, err := parseGeneratorParams(generatorParams)
+	if err != nil {
+		return err
+	}
+	if err := applyRandomFlags(params, generatorName, generateLength, generateCharset); err != nil {
+		return err
+	}
+	bits, entropyErr := generator.Entropy(generatorName, params)
+	if err := checkEntropy(bits, entropyErr, generateEntropy); err != nil {
+		return err
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "generate").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("backend", backend).
+				Set("key", key).
+				Set("generator", generatorName),
+		})
+	}
+
+	g, err := generator.Lookup(generatorName)
+	if err != nil {
+		return err
+	}
+	value, err := g.Generate(params)
+	if err != nil {
+		return fmt.Errorf("Failed to generate value: %w", err)
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+
+	secretId := store.SecretId{
+		Service: service,
+		Key:     key,
+	}
+	if err := secretStore.Write(secretId, value); err != nil {
+		return err
+	}
+	if entropyErr == nil {
+		fmt.Fprintf(os.Stderr, "Wrote a generated value with %d bits of entropy to %s/%s\n", int(bits), service, key)
+	} else {
+		fmt.Fprintf(os.Stderr, "Wrote a generated value to %s/%s\n", service, key)
+	}
+	return nil
+}
+
+// applyRandomFlags sets the parameters given by --length and --charset,
+// which only the random generator takes
+func applyRandomFlags(params map[string]string, name string, length int, charset string) error {
+	if length == 0 && charset == "" {
+		return nil
+	}
+	if name != "random" {
+		return fmt.Errorf("--length and --charset only apply to the random generator, not %s; use --param", name)
+	}
+	if length < 0 {
+		return errors.New("--length must be positive")
+	}
+	if length > 0 {
+		params["length"] = strconv.Itoa(length)
+	}
+	if charset != "" {
+		params["charset"] = charset
+	}
+	return nil
+}
+
+// checkEntropy enforces --entropy-min, given the entropy of the generated
+// value or why it can't be told
+func checkEntropy(bits float64, err error, min int) error {
+	if min <= 0 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("--entropy-min: %w", err)
+	}
+	if bits < float64(min) {
+		return fmt.Errorf("The generated value would have %d bits of entropy, fewer than --entropy-min %d; make it longer or use a larger charset", int(bits), min)
+	}
+	return nil
+}
+
+// parseGeneratorParams turns name=value pairs into a map
+func parseGeneratorParams(pairs []string) (map[string]string, error) {
+	params := map[string]string{}
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, errors.New("Generator parameters must be given as name=value, not " + pair)
+		}
+		params[strings.ToLower(name)] = value
+	}
+	return params, nil
+}
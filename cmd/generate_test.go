@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGeneratorParams(t *testing.T) {
+	params, err := parseGeneratorParams([]string{"Words=10", "separator==", "empty="})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"words": "10", "separator": "=", "empty": ""}, params)
+
+	_, err = parseGeneratorParams([]string{"words"})
+	assert.Error(t, err)
+}
+
+func TestApplyRandomFlags(t *testing.T) {
+	params := map[string]string{}
+	assert.NoError(t, applyRandomFlags(params, "random", 40, "hex"))
+	assert.Equal(t, map[string]string{"length": "40", "charset": "hex"}, params)
+
+	assert.NoError(t, applyRandomFlags(map[string]string{}, "passphrase", 0, ""))
+	assert.Error(t, applyRandomFlags(map[string]string{}, "passphrase", 40, ""))
+	assert.Error(t, applyRandomFlags(map[string]string{}, "random", -1, ""))
+}
+
+func TestCheckEntropy(t *testing.T) {
+	assert.NoError(t, checkEntropy(0, errors.New("unknown"), 0))
+	assert.NoError(t, checkEntropy(160, nil, 128))
+	assert.Error(t, checkEntropy(64, nil, 128))
+	assert.Error(t, checkEntropy(0, errors.New("unknown"), 128))
+}
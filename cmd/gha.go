@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// ghaCmd represents the gha command
+	ghaCmd = &cobra.Command{
+		Use:   "gha <service...>",
+		Short: "Provide the secrets of services to the following steps of a GitHub Actions job",
+		Long: `Provide the secrets of services to the following steps of a GitHub Actions job.
+
+Every value is first masked with an ::add-mask:: workflow command, so that it
+is redacted from the logs of the job, and secrets are then appended to
+$GITHUB_ENV as environment variables named like those of chamber exec. With
+--output-step-outputs, they are also appended to $GITHUB_OUTPUT as outputs of
+the step, named after their keys. When services share a key, the last one
+wins.`,
+		Example: `
+	- name: Load secrets
+	  id: secrets
+	  run: chamber gha ci deploy --output-step-outputs
+	- name: Deploy
+	  run: ./deploy.sh --token "$DEPLOY_TOKEN"
+	- name: Notify
+	  run: ./notify.sh "${{ steps.secrets.outputs.slack_webhook }}"`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runGHA,
+	}
+	ghaStepOutputs bool
+)
+
+func init() {
+	ghaCmd.Flags().BoolVar(&ghaStepOutputs, "output-step-outputs", false, "also set each secret as an output of the step, in $GITHUB_OUTPUT")
+	RootCmd.AddCommand(ghaCmd)
+}
+
+func runGHA(cmd *cobra.Command, args []string) error {
+	services := make([]string, 0, len(args))
+	for _, arg := range args {
+		service := utils.NormalizeService(arg)
+		if err := validateServiceWithLabel(service); err != nil {
+			return fmt.Errorf("Failed to validate service: %w", err)
+		}
+		services = append(services, service)
+	}
+
+	envFile := os.Getenv("GITHUB_ENV")
+	if envFile == "" {
+		return errors.New("$GITHUB_ENV is not set; chamber gha must run in a GitHub Actions step")
+	}
+	outputFile := os.Getenv("GITHUB_OUTPUT")
+	if ghaStepOutputs && outputFile == "" {
+		return errors.New("$GITHUB_OUTPUT is not set, so --output-step-outputs cannot be used")
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "gha").
+				Set("chamber-version", chamberVersion).
+				Set("services", services).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	secretStore = withValueTransforms(secretStore)
+
+	secrets := map[string]string{}
+	for _, service := range services {
+		rawSecrets, err := secretStore.ListRaw(service)
+		if err != nil {
+			return fmt.Errorf("Failed to list store contents: %w", err)
+		}
+		for _, rawSecret := range rawSecrets {
+			secrets[key(rawSecret.Key)] = rawSecret.Value
+		}
+	}
+
+	env := map[string]string{}
+	for k, v := range secrets {
+		name := strings.ToUpper(sanitizeKey(k))
+		if err := validateShellName(name); err != nil {
+			return err
+		}
+		env[name] = v
+	}
+
+	// values must be masked before anything else can print them
+	if err := writeGHAMasks(os.Stdout, secrets); err != nil {
+		return err
+	}
+	if err := appendGHAFile(envFile, env); err != nil {
+		return fmt.Errorf("Failed to write $GITHUB_ENV: %w", err)
+	}
+	if ghaStepOutputs {
+		if err := appendGHAFile(outputFile, secrets); err != nil {
+			return fmt.Errorf("Failed to write $GITHUB_OUTPUT: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeGHAMasks writes an ::add-mask:: command for every value. GitHub masks
+// multi-line values line by line, so each line is masked on its own.
+func writeGHAMasks(w io.Writer, secrets map[string]string) error {
+	for _, k := range sortedKeys(secrets) {
+		for _, line := range strings.Split(secrets[k], "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "::add-mask::%s\n", ghaEscapeData(line)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ghaEscapeData escapes the data of a workflow command
+func ghaEscapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// appendGHAFile appends vars to a $GITHUB_ENV or $GITHUB_OUTPUT file
+func appendGHAFile(path string, vars map[string]string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	err = writeGHAVars(f, vars)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeGHAVars writes vars in the format of $GITHUB_ENV and $GITHUB_OUTPUT.
+// Every value is written between delimiters, as multi-line values must be,
+// so that no value can inject other variables.
+func writeGHAVars(w io.Writer, vars map[string]string) error {
+	for _, name := range sortedKeys(vars) {
+		value := vars[name]
+		delimiter, err := ghaDelimiter()
+		if err != nil {
+			return err
+		}
+		if strings.Contains(value, delimiter) {
+			return fmt.Errorf("value of %s contains the delimiter %s", name, delimiter)
+		}
+		if _, err := fmt.Fprintf(w, "%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ghaDelimiter returns a random heredoc delimiter, as GitHub's toolkit does
+func ghaDelimiter() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "ghadelimiter_" + hex.EncodeToString(b), nil
+}
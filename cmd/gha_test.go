@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteGHAMasks(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeGHAMasks(buf, map[string]string{
+		"api_token": "abc%123",
+		"empty":     "",
+		"tls_key":   "-----BEGIN KEY-----\r\nsecret\r\n\r\n-----END KEY-----\n",
+	}))
+	assert.Equal(t, `::add-mask::abc%25123
+::add-mask::-----BEGIN KEY-----
+::add-mask::secret
+::add-mask::-----END KEY-----
+`, buf.String())
+}
+
+func TestWriteGHAVars(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeGHAVars(buf, map[string]string{
+		"DB_PASSWORD": "hunter22",
+		"TLS_KEY":     "line one\nline two",
+	}))
+
+	pattern := regexp.MustCompile(`^DB_PASSWORD<<(ghadelimiter_[0-9a-f]{32})\nhunter22\n(ghadelimiter_[0-9a-f]{32})\nTLS_KEY<<(ghadelimiter_[0-9a-f]{32})\nline one\nline two\n(ghadelimiter_[0-9a-f]{32})\n$`)
+	m := pattern.FindStringSubmatch(buf.String())
+	require.NotNil(t, m, buf.String())
+	assert.Equal(t, m[1], m[2])
+	assert.Equal(t, m[3], m[4])
+	assert.NotEqual(t, m[1], m[3])
+}
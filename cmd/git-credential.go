@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// defaultCredentialUsername is used when a service holds a token but no
+// username; hosts like GitHub and GitLab accept any username with a token
+const defaultCredentialUsername = "x-access-token"
+
+var (
+	// gitCredentialCmd represents the git-credential command
+	gitCredentialCmd = &cobra.Command{
+		Use:   "git-credential <service> <get|store|erase>",
+		Short: "Act as a git credential helper, answering with credentials from a service",
+		Long: `Act as a git credential helper, answering with credentials from a service.
+
+For a host like github.com, the password is read from the github_com_password
+or github_com_token key and the username from github_com_username, or
+x-access-token without one. Only keys named after the host are used, and only
+for https, so that credentials are never sent elsewhere; other requests are
+left to git's other helpers. Credentials are never stored or erased, since
+they are managed with chamber.`,
+		Example: `
+	$ git config --global credential.helper '!chamber git-credential ci'
+	$ git clone https://github.com/org/private-repo`,
+		Args: cobra.ExactArgs(2),
+		RunE: runGitCredential,
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(gitCredentialCmd)
+}
+
+func runGitCredential(cmd *cobra.Command, args []string) error {
+	service := utils.NormalizeService(args[0])
+	if err := validateServiceWithLabel(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+
+	request, err := readCredentialRequest(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("Failed to read credential request: %w", err)
+	}
+	// git expects helpers to ignore the operations they don't support, and
+	// credentials are only given over https
+	if args[1] != "get" || request["protocol"] != "https" {
+		return nil
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "git-credential").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("backend", backend),
+		})
+	}
+
+	secrets, err := serviceSecrets(service)
+	if err != nil {
+		return err
+	}
+
+	login, password, ok := hostCredentials(secrets, request["host"])
+	if !ok {
+		// let git try its other helpers, or prompt
+		return nil
+	}
+	if request["username"] != "" && request["username"] != login {
+		return nil
+	}
+	fmt.Fprintf(os.Stdout, "username=%s\npassword=%s\n", login, password)
+	return nil
+}
+
+// readCredentialRequest reads the key=value lines git sends to credential
+// helpers, up to a blank line
+func readCredentialRequest(r io.Reader) (map[string]string, error) {
+	request := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		request[k] = v
+	}
+	return request, scanner.Err()
+}
+
+// serviceSecrets returns the latest values of the keys of service
+func serviceSecrets(service string) (map[string]string, error) {
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	rawSecrets, err := secretStore.ListRaw(service)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list store contents: %w", err)
+	}
+	secrets := map[string]string{}
+	for _, rawSecret := range rawSecrets {
+		secrets[key(rawSecret.Key)] = rawSecret.Value
+	}
+	return secrets, nil
+}
+
+// hostCredentials finds the username and password to use for host among
+// secrets, only in keys specific to the host, like github_com_token for
+// github.com, so that credentials are never sent to a host they weren't
+// meant for.
+func hostCredentials(secrets map[string]string, host string) (string, string, bool) {
+	if host == "" {
+		return "", "", false
+	}
+	prefix := strings.NewReplacer(".", "_", "-", "_", ":", "_").Replace(strings.ToLower(host)) + "_"
+	lookup := func(names ...string) string {
+		for _, name := range names {
+			if v, ok := secrets[prefix+name]; ok && v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	password := lookup("password", "token")
+	if password == "" {
+		return "", "", false
+	}
+	login := lookup("username")
+	if login == "" {
+		login = defaultCredentialUsername
+	}
+	return login, password, true
+}
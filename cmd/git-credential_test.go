@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCredentialRequest(t *testing.T) {
+	request, err := readCredentialRequest(strings.NewReader("protocol=https\nhost=github.com\npath=org/repo.git\n\nignored=1\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"protocol": "https", "host": "github.com", "path": "org/repo.git"}, request)
+
+	_, err = readCredentialRequest(strings.NewReader("protocol\n"))
+	assert.Error(t, err)
+}
+
+func TestHostCredentials(t *testing.T) {
+	secrets := map[string]string{
+		"github_com_token":              "ghp_abc",
+		"git_example_com_8443_username": "deploy",
+		"git_example_com_8443_password": "s3cret",
+	}
+
+	cases := []struct {
+		host, login, password string
+	}{
+		{"github.com", defaultCredentialUsername, "ghp_abc"},
+		{"git.example.com:8443", "deploy", "s3cret"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.host, func(t *testing.T) {
+			login, password, ok := hostCredentials(secrets, tc.host)
+			assert.True(t, ok)
+			assert.Equal(t, tc.login, login)
+			assert.Equal(t, tc.password, password)
+		})
+	}
+
+	t.Run("generic keys are never used", func(t *testing.T) {
+		generic := map[string]string{"username": "ci-bot", "password": "generic", "token": "abc"}
+		_, _, ok := hostCredentials(generic, "other.example.com")
+		assert.False(t, ok)
+		_, _, ok = hostCredentials(generic, "")
+		assert.False(t, ok)
+	})
+
+	t.Run("empty values are ignored", func(t *testing.T) {
+		_, _, ok := hostCredentials(map[string]string{"artifacts_example_com_password": "", "artifacts_example_com_username": "ci-bot"}, "artifacts.example.com")
+		assert.False(t, ok)
+	})
+}
+
+func TestGitCredentialHTTPSOnly(t *testing.T) {
+	// an invalid backend fails any request that reaches the store
+	t.Setenv(BackendEnvVar, "invalid")
+	defer func(previous string) { backend = previous }(backend)
+
+	run := func(request string) error {
+		stdin := os.Stdin
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		_, err = w.WriteString(request)
+		require.NoError(t, err)
+		w.Close()
+		os.Stdin = r
+		defer func() { os.Stdin = stdin }()
+		return runGitCredential(gitCredentialCmd, []string{"ci", "get"})
+	}
+
+	assert.NoError(t, run("protocol=http\nhost=github.com\n\n"))
+	assert.Error(t, run("protocol=https\nhost=github.com\n\n"))
+}
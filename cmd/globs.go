@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	slashpath "path"
+	"sort"
+	"strings"
+
+	"github.com/segmentio/chamber/v2/store"
+)
+
+// globChars are the characters that make a service name a glob
+const globChars = "*?["
+
+// isServiceGlob reports whether service is a pattern like myapp/* rather
+// than the name of a service
+func isServiceGlob(service string) bool {
+	return strings.ContainsAny(service, globChars)
+}
+
+// validateServiceGlob checks that pattern is a valid glob, with the syntax of
+// slashpath.Match, in which * does not match /
+func validateServiceGlob(pattern string) error {
+	if strings.ContainsAny(pattern, ":@") {
+		return fmt.Errorf("service glob %s cannot have a label or version", pattern)
+	}
+	if _, err := slashpath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid service glob %s: %w", pattern, err)
+	}
+	return nil
+}
+
+// expandServiceGlobs replaces every glob in services with the services in the
+// store matching it, in alphabetical order. Services are only listed once,
+// at their first position. Globs matching no service are returned separately.
+func expandServiceGlobs(s store.Store, services []string) ([]string, []string, error) {
+	var expanded, unmatched []string
+	seen := map[string]bool{}
+	add := func(service string) {
+		if !seen[service] {
+			seen[service] = true
+			expanded = append(expanded, service)
+		}
+	}
+
+	for _, service := range services {
+		if !isServiceGlob(service) {
+			add(service)
+			continue
+		}
+
+		matches, err := matchServices(s, service)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(matches) == 0 {
+			unmatched = append(unmatched, service)
+		}
+		for _, match := range matches {
+			add(match)
+		}
+	}
+	return expanded, unmatched, nil
+}
+
+// matchServices lists the services in the store matching pattern
+func matchServices(s store.Store, pattern string) ([]string, error) {
+	// only list what is under the directory the pattern starts in
+	prefix := pattern[:strings.IndexAny(pattern, globChars)]
+	prefix = prefix[:strings.LastIndex(prefix, "/")+1]
+
+	services, err := listUntrashedServices(s, prefix, false)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list services matching %s: %w", pattern, err)
+	}
+
+	var matches []string
+	for _, service := range services {
+		// errors were caught by validateServiceGlob
+		if ok, _ := slashpath.Match(pattern, service); ok {
+			matches = append(matches, service)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
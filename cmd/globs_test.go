@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandServiceGlobs(t *testing.T) {
+	s := newFakeStore(map[string]map[string]string{
+		"global":          {"a": "1"},
+		"myapp/web":       {"a": "1"},
+		"myapp/worker":    {"a": "1"},
+		"myapp/web/admin": {"a": "1"},
+		"team-a":          {"a": "1"},
+		"team-b":          {"a": "1"},
+	})
+
+	cases := []struct {
+		name      string
+		services  []string
+		expanded  []string
+		unmatched []string
+	}{
+		{
+			name:     "services without globs are kept",
+			services: []string{"global", "missing"},
+			expanded: []string{"global", "missing"},
+		},
+		{
+			name:     "* does not match /",
+			services: []string{"myapp/*"},
+			expanded: []string{"myapp/web", "myapp/worker"},
+		},
+		{
+			name:     "globs at the top level",
+			services: []string{"global", "team-?"},
+			expanded: []string{"global", "team-a", "team-b"},
+		},
+		{
+			name:     "services are loaded once, at their first position",
+			services: []string{"myapp/worker", "myapp/*", "global"},
+			expanded: []string{"myapp/worker", "myapp/web", "global"},
+		},
+		{
+			name:      "unmatched globs are reported",
+			services:  []string{"global", "other/*"},
+			expanded:  []string{"global"},
+			unmatched: []string{"other/*"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			expanded, unmatched, err := expandServiceGlobs(s, tc.services)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expanded, expanded)
+			assert.Equal(t, tc.unmatched, unmatched)
+		})
+	}
+}
+
+func TestValidateServiceGlob(t *testing.T) {
+	assert.NoError(t, validateServiceGlob("myapp/*"))
+	assert.NoError(t, validateServiceGlob("team-[ab]"))
+	assert.Error(t, validateServiceGlob("team-[ab"))
+	assert.Error(t, validateServiceGlob("myapp/*:prod"))
+	assert.Error(t, validateServiceGlob("myapp/*@3"))
+}
@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	analytics "github.com/segmentio/analytics-go/v3"
 	"github.com/segmentio/chamber/v2/store"
@@ -11,15 +16,34 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// historyCmd represents the history command
-var historyCmd = &cobra.Command{
-	Use:   "history <service> <key>",
-	Short: "View the history of a secret",
-	Args:  cobra.ExactArgs(2),
-	RunE:  history,
-}
+var (
+	historyDiff bool
+	historyShow bool
+	historyFrom int
+	historyTo   int
+
+	// historyCmd represents the history command
+	historyCmd = &cobra.Command{
+		Use:   "history <service> <key>",
+		Short: "View the history of a secret",
+		Long: `View the history of a secret.
+
+--diff also shows how the value changed from each version to the next, line by
+line. Changed lines are masked unless --show-values is given, which still
+shows which lines of a multi-line value changed.`,
+		Example: `
+	$ chamber history app db_password
+	$ chamber history app config --from 3 --to 5 --diff --show-values`,
+		Args: cobra.ExactArgs(2),
+		RunE: history,
+	}
+)
 
 func init() {
+	historyCmd.Flags().BoolVar(&historyDiff, "diff", false, "show how the value changed between consecutive versions")
+	historyCmd.Flags().BoolVar(&historyShow, "show-values", false, "with --diff, show the changed lines rather than masking them")
+	historyCmd.Flags().IntVar(&historyFrom, "from", 0, "only show versions from this one on")
+	historyCmd.Flags().IntVar(&historyTo, "to", 0, "only show versions up to this one")
 	RootCmd.AddCommand(historyCmd)
 }
 
@@ -34,6 +58,20 @@ func history(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("Failed to validate key: %w", err)
 	}
 
+	if historyFrom < 0 || historyTo < 0 {
+		return errors.New("--from and --to must be positive")
+	}
+	if historyTo != 0 && historyFrom > historyTo {
+		return errors.New("--from cannot be after --to")
+	}
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	if structured && historyDiff {
+		return errors.New("--diff can only be used with --output table")
+	}
+
 	if analyticsEnabled && analyticsClient != nil {
 		analyticsClient.Enqueue(analytics.Track{
 			UserId: username,
@@ -60,6 +98,20 @@ func history(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("Failed to get history: %w", err)
 	}
+	events = historyRange(events, historyFrom, historyTo)
+
+	if structured {
+		listed := make([]historyEvent, 0, len(events))
+		for _, event := range events {
+			listed = append(listed, historyEvent{
+				Event:   event.Type.String(),
+				Version: event.Version,
+				Time:    event.Time,
+				User:    event.User,
+			})
+		}
+		return writeStructured(os.Stdout, listed)
+	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
 	fmt.Fprintln(w, "Event\tVersion\tDate\tUser")
@@ -72,5 +124,134 @@ func history(cmd *cobra.Command, args []string) error {
 		)
 	}
 	w.Flush()
+
+	if historyDiff {
+		return writeHistoryDiffs(os.Stdout, secretStore, secretId, events, historyShow)
+	}
 	return nil
 }
+
+// historyEvent is an event as history prints it with --output json or yaml
+type historyEvent struct {
+	Event   string    `json:"event" yaml:"event"`
+	Version int       `json:"version" yaml:"version"`
+	Time    time.Time `json:"time" yaml:"time"`
+	User    string    `json:"user" yaml:"user"`
+}
+
+// historyRange returns the events of versions from from to to, inclusive,
+// ordered by version. Bounds of 0 are open.
+func historyRange(events []store.ChangeEvent, from, to int) []store.ChangeEvent {
+	inRange := make([]store.ChangeEvent, 0, len(events))
+	for _, event := range events {
+		if (from == 0 || event.Version >= from) && (to == 0 || event.Version <= to) {
+			inRange = append(inRange, event)
+		}
+	}
+	sort.SliceStable(inRange, func(i, j int) bool {
+		return inRange[i].Version < inRange[j].Version
+	})
+	return inRange
+}
+
+// writeHistoryDiffs writes how the value changed to each version of events
+// from the one before it
+func writeHistoryDiffs(out io.Writer, secretStore store.Store, id store.SecretId, events []store.ChangeEvent, showValues bool) error {
+	values := map[int]*string{}
+	value := func(version int) (*string, error) {
+		if v, ok := values[version]; ok {
+			return v, nil
+		}
+		secret, err := secretStore.Read(id, version)
+		if errors.Is(err, store.ErrSecretNotFound) {
+			// versions may have been dropped from the history
+			values[version] = nil
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read version %d: %w", version, err)
+		}
+		values[version] = secret.Value
+		return secret.Value, nil
+	}
+
+	for _, event := range events {
+		if event.Version <= 1 {
+			continue
+		}
+		before, err := value(event.Version - 1)
+		if err != nil {
+			return err
+		}
+		after, err := value(event.Version)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "\nversion %d -> %d:\n", event.Version-1, event.Version)
+		if before == nil || after == nil {
+			fmt.Fprintln(out, "  not compared, since one of the versions is no longer kept")
+			continue
+		}
+		changes := diffLines(strings.Split(*before, "\n"), strings.Split(*after, "\n"))
+		if len(changes) == 0 {
+			fmt.Fprintln(out, "  unchanged")
+			continue
+		}
+		for _, change := range changes {
+			line := change.Text
+			if !showValues {
+				line = "********"
+			}
+			fmt.Fprintf(out, "  %c line %d: %s\n", change.Op, change.Line, line)
+		}
+	}
+	return nil
+}
+
+// lineChange is a line removed (-) from the old value or added (+) to the new
+// one. Line is its line number in the value it belongs to.
+type lineChange struct {
+	Op   byte
+	Line int
+	Text string
+}
+
+// diffLines returns the lines removed from before and added to after, using
+// their longest common subsequence of lines
+func diffLines(before, after []string) []lineChange {
+	// lcs[i][j] is the length of the longest common subsequence of before[i:]
+	// and after[j:]
+	lcs := make([][]int, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var changes []lineChange
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			i++
+			j++
+		case j == len(after) || (i < len(before) && lcs[i+1][j] >= lcs[i][j+1]):
+			changes = append(changes, lineChange{Op: '-', Line: i + 1, Text: before[i]})
+			i++
+		default:
+			changes = append(changes, lineChange{Op: '+', Line: j + 1, Text: after[j]})
+			j++
+		}
+	}
+	return changes
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffLines(t *testing.T) {
+	changes := diffLines([]string{"a", "b", "c"}, []string{"a", "x", "c", "d"})
+	assert.Equal(t, []lineChange{
+		{Op: '-', Line: 2, Text: "b"},
+		{Op: '+', Line: 2, Text: "x"},
+		{Op: '+', Line: 4, Text: "d"},
+	}, changes)
+	assert.Empty(t, diffLines([]string{"a"}, []string{"a"}))
+}
+
+func TestHistoryRange(t *testing.T) {
+	events := []store.ChangeEvent{{Version: 5}, {Version: 1}, {Version: 3}, {Version: 4}, {Version: 2}}
+	versions := func(events []store.ChangeEvent) []int {
+		var v []int
+		for _, e := range events {
+			v = append(v, e.Version)
+		}
+		return v
+	}
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, versions(historyRange(events, 0, 0)))
+	assert.Equal(t, []int{3, 4, 5}, versions(historyRange(events, 3, 5)))
+	assert.Equal(t, []int{1, 2}, versions(historyRange(events, 0, 2)))
+}
+
+func TestWriteHistoryDiffs(t *testing.T) {
+	s := store.NewMemoryStore()
+	id := store.SecretId{Service: "app", Key: "config"}
+	for _, v := range []string{"host=a\nport=1", "host=b\nport=1", "host=b\nport=1"} {
+		require.NoError(t, s.Write(id, v))
+	}
+	events, err := s.History(id)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, writeHistoryDiffs(&out, s, id, events, false))
+	assert.Equal(t, "\nversion 1 -> 2:\n  - line 1: ********\n  + line 1: ********\n\nversion 2 -> 3:\n  unchanged\n", out.String())
+	assert.NotContains(t, out.String(), "host=")
+
+	out.Reset()
+	require.NoError(t, writeHistoryDiffs(&out, s, id, events[1:2], true))
+	assert.Equal(t, "\nversion 1 -> 2:\n  - line 1: host=a\n  + line 1: host=b\n", out.String())
+}
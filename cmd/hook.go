@@ -0,0 +1,388 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the file listing the services the shell hook loads in a
+// directory and those below it
+const ConfigFileName = ".chamber.yml"
+
+// The shell hook keeps what it loaded in these variables, so that it can be
+// unloaded on leaving the directory
+const (
+	HookDirEnvVar  = "CHAMBER_HOOK_DIR"
+	HookVarsEnvVar = "CHAMBER_HOOK_VARS"
+)
+
+const bashHook = `_chamber_hook() {
+  local previous_exit_status=$?
+  if [[ "$PWD" != "${_chamber_last_pwd-}" ]]; then
+    _chamber_last_pwd=$PWD
+    eval "$(%[1]s hook bash --eval)"
+  fi
+  return $previous_exit_status
+}
+if [[ ";${PROMPT_COMMAND[*]:-};" != *";_chamber_hook;"* ]]; then
+  PROMPT_COMMAND="_chamber_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`
+
+const zshHook = `_chamber_hook() {
+  eval "$(%[1]s hook zsh --eval)"
+}
+typeset -ag chpwd_functions
+if (( ! ${chpwd_functions[(I)_chamber_hook]} )); then
+  chpwd_functions=(_chamber_hook $chpwd_functions)
+fi
+_chamber_hook
+`
+
+const fishHook = `function _chamber_hook --on-variable PWD
+    %[1]s hook fish --eval | source
+end
+_chamber_hook
+`
+
+var shellHooks = map[string]string{
+	"bash": bashHook,
+	"zsh":  zshHook,
+	"fish": fishHook,
+}
+
+var (
+	// hookCmd represents the hook command
+	hookCmd = &cobra.Command{
+		Use:   "hook <bash|zsh|fish>",
+		Short: "Print a shell hook loading secrets in directories with a " + ConfigFileName,
+		Long: `Print a shell hook loading secrets in directories with a ` + ConfigFileName + `.
+
+Once the hook is installed, changing into a directory with a ` + ConfigFileName + `
+file, or below one, loads the secrets of the services it lists into the
+shell, named as with chamber exec:
+
+	services:
+	  - app-dev
+	  - shared-dev
+
+They are unloaded on leaving the directory. Variables the secrets replaced
+are unset rather than restored.
+
+Since any directory may hold a ` + ConfigFileName + `, such as one of a cloned
+repository, a file is only loaded once chamber hook allow approves it, and
+again after every change to it.`,
+		Example: `
+	$ echo 'eval "$(chamber hook bash)"' >> ~/.bashrc
+	$ echo 'eval "$(chamber hook zsh)"' >> ~/.zshrc
+	$ echo 'chamber hook fish | source' >> ~/.config/fish/config.fish
+	$ chamber hook allow`,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		RunE:      runHook,
+	}
+	hookEval bool
+
+	// hookAllowCmd represents the hook allow command
+	hookAllowCmd = &cobra.Command{
+		Use:   "allow [<dir>]",
+		Short: "Allow the shell hook to load the " + ConfigFileName + " of a directory",
+		Long: `Allow the shell hook to load the ` + ConfigFileName + ` of a directory, the
+current one by default, or of its nearest parent with one.
+
+The path of the file and a hash of its content are recorded in the user's
+config directory, so that changing the file blocks it until it is allowed
+again. The secrets are loaded the next time the directory is entered.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runHookAllow(args, true)
+		},
+	}
+
+	// hookDenyCmd represents the hook deny command
+	hookDenyCmd = &cobra.Command{
+		Use:   "deny [<dir>]",
+		Short: "Revoke the approval of the " + ConfigFileName + " of a directory",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runHookAllow(args, false)
+		},
+	}
+)
+
+func init() {
+	hookCmd.Flags().BoolVar(&hookEval, "eval", false, "print the commands loading or unloading secrets for the current directory; run by the hook")
+	hookCmd.Flags().MarkHidden("eval")
+	hookCmd.AddCommand(hookAllowCmd)
+	hookCmd.AddCommand(hookDenyCmd)
+	RootCmd.AddCommand(hookCmd)
+}
+
+// chamberConfig is the content of a .chamber.yml
+type chamberConfig struct {
+	Services []string `yaml:"services"`
+
+	// path and data are the file the config was read from and its content,
+	// to check that it was allowed
+	path string
+	data []byte
+}
+
+func runHook(cmd *cobra.Command, args []string) error {
+	shell := args[0]
+	hook, ok := shellHooks[shell]
+	if !ok {
+		return fmt.Errorf("Unsupported shell: %s", shell)
+	}
+
+	if !hookEval {
+		self, err := os.Executable()
+		if err != nil {
+			self = "chamber"
+		}
+		_, err = fmt.Fprintf(os.Stdout, hook, shellescape.Quote(self))
+		return err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("Failed to get working directory: %w", err)
+	}
+	dir, config, err := findChamberConfig(cwd)
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		allowed, err := hookAllowed(config)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			fmt.Fprintf(os.Stderr, "chamber: %s is blocked; run chamber hook allow to load its secrets\n", config.path)
+			dir, config = "", nil
+		}
+	}
+	if dir == os.Getenv(HookDirEnvVar) {
+		return nil
+	}
+
+	var vars map[string]string
+	if config != nil {
+		if vars, err = hookVars(config.Services); err != nil {
+			// unload what was loaded anyway, and try again in the next
+			// directory
+			fmt.Fprintf(os.Stderr, "chamber: Failed to load secrets for %s: %s\n", dir, err)
+			dir = ""
+		}
+	}
+
+	var loaded []string
+	if v := os.Getenv(HookVarsEnvVar); v != "" {
+		loaded = strings.Split(v, ",")
+	}
+	if len(loaded) > 0 {
+		fmt.Fprintf(os.Stderr, "chamber: unloaded %d secrets\n", len(loaded))
+	}
+	if vars != nil {
+		fmt.Fprintf(os.Stderr, "chamber: loaded %d secrets of %s\n", len(vars), strings.Join(config.Services, ", "))
+	}
+	return writeHookCommands(os.Stdout, shell, loaded, dir, vars)
+}
+
+// findChamberConfig looks for a .chamber.yml in dir and its parents,
+// returning the directory it was found in, or nothing if there isn't one
+func findChamberConfig(dir string) (string, *chamberConfig, error) {
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, ConfigFileName))
+		if err == nil {
+			var config chamberConfig
+			if err := yaml.Unmarshal(data, &config); err != nil {
+				return "", nil, fmt.Errorf("Failed to parse %s: %w", filepath.Join(dir, ConfigFileName), err)
+			}
+			if len(config.Services) == 0 {
+				return "", nil, fmt.Errorf("%s lists no services", filepath.Join(dir, ConfigFileName))
+			}
+			config.path, config.data = filepath.Join(dir, ConfigFileName), data
+			return dir, &config, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", nil, fmt.Errorf("Failed to read %s: %w", ConfigFileName, err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil, nil
+		}
+		dir = parent
+	}
+}
+
+func runHookAllow(args []string, allow bool) error {
+	dir := "."
+	if len(args) == 1 {
+		dir = args[0]
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve %s: %w", dir, err)
+	}
+	_, config, err := findChamberConfig(dir)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		return fmt.Errorf("No %s in %s or its parents", ConfigFileName, dir)
+	}
+
+	allowPath, err := hookAllowPath(config)
+	if err != nil {
+		return err
+	}
+	if !allow {
+		if err := os.Remove(allowPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("Failed to revoke %s: %w", config.path, err)
+		}
+		fmt.Fprintf(os.Stderr, "chamber: denied %s\n", config.path)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(allowPath), 0700); err != nil {
+		return fmt.Errorf("Failed to create %s: %w", filepath.Dir(allowPath), err)
+	}
+	if err := os.WriteFile(allowPath, []byte(config.path+"\n"), 0600); err != nil {
+		return fmt.Errorf("Failed to allow %s: %w", config.path, err)
+	}
+	fmt.Fprintf(os.Stderr, "chamber: allowed %s\n", config.path)
+	return nil
+}
+
+// hookAllowPath returns where the approval of config is recorded. The name
+// hashes the path and content of the file, so that changing either revokes
+// the approval.
+func hookAllowPath(config *chamberConfig) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("Failed to find the user config directory: %w", err)
+	}
+	h := sha256.New()
+	h.Write([]byte(config.path + "\n"))
+	h.Write(config.data)
+	return filepath.Join(dir, "chamber", "allow", hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// hookAllowed reports whether config was allowed with chamber hook allow
+// since it last changed
+func hookAllowed(config *chamberConfig) (bool, error) {
+	allowPath, err := hookAllowPath(config)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(allowPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed to check whether %s is allowed: %w", config.path, err)
+	}
+	return true, nil
+}
+
+// hookVars returns the variables to set for services, the last service
+// winning when they share a key
+func hookVars(services []string) (map[string]string, error) {
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "hook").
+				Set("chamber-version", chamberVersion).
+				Set("services", services).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	secretStore = withValueTransforms(secretStore)
+
+	vars := map[string]string{}
+	for _, service := range services {
+		service = utils.NormalizeService(service)
+		if err := validateServiceWithLabel(service); err != nil {
+			return nil, fmt.Errorf("Failed to validate service: %w", err)
+		}
+		rawSecrets, err := secretStore.ListRaw(service)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list store contents for service %s: %w", service, err)
+		}
+		for _, rawSecret := range rawSecrets {
+			name := strings.ToUpper(sanitizeKey(key(rawSecret.Key)))
+			if err := validateShellName(name); err != nil {
+				return nil, err
+			}
+			vars[name] = rawSecret.Value
+		}
+	}
+	return vars, nil
+}
+
+// writeHookCommands writes the commands unsetting the variables loaded
+// before, then setting vars and recording them as loaded from dir
+func writeHookCommands(w io.Writer, shell string, loaded []string, dir string, vars map[string]string) error {
+	set, unset := func(name, value string) string {
+		return fmt.Sprintf("export %s=%s\n", name, shellescape.Quote(value))
+	}, func(name string) string {
+		return fmt.Sprintf("unset %s\n", name)
+	}
+	if shell == "fish" {
+		set, unset = func(name, value string) string {
+			return fmt.Sprintf("set -gx %s %s\n", name, fishQuote(value))
+		}, func(name string) string {
+			return fmt.Sprintf("set -e %s\n", name)
+		}
+	}
+
+	var b strings.Builder
+	for _, name := range loaded {
+		if validateShellName(name) == nil {
+			b.WriteString(unset(name))
+		}
+	}
+	if dir == "" || vars == nil {
+		b.WriteString(unset(HookDirEnvVar))
+		b.WriteString(unset(HookVarsEnvVar))
+	} else {
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			b.WriteString(set(name, vars[name]))
+		}
+		b.WriteString(set(HookDirEnvVar, dir))
+		b.WriteString(set(HookVarsEnvVar, strings.Join(names, ",")))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fishQuote quotes s for fish, where only \ and ' are special in single
+// quotes
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindChamberConfig(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "app", "cmd")
+	require.NoError(t, os.MkdirAll(nested, 0700))
+
+	dir, config, err := findChamberConfig(nested)
+	require.NoError(t, err)
+	assert.Equal(t, "", dir)
+	assert.Nil(t, config)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "app", ConfigFileName), []byte("services:\n  - app-dev\n  - shared\n"), 0600))
+	dir, config, err = findChamberConfig(nested)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "app"), dir)
+	assert.Equal(t, []string{"app-dev", "shared"}, config.Services)
+
+	require.NoError(t, os.WriteFile(filepath.Join(nested, ConfigFileName), []byte("services: []\n"), 0600))
+	_, _, err = findChamberConfig(nested)
+	assert.Error(t, err)
+}
+
+func TestHookAllow(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	nested := filepath.Join(root, "cmd")
+	require.NoError(t, os.MkdirAll(nested, 0700))
+	path := filepath.Join(root, ConfigFileName)
+	require.NoError(t, os.WriteFile(path, []byte("services:\n  - app-dev\n"), 0600))
+
+	allowed := func() bool {
+		_, config, err := findChamberConfig(nested)
+		require.NoError(t, err)
+		ok, err := hookAllowed(config)
+		require.NoError(t, err)
+		return ok
+	}
+	assert.False(t, allowed())
+
+	require.NoError(t, runHookAllow([]string{nested}, true))
+	assert.True(t, allowed())
+
+	// changing the file blocks it again
+	require.NoError(t, os.WriteFile(path, []byte("services:\n  - app-prod\n"), 0600))
+	assert.False(t, allowed())
+
+	require.NoError(t, runHookAllow([]string{root}, true))
+	assert.True(t, allowed())
+	require.NoError(t, runHookAllow([]string{root}, false))
+	assert.False(t, allowed())
+
+	assert.Error(t, runHookAllow([]string{t.TempDir()}, true))
+}
+
+func TestWriteHookCommands(t *testing.T) {
+	vars := map[string]string{"DB_PASSWORD": `it's \secret`, "DB_USER": "app"}
+
+	tests := []struct {
+		shell    string
+		loaded   []string
+		dir      string
+		vars     map[string]string
+		expected string
+	}{
+		{
+			shell: "bash",
+			dir:   "/src/app",
+			vars:  vars,
+			expected: `export DB_PASSWORD='it'"'"'s \secret'
+export DB_USER=app
+export CHAMBER_HOOK_DIR=/src/app
+export CHAMBER_HOOK_VARS=DB_PASSWORD,DB_USER
+`,
+		},
+		{
+			shell:  "zsh",
+			loaded: []string{"DB_PASSWORD", "DB_USER"},
+			expected: `unset DB_PASSWORD
+unset DB_USER
+unset CHAMBER_HOOK_DIR
+unset CHAMBER_HOOK_VARS
+`,
+		},
+		{
+			shell:  "fish",
+			loaded: []string{"OLD"},
+			dir:    "/src/app",
+			vars:   vars,
+			expected: `set -e OLD
+set -gx DB_PASSWORD 'it\'s \\secret'
+set -gx DB_USER 'app'
+set -gx CHAMBER_HOOK_DIR '/src/app'
+set -gx CHAMBER_HOOK_VARS 'DB_PASSWORD,DB_USER'
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			require.NoError(t, writeHookCommands(buf, tt.shell, tt.loaded, tt.dir, tt.vars))
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
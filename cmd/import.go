@@ -1,9 +1,18 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 
 	analytics "github.com/segmentio/analytics-go/v3"
 	"github.com/segmentio/chamber/v2/store"
@@ -15,15 +24,83 @@ import (
 var (
 	importCmd = &cobra.Command{
 		Use:   "import <service> <file|->",
-		Short: "import secrets from json or yaml",
+		Short: "import secrets from json, yaml or dotenv",
 		Args:  cobra.ExactArgs(2),
 		RunE:  importRun,
 	}
-	normalizeKeys bool
+	normalizeKeys  bool
+	onConflict     string
+	importForce    bool
+	importDecrypt  bool
+	importValidate string
+	importFormat   string
+	importDryRun   bool
+	importShow     bool
+	importExit     bool
+	importPrune    bool
+	importYes      bool
+	importWorkers  int
+	importLimit    importLimits
+)
+
+// importLimits guard against importing the wrong file, like another
+// environment's, over a service. Zero disables a limit.
+type importLimits struct {
+	// MaxKeys bounds how many keys a single import writes
+	MaxKeys int
+	// MaxBytes bounds the total size of the values written
+	MaxBytes int
+	// MaxChangedPercent bounds the share of the existing keys of the
+	// service whose value changes
+	MaxChangedPercent int
+}
+
+// What an import does to each key, as listed by --dry-run
+const (
+	ImportCreate    = "create"
+	ImportChange    = "change"
+	ImportUntouched = "untouched"
+	ImportDelete    = "delete"
+)
+
+// pruneProtected are keys chamber keeps in services for itself, which
+// --prune never deletes
+var pruneProtected = map[string]bool{ManifestKey: true, store.RolloutKey: true}
+
+// importChange is what an import does to a key
+type importChange struct {
+	Key    string
+	Action string
+	// Old is the current value of a changed or deleted key
+	Old string
+	// New is the value a created or changed key gets
+	New string
+}
+
+// Policies for keys that would be overwritten with a different value
+const (
+	ConflictReplace = "replace"
+	ConflictKeep    = "keep"
+	ConflictAbort   = "abort"
+	ConflictPrompt  = "prompt"
 )
 
 func init() {
 	importCmd.Flags().BoolVar(&normalizeKeys, "normalize-keys", false, "Normalize keys to match how `chamber write` would handle them. If not specified, keys will be written exactly how they are defined in the import source.")
+	importCmd.Flags().StringVar(&onConflict, "on-conflict", ConflictReplace, "what to do with existing keys that would get a different value: replace, keep (or skip), abort, or prompt for each key")
+	importCmd.Flags().IntVar(&importLimit.MaxKeys, "max-keys", 0, "refuse to import more keys than this without --force; 0, the default, sets no limit")
+	importCmd.Flags().IntVar(&importLimit.MaxBytes, "max-bytes", 0, "refuse to import more bytes of values than this without --force; 0, the default, sets no limit")
+	importCmd.Flags().IntVar(&importLimit.MaxChangedPercent, "max-changed-percent", 0, "refuse to change the value of more than this percentage of the existing keys of the service without --force; 0, the default, sets no limit")
+	importCmd.Flags().BoolVar(&importForce, "force", false, "import even if the limits set by --max-keys, --max-bytes and --max-changed-percent are exceeded")
+	importCmd.Flags().StringVar(&importFormat, "format", "auto", "format of the input: json, yaml or dotenv; auto picks one from the file extension, or else the content")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "list the keys that would be created, changed, deleted by --prune or left untouched, without writing anything")
+	importCmd.Flags().BoolVar(&importShow, "show-values", false, "with --dry-run, show the values of created and changed keys rather than masking them")
+	importCmd.Flags().BoolVar(&importExit, "exit-code", false, "with --dry-run, exit with status 1 when keys would be created or changed, e.g. to flag a review")
+	importCmd.Flags().BoolVar(&importPrune, "prune", false, "delete the keys of the service that are absent from the file, after asking for confirmation; try it with --dry-run first")
+	importCmd.Flags().BoolVar(&importYes, "yes", false, "with --prune, delete keys without asking for confirmation")
+	importCmd.Flags().IntVar(&importWorkers, "concurrency", DefaultConcurrency, "how many keys to write at once, on backends that support it; writes the backend throttles are retried after a pause")
+	importCmd.Flags().StringVar(&importValidate, "validate", "", "refuse to import when the service would not match this JSON Schema file afterwards, as checked by chamber validate --schema")
+	importCmd.Flags().BoolVar(&importDecrypt, "decrypt", false, "the input is a bundle encrypted by chamber export --encrypt; decrypt it with KMS before importing")
 	RootCmd.AddCommand(importCmd)
 }
 
@@ -33,6 +110,24 @@ func importRun(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("Failed to validate service: %w", err)
 	}
 
+	if onConflict == "skip" {
+		onConflict = ConflictKeep
+	}
+	switch onConflict {
+	case ConflictReplace, ConflictKeep, ConflictAbort, ConflictPrompt:
+	default:
+		return fmt.Errorf("Unsupported conflict policy: %s", onConflict)
+	}
+	if onConflict == ConflictPrompt && args[1] == "-" {
+		return errors.New("--on-conflict prompt cannot be used when importing from standard input")
+	}
+	if onConflict == ConflictPrompt && importDryRun {
+		return errors.New("--on-conflict prompt cannot be used with --dry-run")
+	}
+	if importPrune && !importDryRun && !importYes && args[1] == "-" {
+		return errors.New("--prune needs --yes when importing from standard input, since it can't ask for confirmation")
+	}
+
 	var in io.Reader
 	var err error
 
@@ -46,11 +141,29 @@ func importRun(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	var toBeImported map[string]string
+	format := strings.ToLower(importFormat)
+	switch format {
+	case "auto", "json", "yaml", "dotenv":
+	default:
+		return fmt.Errorf("Unsupported import format: %s", importFormat)
+	}
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return fmt.Errorf("Failed to read input: %w", err)
+	}
+	if importDecrypt {
+		if data, format, err = decryptImport(data); err != nil {
+			return err
+		}
+	}
+	if format == "auto" {
+		format = importFileFormat(file, data)
+	}
 
-	decoder := yaml.NewDecoder(in)
-	if err := decoder.Decode(&toBeImported); err != nil {
-		return fmt.Errorf("Failed to decode input as json: %w", err)
+	toBeImported, err := parseImport(data, format)
+	if err != nil {
+		return fmt.Errorf("Failed to decode input as %s: %w", format, err)
 	}
 
 	if analyticsEnabled && analyticsClient != nil {
@@ -69,20 +182,447 @@ func importRun(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("Failed to get secret store: %w", err)
 	}
+	if secretStore, err = withKMSKey(secretStore, service, ""); err != nil {
+		return err
+	}
+
+	if normalizeKeys {
+		normalized := make(map[string]string, len(toBeImported))
+		for key, value := range toBeImported {
+			normalized[utils.NormalizeKey(key)] = value
+		}
+		toBeImported = normalized
+	}
+
+	// a new service may not exist yet
+	existing, err := secretStore.ListRaw(service)
+	if err != nil && !errors.Is(err, store.ErrSecretNotFound) {
+		return fmt.Errorf("Failed to list store contents: %w", err)
+	}
+	// conflicts and --prune read their answers from the same reader, so that
+	// answers piped in aren't buffered away by the first prompt
+	answers := bufio.NewReader(os.Stdin)
+	incoming := toBeImported
+	if onConflict != ConflictReplace {
+		toBeImported, err = resolveImportConflicts(existing, toBeImported, onConflict, answers, os.Stderr)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !importForce {
+		if err := checkImportLimits(existing, toBeImported, importLimit); err != nil {
+			return err
+		}
+	}
+
+	changes := planImport(existing, incoming, toBeImported, importPrune)
+	if importValidate != "" {
+		schema, err := readSecretSchema(importValidate)
+		if err != nil {
+			return err
+		}
+		if problems := checkSchema(schema, importResult(existing, changes)); len(problems) > 0 {
+			printManifestProblems(os.Stderr, map[string][]manifestProblem{service: problems})
+			return fmt.Errorf("Refusing to import: %s would not match %s", service, importValidate)
+		}
+	}
+	if importDryRun {
+		if err := writeImportPlan(os.Stdout, changes, importShow); err != nil {
+			return err
+		}
+		if importExit && importChanges(changes) {
+			return errExitStatus
+		}
+		return nil
+	}
 
-	for key, value := range toBeImported {
-		if normalizeKeys {
-			key = utils.NormalizeKey(key)
+	var pruned []string
+	for _, c := range changes {
+		if c.Action == ImportDelete {
+			pruned = append(pruned, c.Key)
 		}
-		secretId := store.SecretId{
-			Service: service,
-			Key:     key,
+	}
+	if len(pruned) > 0 && !importYes {
+		ok, err := confirmPrune(answers, os.Stderr, service, pruned)
+		if err != nil {
+			return err
 		}
-		if err := secretStore.Write(secretId, value); err != nil {
-			return fmt.Errorf("Failed to write secret: %w", err)
+		if !ok {
+			return errors.New("Import aborted")
 		}
 	}
 
-	fmt.Fprintf(os.Stdout, "Successfully imported %d secrets\n", len(toBeImported))
+	workers := writeConcurrency(secretStore, importWorkers)
+	keys := sortedKeys(toBeImported)
+	errs := runPool(workers, len(keys), func(i int) error {
+		return secretStore.Write(store.SecretId{Service: service, Key: keys[i]}, toBeImported[keys[i]])
+	})
+	if err := poolError("write", keys, errs); err != nil {
+		return err
+	}
+
+	errs = runPool(workers, len(pruned), func(i int) error {
+		return secretStore.Delete(store.SecretId{Service: service, Key: pruned[i]})
+	})
+	if err := poolError("delete", pruned, errs); err != nil {
+		return err
+	}
+
+	if importPrune {
+		fmt.Fprintf(os.Stdout, "Successfully imported %d secrets and pruned %d\n", len(toBeImported), len(pruned))
+	} else {
+		fmt.Fprintf(os.Stdout, "Successfully imported %d secrets\n", len(toBeImported))
+	}
 	return nil
 }
+
+// confirmPrune asks whether to delete the keys of a service absent from the
+// imported file, reading the answer from in
+func confirmPrune(in io.Reader, out io.Writer, service string, keys []string) (bool, error) {
+	fmt.Fprintf(out, "--prune deletes %d keys of %s that are absent from the file: %s\nDelete them? [y/N] ",
+		len(keys), service, strings.Join(keys, ", "))
+	return readConfirmation(in)
+}
+
+// readConfirmation reads a yes or no answer from in, no being the default.
+// Callers asking several questions should pass the same *bufio.Reader each
+// time, as other readers could have read ahead past the answer.
+func readConfirmation(in io.Reader) (bool, error) {
+	line, err := lineReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return false, fmt.Errorf("Failed to read confirmation: %w", err)
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes", nil
+}
+
+// lineReader returns in as a *bufio.Reader, reusing it if it already is one
+func lineReader(in io.Reader) *bufio.Reader {
+	if reader, ok := in.(*bufio.Reader); ok {
+		return reader
+	}
+	return bufio.NewReader(in)
+}
+
+// planImport lists what writing resolved over the existing secrets of a
+// service does to each key of incoming. Keys incoming but not resolved were
+// kept by the conflict policy, and are left untouched. With prune, existing
+// keys absent from incoming are deleted.
+func planImport(existing []store.RawSecret, incoming, resolved map[string]string, prune bool) []importChange {
+	current := make(map[string]string, len(existing))
+	for _, rawSecret := range existing {
+		current[key(rawSecret.Key)] = rawSecret.Value
+	}
+
+	changes := make([]importChange, 0, len(incoming))
+	for _, k := range sortedKeys(incoming) {
+		cur, exists := current[k]
+		v, written := resolved[k]
+		switch {
+		case written && !exists:
+			changes = append(changes, importChange{Key: k, Action: ImportCreate, New: v})
+		case written && cur != v:
+			changes = append(changes, importChange{Key: k, Action: ImportChange, Old: cur, New: v})
+		default:
+			changes = append(changes, importChange{Key: k, Action: ImportUntouched})
+		}
+	}
+
+	if prune {
+		for _, k := range sortedKeys(current) {
+			if _, ok := incoming[k]; !ok && !pruneProtected[k] {
+				changes = append(changes, importChange{Key: k, Action: ImportDelete, Old: current[k]})
+			}
+		}
+	}
+	return changes
+}
+
+// importResult returns the values the secrets of a service would have after
+// changes
+func importResult(existing []store.RawSecret, changes []importChange) map[string]string {
+	deleted := map[string]bool{}
+	updated := map[string]string{}
+	for _, c := range changes {
+		switch c.Action {
+		case ImportCreate, ImportChange:
+			updated[c.Key] = c.New
+		case ImportDelete:
+			deleted[c.Key] = true
+		}
+	}
+	result := make(map[string]string, len(existing)+len(updated))
+	for _, rawSecret := range existing {
+		if k := key(rawSecret.Key); !deleted[k] {
+			result[k] = rawSecret.Value
+		}
+	}
+	for k, v := range updated {
+		result[k] = v
+	}
+	return result
+}
+
+// importChanges reports whether an import would create or change any key
+func importChanges(changes []importChange) bool {
+	for _, c := range changes {
+		if c.Action != ImportUntouched {
+			return true
+		}
+	}
+	return false
+}
+
+// writeImportPlan writes changes as a table, masking values unless
+// showValues is set
+func writeImportPlan(out io.Writer, changes []importChange, showValues bool) error {
+	mask := func(v string) string {
+		if showValues {
+			return strconv.Quote(v)
+		}
+		return "********"
+	}
+	counts := map[string]int{}
+	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', 0)
+	fmt.Fprintln(w, "Key\tAction\tValue")
+	for _, c := range changes {
+		counts[c.Action]++
+		switch c.Action {
+		case ImportCreate:
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Key, c.Action, mask(c.New))
+		case ImportChange:
+			fmt.Fprintf(w, "%s\t%s\t%s -> %s\n", c.Key, c.Action, mask(c.Old), mask(c.New))
+		case ImportDelete:
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Key, c.Action, mask(c.Old))
+		default:
+			fmt.Fprintf(w, "%s\t%s\t\n", c.Key, c.Action)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "Would create %d, change %d, delete %d and leave %d secrets untouched\n",
+		counts[ImportCreate], counts[ImportChange], counts[ImportDelete], counts[ImportUntouched])
+	return err
+}
+
+// decryptImport decrypts a bundle, returning the export it holds and its
+// format
+func decryptImport(data []byte) ([]byte, string, error) {
+	bundle, err := readBundle(data)
+	if err != nil {
+		return nil, "", err
+	}
+	switch bundle.Format {
+	case "json", "yaml", "dotenv":
+	default:
+		return nil, "", fmt.Errorf("Failed to import bundle: it holds a %s export; only json, yaml and dotenv can be imported", bundle.Format)
+	}
+	svc, err := newBundleKMS()
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to create KMS client: %w", err)
+	}
+	plaintext, err := openBundle(svc, bundle)
+	if err != nil {
+		return nil, "", err
+	}
+	return plaintext, bundle.Format, nil
+}
+
+// dotenvLine matches the first line of a dotenv file that isn't blank or a
+// comment, which YAML would read as a plain string rather than a mapping
+var dotenvLine = regexp.MustCompile(`^(export\s+)?[A-Za-z_][A-Za-z0-9_.-]*=`)
+
+// importFileFormat picks the format of an input from its file extension, or
+// else from its content. Dotenv files are commonly named .env or
+// .env.<environment>.
+func importFileFormat(path string, data []byte) string {
+	base := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(base, ".json"):
+		return "json"
+	case strings.HasSuffix(base, ".yaml"), strings.HasSuffix(base, ".yml"):
+		return "yaml"
+	case base == ".env", strings.HasPrefix(base, ".env."), strings.HasSuffix(base, ".env"):
+		return "dotenv"
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if dotenvLine.MatchString(line) {
+			return "dotenv"
+		}
+		break
+	}
+	return "yaml"
+}
+
+// parseImport reads the secrets to import from data. Nested JSON and YAML
+// mappings are flattened into parent_child keys. Dotenv variable names are
+// normalized into keys, as chamber writes them.
+func parseImport(data []byte, format string) (map[string]string, error) {
+	if format == "dotenv" {
+		vars, err := parseDotenv(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[string]string, len(vars))
+		for name, value := range vars {
+			k := utils.NormalizeKey(name)
+			if _, ok := values[k]; ok {
+				return nil, fmt.Errorf("%s is set more than once, in different cases", k)
+			}
+			values[k] = value
+		}
+		return values, nil
+	}
+
+	// JSON is a subset of YAML
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	if len(doc.Content) == 0 {
+		return values, nil
+	}
+	if err := flattenImport(doc.Content[0], "", values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// flattenImport adds the scalars of a mapping node to values, prefixing the
+// keys of nested mappings with those of their parents
+func flattenImport(node *yaml.Node, prefix string, values map[string]string) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind != yaml.MappingNode {
+		return errors.New("expected a mapping of keys to values")
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		k := prefix + node.Content[i].Value
+		value := node.Content[i+1]
+		if value.Kind == yaml.AliasNode {
+			value = value.Alias
+		}
+		switch value.Kind {
+		case yaml.MappingNode:
+			if err := flattenImport(value, k+"_", values); err != nil {
+				return err
+			}
+			continue
+		case yaml.ScalarNode:
+		default:
+			return fmt.Errorf("%s: lists can't be imported", k)
+		}
+		if _, ok := values[k]; ok {
+			return fmt.Errorf("%s is defined more than once", k)
+		}
+		if value.Tag == "!!null" {
+			values[k] = ""
+		} else {
+			values[k] = value.Value
+		}
+	}
+	return nil
+}
+
+// checkImportLimits fails, listing every limit exceeded, if writing incoming
+// over the existing secrets of a service goes beyond limits. Changing a single
+// key never counts as changing too many.
+func checkImportLimits(existing []store.RawSecret, incoming map[string]string, limits importLimits) error {
+	var exceeded []string
+
+	if limits.MaxKeys > 0 && len(incoming) > limits.MaxKeys {
+		exceeded = append(exceeded, fmt.Sprintf("%d keys, more than --max-keys %d", len(incoming), limits.MaxKeys))
+	}
+
+	size := 0
+	for _, v := range incoming {
+		size += len(v)
+	}
+	if limits.MaxBytes > 0 && size > limits.MaxBytes {
+		exceeded = append(exceeded, fmt.Sprintf("%d bytes, more than --max-bytes %d", size, limits.MaxBytes))
+	}
+
+	changed := 0
+	for _, rawSecret := range existing {
+		if v, ok := incoming[key(rawSecret.Key)]; ok && v != rawSecret.Value {
+			changed++
+		}
+	}
+	if limits.MaxChangedPercent > 0 && changed > 1 && changed*100 > limits.MaxChangedPercent*len(existing) {
+		exceeded = append(exceeded, fmt.Sprintf("changes %d of %d existing keys, more than --max-changed-percent %d%%",
+			changed, len(existing), limits.MaxChangedPercent))
+	}
+
+	if len(exceeded) > 0 {
+		return fmt.Errorf("Refusing to import %s; check that this is the right file and service, and pass --force to import anyway",
+			strings.Join(exceeded, ", "))
+	}
+	return nil
+}
+
+// resolveImportConflicts returns the secrets of incoming that should be
+// written, given the existing secrets of the service and a conflict policy
+// other than replace. A conflict is a key that exists with a different value.
+// With the prompt policy, choices are read from in and prompts written to out.
+func resolveImportConflicts(existing []store.RawSecret, incoming map[string]string, policy string, in io.Reader, out io.Writer) (map[string]string, error) {
+	current := make(map[string]string, len(existing))
+	for _, rawSecret := range existing {
+		current[key(rawSecret.Key)] = rawSecret.Value
+	}
+
+	conflicts := []string{}
+	for k, v := range incoming {
+		if cur, ok := current[k]; ok && cur != v {
+			conflicts = append(conflicts, k)
+		}
+	}
+	sort.Strings(conflicts)
+
+	if len(conflicts) > 0 && policy == ConflictAbort {
+		return nil, fmt.Errorf("Import would overwrite existing keys: %s", strings.Join(conflicts, ", "))
+	}
+
+	kept := map[string]struct{}{}
+	reader := lineReader(in)
+	for _, k := range conflicts {
+		choice := policy
+		for choice == ConflictPrompt {
+			fmt.Fprintf(out, "%s already exists with a different value. [r]eplace, [k]eep, replace [a]ll, keep a[l]l, or [q]uit? ", k)
+			line, err := reader.ReadString('\n')
+			if err != nil && line == "" {
+				return nil, fmt.Errorf("Failed to read choice: %w", err)
+			}
+			switch strings.TrimSpace(line) {
+			case "r":
+				choice = ConflictReplace
+			case "k":
+				choice = ConflictKeep
+			case "a":
+				choice, policy = ConflictReplace, ConflictReplace
+			case "l":
+				choice, policy = ConflictKeep, ConflictKeep
+			case "q":
+				return nil, errors.New("Import aborted")
+			}
+		}
+		if choice == ConflictKeep {
+			kept[k] = struct{}{}
+		}
+	}
+
+	resolved := make(map[string]string, len(incoming))
+	for k, v := range incoming {
+		if _, ok := kept[k]; !ok {
+			resolved[k] = v
+		}
+	}
+	return resolved, nil
+}
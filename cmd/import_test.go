@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveImportConflicts(t *testing.T) {
+	existing := []store.RawSecret{
+		{Key: "/app/db_host", Value: "db.internal"},
+		{Key: "/app/db_password", Value: "hunter22"},
+		{Key: "/app/log_level", Value: "info"},
+	}
+	incoming := map[string]string{
+		"db_host":     "db.internal",
+		"db_password": "hunter2",
+		"log_level":   "debug",
+		"api_key":     "abc",
+	}
+
+	t.Run("keep only writes new and unchanged keys", func(t *testing.T) {
+		out, err := resolveImportConflicts(existing, incoming, ConflictKeep, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"db_host": "db.internal", "api_key": "abc"}, out)
+	})
+
+	t.Run("abort lists the conflicts", func(t *testing.T) {
+		_, err := resolveImportConflicts(existing, incoming, ConflictAbort, nil, nil)
+		assert.EqualError(t, err, "Import would overwrite existing keys: db_password, log_level")
+	})
+
+	t.Run("prompt asks about each conflict", func(t *testing.T) {
+		prompts := &bytes.Buffer{}
+		out, err := resolveImportConflicts(existing, incoming, ConflictPrompt, strings.NewReader("x\nk\nr\n"), prompts)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"db_host": "db.internal", "log_level": "debug", "api_key": "abc"}, out)
+		assert.Equal(t, 3, strings.Count(prompts.String(), "already exists"))
+	})
+
+	t.Run("prompt can apply a choice to the remaining conflicts", func(t *testing.T) {
+		out, err := resolveImportConflicts(existing, incoming, ConflictPrompt, strings.NewReader("a\n"), &bytes.Buffer{})
+		assert.NoError(t, err)
+		assert.Equal(t, incoming, out)
+	})
+
+	t.Run("prompt can quit", func(t *testing.T) {
+		_, err := resolveImportConflicts(existing, incoming, ConflictPrompt, strings.NewReader("q\n"), &bytes.Buffer{})
+		assert.EqualError(t, err, "Import aborted")
+	})
+}
+
+func TestCheckImportLimits(t *testing.T) {
+	existing := []store.RawSecret{
+		{Key: "/app/a", Value: "1"},
+		{Key: "/app/b", Value: "2"},
+		{Key: "/app/c", Value: "3"},
+		{Key: "/app/d", Value: "4"},
+	}
+	limits := importLimits{MaxKeys: 5, MaxBytes: 10, MaxChangedPercent: 50}
+
+	t.Run("within limits", func(t *testing.T) {
+		assert.NoError(t, checkImportLimits(existing, map[string]string{"a": "1", "b": "x", "c": "y", "e": "5"}, limits))
+	})
+
+	t.Run("changing a single key is always allowed", func(t *testing.T) {
+		assert.NoError(t, checkImportLimits(existing[:1], map[string]string{"a": "x"}, limits))
+	})
+
+	t.Run("every exceeded limit is reported", func(t *testing.T) {
+		incoming := map[string]string{"a": "x", "b": "x", "c": "x", "d": "1234567", "e": "5", "f": "6"}
+		err := checkImportLimits(existing, incoming, limits)
+		assert.EqualError(t, err, "Refusing to import 6 keys, more than --max-keys 5, 12 bytes, more than --max-bytes 10, "+
+			"changes 4 of 4 existing keys, more than --max-changed-percent 50%; check that this is the right file and service, and pass --force to import anyway")
+	})
+
+	t.Run("zero disables limits", func(t *testing.T) {
+		incoming := map[string]string{"a": "x", "b": "x", "c": "x", "d": "1234567", "e": "5", "f": "6"}
+		assert.NoError(t, checkImportLimits(existing, incoming, importLimits{}))
+	})
+}
+
+func TestImportFileFormat(t *testing.T) {
+	tests := []struct {
+		path   string
+		data   string
+		format string
+	}{
+		{path: "secrets.json", data: `{"a":"b"}`, format: "json"},
+		{path: "secrets.YML", data: "a: b", format: "yaml"},
+		{path: ".env", data: "A=b", format: "dotenv"},
+		{path: ".env.production", data: "A=b", format: "dotenv"},
+		{path: "app.env", data: "A=b", format: "dotenv"},
+		{path: "-", data: `{"a":"b"}`, format: "yaml"},
+		{path: "-", data: "a: b", format: "yaml"},
+		{path: "-", data: "# comment\n\nexport A='b'\n", format: "dotenv"},
+		{path: "export.out", data: "DB_HOST=localhost\n", format: "dotenv"},
+	}
+	for _, test := range tests {
+		t.Run(test.path+" "+test.data, func(t *testing.T) {
+			assert.Equal(t, test.format, importFileFormat(test.path, []byte(test.data)))
+		})
+	}
+}
+
+func TestParseImport(t *testing.T) {
+	t.Run("nested yaml is flattened", func(t *testing.T) {
+		values, err := parseImport([]byte(`
+db:
+  host: db.internal
+  port: 5432
+  replica:
+    host: replica.internal
+log_level: info
+debug: false
+empty:
+`), "yaml")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"db_host":         "db.internal",
+			"db_port":         "5432",
+			"db_replica_host": "replica.internal",
+			"log_level":       "info",
+			"debug":           "false",
+			"empty":           "",
+		}, values)
+	})
+
+	t.Run("nested json is flattened", func(t *testing.T) {
+		values, err := parseImport([]byte(`{"db":{"host":"db.internal"},"api_key":"abc"}`), "json")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"db_host": "db.internal", "api_key": "abc"}, values)
+	})
+
+	t.Run("dotenv", func(t *testing.T) {
+		values, err := parseImport([]byte("# comment\nexport DB_HOST=db.internal\nDB_PASSWORD=\"a\\\"b\"\n"), "dotenv")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"db_host": "db.internal", "db_password": `a"b`}, values)
+
+		_, err = parseImport([]byte("DB_HOST=a\ndb_host=b\n"), "dotenv")
+		assert.Error(t, err)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, data := range []string{
+			"hosts: [a, b]",
+			"db_host: a\ndb:\n  host: b\n",
+			"just a string",
+		} {
+			_, err := parseImport([]byte(data), "yaml")
+			assert.Error(t, err, data)
+		}
+	})
+}
+
+func TestPlanImport(t *testing.T) {
+	existing := []store.RawSecret{
+		{Key: "/app/db_host", Value: "db.internal"},
+		{Key: "/app/db_password", Value: "hunter22"},
+		{Key: "/app/log_level", Value: "info"},
+		{Key: "/app/unrelated", Value: "x"},
+	}
+	incoming := map[string]string{
+		"db_host":     "db.internal",
+		"db_password": "hunter2",
+		"log_level":   "debug",
+		"api_key":     "abc",
+	}
+	// log_level was kept by the conflict policy
+	resolved := map[string]string{
+		"db_host":     "db.internal",
+		"db_password": "hunter2",
+		"api_key":     "abc",
+	}
+
+	changes := planImport(existing, incoming, resolved, false)
+	assert.Equal(t, []importChange{
+		{Key: "api_key", Action: ImportCreate, New: "abc"},
+		{Key: "db_host", Action: ImportUntouched},
+		{Key: "db_password", Action: ImportChange, Old: "hunter22", New: "hunter2"},
+		{Key: "log_level", Action: ImportUntouched},
+	}, changes)
+	assert.True(t, importChanges(changes))
+	assert.False(t, importChanges(planImport(existing, map[string]string{"db_host": "db.internal"}, map[string]string{"db_host": "db.internal"}, false)))
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, writeImportPlan(buf, changes, false))
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, []string{"Key", "Action", "Value"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"api_key", "create", "********"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"db_host", "untouched"}, strings.Fields(lines[2]))
+	assert.Equal(t, []string{"db_password", "change", "********", "->", "********"}, strings.Fields(lines[3]))
+	assert.Equal(t, "Would create 1, change 1, delete 0 and leave 2 secrets untouched", lines[5])
+	assert.NotContains(t, buf.String(), "hunter")
+
+	buf.Reset()
+	assert.NoError(t, writeImportPlan(buf, changes, true))
+	assert.Contains(t, buf.String(), `"hunter22" -> "hunter2"`)
+}
+
+func TestPlanImportPrune(t *testing.T) {
+	existing := []store.RawSecret{
+		{Key: "/app/db_host", Value: "db.internal"},
+		{Key: "/app/old_key", Value: "stale"},
+		{Key: "/app/" + ManifestKey, Value: "{}"},
+		{Key: "/app/" + store.RolloutKey, Value: "{}"},
+	}
+	incoming := map[string]string{"db_host": "db.internal"}
+
+	changes := planImport(existing, incoming, incoming, true)
+	assert.Equal(t, []importChange{
+		{Key: "db_host", Action: ImportUntouched},
+		{Key: "old_key", Action: ImportDelete, Old: "stale"},
+	}, changes)
+	assert.True(t, importChanges(changes))
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, writeImportPlan(buf, changes, false))
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, []string{"old_key", "delete", "********"}, strings.Fields(lines[2]))
+	assert.Equal(t, "Would create 0, change 0, delete 1 and leave 1 secrets untouched", lines[3])
+}
+
+func TestImportResult(t *testing.T) {
+	existing := []store.RawSecret{
+		{Key: "/app/db_host", Value: "db.internal"},
+		{Key: "/app/db_user", Value: "app"},
+		{Key: "/app/old_key", Value: "stale"},
+	}
+	changes := []importChange{
+		{Key: "db_host", Action: ImportChange, Old: "db.internal", New: "db.example.com"},
+		{Key: "db_user", Action: ImportUntouched},
+		{Key: "old_key", Action: ImportDelete, Old: "stale"},
+		{Key: "port", Action: ImportCreate, New: "5432"},
+	}
+	assert.Equal(t, map[string]string{"db_host": "db.example.com", "db_user": "app", "port": "5432"}, importResult(existing, changes))
+}
+
+func TestConfirmPrune(t *testing.T) {
+	for answer, expected := range map[string]bool{"y\n": true, "YES\n": true, "n\n": false, "\n": false, "sure\n": false} {
+		out := &bytes.Buffer{}
+		ok, err := confirmPrune(strings.NewReader(answer), out, "app", []string{"a", "b"})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, ok, answer)
+		assert.Contains(t, out.String(), "deletes 2 keys of app that are absent from the file: a, b")
+	}
+
+	_, err := confirmPrune(strings.NewReader(""), &bytes.Buffer{}, "app", []string{"a"})
+	assert.Error(t, err)
+}
+
+func TestImportPromptsShareAnswers(t *testing.T) {
+	existing := []store.RawSecret{{Key: "/app/a", Value: "old"}, {Key: "/app/stale", Value: "x"}}
+	answers := bufio.NewReader(strings.NewReader("r\ny\n"))
+
+	resolved, err := resolveImportConflicts(existing, map[string]string{"a": "new"}, ConflictPrompt, answers, &bytes.Buffer{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "new"}, resolved)
+
+	ok, err := confirmPrune(answers, &bytes.Buffer{}, "app", []string{"stale"})
+	require.NoError(t, err)
+	assert.True(t, ok, "the second answer is left for the prune confirmation")
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// ServicesAnnotation is the pod annotation listing the services k8s-init
+// fetches, separated by commas
+const ServicesAnnotation = "chamber.segmentio.com/services"
+
+var (
+	// k8sInitCmd represents the k8s-init command
+	k8sInitCmd = &cobra.Command{
+		Use:   "k8s-init [<service...>] --output-path <path>",
+		Short: "Write secrets to a volume shared with a pod's containers, for init containers",
+		Long: `Write secrets to a volume shared with a pod's containers, for init containers.
+
+The secrets of the services are written to --output-path, usually on an emptyDir
+volume, and k8s-init exits. The env format writes a file the main container
+can source, dotenv and json write a file in those formats, and files writes a
+file per secret into the --output-path directory, named like its environment
+variable.
+
+Besides arguments, services can be listed in the ` + ServicesAnnotation + `
+annotation of the pod, exposed to the init container with a downwardAPI
+volume and read with --annotations, so that a mutating webhook can inject the
+init container without knowing about the services.`,
+		Example: `
+	initContainers:
+	- name: chamber
+	  image: segment/chamber:2
+	  args: [k8s-init, --annotations, /etc/podinfo/annotations, --output-path, /chamber/env]
+	  volumeMounts:
+	  - {name: chamber, mountPath: /chamber}
+	  - {name: podinfo, mountPath: /etc/podinfo}
+	containers:
+	- name: app
+	  command: [sh, -c, '. /chamber/env && exec ./server']`,
+		RunE: runK8sInit,
+	}
+	k8sInitOutput      string
+	k8sInitFormat      string
+	k8sInitMode        string
+	k8sInitAnnotations string
+)
+
+func init() {
+	k8sInitCmd.Flags().StringVarP(&k8sInitOutput, "output-path", "o", "", "file to write, or directory with --format files")
+	k8sInitCmd.Flags().StringVarP(&k8sInitFormat, "format", "f", "env", "output format: env, dotenv, json or files")
+	k8sInitCmd.Flags().StringVar(&k8sInitMode, "mode", "0400", "octal permissions of the written files; relax them when the containers run as different users")
+	k8sInitCmd.Flags().StringVar(&k8sInitAnnotations, "annotations", "", "downwardAPI file of pod annotations to read services from")
+	k8sInitCmd.MarkFlagRequired("output-path")
+	RootCmd.AddCommand(k8sInitCmd)
+}
+
+func runK8sInit(cmd *cobra.Command, args []string) error {
+	mode, err := strconv.ParseUint(k8sInitMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return fmt.Errorf("Invalid --mode %q: must be octal, like 0440", k8sInitMode)
+	}
+	format := strings.ToLower(k8sInitFormat)
+	switch format {
+	case "env", "dotenv", "json", "files":
+	default:
+		return fmt.Errorf("Unsupported format: %s", k8sInitFormat)
+	}
+
+	requested := args
+	if k8sInitAnnotations != "" {
+		f, err := os.Open(k8sInitAnnotations)
+		if err != nil {
+			return fmt.Errorf("Failed to open annotations: %w", err)
+		}
+		annotations, err := parseDownwardAnnotations(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("Failed to read annotations: %w", err)
+		}
+		requested = append(requested, annotatedServices(annotations)...)
+	}
+	if len(requested) == 0 {
+		return fmt.Errorf("no services given, as arguments or in the %s annotation", ServicesAnnotation)
+	}
+
+	services := make([]string, 0, len(requested))
+	for _, service := range requested {
+		service = utils.NormalizeService(service)
+		if err := validateService(service); err != nil {
+			return fmt.Errorf("Failed to validate service %s: %w", service, err)
+		}
+		services = append(services, service)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "k8s-init").
+				Set("chamber-version", chamberVersion).
+				Set("services", services).
+				Set("format", format).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	secretStore = withValueTransforms(secretStore)
+
+	params := map[string]string{}
+	for _, service := range services {
+		rawSecrets, err := secretStore.ListRaw(service)
+		if err != nil {
+			return fmt.Errorf("Failed to list store contents for service %s: %w", service, err)
+		}
+		for _, rawSecret := range rawSecrets {
+			k := key(rawSecret.Key)
+			if _, ok := params[k]; ok {
+				fmt.Fprintf(os.Stderr, "warning: parameter %s specified more than once (overridden by service %s)\n", k, service)
+			}
+			params[k] = rawSecret.Value
+		}
+	}
+
+	if err := writeK8sInitOutput(k8sInitOutput, format, params, os.FileMode(mode)); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d secrets of %s to %s\n", len(params), strings.Join(services, ", "), k8sInitOutput)
+	return nil
+}
+
+// writeK8sInitOutput writes params to output in format, with mode
+func writeK8sInitOutput(output, format string, params map[string]string, mode os.FileMode) error {
+	if format == "files" {
+		if err := os.MkdirAll(output, 0755); err != nil {
+			return fmt.Errorf("Failed to create output directory: %w", err)
+		}
+		for _, k := range sortedKeys(params) {
+			name := sanitizeKey(k)
+			if !preserveCase {
+				name = strings.ToUpper(name)
+			}
+			if err := validateShellName(name); err != nil {
+				return err
+			}
+			if err := writeFileAtomically(filepath.Join(output, name), []byte(params[k]), mode); err != nil {
+				return fmt.Errorf("Failed to write %s: %w", name, err)
+			}
+		}
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	var err error
+	switch format {
+	case "env":
+		// shell quoting, since the file is sourced
+		escapeSpecials = false
+		var out []string
+		if out, err = buildEnvOutput(params); err == nil {
+			for _, line := range out {
+				fmt.Fprintf(buf, "export %s\n", line)
+			}
+		}
+	case "dotenv":
+		err = exportAsEnvFile(params, buf)
+	case "json":
+		err = exportAsJson(params, buf)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to export parameters: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return fmt.Errorf("Failed to create output directory: %w", err)
+	}
+	if err := writeFileAtomically(output, buf.Bytes(), mode); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", output, err)
+	}
+	return nil
+}
+
+// parseDownwardAnnotations reads the annotations of a pod from a downwardAPI
+// volume, which writes them as key="value" lines with Go string escaping
+func parseDownwardAnnotations(r io.Reader) (map[string]string, error) {
+	annotations := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		k, quoted, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		v, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", k, err)
+		}
+		annotations[k] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return annotations, nil
+}
+
+// annotatedServices returns the services listed in ServicesAnnotation
+func annotatedServices(annotations map[string]string) []string {
+	var services []string
+	for _, service := range strings.Split(annotations[ServicesAnnotation], ",") {
+		if service = strings.TrimSpace(service); service != "" {
+			services = append(services, service)
+		}
+	}
+	return services
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDownwardAnnotations(t *testing.T) {
+	annotations, err := parseDownwardAnnotations(strings.NewReader(`chamber.segmentio.com/services="app, global"
+kubernetes.io/config.seen="2024-01-01T00:00:00Z"
+note="multi\nline"
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, "multi\nline", annotations["note"])
+	assert.Equal(t, []string{"app", "global"}, annotatedServices(annotations))
+
+	_, err = parseDownwardAnnotations(strings.NewReader("broken\n"))
+	assert.Error(t, err)
+	assert.Empty(t, annotatedServices(map[string]string{}))
+}
+
+func TestWriteK8sInitOutput(t *testing.T) {
+	params := map[string]string{"db-password": "it's", "port": "5432"}
+
+	testCases := []struct {
+		format string
+		output string
+	}{
+		{"env", "export DB_PASSWORD='it'\"'\"'s'\nexport PORT=5432\n"},
+		{"dotenv", "DB_PASSWORD=\"it's\"\nPORT=\"5432\"\n"},
+		{"json", `{"db-password":"it's","port":"5432"}` + "\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "chamber", "env")
+			err := writeK8sInitOutput(path, tc.format, params, 0440)
+			assert.NoError(t, err)
+
+			data, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.output, string(data))
+			info, err := os.Stat(path)
+			assert.NoError(t, err)
+			assert.Equal(t, os.FileMode(0440), info.Mode().Perm())
+		})
+	}
+
+	t.Run("files", func(t *testing.T) {
+		dir := t.TempDir()
+		err := writeK8sInitOutput(dir, "files", params, 0400)
+		assert.NoError(t, err)
+
+		data, err := os.ReadFile(filepath.Join(dir, "DB_PASSWORD"))
+		assert.NoError(t, err)
+		assert.Equal(t, "it's", string(data))
+		info, err := os.Stat(filepath.Join(dir, "PORT"))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0400), info.Mode().Perm())
+	})
+}
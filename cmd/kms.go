@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	slashpath "path"
+	"sort"
+	"strings"
+
+	"github.com/segmentio/chamber/v2/store"
+)
+
+// kmsKeyFor returns the KMS key to write the secrets of service with: key if
+// given, else the one $CHAMBER_KMS_KEYS maps service to, exactly or by a glob.
+// It returns "" when neither chooses one, leaving the backend's default.
+func kmsKeyFor(service, key string) (string, error) {
+	if key != "" {
+		return key, nil
+	}
+	keys, err := parseKMSKeys(os.Getenv(KMSKeysEnvVar))
+	if err != nil {
+		return "", err
+	}
+	return matchKMSKey(keys, service)
+}
+
+// parseKMSKeys parses a comma separated list of service=key pairs, where
+// services may be globs
+func parseKMSKeys(s string) (map[string]string, error) {
+	keys := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		service, key, ok := strings.Cut(pair, "=")
+		if !ok || service == "" || key == "" {
+			return nil, fmt.Errorf("invalid %s entry %q: must be service=key", KMSKeysEnvVar, pair)
+		}
+		keys[service] = key
+	}
+	return keys, nil
+}
+
+// matchKMSKey returns the key keys maps service to. An exact match wins over
+// globs, which are tried in alphabetical order.
+func matchKMSKey(keys map[string]string, service string) (string, error) {
+	if key, ok := keys[service]; ok {
+		return key, nil
+	}
+	patterns := make([]string, 0, len(keys))
+	for pattern := range keys {
+		if isServiceGlob(pattern) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		matched, err := slashpath.Match(pattern, service)
+		if err != nil {
+			return "", fmt.Errorf("invalid service glob %s in %s: %w", pattern, KMSKeysEnvVar, err)
+		}
+		if matched {
+			return keys[pattern], nil
+		}
+	}
+	return "", nil
+}
+
+// withKMSKey returns secretStore writing the secrets of service with the key
+// kmsKeyFor chooses, failing on backends that can't choose one per write
+func withKMSKey(secretStore store.Store, service, key string) (store.Store, error) {
+	key, err := kmsKeyFor(service, key)
+	if err != nil || key == "" {
+		return secretStore, err
+	}
+	s, ok := store.Unwrap(secretStore).(store.KMSKeyStore)
+	if !ok {
+		return nil, fmt.Errorf("The %s backend cannot choose a KMS key per write, so the key %s for %s cannot be used", backend, key, service)
+	}
+	return readableStore(s.WithKMSKey(key)), nil
+}
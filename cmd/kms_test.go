@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchKMSKey(t *testing.T) {
+	keys := map[string]string{
+		"billing/*":   "alias/team-billing",
+		"billing/ops": "alias/ops",
+		"b*":          "alias/b",
+	}
+	for service, expected := range map[string]string{
+		"billing/ops": "alias/ops",
+		"billing/api": "alias/team-billing",
+		"backend":     "alias/b",
+		"identity":    "",
+	} {
+		key, err := matchKMSKey(keys, service)
+		require.NoError(t, err)
+		assert.Equal(t, expected, key, service)
+	}
+
+	_, err := matchKMSKey(map[string]string{"billing/[": "alias/x"}, "billing/api")
+	assert.Error(t, err)
+}
+
+func TestKMSKeyFor(t *testing.T) {
+	t.Setenv(KMSKeysEnvVar, "billing/*=alias/team-billing, identity-prod=alias/team-identity")
+	for service, expected := range map[string]string{
+		"billing/api":   "alias/team-billing",
+		"identity-prod": "alias/team-identity",
+		"other":         "",
+	} {
+		key, err := kmsKeyFor(service, "")
+		require.NoError(t, err)
+		assert.Equal(t, expected, key, service)
+	}
+
+	key, err := kmsKeyFor("billing/api", "alias/override")
+	require.NoError(t, err)
+	assert.Equal(t, "alias/override", key)
+
+	t.Setenv(KMSKeysEnvVar, "billing/*")
+	_, err = kmsKeyFor("billing/api", "")
+	assert.ErrorContains(t, err, "must be service=key")
+}
+
+func TestWithKMSKey(t *testing.T) {
+	_, err := withKMSKey(store.NewMemoryStore(), "billing", "alias/team-billing")
+	assert.ErrorContains(t, err, "cannot choose a KMS key")
+}
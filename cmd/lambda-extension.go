@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// lambdaExtensionAPIVersion is the version of the Lambda Extensions API used
+const lambdaExtensionAPIVersion = "2020-01-01"
+
+var (
+	// lambdaExtensionCmd represents the lambda-extension command
+	lambdaExtensionCmd = &cobra.Command{
+		Use:   "lambda-extension <service...>",
+		Short: "Run as an AWS Lambda extension, providing secrets to the function",
+		Long: `Run as an AWS Lambda extension, providing secrets to the function without
+calling the backend on every invocation.
+
+When the function starts, the secrets of the services are written to
+--output-dir as <service>.json, or served over localhost with --listen, using
+the API of chamber server. They are read again before an invocation once
+--refresh has passed since they were last read.
+
+Lambda runs the executables in /opt/extensions of a layer, by file name, so
+install a script like this one as /opt/extensions/chamber:
+
+	#!/bin/sh
+	exec /opt/bin/chamber lambda-extension --name chamber app global`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runLambdaExtension,
+	}
+	lambdaExtensionName      string
+	lambdaExtensionOutputDir string
+	lambdaExtensionListen    string
+	lambdaExtensionRefresh   time.Duration
+)
+
+func init() {
+	lambdaExtensionCmd.Flags().StringVar(&lambdaExtensionName, "name", filepath.Base(os.Args[0]), "name to register the extension with, which must be the file name in /opt/extensions")
+	lambdaExtensionCmd.Flags().StringVar(&lambdaExtensionOutputDir, "output-dir", "/tmp/chamber", "directory to write secrets to")
+	lambdaExtensionCmd.Flags().StringVar(&lambdaExtensionListen, "listen", "", "serve secrets on this address, like chamber server, instead of writing them to files")
+	lambdaExtensionCmd.Flags().DurationVar(&lambdaExtensionRefresh, "refresh", 5*time.Minute, "read secrets again before an invocation once this long has passed")
+	RootCmd.AddCommand(lambdaExtensionCmd)
+}
+
+// lambdaEvent is an event sent to extensions by Lambda
+type lambdaEvent struct {
+	EventType string `json:"eventType"`
+}
+
+// lambdaExtensionClient is a client of the Lambda Extensions API
+type lambdaExtensionClient struct {
+	baseURL string
+	client  *http.Client
+	id      string
+}
+
+func newLambdaExtensionClient(runtimeAPI string) *lambdaExtensionClient {
+	return &lambdaExtensionClient{
+		baseURL: "http://" + runtimeAPI + "/" + lambdaExtensionAPIVersion + "/extension",
+		// next blocks until the next event, which may be a long time
+		client: &http.Client{},
+	}
+}
+
+// register registers the extension for invoke and shutdown events
+func (c *lambdaExtensionClient) register(name string) error {
+	body := []byte(`{"events":["INVOKE","SHUTDOWN"]}`)
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/register", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Lambda-Extension-Name", name)
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to register extension: %w", err)
+	}
+	c.id = resp.Header.Get("Lambda-Extension-Identifier")
+	if c.id == "" {
+		return errors.New("Failed to register extension: no identifier in response")
+	}
+	return nil
+}
+
+// next waits for the next event
+func (c *lambdaExtensionClient) next() (lambdaEvent, error) {
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+"/event/next", nil)
+	if err != nil {
+		return lambdaEvent{}, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return lambdaEvent{}, fmt.Errorf("Failed to get next event: %w", err)
+	}
+	var event lambdaEvent
+	if err := json.Unmarshal(resp.body, &event); err != nil {
+		return lambdaEvent{}, fmt.Errorf("Failed to decode event: %w", err)
+	}
+	return event, nil
+}
+
+// initError reports that the extension failed to start, which fails the
+// function's initialization
+func (c *lambdaExtensionClient) initError(cause error) error {
+	body, err := json.Marshal(map[string]string{"errorMessage": cause.Error(), "errorType": "Extension.ChamberError"})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/init/error", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Lambda-Extension-Function-Error-Type", "Extension.ChamberError")
+	_, err = c.do(req)
+	return err
+}
+
+type lambdaResponse struct {
+	Header http.Header
+	body   []byte
+}
+
+func (c *lambdaExtensionClient) do(req *http.Request) (lambdaResponse, error) {
+	if c.id != "" {
+		req.Header.Set("Lambda-Extension-Identifier", c.id)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return lambdaResponse{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return lambdaResponse{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return lambdaResponse{}, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return lambdaResponse{Header: resp.Header, body: body}, nil
+}
+
+func runLambdaExtension(cmd *cobra.Command, args []string) error {
+	services := make([]string, 0, len(args))
+	for _, arg := range args {
+		service := utils.NormalizeService(arg)
+		if err := validateServiceWithLabel(service); err != nil {
+			return fmt.Errorf("Failed to validate service: %w", err)
+		}
+		services = append(services, service)
+	}
+
+	runtimeAPI := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+	if runtimeAPI == "" {
+		return errors.New("$AWS_LAMBDA_RUNTIME_API is not set; lambda-extension must be run by Lambda")
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "lambda-extension").
+				Set("chamber-version", chamberVersion).
+				Set("services", services).
+				Set("backend", backend),
+		})
+	}
+
+	client := newLambdaExtensionClient(runtimeAPI)
+	if err := client.register(lambdaExtensionName); err != nil {
+		return err
+	}
+
+	refresh, err := lambdaExtensionProvider(services)
+	if err == nil {
+		err = refresh()
+	}
+	if err != nil {
+		if reportErr := client.initError(err); reportErr != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to report error to Lambda: %s\n", reportErr)
+		}
+		return err
+	}
+	return serveLambdaEvents(client, refresh, lambdaExtensionRefresh, time.Now)
+}
+
+// lambdaExtensionProvider sets up the way secrets are provided to the
+// function, returning a function that reads them again
+func lambdaExtensionProvider(services []string) (func() error, error) {
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get secret store: %w", err)
+	}
+
+	if lambdaExtensionListen == "" {
+		return func() error {
+			for _, service := range services {
+				rawSecrets, err := secretStore.ListRaw(service)
+				if err != nil {
+					return fmt.Errorf("Failed to list store contents: %w", err)
+				}
+				secrets := map[string]string{}
+				for _, rawSecret := range rawSecrets {
+					secrets[key(rawSecret.Key)] = rawSecret.Value
+				}
+				if err := writeLambdaSecrets(lambdaExtensionOutputDir, service, secrets); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, nil
+	}
+
+	token := os.Getenv(ServerTokenEnvVar)
+	if token == "" {
+		return nil, fmt.Errorf("$%s must be set to authenticate clients", ServerTokenEnvVar)
+	}
+	listener, err := net.Listen("tcp", lambdaExtensionListen)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to listen: %w", err)
+	}
+	server := newSecretServer(secretStore, token, lambdaExtensionRefresh)
+	go http.Serve(listener, server)
+	return func() error {
+		for _, service := range services {
+			if _, err := server.reload(service); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// writeLambdaSecrets writes the secrets of service to dir as JSON, readable
+// only by the function's user
+func writeLambdaSecrets(dir, service string, secrets map[string]string) error {
+	path := filepath.Join(dir, filepath.FromSlash(service)+".json")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("Failed to create output directory: %w", err)
+	}
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomically(path, data, 0600); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// serveLambdaEvents handles events until Lambda shuts the extension down,
+// refreshing the secrets before an invocation once interval has passed.
+// Failed refreshes keep the previous secrets, since the function can still
+// use them.
+func serveLambdaEvents(client *lambdaExtensionClient, refresh func() error, interval time.Duration, now func() time.Time) error {
+	refreshed := now()
+	for {
+		event, err := client.next()
+		if err != nil {
+			return err
+		}
+		switch event.EventType {
+		case "SHUTDOWN":
+			return nil
+		case "INVOKE":
+			if now().Sub(refreshed) < interval {
+				continue
+			}
+			if err := refresh(); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to refresh secrets: %s\n", err)
+				continue
+			}
+			refreshed = now()
+		}
+	}
+}
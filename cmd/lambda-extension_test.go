@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRuntimeAPI serves the Lambda Extensions API, sending events in order
+func fakeRuntimeAPI(t *testing.T, events []string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2020-01-01/extension/register":
+			assert.Equal(t, "chamber", r.Header.Get("Lambda-Extension-Name"))
+			w.Header().Set("Lambda-Extension-Identifier", "ext-1")
+		case "/2020-01-01/extension/event/next":
+			assert.Equal(t, "ext-1", r.Header.Get("Lambda-Extension-Identifier"))
+			if len(events) == 0 {
+				http.Error(w, "no more events", http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(lambdaEvent{EventType: events[0]})
+			events = events[1:]
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestServeLambdaEvents(t *testing.T) {
+	api := fakeRuntimeAPI(t, []string{"INVOKE", "INVOKE", "INVOKE", "SHUTDOWN"})
+	defer api.Close()
+
+	client := newLambdaExtensionClient(strings.TrimPrefix(api.URL, "http://"))
+	assert.NoError(t, client.register("chamber"))
+
+	// every call to now is a minute after the last
+	clock := time.Unix(0, 0)
+	now := func() time.Time {
+		clock = clock.Add(time.Minute)
+		return clock
+	}
+	refreshes := 0
+	refresh := func() error {
+		refreshes++
+		if refreshes == 1 {
+			return errors.New("throttled")
+		}
+		return nil
+	}
+
+	err := serveLambdaEvents(client, refresh, 90*time.Second, now)
+	assert.NoError(t, err)
+	// the first invocation is too soon, the second fails and the third
+	// tries again
+	assert.Equal(t, 2, refreshes)
+}
+
+func TestWriteLambdaSecrets(t *testing.T) {
+	dir := t.TempDir()
+	err := writeLambdaSecrets(dir, "team/app", map[string]string{"db_password": "hunter22"})
+	assert.NoError(t, err)
+
+	path := filepath.Join(dir, "team", "app.json")
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"db_password":"hunter22"}`, string(data))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
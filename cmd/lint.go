@@ -0,0 +1,363 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// LintConfigFileName is the file lint reads its rules from when --config
+// isn't given, if it exists
+const LintConfigFileName = ".chamber-lint.yml"
+
+// The rules of chamber lint
+const (
+	lintKeyNaming      = "key-naming"
+	lintValueSize      = "value-size"
+	lintForbiddenValue = "forbidden-value"
+	lintRotationSLA    = "rotation-sla"
+)
+
+// lintRuleDescriptions describe each rule, in the order they are checked
+var lintRuleDescriptions = []struct{ ID, Description string }{
+	{lintKeyNaming, "Keys follow the naming convention"},
+	{lintValueSize, "Values fit within the size limit"},
+	{lintForbiddenValue, "Values aren't placeholders like changeme"},
+	{lintRotationSLA, "Secrets are rotated within the rotation SLA"},
+}
+
+var (
+	// lintCmd represents the lint command
+	lintCmd = &cobra.Command{
+		Use:   "lint [prefix]",
+		Short: "Check the secrets of every service against naming and hygiene rules",
+		Long: `Check the secrets of every service under prefix against naming and hygiene
+rules, exiting with status 1 when any are broken:
+
+	key-naming       keys match key_pattern
+	value-size       values are at most max_value_bytes long
+	forbidden-value  values aren't placeholders like changeme, or one of
+	                 forbidden_values
+	rotation-sla     secrets changed within rotation_sla_days, or the
+	                 schedule set by chamber rotate --schedule
+
+The rules are configured in a YAML file, ` + LintConfigFileName + ` in the current
+directory by default:
+
+	key_pattern: '^[a-z][a-z0-9_]*$'
+	max_value_bytes: 4096
+	forbidden_values: [dummy]
+	rotation_sla_days: 90
+	disable: [value-size]
+
+Keys nobody reads are found by chamber clean --unread-days, from CloudTrail.
+--output json and yaml print the findings, and --output sarif prints them as
+a SARIF log for CI annotations.`,
+		Example: `
+	$ chamber lint
+	Service  Key          Rule             Message
+	app      DB-Password  key-naming       key doesn't match ^[a-z][a-z0-9_]*$
+	app      api_key      forbidden-value  value is a placeholder
+	$ chamber lint prod --output sarif > chamber.sarif`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runLint,
+	}
+	lintConfigFile string
+)
+
+// lintOutputSARIF is the format lint accepts for --output besides those of
+// other commands
+const lintOutputSARIF = "sarif"
+
+func init() {
+	lintCmd.Flags().StringVar(&lintConfigFile, "config", "", "YAML file configuring the rules; defaults to "+LintConfigFileName+" if it exists")
+	RootCmd.AddCommand(lintCmd)
+}
+
+// lintConfig configures the rules of chamber lint
+type lintConfig struct {
+	KeyPattern      string   `yaml:"key_pattern"`
+	MaxValueBytes   int      `yaml:"max_value_bytes"`
+	ForbiddenValues []string `yaml:"forbidden_values"`
+	RotationSLADays int      `yaml:"rotation_sla_days"`
+	Disable         []string `yaml:"disable"`
+
+	keyPattern *regexp.Regexp
+}
+
+// defaultLintConfig is the configuration of rules the config file leaves out
+var defaultLintConfig = lintConfig{
+	KeyPattern:      `^[a-z][a-z0-9_]*$`,
+	MaxValueBytes:   4096,
+	RotationSLADays: 90,
+}
+
+// lintFinding is a rule broken by a secret
+type lintFinding struct {
+	Service string `json:"service" yaml:"service"`
+	Key     string `json:"key" yaml:"key"`
+	Rule    string `json:"rule" yaml:"rule"`
+	Message string `json:"message" yaml:"message"`
+}
+
+// readLintConfig reads the configuration of the rules from path, or from
+// LintConfigFileName if path is empty and it exists
+func readLintConfig(path string) (lintConfig, error) {
+	optional := path == ""
+	if optional {
+		path = LintConfigFileName
+	}
+	data, err := os.ReadFile(path)
+	if optional && errors.Is(err, os.ErrNotExist) {
+		data, err = nil, nil
+	}
+	if err != nil {
+		return defaultLintConfig, fmt.Errorf("Failed to read lint config: %w", err)
+	}
+	return parseLintConfig(data)
+}
+
+// parseLintConfig decodes the configuration of the rules over the defaults
+func parseLintConfig(data []byte) (lintConfig, error) {
+	config := defaultLintConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("Invalid lint config: %w", err)
+	}
+	re, err := regexp.Compile(config.KeyPattern)
+	if err != nil {
+		return config, fmt.Errorf("Invalid key_pattern: %w", err)
+	}
+	config.keyPattern = re
+	for _, rule := range config.Disable {
+		known := false
+		for _, r := range lintRuleDescriptions {
+			known = known || r.ID == rule
+		}
+		if !known {
+			return config, fmt.Errorf("Invalid lint config: unknown rule %q", rule)
+		}
+	}
+	return config, nil
+}
+
+// enabled reports whether rule is checked
+func (c lintConfig) enabled(rule string) bool {
+	for _, r := range c.Disable {
+		if r == rule {
+			return false
+		}
+	}
+	switch rule {
+	case lintValueSize:
+		return c.MaxValueBytes > 0
+	}
+	return true
+}
+
+// lintService checks the secrets of a service. schedules holds the rotation
+// schedule of the keys that have one.
+func lintService(service string, secrets []store.Secret, schedules map[string]string, config lintConfig, now time.Time) []lintFinding {
+	var findings []lintFinding
+	add := func(k, rule, format string, args ...interface{}) {
+		findings = append(findings, lintFinding{Service: service, Key: k, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+	forbidden := map[string]bool{}
+	for _, v := range config.ForbiddenValues {
+		forbidden[strings.ToLower(strings.TrimSpace(v))] = true
+	}
+	day := 24 * time.Hour
+
+	for _, secret := range secrets {
+		k := key(secret.Meta.Key)
+		if config.enabled(lintKeyNaming) && !config.keyPattern.MatchString(k) {
+			add(k, lintKeyNaming, "key doesn't match %s", config.KeyPattern)
+		}
+		if secret.Value != nil {
+			v := *secret.Value
+			if config.enabled(lintValueSize) && len(v) > config.MaxValueBytes {
+				add(k, lintValueSize, "value is %d bytes, more than %d", len(v), config.MaxValueBytes)
+			}
+			if config.enabled(lintForbiddenValue) && (isPlaceholder(v) || forbidden[strings.ToLower(strings.TrimSpace(v))]) {
+				add(k, lintForbiddenValue, "value is a placeholder")
+			}
+		}
+		age := now.Sub(secret.Meta.Created)
+		if config.enabled(lintRotationSLA) {
+			sla, label := time.Duration(config.RotationSLADays)*day, fmt.Sprintf("%d days", config.RotationSLADays)
+			if schedule, ok := schedules[k]; ok {
+				if period, err := parseRetention(schedule); err == nil {
+					sla, label = period, "its schedule of "+schedule
+				}
+			}
+			if sla > 0 && age > sla {
+				add(k, lintRotationSLA, "not rotated for %d days, longer than %s", int(age/day), label)
+			}
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Key < findings[j].Key })
+	return findings
+}
+
+func runLint(cmd *cobra.Command, args []string) error {
+	prefix := ""
+	if len(args) == 1 {
+		prefix = utils.NormalizeService(args[0])
+	}
+	sarif := outputFormat == lintOutputSARIF
+	structured := false
+	if !sarif {
+		var err error
+		if structured, err = structuredOutput(); err != nil {
+			return err
+		}
+	}
+	config, err := readLintConfig(lintConfigFile)
+	if err != nil {
+		return err
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "lint").
+				Set("chamber-version", chamberVersion).
+				Set("prefix", prefix).
+				Set("format", outputFormat).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	withSchedules := secretStore.Capabilities().Tags && config.enabled(lintRotationSLA)
+
+	services, err := listUntrashedServices(secretStore, prefix, false)
+	if err != nil {
+		return fmt.Errorf("Failed to list services: %w", err)
+	}
+	sort.Strings(services)
+
+	findings := []lintFinding{}
+	now := time.Now()
+	for _, service := range services {
+		secrets, err := secretStore.List(service, true)
+		if err != nil {
+			return fmt.Errorf("Failed to list store contents for %s: %w", service, err)
+		}
+		schedules := map[string]string{}
+		if withSchedules {
+			for _, secret := range secrets {
+				k := key(secret.Meta.Key)
+				tags, err := secretStore.ReadTags(store.SecretId{Service: service, Key: k})
+				if err != nil {
+					return fmt.Errorf("Failed to read tags of %s/%s: %w", service, k, err)
+				}
+				if schedule, ok := tags[RotationScheduleTagKey]; ok {
+					schedules[k] = schedule
+				}
+			}
+		}
+		findings = append(findings, lintService(service, secrets, schedules, config, now)...)
+	}
+
+	switch {
+	case sarif:
+		err = writeLintSARIF(os.Stdout, findings)
+	case structured:
+		err = writeStructured(os.Stdout, findings)
+	default:
+		if len(findings) == 0 {
+			fmt.Fprintf(os.Stderr, "no problems found\n")
+			break
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+		fmt.Fprintln(w, "Service\tKey\tRule\tMessage")
+		for _, f := range findings {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Service, f.Key, f.Rule, f.Message)
+		}
+		err = w.Flush()
+	}
+	if err != nil {
+		return err
+	}
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// writeLintSARIF writes findings as a SARIF 2.1.0 log, locating them by
+// service and key since secrets have no file
+func writeLintSARIF(w io.Writer, findings []lintFinding) error {
+	type message struct {
+		Text string `json:"text"`
+	}
+	type rule struct {
+		ID               string  `json:"id"`
+		ShortDescription message `json:"shortDescription"`
+	}
+	type logicalLocation struct {
+		FullyQualifiedName string `json:"fullyQualifiedName"`
+		Kind               string `json:"kind"`
+	}
+	type location struct {
+		LogicalLocations []logicalLocation `json:"logicalLocations"`
+	}
+	type result struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   message    `json:"message"`
+		Locations []location `json:"locations"`
+	}
+
+	rules := make([]rule, 0, len(lintRuleDescriptions))
+	for _, r := range lintRuleDescriptions {
+		rules = append(rules, rule{ID: r.ID, ShortDescription: message{r.Description}})
+	}
+	results := make([]result, 0, len(findings))
+	for _, f := range findings {
+		name := f.Service + "/" + f.Key
+		results = append(results, result{
+			RuleID:    f.Rule,
+			Level:     "error",
+			Message:   message{name + ": " + f.Message},
+			Locations: []location{{LogicalLocations: []logicalLocation{{FullyQualifiedName: name, Kind: "member"}}}},
+		})
+	}
+
+	log := map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []interface{}{map[string]interface{}{
+			"tool": map[string]interface{}{
+				"driver": map[string]interface{}{
+					"name":           "chamber",
+					"version":        chamberVersion,
+					"informationUri": "https://github.com/segmentio/chamber",
+					"rules":          rules,
+				},
+			},
+			"results": results,
+		}},
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
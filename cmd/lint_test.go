@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLintConfig(t *testing.T) {
+	config, err := parseLintConfig(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 4096, config.MaxValueBytes)
+	assert.True(t, config.enabled(lintRotationSLA))
+
+	config, err = parseLintConfig([]byte("max_value_bytes: 0\ndisable: [rotation-sla]\n"))
+	require.NoError(t, err)
+	assert.False(t, config.enabled(lintValueSize))
+	assert.False(t, config.enabled(lintRotationSLA))
+
+	_, err = parseLintConfig([]byte("key_pattern: '['\n"))
+	assert.Error(t, err)
+	_, err = parseLintConfig([]byte("disable: [naming]\n"))
+	assert.Error(t, err)
+}
+
+func TestLintService(t *testing.T) {
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	secret := func(k, v string, age time.Duration) store.Secret {
+		return store.Secret{Value: &v, Meta: store.SecretMetadata{Key: "/app/" + k, Created: now.Add(-age)}}
+	}
+	day := 24 * time.Hour
+	secrets := []store.Secret{
+		secret("DB-Password", "hunter2", day),
+		secret("api_key", "changeme", day),
+		secret("token", "dummy", day),
+		secret("cert", strings.Repeat("x", 20), day),
+		secret("legacy", "value", 400*day),
+		secret("old", "value", 100*day),
+		secret("weekly", "value", 10*day),
+		secret("fine", "value", day),
+	}
+	config, err := parseLintConfig([]byte("max_value_bytes: 10\nforbidden_values: [Dummy]\n"))
+	require.NoError(t, err)
+
+	findings := lintService("app", secrets, map[string]string{"weekly": "7d"}, config, now)
+	rules := map[string]string{}
+	for _, f := range findings {
+		assert.Equal(t, "app", f.Service)
+		rules[f.Key] = f.Rule
+	}
+	assert.Equal(t, map[string]string{
+		"DB-Password": lintKeyNaming,
+		"api_key":     lintForbiddenValue,
+		"token":       lintForbiddenValue,
+		"cert":        lintValueSize,
+		"legacy":      lintRotationSLA,
+		"old":         lintRotationSLA,
+		"weekly":      lintRotationSLA,
+	}, rules)
+}
+
+func TestWriteLintSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeLintSARIF(&buf, []lintFinding{{Service: "app", Key: "api_key", Rule: lintForbiddenValue, Message: "value is a placeholder"}})
+	require.NoError(t, err)
+
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Locations []struct {
+					LogicalLocations []struct {
+						FullyQualifiedName string `json:"fullyQualifiedName"`
+					} `json:"logicalLocations"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+	assert.Len(t, log.Runs[0].Tool.Driver.Rules, len(lintRuleDescriptions))
+	require.Len(t, log.Runs[0].Results, 1)
+	assert.Equal(t, lintForbiddenValue, log.Runs[0].Results[0].RuleID)
+	assert.Equal(t, "app/api_key", log.Runs[0].Results[0].Locations[0].LogicalLocations[0].FullyQualifiedName)
+}
@@ -1,59 +1,173 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	slashpath "path"
 	"sort"
+	"strings"
 	"text/tabwriter"
 
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
 	"github.com/segmentio/chamber/v2/utils"
 	"github.com/spf13/cobra"
 )
 
 // listServicesCmd represents the list command
 var listServicesCmd = &cobra.Command{
-	Use:   "list-services <service>",
-	Short: "List services",
-	RunE:  listServices,
+	Use:     "list-services [<service or glob>]",
+	Aliases: []string{"services"},
+	Short:   "List services",
+	Long: `List the services present in the backend, optionally only those under a
+prefix or matching a glob such as "app-*" or "team/*/prod". --counts also
+shows how many keys each service has.`,
+	Example: `
+	$ chamber services
+	$ chamber services 'app-*' --counts`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: listServices,
 }
 
 var (
 	includeSecretName bool
+	includeKeyCounts  bool
 )
 
 func init() {
 	listServicesCmd.Flags().BoolVarP(&includeSecretName, "secrets", "s", false, "Include secret names in the list")
+	listServicesCmd.Flags().BoolVarP(&includeKeyCounts, "counts", "c", false, "Include the number of keys of each service")
 	RootCmd.AddCommand(listServicesCmd)
 }
 
 func listServices(cmd *cobra.Command, args []string) error {
-	var service string
-	if len(args) == 0 {
-		service = ""
-	} else {
+	if includeSecretName && includeKeyCounts {
+		return errors.New("--secrets and --counts can't be used together")
+	}
+	var service, pattern string
+	if len(args) == 1 {
 		service = utils.NormalizeService(args[0])
+	}
+	if isServiceGlob(service) {
+		if err := validateServiceGlob(service); err != nil {
+			return err
+		}
+		// only list what is under the directory the pattern starts in
+		pattern = service
+		service = pattern[:strings.IndexAny(pattern, globChars)]
+		service = service[:strings.LastIndex(service, "/")+1]
+	}
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
 
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "list-services").
+				Set("chamber-version", chamberVersion).
+				Set("glob", pattern != "").
+				Set("counts", includeKeyCounts).
+				Set("backend", backend),
+		})
 	}
+
 	secretStore, err := getSecretStore()
 	if err != nil {
 		return fmt.Errorf("Failed to get secret store: %w", err)
 	}
-	secrets, err := secretStore.ListServices(service, includeSecretName)
+	listed, err := findServices(secretStore, service, pattern, includeSecretName, includeKeyCounts)
 	if err != nil {
-		return fmt.Errorf("Failed to list store contents: %w", err)
+		return err
+	}
+
+	if structured {
+		return writeStructured(os.Stdout, listed)
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
 	fmt.Fprint(w, "Service")
+	if includeKeyCounts {
+		fmt.Fprint(w, "\tKeys")
+	}
 	fmt.Fprintln(w, "")
 
-	sort.Strings(secrets)
-
-	for _, secret := range secrets {
+	for _, s := range listed {
 		fmt.Fprintf(w, "%s",
-			secret)
+			s.Service)
+		if includeKeyCounts {
+			fmt.Fprintf(w, "\t%d", s.Keys)
+		}
 		fmt.Fprintln(w, "")
 	}
 	w.Flush()
 	return nil
 }
+
+// findServices lists the services under prefix, or the names of their
+// secrets with secretNames, keeping those matching pattern if it isn't empty.
+// With counts, the number of keys of each service is filled in.
+func findServices(s store.Store, prefix, pattern string, secretNames, counts bool) ([]listedService, error) {
+	// counting needs the secrets of every service anyway
+	names, err := listUntrashedServices(s, prefix, secretNames || counts)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list store contents: %w", err)
+	}
+
+	keys := map[string]int{}
+	for _, name := range names {
+		service := name
+		if secretNames || counts {
+			service = secretService(name)
+		}
+		if pattern != "" {
+			// errors were caught by validateServiceGlob
+			if ok, _ := slashpath.Match(pattern, service); !ok {
+				continue
+			}
+		}
+		if secretNames {
+			keys[name] = 0
+		} else {
+			keys[service]++
+		}
+	}
+
+	listed := make([]listedService, 0, len(keys))
+	for name, count := range keys {
+		l := listedService{Service: name}
+		if counts {
+			l.Keys = count
+		}
+		listed = append(listed, l)
+	}
+	sort.Slice(listed, func(i, j int) bool {
+		return listed[i].Service < listed[j].Service
+	})
+	return listed, nil
+}
+
+// secretService returns the service of a secret name as ListServices returns
+// it, either /service/key or service.key without paths
+func secretService(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// listedService is a service as list-services prints it with --output json
+// or yaml. With --secrets, Service is the name of a secret of the service.
+type listedService struct {
+	Service string `json:"service" yaml:"service"`
+	// Keys is the number of keys of the service, with --counts
+	Keys int `json:"keys,omitempty" yaml:"keys,omitempty"`
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindServices(t *testing.T) {
+	s := store.NewMemoryStore()
+	for _, id := range []store.SecretId{
+		{Service: "app-dev", Key: "a"},
+		{Service: "app-dev", Key: "b"},
+		{Service: "app-prod", Key: "a"},
+		{Service: "team/api/prod", Key: "a"},
+		{Service: "other", Key: "a"},
+	} {
+		require.NoError(t, s.Write(id, "value"))
+	}
+
+	listed, err := findServices(s, "", "", false, false)
+	require.NoError(t, err)
+	assert.Equal(t, []listedService{{Service: "app-dev"}, {Service: "app-prod"}, {Service: "other"}, {Service: "team/api/prod"}}, listed)
+
+	listed, err = findServices(s, "", "app-*", false, true)
+	require.NoError(t, err)
+	assert.Equal(t, []listedService{{Service: "app-dev", Keys: 2}, {Service: "app-prod", Keys: 1}}, listed)
+
+	listed, err = findServices(s, "team/", "team/*/prod", false, true)
+	require.NoError(t, err)
+	assert.Equal(t, []listedService{{Service: "team/api/prod", Keys: 1}}, listed)
+
+	listed, err = findServices(s, "", "app-d*", true, false)
+	require.NoError(t, err)
+	assert.Equal(t, []listedService{{Service: "/app-dev/a"}, {Service: "/app-dev/b"}}, listed)
+}
+
+func TestSecretService(t *testing.T) {
+	assert.Equal(t, "app", secretService("/app/key"))
+	assert.Equal(t, "team/api", secretService("/team/api/key"))
+	assert.Equal(t, "app", secretService("app.key"))
+}
@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	analytics "github.com/segmentio/analytics-go/v3"
 	"github.com/segmentio/chamber/v2/store"
@@ -26,6 +27,8 @@ var (
 	sortByTime    bool
 	sortByUser    bool
 	sortByVersion bool
+	listWithTags  bool
+	listTagFilter []string
 )
 
 func init() {
@@ -33,6 +36,9 @@ func init() {
 	listCmd.Flags().BoolVarP(&sortByTime, "time", "t", false, "Sort by modified time")
 	listCmd.Flags().BoolVarP(&sortByUser, "user", "u", false, "Sort by user")
 	listCmd.Flags().BoolVarP(&sortByVersion, "version", "v", false, "Sort by version")
+	listCmd.Flags().BoolVar(&listWithTags, "with-tags", false, "Show the description and tags of each secret, as written by write --description and --tag")
+	listCmd.Flags().StringArrayVar(&listTagFilter, "filter-tag", nil, "only list secrets with this tag, as key=value; may be repeated to require several tags")
+	listCmd.Flags().StringVar(&keyCollation, "sort-keys", utils.CollationBytewise, sortKeysUsage+"; keys with the same --time, --user or --version stay in this order")
 	RootCmd.AddCommand(listCmd)
 }
 
@@ -41,6 +47,13 @@ func list(cmd *cobra.Command, args []string) error {
 	if err := validateServiceWithLabel(service); err != nil {
 		return fmt.Errorf("Failed to validate service: %w", err)
 	}
+	if err := utils.ValidateCollation(keyCollation); err != nil {
+		return fmt.Errorf("Invalid --sort-keys: %w", err)
+	}
+	tagFilters, err := parseTagFilters(listTagFilter)
+	if err != nil {
+		return err
+	}
 
 	if analyticsEnabled && analyticsClient != nil {
 		analyticsClient.Enqueue(analytics.Track{
@@ -58,10 +71,54 @@ func list(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("Failed to get secret store: %w", err)
 	}
+	if (listWithTags || len(tagFilters) > 0) && !secretStore.Capabilities().Tags {
+		return fmt.Errorf("The %s backend does not support tags", backend)
+	}
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
 	secrets, err := secretStore.List(service, withValues)
 	if err != nil {
 		return fmt.Errorf("Failed to list store contents: %w", err)
 	}
+	if len(tagFilters) > 0 {
+		if secrets, err = filterByTags(secretStore, service, secrets, tagFilters); err != nil {
+			return err
+		}
+	}
+
+	// stable sorts, so that ties are always in key order
+	sort.SliceStable(secrets, func(i, j int) bool {
+		return utils.CompareKeys(keyCollation, key(secrets[i].Meta.Key), key(secrets[j].Meta.Key)) < 0
+	})
+	if sortByTime {
+		sort.Stable(ByTime(secrets))
+	}
+	if sortByUser {
+		sort.Stable(ByUser(secrets))
+	}
+	if sortByVersion {
+		sort.Stable(ByVersion(secrets))
+	}
+
+	if structured {
+		listed := make([]listedSecret, 0, len(secrets))
+		for _, secret := range secrets {
+			l, err := newListedSecret(secretStore, service, secret)
+			if err != nil {
+				return err
+			}
+			listed = append(listed, l)
+		}
+		return writeStructured(os.Stdout, listed)
+	}
+
+	// policies, like expiries, are only shown when a secret has one
+	withPolicies := false
+	for _, secret := range secrets {
+		withPolicies = withPolicies || len(secret.Meta.Policies) > 0
+	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
 
@@ -69,18 +126,13 @@ func list(cmd *cobra.Command, args []string) error {
 	if withValues {
 		fmt.Fprint(w, "\tValue")
 	}
-	fmt.Fprintln(w, "")
-
-	sort.Sort(ByName(secrets))
-	if sortByTime {
-		sort.Sort(ByTime(secrets))
+	if listWithTags {
+		fmt.Fprint(w, "\tDescription\tTags")
 	}
-	if sortByUser {
-		sort.Sort(ByUser(secrets))
-	}
-	if sortByVersion {
-		sort.Sort(ByVersion(secrets))
+	if withPolicies {
+		fmt.Fprint(w, "\tPolicies")
 	}
+	fmt.Fprintln(w, "")
 
 	for _, secret := range secrets {
 		fmt.Fprintf(w, "%s\t%d\t%s\t%s",
@@ -91,6 +143,17 @@ func list(cmd *cobra.Command, args []string) error {
 		if withValues {
 			fmt.Fprintf(w, "\t%s", *secret.Value)
 		}
+		if listWithTags {
+			tags, err := secretStore.ReadTags(store.SecretId{Service: service, Key: key(secret.Meta.Key)})
+			if err != nil {
+				return fmt.Errorf("Failed to read tags of %s: %w", key(secret.Meta.Key), err)
+			}
+			description, others := formatTags(tags)
+			fmt.Fprintf(w, "\t%s\t%s", description, others)
+		}
+		if withPolicies {
+			fmt.Fprintf(w, "\t%s", formatPolicies(secret.Meta.Policies))
+		}
 		fmt.Fprintln(w, "")
 	}
 
@@ -98,6 +161,69 @@ func list(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// listedSecret is a secret as list prints it with --output json or yaml
+type listedSecret struct {
+	Key          string            `json:"key" yaml:"key"`
+	Version      int               `json:"version" yaml:"version"`
+	LastModified time.Time         `json:"last_modified" yaml:"last_modified"`
+	User         string            `json:"user" yaml:"user"`
+	Value        *string           `json:"value,omitempty" yaml:"value,omitempty"`
+	Description  string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Policies     []listedPolicy    `json:"policies,omitempty" yaml:"policies,omitempty"`
+}
+
+// listedPolicy is a policy in effect on a listed secret
+type listedPolicy struct {
+	Type       string            `json:"type" yaml:"type"`
+	Attributes map[string]string `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+}
+
+// newListedSecret returns secret as list prints it, reading its tags with
+// --with-tags
+func newListedSecret(secretStore store.Store, service string, secret store.Secret) (listedSecret, error) {
+	l := listedSecret{
+		Key:          key(secret.Meta.Key),
+		Version:      secret.Meta.Version,
+		LastModified: secret.Meta.Created,
+		User:         secret.Meta.CreatedBy,
+		Value:        secret.Value,
+	}
+	for _, p := range secret.Meta.Policies {
+		l.Policies = append(l.Policies, listedPolicy{Type: p.Type, Attributes: p.Attributes})
+	}
+	if listWithTags {
+		tags, err := secretStore.ReadTags(store.SecretId{Service: service, Key: l.Key})
+		if err != nil {
+			return l, fmt.Errorf("Failed to read tags of %s: %w", l.Key, err)
+		}
+		l.Description = tags[DescriptionTagKey]
+		for k, v := range tags {
+			if k == DescriptionTagKey {
+				continue
+			}
+			if l.Tags == nil {
+				l.Tags = map[string]string{}
+			}
+			l.Tags[k] = v
+		}
+	}
+	return l, nil
+}
+
+// formatTags splits the description off tags, and formats the others as
+// sorted key=value pairs
+func formatTags(tags map[string]string) (string, string) {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if k != DescriptionTagKey {
+			pairs = append(pairs, k+"="+v)
+		}
+	}
+	sort.Strings(pairs)
+	return tags[DescriptionTagKey], strings.Join(pairs, ",")
+}
+
 func key(s string) string {
 	_, noPaths := os.LookupEnv("CHAMBER_NO_PATHS")
 	sep := "/"
@@ -133,3 +259,21 @@ type ByVersion []store.Secret
 func (a ByVersion) Len() int           { return len(a) }
 func (a ByVersion) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByVersion) Less(i, j int) bool { return a[i].Meta.Version < a[j].Meta.Version }
+
+// formatPolicies describes the policies of a secret
+func formatPolicies(policies []store.SecretPolicy) string {
+	described := make([]string, 0, len(policies))
+	for _, p := range policies {
+		switch p.Type {
+		case "Expiration":
+			described = append(described, "expires "+p.Attributes["Timestamp"])
+		case "ExpirationNotification":
+			described = append(described, fmt.Sprintf("notify %s %s before expiry", p.Attributes["Before"], strings.ToLower(p.Attributes["Unit"])))
+		case "NoChangeNotification":
+			described = append(described, fmt.Sprintf("notify if unchanged for %s %s", p.Attributes["After"], strings.ToLower(p.Attributes["Unit"])))
+		default:
+			described = append(described, p.Type)
+		}
+	}
+	return strings.Join(described, ", ")
+}
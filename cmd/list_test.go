@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatPolicies(t *testing.T) {
+	assert.Equal(t, "", formatPolicies(nil))
+	assert.Equal(t, "expires 2025-12-31T00:00:00Z, notify if unchanged for 30 days", formatPolicies([]store.SecretPolicy{
+		{Type: "Expiration", Attributes: map[string]string{"Timestamp": "2025-12-31T00:00:00Z"}},
+		{Type: "NoChangeNotification", Attributes: map[string]string{"After": "30", "Unit": "Days"}},
+	}))
+}
@@ -0,0 +1,408 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestKey is the key holding the manifest of a service, describing the
+// keys it is expected to have. It is left out of exec, env and export.
+const ManifestKey = "chamber_manifest"
+
+// Types of values a manifest can declare
+var manifestTypes = map[string]func(string) bool{
+	"string": func(string) bool { return true },
+	"int": func(v string) bool {
+		_, err := strconv.Atoi(v)
+		return err == nil
+	},
+	"bool": func(v string) bool {
+		_, err := strconv.ParseBool(v)
+		return err == nil
+	},
+	"url": func(v string) bool {
+		u, err := url.Parse(v)
+		return err == nil && u.Scheme != "" && u.Host != ""
+	},
+	"json": func(v string) bool {
+		return json.Valid([]byte(v))
+	},
+}
+
+var (
+	// manifestCmd represents the manifest command
+	manifestCmd = &cobra.Command{
+		Use:   "manifest",
+		Short: "Manage the manifests describing the keys services should have",
+		Long: `Manage the manifests describing the keys services should have.
+
+A manifest is YAML stored in the ` + ManifestKey + ` key of its service, so
+the store describes itself:
+
+	keys:
+	  db_password:
+	    description: password of the app database user
+	  port:
+	    type: int
+	  debug:
+	    type: bool
+	    optional: true
+
+Types are string (the default), int, bool, url and json. Keys are required
+unless they are optional. Manifests are used by chamber validate, chamber
+scaffold and chamber exec --strict-from-manifest.`,
+	}
+
+	// manifestSetCmd represents the manifest set command
+	manifestSetCmd = &cobra.Command{
+		Use:   "set <service> <file|->",
+		Short: "Store the manifest of a service",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runManifestSet,
+	}
+
+	// manifestGetCmd represents the manifest get command
+	manifestGetCmd = &cobra.Command{
+		Use:   "get <service>",
+		Short: "Print the manifest of a service",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runManifestGet,
+	}
+
+	// manifestCheckCmd represents the manifest check command
+	manifestCheckCmd = &cobra.Command{
+		Use:   "check <file...>",
+		Short: "Check that manifest files are valid, e.g. before storing them",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runManifestCheck,
+	}
+
+	// validateCmd represents the validate command
+	validateCmd = &cobra.Command{
+		Use:   "validate <service...>",
+		Short: "Check the secrets of services against their manifests",
+		Long: `Check the secrets of services against their manifests, reporting required
+keys that are missing, values of the wrong type and keys the manifest does
+not declare. Exits with status 1 when there are any problems.
+
+--schema checks them against a JSON Schema file instead, describing the
+service as an object whose properties are its keys. The required,
+properties and additionalProperties keywords are supported, and for each key
+type, pattern, enum, format, minLength, maxLength, minimum and maximum.
+Values are strings, so a type other than string requires that they parse as
+one.`,
+		Example: `
+	$ chamber validate app
+	Service  Key          Problem
+	app      port         not a valid int
+	app      db_password  missing
+
+	$ chamber validate app --schema app.schema.json`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runValidate,
+	}
+)
+
+var validateSchema string
+
+// serviceManifest describes the keys a service should have
+type serviceManifest struct {
+	Keys map[string]manifestKey `yaml:"keys"`
+}
+
+// manifestKey describes one key of a service
+type manifestKey struct {
+	Description string `yaml:"description,omitempty"`
+	Type        string `yaml:"type,omitempty"`
+	Optional    bool   `yaml:"optional,omitempty"`
+}
+
+// manifestProblem is a way in which a key does not match its manifest
+type manifestProblem struct {
+	Key     string
+	Problem string
+}
+
+func init() {
+	manifestCmd.AddCommand(manifestSetCmd)
+	manifestCmd.AddCommand(manifestGetCmd)
+	manifestCmd.AddCommand(manifestCheckCmd)
+	RootCmd.AddCommand(manifestCmd)
+	validateCmd.Flags().StringVar(&validateSchema, "schema", "", "check the secrets against this JSON Schema file rather than the manifests of the services")
+	RootCmd.AddCommand(validateCmd)
+}
+
+// parseManifest decodes and checks a manifest
+func parseManifest(data []byte) (*serviceManifest, error) {
+	var m serviceManifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	keys := map[string]manifestKey{}
+	for k, spec := range m.Keys {
+		normalized := utils.NormalizeKey(k)
+		if err := validateKey(normalized); err != nil {
+			return nil, err
+		}
+		if normalized == ManifestKey {
+			return nil, fmt.Errorf("%s cannot describe itself", ManifestKey)
+		}
+		if spec.Type == "" {
+			spec.Type = "string"
+		}
+		if _, ok := manifestTypes[spec.Type]; !ok {
+			return nil, fmt.Errorf("key %s has unknown type %q", k, spec.Type)
+		}
+		keys[normalized] = spec
+	}
+	m.Keys = keys
+	return &m, nil
+}
+
+// readManifest reads the manifest of service, returning nil when it has none
+func readManifest(s store.Store, service string) (*serviceManifest, error) {
+	secret, err := withManifests(s).Read(store.SecretId{Service: service, Key: ManifestKey}, -1)
+	if errors.Is(err, store.ErrSecretNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read manifest of %s: %w", service, err)
+	}
+	m, err := parseManifest([]byte(*secret.Value))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid manifest in %s: %w", service, err)
+	}
+	return m, nil
+}
+
+// checkManifest compares secrets with a manifest. Keys the manifest does not
+// declare are only problems when allowUndeclared is false.
+func checkManifest(m *serviceManifest, secrets map[string]string, allowUndeclared bool) []manifestProblem {
+	problems := []manifestProblem{}
+	for k, spec := range m.Keys {
+		v, ok := secrets[k]
+		switch {
+		case !ok && !spec.Optional:
+			problems = append(problems, manifestProblem{k, "missing"})
+		case ok && !manifestTypes[spec.Type](v):
+			problems = append(problems, manifestProblem{k, "not a valid " + spec.Type})
+		}
+	}
+	if !allowUndeclared {
+		for k := range secrets {
+			if _, ok := m.Keys[k]; !ok && k != ManifestKey {
+				problems = append(problems, manifestProblem{k, "not declared in the manifest"})
+			}
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Key < problems[j].Key })
+	return problems
+}
+
+// checkServiceManifests checks the secrets of every service that has a
+// manifest in manifests, as read from s, returning the problems by service
+func checkServiceManifests(manifests, s store.Store, services []string, allowUndeclared bool) (map[string][]manifestProblem, error) {
+	found := map[string][]manifestProblem{}
+	for _, service := range services {
+		m, err := readManifest(manifests, service)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			continue
+		}
+		secrets, err := serviceValues(s, service)
+		if err != nil {
+			return nil, err
+		}
+		if problems := checkManifest(m, secrets, allowUndeclared); len(problems) > 0 {
+			found[service] = problems
+		}
+	}
+	return found, nil
+}
+
+// checkServiceSchemas checks the secrets of services against schema,
+// returning the problems by service
+func checkServiceSchemas(s store.Store, services []string, schema *secretSchema) (map[string][]manifestProblem, error) {
+	found := map[string][]manifestProblem{}
+	for _, service := range services {
+		secrets, err := serviceValues(s, service)
+		if err != nil {
+			return nil, err
+		}
+		if problems := checkSchema(schema, secrets); len(problems) > 0 {
+			found[service] = problems
+		}
+	}
+	return found, nil
+}
+
+// serviceValues returns the values of the secrets of service by key
+func serviceValues(s store.Store, service string) (map[string]string, error) {
+	rawSecrets, err := s.ListRaw(service)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list store contents for %s: %w", service, err)
+	}
+	secrets := map[string]string{}
+	for _, rawSecret := range rawSecrets {
+		secrets[key(rawSecret.Key)] = rawSecret.Value
+	}
+	return secrets, nil
+}
+
+// printManifestProblems prints the problems found by checkServiceManifests
+func printManifestProblems(w io.Writer, found map[string][]manifestProblem) {
+	services := make([]string, 0, len(found))
+	for service := range found {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, '\t', 0)
+	fmt.Fprintln(tw, "Service\tKey\tProblem")
+	for _, service := range services {
+		for _, p := range found[service] {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", service, p.Key, p.Problem)
+		}
+	}
+	tw.Flush()
+}
+
+func trackManifestCommand(command string, services []string) {
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", command).
+				Set("chamber-version", chamberVersion).
+				Set("services", services).
+				Set("backend", backend),
+		})
+	}
+}
+
+func runManifestSet(cmd *cobra.Command, args []string) error {
+	service := utils.NormalizeService(args[0])
+	if err := validateService(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+
+	var data []byte
+	var err error
+	if args[1] == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(args[1])
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read manifest: %w", err)
+	}
+	if _, err := parseManifest(data); err != nil {
+		return fmt.Errorf("Invalid manifest: %w", err)
+	}
+
+	trackManifestCommand("manifest set", []string{service})
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	return secretStore.Write(store.SecretId{Service: service, Key: ManifestKey}, string(data))
+}
+
+func runManifestGet(cmd *cobra.Command, args []string) error {
+	service := utils.NormalizeService(args[0])
+	if err := validateService(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+
+	trackManifestCommand("manifest get", []string{service})
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	secret, err := withManifests(secretStore).Read(store.SecretId{Service: service, Key: ManifestKey}, -1)
+	if errors.Is(err, store.ErrSecretNotFound) {
+		return fmt.Errorf("%s has no manifest", service)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read manifest: %w", err)
+	}
+	fmt.Fprint(os.Stdout, *secret.Value)
+	return nil
+}
+
+func runManifestCheck(cmd *cobra.Command, args []string) error {
+	invalid := 0
+	for _, path := range args {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			_, err = parseManifest(data)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d manifests are invalid", invalid, len(args))
+	}
+	return nil
+}
+
+func runValidate(cmd *cobra.Command, args []string) error {
+	services := make([]string, 0, len(args))
+	for _, arg := range args {
+		service := utils.NormalizeService(arg)
+		if err := validateService(service); err != nil {
+			return fmt.Errorf("Failed to validate service %s: %w", service, err)
+		}
+		services = append(services, service)
+	}
+	var schema *secretSchema
+	if validateSchema != "" {
+		var err error
+		if schema, err = readSecretSchema(validateSchema); err != nil {
+			return err
+		}
+	}
+
+	trackManifestCommand("validate", services)
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	var found map[string][]manifestProblem
+	if schema != nil {
+		found, err = checkServiceSchemas(secretStore, services, schema)
+	} else {
+		found, err = checkServiceManifests(secretStore, secretStore, services, false)
+	}
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		fmt.Fprintf(os.Stderr, "no problems found\n")
+		return nil
+	}
+	printManifestProblems(os.Stdout, found)
+	os.Exit(1)
+	return nil
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testManifest = `keys:
+  DB_Password:
+    description: password of the app database user
+  port:
+    type: int
+  endpoint:
+    type: url
+  debug:
+    type: bool
+    optional: true
+`
+
+func TestParseManifest(t *testing.T) {
+	m, err := parseManifest([]byte(testManifest))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]manifestKey{
+		"db_password": {Description: "password of the app database user", Type: "string"},
+		"port":        {Type: "int"},
+		"endpoint":    {Type: "url"},
+		"debug":       {Type: "bool", Optional: true},
+	}, m.Keys)
+
+	for _, invalid := range []string{
+		"keys:\n  port:\n    type: number\n",
+		"keys:\n  bad/key: {}\n",
+		"keys:\n  chamber_manifest: {}\n",
+		"keys: [port]\n",
+	} {
+		_, err := parseManifest([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestCheckManifest(t *testing.T) {
+	m, err := parseManifest([]byte(testManifest))
+	assert.NoError(t, err)
+
+	secrets := map[string]string{
+		"port":     "eighty",
+		"endpoint": "https://api.example.com",
+		"extra":    "value",
+	}
+	assert.Equal(t, []manifestProblem{
+		{"db_password", "missing"},
+		{"extra", "not declared in the manifest"},
+		{"port", "not a valid int"},
+	}, checkManifest(m, secrets, false))
+	assert.Equal(t, []manifestProblem{
+		{"db_password", "missing"},
+		{"port", "not a valid int"},
+	}, checkManifest(m, secrets, true))
+
+	assert.Empty(t, checkManifest(m, map[string]string{
+		"db_password": "hunter22",
+		"port":        "80",
+		"endpoint":    "https://api.example.com",
+		"debug":       "true",
+	}, false))
+}
+
+func TestCheckServiceManifests(t *testing.T) {
+	s := newFakeStore(map[string]map[string]string{
+		"app":    {ManifestKey: testManifest, "db_password": "hunter22", "port": "80", "endpoint": "not a url"},
+		"global": {"region": "us-east-1"},
+	})
+
+	found, err := checkServiceManifests(s, s, []string{"app", "global", "missing"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]manifestProblem{
+		"app": {{"endpoint", "not a valid url"}},
+	}, found)
+
+	out := &bytes.Buffer{}
+	printManifestProblems(out, found)
+	assert.Equal(t, "Service\t\tKey\t\tProblem\napp\t\tendpoint\tnot a valid url\n", out.String())
+}
+
+func TestWriteScaffold(t *testing.T) {
+	m, err := parseManifest([]byte(testManifest))
+	assert.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	assert.NoError(t, writeScaffold(out, m))
+	assert.Equal(t, `# password of the app database user
+DB_PASSWORD=
+# bool, optional
+DEBUG=
+# url
+ENDPOINT=
+# int
+PORT=
+`, out.String())
+}
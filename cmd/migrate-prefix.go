@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migratePrefixCmd = &cobra.Command{
+		Use:   "migrate-prefix <service...>",
+		Short: "Move services from the root of the store to under $" + store.PrefixEnvVar,
+		Long: `Move services from the root of the store to under $` + store.PrefixEnvVar + `.
+
+The latest value and the tags of every key are copied. Keys that already exist
+under the prefix are left alone. Only supported by the SSM backend.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: migratePrefix,
+	}
+	migrateDeleteSource bool
+)
+
+func init() {
+	migratePrefixCmd.Flags().BoolVar(&migrateDeleteSource, "delete", false, "delete keys from the root of the store once they have been copied")
+	RootCmd.AddCommand(migratePrefixCmd)
+}
+
+func migratePrefix(cmd *cobra.Command, args []string) error {
+	services := make([]string, 0, len(args))
+	for _, arg := range args {
+		service := utils.NormalizeService(arg)
+		if err := validateService(service); err != nil {
+			return fmt.Errorf("Failed to validate service: %w", err)
+		}
+		services = append(services, service)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "migrate-prefix").
+				Set("chamber-version", chamberVersion).
+				Set("services", services).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	dst, ok := store.Unwrap(secretStore).(*store.SSMStore)
+	if !ok {
+		return errors.New("migrate-prefix is only supported by the SSM backend")
+	}
+	if dst.Prefix() == "" {
+		return fmt.Errorf("%s must be set to the prefix to migrate to", store.PrefixEnvVar)
+	}
+	src, err := dst.WithPrefix("")
+	if err != nil {
+		return err
+	}
+
+	for _, service := range services {
+		if err := migrateService(src, dst, service, migrateDeleteSource, os.Stdout); err != nil {
+			return fmt.Errorf("Failed to migrate %s: %w", service, err)
+		}
+	}
+	return nil
+}
+
+// migrateService copies the latest value and tags of every key of service from
+// src to dst, skipping keys that already exist in dst.
+func migrateService(src, dst store.Store, service string, deleteSource bool, out io.Writer) error {
+	rawSecrets, err := src.ListRaw(service)
+	if err != nil {
+		return err
+	}
+
+	for _, rawSecret := range rawSecrets {
+		secretId := store.SecretId{Service: service, Key: key(rawSecret.Key)}
+
+		_, err := dst.Read(secretId, -1)
+		if err == nil {
+			fmt.Fprintf(out, "skipped %s/%s: already exists under the prefix\n", service, secretId.Key)
+			continue
+		}
+		if !errors.Is(err, store.ErrSecretNotFound) {
+			return err
+		}
+
+		tags, err := src.ReadTags(secretId)
+		if err != nil {
+			return err
+		}
+		if err := dst.Write(secretId, rawSecret.Value); err != nil {
+			return err
+		}
+		if len(tags) > 0 {
+			if err := dst.WriteTags(secretId, tags); err != nil {
+				return err
+			}
+		}
+		if deleteSource {
+			if err := src.Delete(secretId); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(out, "migrated %s/%s\n", service, secretId.Key)
+	}
+	return nil
+}
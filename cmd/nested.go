@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/segmentio/chamber/v2/store"
+)
+
+// Whether to load the services nested under the requested ones as well
+var recursive bool
+
+// withNestedServices follows every service in services with the services
+// nested under it, like myapp/worker and myapp/worker/queue for myapp, from
+// the shallowest to the deepest so that deeper services take precedence.
+// Services are only listed once, at their first position.
+func withNestedServices(s store.Store, services []string) ([]string, error) {
+	if _, noPaths := os.LookupEnv("CHAMBER_NO_PATHS"); noPaths {
+		return nil, errors.New("--recursive cannot be used with CHAMBER_NO_PATHS")
+	}
+
+	var expanded []string
+	seen := map[string]bool{}
+	for _, service := range services {
+		nested, err := nestedServices(s, service)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range append([]string{service}, nested...) {
+			if !seen[n] {
+				seen[n] = true
+				expanded = append(expanded, n)
+			}
+		}
+	}
+	return expanded, nil
+}
+
+// nestedServices lists the services under service, shallowest first
+func nestedServices(s store.Store, service string) ([]string, error) {
+	services, err := s.ListServices(service+"/", false)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list services under %s: %w", service, err)
+	}
+
+	var nested []string
+	for _, n := range services {
+		if strings.HasPrefix(n, service+"/") {
+			nested = append(nested, n)
+		}
+	}
+	sort.Slice(nested, func(i, j int) bool {
+		di, dj := strings.Count(nested[i], "/"), strings.Count(nested[j], "/")
+		if di != dj {
+			return di < dj
+		}
+		return nested[i] < nested[j]
+	})
+	return nested, nil
+}
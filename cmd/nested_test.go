@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithNestedServices(t *testing.T) {
+	s := newFakeStore(map[string]map[string]string{
+		"global":                {"a": "1"},
+		"myapp":                 {"a": "1"},
+		"myapp2":                {"a": "1"},
+		"myapp/worker/queue":    {"a": "1"},
+		"myapp/worker":          {"a": "1"},
+		"myapp/api":             {"a": "1"},
+		"myapp/api/admin/users": {"a": "1"},
+	})
+
+	services, err := withNestedServices(s, []string{"global", "myapp"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"global",
+		"myapp",
+		"myapp/api",
+		"myapp/worker",
+		"myapp/worker/queue",
+		"myapp/api/admin/users",
+	}, services)
+
+	services, err = withNestedServices(s, []string{"myapp/worker", "myapp"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"myapp/worker",
+		"myapp/worker/queue",
+		"myapp",
+		"myapp/api",
+		"myapp/api/admin/users",
+	}, services)
+
+	t.Run("services without secrets of their own are kept", func(t *testing.T) {
+		services, err := withNestedServices(s, []string{"myapp/api/admin"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"myapp/api/admin", "myapp/api/admin/users"}, services)
+	})
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// netrcCmd represents the netrc command
+	netrcCmd = &cobra.Command{
+		Use:   "netrc <service> --host <host>... [-- <command> [<arg...>]]",
+		Short: "Print a netrc file with credentials from a service, or run a command with a temporary one",
+		Long: `Print a netrc file with credentials from a service, or run a command with a
+temporary one.
+
+Credentials for each host are found as for chamber git-credential. When a
+command is given, the netrc file is written where only the current user can
+read it, on a tmpfs where available, $NETRC is set to its path for the
+command, and the file is removed when the command exits.`,
+		Example: `
+	$ curl --netrc-file <(chamber netrc ci --host artifacts.example.com) https://artifacts.example.com/build.tgz
+	$ chamber netrc ci --host github.com -- go mod download`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			services := args
+			if dashIx := cmd.ArgsLenAtDash(); dashIx != -1 {
+				services = args[:dashIx]
+				if err := cobra.MinimumNArgs(1)(cmd, args[dashIx:]); err != nil {
+					return fmt.Errorf("must specify command to run after '--': %w", err)
+				}
+			}
+			return cobra.ExactArgs(1)(cmd, services)
+		},
+		RunE: runNetrc,
+	}
+	netrcHosts []string
+)
+
+func init() {
+	netrcCmd.Flags().StringSliceVar(&netrcHosts, "host", nil, "host to write credentials for; may be repeated")
+	netrcCmd.MarkFlagRequired("host")
+	RootCmd.AddCommand(netrcCmd)
+}
+
+func runNetrc(cmd *cobra.Command, args []string) error {
+	service := utils.NormalizeService(args[0])
+	if err := validateServiceWithLabel(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "netrc").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("backend", backend),
+		})
+	}
+
+	secrets, err := serviceSecrets(service)
+	if err != nil {
+		return err
+	}
+
+	dashIx := cmd.ArgsLenAtDash()
+	if dashIx == -1 {
+		return writeNetrc(os.Stdout, secrets, netrcHosts)
+	}
+
+	dir, err := os.MkdirTemp(secretFilesBaseDir(), "chamber-")
+	if err != nil {
+		return fmt.Errorf("Failed to create netrc directory: %w", err)
+	}
+	path := filepath.Join(dir, ".netrc")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil {
+		err = writeNetrc(f, secrets, netrcHosts)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("Failed to write netrc: %w", err)
+	}
+
+	env := append(os.Environ(), "NETRC="+path)
+	status, err := runChild(args[dashIx], args[dashIx+1:], env, childOptions{})
+	os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+	os.Exit(status)
+	return nil
+}
+
+// writeNetrc writes a netrc entry for every host, failing if any host has no
+// credentials
+func writeNetrc(w io.Writer, secrets map[string]string, hosts []string) error {
+	if len(hosts) == 0 {
+		return errors.New("at least one --host must be given")
+	}
+	for _, host := range hosts {
+		login, password, ok := hostCredentials(secrets, host)
+		if !ok {
+			return fmt.Errorf("no password or token for %s", host)
+		}
+		// netrc has no quoting
+		if strings.ContainsAny(login+password, " \t\r\n") {
+			return fmt.Errorf("credentials for %s contain whitespace, which netrc cannot represent", host)
+		}
+		if _, err := fmt.Fprintf(w, "machine %s\n  login %s\n  password %s\n", host, login, password); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteNetrc(t *testing.T) {
+	secrets := map[string]string{"github_com_token": "ghp_abc", "gitlab_com_token": "glpat abc"}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, writeNetrc(buf, secrets, []string{"github.com"}))
+	assert.Equal(t, "machine github.com\n  login x-access-token\n  password ghp_abc\n", buf.String())
+
+	assert.EqualError(t, writeNetrc(&bytes.Buffer{}, secrets, []string{"example.com"}), "no password or token for example.com")
+	assert.Error(t, writeNetrc(&bytes.Buffer{}, secrets, []string{"gitlab.com"}))
+	assert.Error(t, writeNetrc(&bytes.Buffer{}, secrets, nil))
+}
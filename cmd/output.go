@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The formats of --output
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+// outputFormat is the format list, list-services, read, history, find, audit, whoami
+// and lint print in, as do exec --strict problems, set by the global --output flag
+var outputFormat string
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&outputFormat, "output", OutputTable, "format of the output of list, list-services, read, history, find, audit, whoami, lint and the problems of exec --strict: table, json or yaml; lint also takes sarif")
+}
+
+// structuredOutput reports whether --output asks for JSON or YAML rather than
+// a table, failing for unknown formats
+func structuredOutput() (bool, error) {
+	switch outputFormat {
+	case OutputTable, "":
+		return false, nil
+	case OutputJSON, OutputYAML:
+		return true, nil
+	default:
+		return false, fmt.Errorf("Invalid --output %q: must be %s, %s or %s", outputFormat, OutputTable, OutputJSON, OutputYAML)
+	}
+}
+
+// writeStructured writes v in the format of --output, JSON or YAML. Their
+// field names are stable, unlike the columns of tables.
+func writeStructured(out io.Writer, v interface{}) error {
+	if outputFormat == OutputYAML {
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
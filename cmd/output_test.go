@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteStructured(t *testing.T) {
+	defer func() { outputFormat = OutputTable }()
+	value := "a&b"
+	listed := []listedSecret{{
+		Key:          "db_password",
+		Version:      2,
+		LastModified: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		User:         "alice",
+		Value:        &value,
+	}}
+
+	var out bytes.Buffer
+	outputFormat = OutputJSON
+	require.NoError(t, writeStructured(&out, listed))
+	assert.JSONEq(t, `[{"key":"db_password","version":2,"last_modified":"2024-06-01T12:00:00Z","user":"alice","value":"a&b"}]`, out.String())
+
+	out.Reset()
+	outputFormat = OutputYAML
+	require.NoError(t, writeStructured(&out, listed))
+	assert.Equal(t, `- key: db_password
+  version: 2
+  last_modified: 2024-06-01T12:00:00Z
+  user: alice
+  value: a&b
+`, out.String())
+
+	for format, expected := range map[string]bool{"table": false, "json": true, "yaml": true} {
+		outputFormat = format
+		structured, err := structuredOutput()
+		require.NoError(t, err)
+		assert.Equal(t, expected, structured, format)
+	}
+	outputFormat = "xml"
+	_, err := structuredOutput()
+	assert.Error(t, err)
+}
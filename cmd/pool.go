@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/segmentio/chamber/v2/store"
+)
+
+const (
+	// DefaultConcurrency is how many requests import and export make at once
+	DefaultConcurrency = 10
+
+	// poolThrottleRetries bounds how many times a throttled job is retried,
+	// on top of the retries of the AWS SDK
+	poolThrottleRetries = 5
+	// poolMaxThrottleDelay bounds how long a pool pauses after throttling
+	poolMaxThrottleDelay = 30 * time.Second
+)
+
+// throttlePause is shared by the workers of a pool. When the backend
+// throttles a job, every worker waits before starting another, for longer
+// each time throttling goes on.
+type throttlePause struct {
+	mu       sync.Mutex
+	minDelay time.Duration
+	delay    time.Duration
+	until    time.Time
+}
+
+// wait blocks until the pool is no longer paused
+func (p *throttlePause) wait() {
+	p.mu.Lock()
+	d := time.Until(p.until)
+	p.mu.Unlock()
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// throttled pauses the pool, doubling the pause of the previous throttling
+func (p *throttlePause) throttled() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.delay == 0 {
+		p.delay = p.minDelay
+	} else if p.delay < poolMaxThrottleDelay {
+		p.delay *= 2
+	}
+	if p.delay > poolMaxThrottleDelay {
+		p.delay = poolMaxThrottleDelay
+	}
+	p.until = time.Now().Add(p.delay)
+}
+
+// succeeded shortens the pause after a job goes through
+func (p *throttlePause) succeeded() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.delay /= 2
+}
+
+// newThrottlePause returns a pause starting with the --min-throttle-delay
+func newThrottlePause() *throttlePause {
+	pause := &throttlePause{minDelay: minThrottleDelay}
+	if pause.minDelay <= 0 {
+		pause.minDelay = store.DefaultMinThrottleDelay
+	}
+	return pause
+}
+
+// retryThrottled runs job, once pause is over, retrying it after a longer
+// pause each time the backend throttles it
+func retryThrottled(pause *throttlePause, job func() error) error {
+	for attempt := 0; ; attempt++ {
+		pause.wait()
+		err := job()
+		if err == nil {
+			pause.succeeded()
+			return nil
+		}
+		if !isThrottled(err) || attempt == poolThrottleRetries {
+			return err
+		}
+		pause.throttled()
+	}
+}
+
+// runPool runs job for each index below count, on at most concurrency
+// goroutines, and returns the error of each. Jobs the backend throttles are
+// retried once the pool has paused, starting with the --min-throttle-delay.
+func runPool(concurrency, count int, job func(i int) error) []error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	errs := make([]error, count)
+	pause := newThrottlePause()
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				i := i
+				errs[i] = retryThrottled(pause, func() error { return job(i) })
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return errs
+}
+
+// writeConcurrency returns how many secrets of a service to write to s at
+// once: concurrency, or 1 when the backend holds a service in one object and
+// concurrent writes would undo each other
+func writeConcurrency(s store.Store, concurrency int) int {
+	if !s.Capabilities().ConcurrentWrites {
+		return 1
+	}
+	return concurrency
+}
+
+// poolError reports the keys whose job failed, if any
+func poolError(action string, keys []string, errs []error) error {
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", keys[i], err))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("Failed to %s %d of %d secrets: %s", action, len(failed), len(keys), strings.Join(failed, "; "))
+}
+
+// isThrottled reports whether err, or an error it wraps, is AWS throttling a
+// request
+func isThrottled(err error) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && request.IsErrorThrottle(aerr)
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPool(t *testing.T) {
+	defer func(d time.Duration) { minThrottleDelay = d }(minThrottleDelay)
+	minThrottleDelay = time.Millisecond
+
+	t.Run("bounds concurrency", func(t *testing.T) {
+		var inFlight, maxInFlight int32
+		errs := runPool(3, 20, func(i int) error {
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			return nil
+		})
+		assert.Len(t, errs, 20)
+		assert.LessOrEqual(t, maxInFlight, int32(3))
+		for _, err := range errs {
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("reports the error of each job", func(t *testing.T) {
+		errs := runPool(4, 5, func(i int) error {
+			if i%2 == 1 {
+				return fmt.Errorf("job %d failed", i)
+			}
+			return nil
+		})
+		assert.NoError(t, errs[0])
+		assert.EqualError(t, errs[1], "job 1 failed")
+		assert.EqualError(t, errs[3], "job 3 failed")
+		assert.EqualError(t, poolError("write", []string{"a", "b", "c", "d", "e"}, errs), "Failed to write 2 of 5 secrets: b: job 1 failed; d: job 3 failed")
+	})
+
+	t.Run("retries throttled jobs", func(t *testing.T) {
+		var mu sync.Mutex
+		attempts := map[int]int{}
+		errs := runPool(2, 4, func(i int) error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts[i]++
+			switch {
+			case i == 0 && attempts[i] < 3:
+				return fmt.Errorf("Failed to write: %w", awserr.New("ThrottlingException", "Rate exceeded", nil))
+			case i == 1:
+				return errors.New("ParameterLimitExceeded")
+			}
+			return nil
+		})
+		assert.NoError(t, errs[0])
+		assert.Equal(t, 3, attempts[0])
+		assert.Error(t, errs[1])
+		assert.Equal(t, 1, attempts[1], "other errors aren't retried")
+	})
+
+	t.Run("gives up on throttling eventually", func(t *testing.T) {
+		attempts := 0
+		errs := runPool(1, 1, func(i int) error {
+			attempts++
+			return awserr.New("ThrottlingException", "Rate exceeded", nil)
+		})
+		assert.Error(t, errs[0])
+		assert.Equal(t, poolThrottleRetries+1, attempts)
+	})
+}
+
+// singleObjectStore reports the capabilities of a backend holding a service
+// in one object, like Secrets Manager
+type singleObjectStore struct {
+	store.Store
+}
+
+func (s singleObjectStore) Capabilities() store.Capabilities {
+	return store.Capabilities{History: true}
+}
+
+func TestWriteConcurrency(t *testing.T) {
+	assert.Equal(t, 10, writeConcurrency(store.NewMemoryStore(), 10))
+	assert.Equal(t, 1, writeConcurrency(singleObjectStore{store.NewMemoryStore()}, 10))
+}
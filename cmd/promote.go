@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	slashpath "path"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// promoteCmd represents the promote command
+	promoteCmd = &cobra.Command{
+		Use:   "promote <source service> <target service>",
+		Short: "Copy the secrets of one environment's service to another's",
+		Long: `Copy the secrets of one environment's service to another's, such as from
+staging to production, optionally only the keys matching --keys globs.
+
+The keys created or changed are listed with masked values, and written once
+confirmed. Keys only in the target service are left alone.`,
+		Example: `
+	$ chamber promote app/staging app/prod --keys 'db_*' --dry-run
+	Key          Action     Value
+	db_host      change     ******** -> ********
+	db_pool      create     ********
+	db_user      untouched
+	Would create 1, change 1, delete 0 and leave 1 secrets untouched`,
+		Args: cobra.ExactArgs(2),
+		RunE: runPromote,
+	}
+
+	promoteKeys   []string
+	promoteDryRun bool
+	promoteYes    bool
+)
+
+func init() {
+	promoteCmd.Flags().StringSliceVar(&promoteKeys, "keys", nil, "only promote the keys matching these globs, e.g. 'db_*'; all keys by default")
+	promoteCmd.Flags().BoolVar(&promoteDryRun, "dry-run", false, "print what would be promoted without writing anything")
+	promoteCmd.Flags().BoolVar(&promoteYes, "yes", false, "promote without asking for confirmation")
+	RootCmd.AddCommand(promoteCmd)
+}
+
+func runPromote(cmd *cobra.Command, args []string) error {
+	source := utils.NormalizeService(args[0])
+	if err := validateServiceWithLabel(source); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+	target := utils.NormalizeService(args[1])
+	if err := validateService(target); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+	if source == target {
+		return errors.New("The source and target services are the same")
+	}
+	for _, glob := range promoteKeys {
+		if _, err := slashpath.Match(glob, ""); err != nil {
+			return fmt.Errorf("Invalid --keys glob %q: %w", glob, err)
+		}
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "promote").
+				Set("chamber-version", chamberVersion).
+				Set("service", source).
+				Set("target-service", target).
+				Set("dry-run", promoteDryRun).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	sourceSecrets, err := secretStore.ListRaw(source)
+	if err != nil {
+		return fmt.Errorf("Failed to list store contents for service %s: %w", source, err)
+	}
+	targetSecrets, err := secretStore.ListRaw(target)
+	if err != nil {
+		return fmt.Errorf("Failed to list store contents for service %s: %w", target, err)
+	}
+
+	promoted := selectPromoted(sourceSecrets, promoteKeys)
+	if len(promoted) == 0 {
+		return fmt.Errorf("%s has no keys to promote", source)
+	}
+	changes := planImport(targetSecrets, promoted, promoted, false)
+	if err := writeImportPlan(os.Stdout, changes, false); err != nil {
+		return err
+	}
+	if promoteDryRun || !importChanges(changes) {
+		return nil
+	}
+
+	var keys []string
+	for _, c := range changes {
+		if c.Action != ImportUntouched {
+			keys = append(keys, c.Key)
+		}
+	}
+	if !promoteYes {
+		fmt.Fprintf(os.Stderr, "Promote %d keys from %s to %s? [y/N] ", len(keys), source, target)
+		ok, err := readConfirmation(os.Stdin)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("Promotion aborted")
+		}
+	}
+
+	errs := runPool(writeConcurrency(secretStore, DefaultConcurrency), len(keys), func(i int) error {
+		return secretStore.Write(store.SecretId{Service: target, Key: keys[i]}, promoted[keys[i]])
+	})
+	if err := poolError("write", keys, errs); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "Successfully promoted %d secrets from %s to %s\n", len(keys), source, target)
+	return nil
+}
+
+// selectPromoted returns the values of the secrets whose key matches one of
+// globs, or of all of them without globs. The keys chamber keeps in services
+// for itself are never promoted.
+func selectPromoted(secrets []store.RawSecret, globs []string) map[string]string {
+	promoted := map[string]string{}
+	for _, rawSecret := range secrets {
+		k := key(rawSecret.Key)
+		if pruneProtected[k] {
+			continue
+		}
+		matched := len(globs) == 0
+		for _, glob := range globs {
+			// errors were caught by validating the globs
+			if ok, _ := slashpath.Match(glob, k); ok {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			promoted[k] = rawSecret.Value
+		}
+	}
+	return promoted
+}
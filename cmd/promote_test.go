@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectPromoted(t *testing.T) {
+	secrets := []store.RawSecret{
+		{Key: "/app/staging/db_host", Value: "staging.db"},
+		{Key: "/app/staging/db_user", Value: "app"},
+		{Key: "/app/staging/api_key", Value: "key"},
+		{Key: "/app/staging/" + ManifestKey, Value: "{}"},
+	}
+
+	assert.Equal(t, map[string]string{"db_host": "staging.db", "db_user": "app"}, selectPromoted(secrets, []string{"db_*"}))
+	assert.Equal(t, map[string]string{"db_host": "staging.db", "api_key": "key"}, selectPromoted(secrets, []string{"db_host", "api_*"}))
+	assert.Equal(t, map[string]string{"db_host": "staging.db", "db_user": "app", "api_key": "key"}, selectPromoted(secrets, nil))
+}
@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	analytics "github.com/segmentio/analytics-go/v3"
 	"github.com/segmentio/chamber/v2/store"
@@ -14,19 +18,40 @@ import (
 var (
 	version int
 	quiet   bool
+	readAll bool
+	readAt  string
 
 	// readCmd represents the read command
 	readCmd = &cobra.Command{
-		Use:   "read <service> <key>",
+		Use:   "read <service> <key...>",
 		Short: "Read a specific secret from the parameter store",
-		Args:  cobra.ExactArgs(2),
-		RunE:  read,
+		Long: `Read a specific secret from the parameter store.
+
+Several keys can be read at once, or all the keys of the service with --all,
+printing a table of their latest values. With --output json or yaml, read
+prints an object of keys and values, whether it reads one key or several. On
+the SSM backend they are read ten at a time, rather than with a
+request or two per key.`,
+		Example: `
+	$ chamber read app db_password
+	$ chamber read app db_user db_password --output json
+	$ chamber read app --all
+	$ chamber read app db_password --at 2024-06-01T12:00:00Z`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if readAll {
+				return cobra.ExactArgs(1)(cmd, args)
+			}
+			return cobra.MinimumNArgs(2)(cmd, args)
+		},
+		RunE: read,
 	}
 )
 
 func init() {
 	readCmd.Flags().IntVarP(&version, "version", "v", -1, "The version number of the secret. Defaults to latest.")
-	readCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Only print the secret")
+	readCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Only print the secret, even with --output json or yaml")
+	readCmd.Flags().BoolVar(&readAll, "all", false, "read all the keys of the service")
+	readCmd.Flags().StringVar(&readAt, "at", "", "read the version that was current at this time, e.g. 2024-06-01T12:00:00Z, from the history of the secret")
 	RootCmd.AddCommand(readCmd)
 }
 
@@ -35,6 +60,25 @@ func read(cmd *cobra.Command, args []string) error {
 	if err := validateService(service); err != nil {
 		return fmt.Errorf("Failed to validate service: %w", err)
 	}
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	if readAll || len(args) > 2 {
+		if readAt != "" {
+			return errors.New("--at can only be used when reading a single key")
+		}
+		return readMany(service, args[1:])
+	}
+	var at time.Time
+	if readAt != "" {
+		if version != -1 {
+			return errors.New("--at and --version are mutually exclusive")
+		}
+		if at, err = time.Parse(time.RFC3339, readAt); err != nil {
+			return fmt.Errorf("Invalid --at %q: must be a time like 2024-06-01T12:00:00Z", readAt)
+		}
+	}
 
 	key := utils.NormalizeKey(args[1])
 	if err := validateKey(key); err != nil {
@@ -64,17 +108,33 @@ func read(cmd *cobra.Command, args []string) error {
 		Key:     key,
 	}
 
+	if !at.IsZero() {
+		if version, err = versionAt(secretStore, secretId, at); err != nil {
+			return err
+		}
+	}
+
 	secret, err := secretStore.Read(secretId, version)
 	if err != nil {
 		return fmt.Errorf("Failed to read: %w", err)
 	}
 
+	return writeReadSecret(os.Stdout, key, secret, structured)
+}
+
+// writeReadSecret writes a single secret read as a table with its metadata,
+// as an object with --output json or yaml, or only its value with --quiet,
+// which takes precedence over --output as it does when reading several keys
+func writeReadSecret(out io.Writer, key string, secret store.Secret, structured bool) error {
 	if quiet {
-		fmt.Fprintf(os.Stdout, "%s\n", *secret.Value)
-		return nil
+		_, err := fmt.Fprintf(out, "%s\n", *secret.Value)
+		return err
+	}
+	if structured {
+		return writeStructured(out, map[string]string{key: *secret.Value})
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', 0)
 	fmt.Fprintln(w, "Key\tValue\tVersion\tLastModified\tUser")
 	fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n",
 		key,
@@ -82,6 +142,136 @@ func read(cmd *cobra.Command, args []string) error {
 		secret.Meta.Version,
 		secret.Meta.Created.Local().Format(ShortTimeFormat),
 		secret.Meta.CreatedBy)
-	w.Flush()
-	return nil
+	return w.Flush()
+}
+
+// versionAt returns the version of a secret that was current at at, the last
+// one written by then
+func versionAt(secretStore store.Store, id store.SecretId, at time.Time) (int, error) {
+	if !secretStore.Capabilities().History {
+		return 0, fmt.Errorf("The %s backend does not keep the history of secrets, so --at cannot be used", backend)
+	}
+	events, err := secretStore.History(id)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get history: %w", err)
+	}
+	var current *store.ChangeEvent
+	var oldest time.Time
+	for i, event := range events {
+		if oldest.IsZero() || event.Time.Before(oldest) {
+			oldest = event.Time
+		}
+		if !event.Time.After(at) && (current == nil || event.Time.After(current.Time)) {
+			current = &events[i]
+		}
+	}
+	if current == nil {
+		if oldest.IsZero() {
+			return 0, fmt.Errorf("%s/%s has no history", id.Service, id.Key)
+		}
+		return 0, fmt.Errorf("%s/%s has no version from before %s; the oldest version kept is from %s",
+			id.Service, id.Key, at.Local().Format(ShortTimeFormat), oldest.Local().Format(ShortTimeFormat))
+	}
+	return current.Version, nil
+}
+
+// readMany reads the latest values of keys of service, or all of its keys
+// with --all
+func readMany(service string, args []string) error {
+	if version != -1 {
+		return errors.New("--version can only be used when reading a single key")
+	}
+	keys := make([]string, 0, len(args))
+	for _, arg := range args {
+		key := utils.NormalizeKey(arg)
+		if err := validateKey(key); err != nil {
+			return fmt.Errorf("Failed to validate key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "read").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("keys", len(keys)).
+				Set("all", readAll).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+
+	values, err := readValues(secretStore, service, keys)
+	if err != nil {
+		return fmt.Errorf("Failed to read: %w", err)
+	}
+	if readAll {
+		keys = sortedKeys(values)
+	}
+	return writeReadValues(os.Stdout, keys, values)
+}
+
+// readValues returns the values of keys of service, or of all
+// its keys if none are given. Any key that doesn't exist is an error.
+func readValues(secretStore store.Store, service string, keys []string) (map[string]string, error) {
+	values := map[string]string{}
+	if len(keys) == 0 {
+		rawSecrets, err := secretStore.ListRaw(service)
+		if err != nil {
+			return nil, err
+		}
+		for _, rawSecret := range rawSecrets {
+			values[key(rawSecret.Key)] = rawSecret.Value
+		}
+		return values, nil
+	}
+
+	read, err := store.ReadBatch(secretStore, service, keys)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, k := range keys {
+		value, ok := read[k]
+		if !ok {
+			missing = append(missing, k)
+			continue
+		}
+		values[k] = value
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", store.ErrSecretNotFound, strings.Join(missing, ", "))
+	}
+	return values, nil
+}
+
+// writeReadValues writes values as a table of keys in order, as an object
+// with --output json or yaml, or only the values with --quiet, which takes
+// precedence over --output as it does for writeReadSecret
+func writeReadValues(out io.Writer, keys []string, values map[string]string) error {
+	if quiet {
+		for _, k := range keys {
+			if _, err := fmt.Fprintln(out, values[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if outputFormat == OutputJSON || outputFormat == OutputYAML {
+		return writeStructured(out, values)
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', 0)
+	fmt.Fprintln(w, "Key\tValue")
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s\t%s\n", k, values[k])
+	}
+	return w.Flush()
 }
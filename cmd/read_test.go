@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadValues(t *testing.T) {
+	memory := store.NewMemoryStore()
+	compressed, err := store.CompressValue("large")
+	require.NoError(t, err)
+	for k, v := range map[string]string{"db_user": "app", "db_password": "hunter2", "config": compressed} {
+		require.NoError(t, memory.Write(store.SecretId{Service: "app", Key: k}, v))
+	}
+	// as getSecretStore returns it
+	s := readableStore(memory)
+
+	values, err := readValues(s, "app", []string{"db_user", "config"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"db_user": "app", "config": "large"}, values)
+
+	values, err = readValues(s, "app", nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"db_user": "app", "db_password": "hunter2", "config": "large"}, values)
+
+	_, err = readValues(s, "app", []string{"db_user", "api_key", "token"})
+	assert.True(t, errors.Is(err, store.ErrSecretNotFound))
+	assert.ErrorContains(t, err, "api_key, token")
+}
+
+func TestWriteReadValues(t *testing.T) {
+	defer func() { outputFormat, quiet = OutputTable, false }()
+	values := map[string]string{"db_user": "app", "db_password": "a&b"}
+	keys := []string{"db_user", "db_password"}
+
+	var out bytes.Buffer
+	require.NoError(t, writeReadValues(&out, keys, values))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"db_user", "app"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"db_password", "a&b"}, strings.Fields(lines[2]))
+
+	out.Reset()
+	quiet = true
+	require.NoError(t, writeReadValues(&out, keys, values))
+	assert.Equal(t, "app\na&b\n", out.String())
+
+	out.Reset()
+	quiet = false
+	outputFormat = OutputJSON
+	require.NoError(t, writeReadValues(&out, keys, values))
+	assert.JSONEq(t, `{"db_user":"app","db_password":"a&b"}`, out.String())
+	assert.Contains(t, out.String(), "a&b")
+}
+
+func TestReadQuietOverridesOutput(t *testing.T) {
+	defer func() { outputFormat, quiet = OutputTable, false }()
+	outputFormat, quiet = OutputJSON, true
+	value := "a&b"
+
+	var one, several bytes.Buffer
+	require.NoError(t, writeReadSecret(&one, "db_password", store.Secret{Value: &value}, true))
+	require.NoError(t, writeReadValues(&several, []string{"db_password"}, map[string]string{"db_password": value}))
+	assert.Equal(t, "a&b\n", one.String())
+	assert.Equal(t, one.String(), several.String())
+}
+
+// historyStore reports a fixed history
+type historyStore struct {
+	*store.MemoryStore
+	events []store.ChangeEvent
+}
+
+func (s historyStore) History(id store.SecretId) ([]store.ChangeEvent, error) {
+	return s.events, nil
+}
+
+func TestVersionAt(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 6, d, 12, 0, 0, 0, time.UTC) }
+	s := historyStore{MemoryStore: store.NewMemoryStore(), events: []store.ChangeEvent{
+		{Type: store.Updated, Time: day(10), Version: 3},
+		{Type: store.Created, Time: day(1), Version: 1},
+		{Type: store.Updated, Time: day(5), Version: 2},
+	}}
+	id := store.SecretId{Service: "app", Key: "db_password"}
+
+	for at, expected := range map[time.Time]int{
+		day(1):                   1,
+		day(4):                   1,
+		day(5):                   2,
+		day(9).Add(-time.Minute): 2,
+		day(20):                  3,
+	} {
+		v, err := versionAt(s, id, at)
+		require.NoError(t, err)
+		assert.Equal(t, expected, v, at)
+	}
+
+	_, err := versionAt(s, id, day(1).Add(-time.Second))
+	assert.ErrorContains(t, err, "oldest version kept")
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"sort"
+)
+
+// redactedValue replaces secret values in masked output
+const redactedValue = "***"
+
+// minRedactedLength is the length below which values are not redacted, since
+// masking every "1" or "true" would make output unreadable
+const minRedactedLength = 4
+
+// redactor is a writer replacing secret values with redactedValue before
+// passing output on. Output that ends with the beginning of a secret is held
+// back until the next write shows whether the secret follows, so values split
+// across writes are still redacted. Close flushes what is held back.
+type redactor struct {
+	w       io.Writer
+	secrets [][]byte
+	pending []byte
+}
+
+func newRedactor(w io.Writer, secrets []string) *redactor {
+	r := &redactor{w: w}
+	for _, s := range secrets {
+		if len(s) >= minRedactedLength {
+			r.secrets = append(r.secrets, []byte(s))
+		}
+	}
+	// prefer the longest secret when several match at the same place
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+	return r
+}
+
+// Write redacts p. It reports p as fully written once it has been accepted,
+// even if some of it is held back.
+func (r *redactor) Write(p []byte) (int, error) {
+	r.pending = append(r.pending, p...)
+	if err := r.flush(false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes out anything held back
+func (r *redactor) Close() error {
+	return r.flush(true)
+}
+
+func (r *redactor) flush(final bool) error {
+	out := &bytes.Buffer{}
+	buf := r.pending
+	for {
+		at, secret := r.firstMatch(buf)
+		if secret == nil {
+			break
+		}
+		out.Write(buf[:at])
+		out.WriteString(redactedValue)
+		buf = buf[at+len(secret):]
+	}
+
+	hold := 0
+	if !final {
+		hold = r.partialMatchLength(buf)
+	}
+	out.Write(buf[:len(buf)-hold])
+	r.pending = append([]byte(nil), buf[len(buf)-hold:]...)
+
+	if out.Len() == 0 {
+		return nil
+	}
+	_, err := r.w.Write(out.Bytes())
+	return err
+}
+
+// firstMatch returns the earliest secret in buf and where it starts
+func (r *redactor) firstMatch(buf []byte) (int, []byte) {
+	first, match := -1, []byte(nil)
+	for _, s := range r.secrets {
+		if i := bytes.Index(buf, s); i != -1 && (first == -1 || i < first) {
+			first, match = i, s
+		}
+	}
+	return first, match
+}
+
+// partialMatchLength returns the length of the longest end of buf that is the
+// beginning of a secret
+func (r *redactor) partialMatchLength(buf []byte) int {
+	longest := 0
+	for _, s := range r.secrets {
+		n := len(s) - 1
+		if n > len(buf) {
+			n = len(buf)
+		}
+		for ; n > longest; n-- {
+			if bytes.HasSuffix(buf, s[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
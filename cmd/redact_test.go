@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactor(t *testing.T) {
+	cases := []struct {
+		name   string
+		writes []string
+		out    string
+	}{
+		{
+			name:   "values are redacted",
+			writes: []string{"password is hunter22, key is abcdef\n"},
+			out:    "password is ***, key is ***\n",
+		},
+		{
+			name:   "values split across writes are redacted",
+			writes: []string{"password is hun", "te", "r22!\n"},
+			out:    "password is ***!\n",
+		},
+		{
+			name:   "the longest value wins",
+			writes: []string{"hunter22hunter"},
+			out:    "***",
+		},
+		{
+			name:   "beginnings of values are written out on close",
+			writes: []string{"hunt"},
+			out:    "hunt",
+		},
+		{
+			name:   "short values are not redacted",
+			writes: []string{"ok: 1\n"},
+			out:    "ok: 1\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			r := newRedactor(buf, []string{"hunter22", "hunter22hunter", "abcdef", "1", ""})
+			for _, w := range tc.writes {
+				n, err := r.Write([]byte(w))
+				assert.NoError(t, err)
+				assert.Equal(t, len(w), n)
+			}
+			assert.NoError(t, r.Close())
+			assert.Equal(t, tc.out, buf.String())
+		})
+	}
+
+	t.Run("output not at risk is written immediately", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		r := newRedactor(buf, []string{"hunter22"})
+		r.Write([]byte("starting up\n"))
+		assert.Equal(t, "starting up\n", buf.String())
+		r.Write([]byte("password: hun"))
+		assert.Equal(t, "starting up\npassword: ", buf.String())
+	})
+}
@@ -31,6 +31,9 @@ var (
 	backendFlag         string
 	backendS3BucketFlag string
 	kmsKeyAliasFlag     string
+	httpsProxyFlag      string
+	caBundleFlag        string
+	kmsContextFlag      bool
 
 	analyticsEnabled  bool
 	analyticsWriteKey string
@@ -56,18 +59,39 @@ const (
 	BackendEnvVar    = "CHAMBER_SECRET_BACKEND"
 	BucketEnvVar     = "CHAMBER_S3_BUCKET"
 	KMSKeyEnvVar     = "CHAMBER_KMS_KEY_ALIAS"
+	KMSKeysEnvVar    = "CHAMBER_KMS_KEYS"
 	NumRetriesEnvVar = "CHAMBER_RETRIES"
+	HTTPSProxyEnvVar = "CHAMBER_HTTPS_PROXY"
+	CABundleEnvVar   = "CHAMBER_CA_BUNDLE"
+	KMSContextEnvVar = "CHAMBER_KMS_ENCRYPTION_CONTEXT"
 
 	DefaultKMSKey = "alias/parameter_store_key"
 )
 
 var Backends = []string{SSMBackend, SecretsManagerBackend, S3Backend, NullBackend, S3KMSBackend}
 
+// EnabledBackends returns the backends compiled into this binary
+func EnabledBackends() []string {
+	enabled := []string{SSMBackend}
+	if secretsManagerBackendEnabled {
+		enabled = append(enabled, SecretsManagerBackend)
+	}
+	if s3BackendEnabled {
+		enabled = append(enabled, S3Backend)
+	}
+	enabled = append(enabled, NullBackend)
+	if s3BackendEnabled {
+		enabled = append(enabled, S3KMSBackend)
+	}
+	return enabled
+}
+
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
 	Use:               "chamber",
 	Short:             "CLI for storing secrets",
 	SilenceUsage:      true,
+	SilenceErrors:     true,
 	PersistentPreRun:  prerun,
 	PersistentPostRun: postrun,
 }
@@ -85,9 +109,17 @@ func init() {
 	s3-kms: S3 using AWS-KMS encryption; requires --backend-s3-bucket and --kms-key-alias set (if you want to write or delete keys).`,
 	)
 	RootCmd.PersistentFlags().StringVarP(&backendS3BucketFlag, "backend-s3-bucket", "", "", "bucket for S3 backend; AKA $CHAMBER_S3_BUCKET")
+	RootCmd.PersistentFlags().StringVar(&httpsProxyFlag, "https-proxy", "", "proxy URL to send all backend requests through, e.g. http://proxy.corp:3128; AKA $CHAMBER_HTTPS_PROXY")
+	RootCmd.PersistentFlags().StringVar(&caBundleFlag, "ca-bundle", "", "PEM file of certificate authorities to trust in addition to the system ones, e.g. for a TLS intercepting proxy; AKA $CHAMBER_CA_BUNDLE")
+	RootCmd.PersistentFlags().BoolVar(&kmsContextFlag, "kms-encryption-context", false, `encrypt secrets with the KMS encryption context {"service": "<service>"}, so that key policies can grant access per service; AKA $CHAMBER_KMS_ENCRYPTION_CONTEXT`)
 	RootCmd.PersistentFlags().StringVarP(&kmsKeyAliasFlag, "kms-key-alias", "", DefaultKMSKey, "KMS Key Alias for writing and deleting secrets; AKA $CHAMBER_KMS_KEY_ALIAS. This option is currently only supported for the S3-KMS backend.")
 }
 
+// errExitStatus is returned by commands that have already reported why they
+// fail, like import --exit-code finding changes, to exit with status 1
+// without printing an error
+var errExitStatus = errors.New("exit status 1")
+
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute(vers string, writeKey string) {
@@ -97,14 +129,22 @@ func Execute(vers string, writeKey string) {
 	analyticsEnabled = analyticsWriteKey != ""
 
 	if cmd, err := RootCmd.ExecuteC(); err != nil {
+		if !errors.Is(err, errExitStatus) {
+			cmd.PrintErrln("Error:", err.Error())
+		}
 		if strings.Contains(err.Error(), "arg(s)") || strings.Contains(err.Error(), "usage") {
 			cmd.Usage()
 		}
+		// the post-run hook only runs after commands that succeed
+		postrun(cmd, nil)
 		os.Exit(1)
 	}
 }
 
 func validateService(service string) error {
+	if isTrashService(service) {
+		return fmt.Errorf("Failed to validate service name '%s'. %s is kept by chamber for the secrets deleted with delete --soft; use restore and purge instead", service, TrashService)
+	}
 	_, noPaths := os.LookupEnv("CHAMBER_NO_PATHS")
 	if noPaths {
 		if !validServiceFormat.MatchString(service) {
@@ -120,6 +160,9 @@ func validateService(service string) error {
 }
 
 func validateServiceWithLabel(service string) error {
+	if name, _, _ := strings.Cut(service, ":"); isTrashService(name) {
+		return validateService(name)
+	}
 	_, noPaths := os.LookupEnv("CHAMBER_NO_PATHS")
 	if noPaths {
 		if !validServiceFormatWithLabel.MatchString(service) {
@@ -143,12 +186,7 @@ func validateKey(key string) error {
 
 func getSecretStore() (store.Store, error) {
 	rootPflags := RootCmd.PersistentFlags()
-	if backendEnvVarValue := os.Getenv(BackendEnvVar); !rootPflags.Changed("backend") && backendEnvVarValue != "" {
-		backend = backendEnvVarValue
-	} else {
-		backend = backendFlag
-	}
-	backend = strings.ToUpper(backend)
+	resolveBackend()
 
 	if numRetriesEnvVarValue := os.Getenv(NumRetriesEnvVar); !rootPflags.Changed("retries") && numRetriesEnvVarValue != "" {
 		var err error
@@ -158,6 +196,15 @@ func getSecretStore() (store.Store, error) {
 		}
 	}
 
+	if err := store.SetHTTPOptions(httpsProxy(), caBundle()); err != nil {
+		return nil, err
+	}
+
+	// other backends would silently write outside of the prefix
+	if os.Getenv(store.PrefixEnvVar) != "" && backend != SSMBackend && backend != NullBackend {
+		return nil, fmt.Errorf("$%s is only supported by the %s backend, not %s", store.PrefixEnvVar, SSMBackend, backend)
+	}
+
 	var s store.Store
 	var err error
 
@@ -169,45 +216,25 @@ func getSecretStore() (store.Store, error) {
 			return nil, errors.New("Unable to use --kms-key-alias with this backend.")
 		}
 
-		var bucket string
-		if bucketEnvVarValue := os.Getenv(BucketEnvVar); !rootPflags.Changed("backend-s3-bucket") && bucketEnvVarValue != "" {
-			bucket = bucketEnvVarValue
-		} else {
-			bucket = backendS3BucketFlag
-		}
+		bucket := backendS3Bucket()
 		if bucket == "" {
 			return nil, errors.New("Must set bucket for s3 backend")
 		}
-		s, err = store.NewS3StoreWithBucket(numRetries, bucket)
+		s, err = newS3Store(numRetries, bucket)
 	case S3KMSBackend:
-		var bucket string
-		if bucketEnvVarValue := os.Getenv(BucketEnvVar); !rootPflags.Changed("backend-s3-bucket") && bucketEnvVarValue != "" {
-			bucket = bucketEnvVarValue
-		} else {
-			bucket = backendS3BucketFlag
-		}
+		bucket := backendS3Bucket()
 		if bucket == "" {
 			return nil, errors.New("Must set bucket for s3 backend")
 		}
 
-		var kmsKeyAlias string
-		if kmsKeyAliasValue := os.Getenv(KMSKeyEnvVar); !rootPflags.Changed("kms-key-alias") && kmsKeyAliasValue != "" {
-			kmsKeyAlias = kmsKeyAliasValue
-		} else {
-			kmsKeyAlias = kmsKeyAliasFlag
-		}
-
-		if !strings.HasPrefix(kmsKeyAlias, "alias/") {
-			kmsKeyAlias = fmt.Sprintf("alias/%s", kmsKeyAlias)
-		}
-
+		kmsKeyAlias := s3KMSKeyAlias()
 		if kmsKeyAlias == "" {
 			return nil, errors.New("Must set kmsKeyAlias for S3 KMS backend")
 		}
 
-		s, err = store.NewS3KMSStore(numRetries, bucket, kmsKeyAlias)
+		s, err = newS3KMSStore(numRetries, bucket, kmsKeyAlias)
 	case SecretsManagerBackend:
-		s, err = store.NewSecretsManagerStore(numRetries)
+		s, err = newSecretsManagerStore(numRetries)
 	case SSMBackend:
 		if kmsKeyAliasFlag != DefaultKMSKey {
 			return nil, errors.New("Unable to use --kms-key-alias with this backend. Use CHAMBER_KMS_KEY_ALIAS instead.")
@@ -217,7 +244,47 @@ func getSecretStore() (store.Store, error) {
 	default:
 		return nil, fmt.Errorf("invalid backend `%s`", backend)
 	}
-	return s, err
+	if err != nil {
+		return nil, err
+	}
+
+	kmsContext := kmsContextFlag
+	if kmsContextEnvVarValue := os.Getenv(KMSContextEnvVar); !rootPflags.Changed("kms-encryption-context") && kmsContextEnvVarValue != "" {
+		if kmsContext, err = strconv.ParseBool(kmsContextEnvVarValue); err != nil {
+			return nil, fmt.Errorf("Cannot parse $%s as a boolean.", KMSContextEnvVar)
+		}
+	}
+	if kmsContext {
+		contextStore, ok := s.(store.EncryptionContextStore)
+		if !ok && backend == SSMBackend {
+			return nil, errors.New(`Parameter Store always encrypts with the KMS encryption context {"PARAMETER_ARN": "<arn>"} and takes no other; condition key policies on the path of the service instead`)
+		}
+		if !ok {
+			return nil, fmt.Errorf("The %s backend does not support KMS encryption contexts", backend)
+		}
+		s = contextStore.WithServiceEncryptionContext()
+	}
+	// other backends have no lists to join
+	if listStore, ok := s.(store.StringListStore); ok && listSeparator != "" {
+		s = listStore.WithListSeparator(listSeparator)
+	}
+	return readableStore(s), nil
+}
+
+// readableStore wraps s so that every command reads it alike, with compressed
+// values decompressed and manifests left out. Use store.Unwrap to find the
+// features of the backend, and withManifests to read manifests.
+func readableStore(s store.Store) store.Store {
+	return store.NewExcludingStore(store.NewDecompressingStore(s), ManifestKey)
+}
+
+// withManifests returns s without leaving out manifests, for commands that
+// read them or handle every key of a service
+func withManifests(s store.Store) store.Store {
+	if excluding, ok := s.(*store.ExcludingStore); ok {
+		return excluding.Unwrap()
+	}
+	return s
 }
 
 func prerun(cmd *cobra.Command, args []string) {
@@ -241,3 +308,54 @@ func postrun(cmd *cobra.Command, args []string) {
 		analyticsClient.Close()
 	}
 }
+
+// backendS3Bucket returns the bucket of the S3 backends, from
+// --backend-s3-bucket or $CHAMBER_S3_BUCKET
+func backendS3Bucket() string {
+	if bucketEnvVarValue := os.Getenv(BucketEnvVar); !RootCmd.PersistentFlags().Changed("backend-s3-bucket") && bucketEnvVarValue != "" {
+		return bucketEnvVarValue
+	}
+	return backendS3BucketFlag
+}
+
+// s3KMSKeyAlias returns the KMS key of the S3-KMS backend, from
+// --kms-key-alias or $CHAMBER_KMS_KEY_ALIAS
+func s3KMSKeyAlias() string {
+	kmsKeyAlias := kmsKeyAliasFlag
+	if kmsKeyAliasValue := os.Getenv(KMSKeyEnvVar); !RootCmd.PersistentFlags().Changed("kms-key-alias") && kmsKeyAliasValue != "" {
+		kmsKeyAlias = kmsKeyAliasValue
+	}
+	if !strings.HasPrefix(kmsKeyAlias, "alias/") {
+		kmsKeyAlias = fmt.Sprintf("alias/%s", kmsKeyAlias)
+	}
+	return kmsKeyAlias
+}
+
+// httpsProxy returns the proxy backend requests are sent through, from
+// --https-proxy or $CHAMBER_HTTPS_PROXY
+func httpsProxy() string {
+	if httpsProxyEnvVarValue := os.Getenv(HTTPSProxyEnvVar); !RootCmd.PersistentFlags().Changed("https-proxy") && httpsProxyEnvVarValue != "" {
+		return httpsProxyEnvVarValue
+	}
+	return httpsProxyFlag
+}
+
+// caBundle returns the file of extra certificate authorities to trust, from
+// --ca-bundle or $CHAMBER_CA_BUNDLE
+func caBundle() string {
+	if caBundleEnvVarValue := os.Getenv(CABundleEnvVar); !RootCmd.PersistentFlags().Changed("ca-bundle") && caBundleEnvVarValue != "" {
+		return caBundleEnvVarValue
+	}
+	return caBundleFlag
+}
+
+// resolveBackend sets backend from --backend or $CHAMBER_SECRET_BACKEND, for
+// commands that need to know it without a secret store
+func resolveBackend() {
+	if backendEnvVarValue := os.Getenv(BackendEnvVar); !RootCmd.PersistentFlags().Changed("backend") && backendEnvVarValue != "" {
+		backend = backendEnvVarValue
+	} else {
+		backend = backendFlag
+	}
+	backend = strings.ToUpper(backend)
+}
@@ -4,7 +4,9 @@ import (
 	"os"
 	"testing"
 
+	"github.com/segmentio/chamber/v2/store"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestValidations(t *testing.T) {
@@ -141,3 +143,58 @@ func TestValidations(t *testing.T) {
 		})
 	}
 }
+
+func TestGetSecretStoreDecompresses(t *testing.T) {
+	t.Setenv(BackendEnvVar, "null")
+	defer func(previous string) { backend = previous }(backend)
+
+	s, err := getSecretStore()
+	require.NoError(t, err)
+	assert.IsType(t, &store.ExcludingStore{}, s)
+	assert.IsType(t, &store.DecompressingStore{}, withManifests(s))
+	assert.IsType(t, &store.NullStore{}, store.Unwrap(s))
+}
+
+func TestReadableStoreExcludesManifests(t *testing.T) {
+	memory := store.NewMemoryStore()
+	require.NoError(t, memory.Write(store.SecretId{Service: "app", Key: "db_password"}, "hunter2"))
+	manifest := store.SecretId{Service: "app", Key: ManifestKey}
+	require.NoError(t, memory.Write(manifest, "keys: {}"))
+	s := readableStore(memory)
+
+	secrets, err := s.List("app", false)
+	require.NoError(t, err)
+	require.Len(t, secrets, 1)
+	assert.Equal(t, "db_password", key(secrets[0].Meta.Key))
+	names, err := s.ListServices("app", true)
+	require.NoError(t, err)
+	assert.Len(t, names, 1)
+	values, err := store.ReadBatch(s, "app", []string{"db_password", ManifestKey})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"db_password": "hunter2"}, values)
+	_, err = s.Read(manifest, -1)
+	assert.ErrorIs(t, err, store.ErrSecretNotFound)
+
+	m, err := withManifests(s).Read(manifest, -1)
+	require.NoError(t, err)
+	assert.Equal(t, "keys: {}", *m.Value)
+}
+
+func TestGetSecretStoreRejectsSSMEncryptionContext(t *testing.T) {
+	t.Setenv(BackendEnvVar, "ssm")
+	t.Setenv(KMSContextEnvVar, "true")
+	t.Setenv("CHAMBER_AWS_REGION", "us-east-1")
+	defer func(previous string) { backend = previous }(backend)
+
+	_, err := getSecretStore()
+	assert.ErrorContains(t, err, "PARAMETER_ARN")
+}
+
+func TestGetSecretStoreRejectsPrefixOutsideSSM(t *testing.T) {
+	t.Setenv(BackendEnvVar, "secretsmanager")
+	t.Setenv(store.PrefixEnvVar, "/chamber/payments")
+	defer func(previous string) { backend = previous }(backend)
+
+	_, err := getSecretStore()
+	assert.ErrorContains(t, err, "only supported by the SSM backend")
+}
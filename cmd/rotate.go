@@ -0,0 +1,335 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	osexec "os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/generator"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// RotationScheduleTagKey is the tag holding how often a secret should be
+// rotated, as set by rotate --schedule
+const RotationScheduleTagKey = "chamber:rotation-schedule"
+
+// Rotation commands and hooks are told which secret is rotated through these
+// variables
+const (
+	RotateServiceEnvVar = "CHAMBER_ROTATE_SERVICE"
+	RotateKeyEnvVar     = "CHAMBER_ROTATE_KEY"
+	RotateVersionEnvVar = "CHAMBER_ROTATE_VERSION"
+)
+
+var (
+	// rotateCmd represents the rotate command
+	rotateCmd = &cobra.Command{
+		Use:   "rotate <service> <key>",
+		Short: "Replace a secret with a new value, and tell its consumers",
+		Long: `Replace a secret with a new value, without it ever being shown.
+
+The new value is made by a generator, as with chamber generate, or by running
+the --exec command, which reads the current value on its standard input and
+prints the new one. Each --hook command then runs with the new value on its
+standard input, to update the consumers of the secret. Both are run with the
+shell, and get the secret in $` + RotateServiceEnvVar + ` and $` + RotateKeyEnvVar + `;
+hooks get its new version in $` + RotateVersionEnvVar + ` too.
+
+--schedule records how often the secret should be rotated, in the
+` + RotationScheduleTagKey + ` tag, and --due lists the secrets that are overdue, based
+on when they last changed.`,
+		Example: `
+	$ chamber rotate app db_password --generator passphrase --schedule 90d
+	$ chamber rotate app api_token --exec ./new-token.sh --hook 'kubectl rollout restart deploy/app'
+	$ chamber rotate --due app`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if rotateDue {
+				return cobra.MaximumNArgs(1)(cmd, args)
+			}
+			return cobra.ExactArgs(2)(cmd, args)
+		},
+		RunE: rotate,
+	}
+
+	rotateGenerator string
+	rotateParams    []string
+	rotateExec      string
+	rotateHooks     []string
+	rotateSchedule  string
+	rotateDue       bool
+)
+
+func init() {
+	rotateCmd.Flags().StringVarP(&rotateGenerator, "generator", "g", "random", "generator making the new value, as with chamber generate")
+	rotateCmd.Flags().StringArrayVarP(&rotateParams, "param", "p", nil, "generator parameter as name=value; may be repeated")
+	rotateCmd.Flags().StringVar(&rotateExec, "exec", "", "command making the new value instead of a generator, reading the current value on standard input and printing the new one")
+	rotateCmd.Flags().StringArrayVar(&rotateHooks, "hook", nil, "command to run once the secret is rotated, with the new value on standard input; may be repeated")
+	rotateCmd.Flags().StringVar(&rotateSchedule, "schedule", "", "how often the secret should be rotated, e.g. 90d, recorded for --due; needs a backend supporting tags")
+	rotateCmd.Flags().BoolVar(&rotateDue, "due", false, "list the secrets whose --schedule says they are due for rotation, of every service or of the one given")
+	RootCmd.AddCommand(rotateCmd)
+}
+
+// rotator makes the new value of a secret from its current one
+type rotator interface {
+	Rotate(current string) (string, error)
+}
+
+// generatorRotator makes new values with a generator, ignoring the current
+// value
+type generatorRotator struct {
+	generator generator.Generator
+	params    map[string]string
+}
+
+func (r generatorRotator) Rotate(current string) (string, error) {
+	return r.generator.Generate(r.params)
+}
+
+// commandRotator makes new values by running a command with the shell
+type commandRotator struct {
+	command string
+	id      store.SecretId
+}
+
+func (r commandRotator) Rotate(current string) (string, error) {
+	var out bytes.Buffer
+	if err := runRotationCommand(r.command, r.id, strings.NewReader(current), &out, nil); err != nil {
+		return "", err
+	}
+	value := strings.TrimSuffix(strings.TrimSuffix(out.String(), "\n"), "\r")
+	if value == "" {
+		return "", fmt.Errorf("%s printed nothing", r.command)
+	}
+	return value, nil
+}
+
+// runRotationCommand runs command with the shell, telling it the secret
+// rotated through the environment
+func runRotationCommand(command string, id store.SecretId, stdin io.Reader, stdout io.Writer, env []string) error {
+	shell := os.Getenv(ShellEnvVar)
+	if shell == "" {
+		shell = defaultShell()
+	}
+	name, args := shellCommand(shell, []string{command})
+	c := osexec.Command(name, args...)
+	c.Env = append(os.Environ(), RotateServiceEnvVar+"="+id.Service, RotateKeyEnvVar+"="+id.Key)
+	c.Env = append(c.Env, env...)
+	c.Stdin = stdin
+	c.Stdout = stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", command, err)
+	}
+	return nil
+}
+
+// rotateSecret writes the value r makes for id, then runs hooks, and records
+// schedule unless it is empty. It returns the new version.
+func rotateSecret(s store.Store, id store.SecretId, r rotator, hooks []string, schedule string) (int, error) {
+	current, err := s.Read(id, -1)
+	if errors.Is(err, store.ErrSecretNotFound) {
+		return 0, fmt.Errorf("%s/%s doesn't exist; chamber generate creates it", id.Service, id.Key)
+	}
+	if err != nil {
+		return 0, err
+	}
+	value, err := r.Rotate(*current.Value)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to make the new value: %w", err)
+	}
+	if value == *current.Value {
+		return 0, errors.New("The new value is the same as the current one")
+	}
+	if err := s.Write(id, value); err != nil {
+		return 0, fmt.Errorf("Failed to write the new value: %w", err)
+	}
+	rotated, err := s.Read(id, -1)
+	if err != nil {
+		return 0, err
+	}
+	version := rotated.Meta.Version
+
+	if schedule != "" {
+		if err := s.WriteTags(id, map[string]string{RotationScheduleTagKey: schedule}); err != nil {
+			return version, fmt.Errorf("Rotated %s/%s, but failed to record its schedule: %w", id.Service, id.Key, err)
+		}
+	}
+	for _, hook := range hooks {
+		env := []string{RotateVersionEnvVar + "=" + strconv.Itoa(version)}
+		if err := runRotationCommand(hook, id, strings.NewReader(value), os.Stderr, env); err != nil {
+			return version, fmt.Errorf("Rotated %s/%s to version %d, but a hook failed: %w", id.Service, id.Key, version, err)
+		}
+	}
+	return version, nil
+}
+
+// dueRotation is a secret due for rotation
+type dueRotation struct {
+	Id       store.SecretId
+	Schedule string
+	// Changed is when the secret last changed
+	Changed time.Time
+	Due     time.Time
+}
+
+// findDueRotations returns the secrets of services whose schedule is due at
+// now, most overdue first
+func findDueRotations(s store.Store, services []string, now time.Time) ([]dueRotation, error) {
+	var due []dueRotation
+	for _, service := range services {
+		secrets, err := s.List(service, false)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list store contents for service %s: %w", service, err)
+		}
+		for _, secret := range secrets {
+			id := store.SecretId{Service: service, Key: key(secret.Meta.Key)}
+			tags, err := s.ReadTags(id)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to read tags of %s/%s: %w", id.Service, id.Key, err)
+			}
+			schedule, ok := tags[RotationScheduleTagKey]
+			if !ok {
+				continue
+			}
+			period, err := parseRetention(schedule)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "chamber: %s/%s has an invalid rotation schedule: %s\n", id.Service, id.Key, err)
+				continue
+			}
+			if d := secret.Meta.Created.Add(period); !d.After(now) {
+				due = append(due, dueRotation{Id: id, Schedule: schedule, Changed: secret.Meta.Created, Due: d})
+			}
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].Due.Before(due[j].Due)
+	})
+	return due, nil
+}
+
+func rotate(cmd *cobra.Command, args []string) error {
+	if rotateDue {
+		return listDueRotations(args)
+	}
+
+	service := utils.NormalizeService(args[0])
+	if err := validateService(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+	key := utils.NormalizeKey(args[1])
+	if err := validateKey(key); err != nil {
+		return fmt.Errorf("Failed to validate key: %w", err)
+	}
+	if rotateSchedule != "" {
+		if _, err := parseRetention(rotateSchedule); err != nil {
+			return fmt.Errorf("Invalid --schedule: %w", err)
+		}
+	}
+	if rotateExec != "" && (cmd.Flags().Changed("generator") || len(rotateParams) > 0) {
+		return errors.New("--exec can't be used with --generator or --param")
+	}
+	id := store.SecretId{Service: service, Key: key}
+
+	var r rotator = commandRotator{command: rotateExec, id: id}
+	if rotateExec == "" {
+		params, err := parseGeneratorParams(rotateParams)
+		if err != nil {
+			return err
+		}
+		g, err := generator.Lookup(rotateGenerator)
+		if err != nil {
+			return err
+		}
+		r = generatorRotator{generator: g, params: params}
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "rotate").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("key", key).
+				Set("exec", rotateExec != "").
+				Set("hooks", len(rotateHooks)).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	if rotateSchedule != "" && !secretStore.Capabilities().Tags {
+		return fmt.Errorf("--schedule needs a backend supporting tags, which %s doesn't", backend)
+	}
+	version, err := rotateSecret(secretStore, id, r, rotateHooks, rotateSchedule)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "Rotated %s/%s to version %d\n", service, key, version)
+	return nil
+}
+
+// listDueRotations prints the secrets due for rotation of the service in
+// args, or of every service
+func listDueRotations(args []string) error {
+	var service string
+	if len(args) == 1 {
+		service = utils.NormalizeService(args[0])
+		if err := validateService(service); err != nil {
+			return fmt.Errorf("Failed to validate service: %w", err)
+		}
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "rotate").
+				Set("chamber-version", chamberVersion).
+				Set("due", true).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	if !secretStore.Capabilities().Tags {
+		return fmt.Errorf("--due needs a backend supporting tags, which %s doesn't", backend)
+	}
+	services := []string{service}
+	if service == "" {
+		if services, err = listUntrashedServices(secretStore, "", false); err != nil {
+			return fmt.Errorf("Failed to list store contents: %w", err)
+		}
+	}
+	due, err := findDueRotations(secretStore, services, time.Now())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+	fmt.Fprintln(w, "Service\tKey\tSchedule\tLastChanged\tDue")
+	for _, d := range due {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.Id.Service, d.Id.Key, d.Schedule,
+			d.Changed.Local().Format(ShortTimeFormat), d.Due.Local().Format(ShortTimeFormat))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/segmentio/chamber/v2/generator"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotateSecret(t *testing.T) {
+	s := store.NewMemoryStore()
+	id := store.SecretId{Service: "app", Key: "db_password"}
+	r := generatorRotator{generator: generator.Func(generator.Random), params: map[string]string{"length": "16"}}
+
+	_, err := rotateSecret(s, id, r, nil, "")
+	assert.Error(t, err, "doesn't exist yet")
+
+	require.NoError(t, s.Write(id, "old"))
+	version, err := rotateSecret(s, id, r, nil, "90d")
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+	rotated, err := s.Read(id, -1)
+	require.NoError(t, err)
+	assert.Len(t, *rotated.Value, 16)
+	tags, err := s.ReadTags(id)
+	require.NoError(t, err)
+	assert.Equal(t, "90d", tags[RotationScheduleTagKey])
+
+	same := generatorRotator{generator: generator.Func(func(map[string]string) (string, error) { return *rotated.Value, nil })}
+	_, err = rotateSecret(s, id, same, nil, "")
+	assert.Error(t, err)
+}
+
+func TestCommandRotator(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	t.Setenv(ShellEnvVar, "sh")
+	s := store.NewMemoryStore()
+	id := store.SecretId{Service: "app", Key: "api_token"}
+	require.NoError(t, s.Write(id, "token-1"))
+
+	hooked := filepath.Join(t.TempDir(), "hooked")
+	r := commandRotator{command: `sed s/1/2/`, id: id}
+	hook := `echo "$` + RotateServiceEnvVar + `/$` + RotateKeyEnvVar + `@$` + RotateVersionEnvVar + ` $(cat)" > ` + hooked
+	version, err := rotateSecret(s, id, r, []string{hook}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	rotated, err := s.Read(id, -1)
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", *rotated.Value)
+	out, err := os.ReadFile(hooked)
+	require.NoError(t, err)
+	assert.Equal(t, "app/api_token@2 token-2\n", string(out))
+
+	_, err = commandRotator{command: "true", id: id}.Rotate("token-2")
+	assert.Error(t, err, "printed nothing")
+	version, err = rotateSecret(s, id, commandRotator{command: `sed s/2/3/`, id: id}, []string{"false"}, "")
+	assert.ErrorContains(t, err, "a hook failed")
+	assert.Equal(t, 3, version)
+}
+
+func TestFindDueRotations(t *testing.T) {
+	s := store.NewMemoryStore()
+	for _, k := range []string{"due", "not_due", "unscheduled"} {
+		require.NoError(t, s.Write(store.SecretId{Service: "app", Key: k}, "value"))
+	}
+	require.NoError(t, s.WriteTags(store.SecretId{Service: "app", Key: "due"}, map[string]string{RotationScheduleTagKey: "30d"}))
+	require.NoError(t, s.WriteTags(store.SecretId{Service: "app", Key: "not_due"}, map[string]string{RotationScheduleTagKey: "90d"}))
+
+	due, err := findDueRotations(s, []string{"app"}, time.Now().Add(31*24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, store.SecretId{Service: "app", Key: "due"}, due[0].Id)
+	assert.Equal(t, "30d", due[0].Schedule)
+}
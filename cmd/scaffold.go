@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// scaffoldCmd represents the scaffold command
+var scaffoldCmd = &cobra.Command{
+	Use:   "scaffold <service>",
+	Short: "Print an empty dotenv file of the keys in the manifest of a service",
+	Long: `Print an empty dotenv file of the keys in the manifest of a service, with
+their descriptions and types as comments, e.g. to start a .env file for local
+development or to see what a new environment needs.`,
+	Example: `
+	$ chamber scaffold app > .env.example
+	$ cat .env.example
+	# password of the app database user
+	DB_PASSWORD=
+	# bool, optional
+	DEBUG=
+	# int
+	PORT=`,
+	Args: cobra.ExactArgs(1),
+	RunE: runScaffold,
+}
+
+func init() {
+	RootCmd.AddCommand(scaffoldCmd)
+}
+
+func runScaffold(cmd *cobra.Command, args []string) error {
+	service := utils.NormalizeService(args[0])
+	if err := validateService(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+
+	trackManifestCommand("scaffold", []string{service})
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	m, err := readManifest(secretStore, service)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return fmt.Errorf("%s has no manifest; see chamber manifest --help", service)
+	}
+	return writeScaffold(os.Stdout, m)
+}
+
+// writeScaffold writes a dotenv line for every key of m, preceded by a
+// comment describing it
+func writeScaffold(w io.Writer, m *serviceManifest) error {
+	keys := make([]string, 0, len(m.Keys))
+	for k := range m.Keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		spec := m.Keys[k]
+		notes := []string{}
+		if spec.Description != "" {
+			notes = append(notes, spec.Description)
+		}
+		if spec.Type != "string" {
+			notes = append(notes, spec.Type)
+		}
+		if spec.Optional {
+			notes = append(notes, "optional")
+		}
+		if len(notes) > 0 {
+			if _, err := fmt.Fprintf(w, "# %s\n", strings.Join(notes, ", ")); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s=\n", strings.ToUpper(sanitizeKey(k))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// schemaCmd represents the schema command
+var schemaCmd = &cobra.Command{
+	Use:   "schema [command]",
+	Short: "print the JSON Schema of a command's JSON output",
+	Long: `Print the JSON Schema of a command's JSON output, so tools consuming it can
+validate and generate code against it. Without a command, lists the commands
+that have a schema.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: schemaRun,
+}
+
+// outputSchemas maps the name of each machine-readable output to a function
+// returning its schema
+var outputSchemas = map[string]func() jsonSchema{
+	"audit": func() jsonSchema {
+		return schemaOf(reflect.TypeOf([]auditEvent{}))
+	},
+	"backend-info": func() jsonSchema {
+		return schemaOf(reflect.TypeOf(BackendInfo{}))
+	},
+	"backup": func() jsonSchema {
+		return schemaOf(reflect.TypeOf(backupArchive{}))
+	},
+	"buildinfo": func() jsonSchema {
+		return schemaOf(reflect.TypeOf(BuildInfo{}))
+	},
+	"drift-baseline": func() jsonSchema {
+		return schemaOf(reflect.TypeOf(driftBaselineFile{}))
+	},
+	"exec": func() jsonSchema {
+		return schemaOf(reflect.TypeOf(strictProblemsOutput{}))
+	},
+	"exec-attest": func() jsonSchema {
+		s := schemaOf(reflect.TypeOf(signedAttestation{}))
+		s.Properties["attestation"] = schemaOf(reflect.TypeOf(attestation{}))
+		return s
+	},
+	"exec-outcome": func() jsonSchema {
+		return schemaOf(reflect.TypeOf(execOutcome{}))
+	},
+	"export": func() jsonSchema {
+		return withExportSources(schemaOf(reflect.TypeOf(map[string]string{})))
+	},
+	"export-metadata": func() jsonSchema {
+		return withExportSources(schemaOf(reflect.TypeOf(map[string]exportedSecret{})))
+	},
+	"find": func() jsonSchema {
+		return schemaOf(reflect.TypeOf([]foundSecret{}))
+	},
+	"history": func() jsonSchema {
+		return schemaOf(reflect.TypeOf([]historyEvent{}))
+	},
+	"lint": func() jsonSchema {
+		return schemaOf(reflect.TypeOf([]lintFinding{}))
+	},
+	"list": func() jsonSchema {
+		return schemaOf(reflect.TypeOf([]listedSecret{}))
+	},
+	"list-services": func() jsonSchema {
+		return schemaOf(reflect.TypeOf([]listedService{}))
+	},
+	"read": func() jsonSchema {
+		return schemaOf(reflect.TypeOf(map[string]string{}))
+	},
+	"scorecard": func() jsonSchema {
+		return schemaOf(reflect.TypeOf(scorecard{}))
+	},
+	"watch": func() jsonSchema {
+		return schemaOf(reflect.TypeOf(watchEvent{}))
+	},
+	"watch-webhook": func() jsonSchema {
+		return schemaOf(reflect.TypeOf(watchNotification{}))
+	},
+	"whoami": func() jsonSchema {
+		return schemaOf(reflect.TypeOf(whoamiInfo{}))
+	},
+}
+
+// outputDescriptions describes which output each schema applies to
+var outputDescriptions = map[string]string{
+	"audit":           "chamber audit --output json",
+	"backend-info":    "chamber backend info",
+	"backup":          "chamber backup",
+	"buildinfo":       "chamber buildinfo --json",
+	"drift-baseline":  "chamber drift --write-baseline",
+	"exec":            "chamber exec --strict --output json",
+	"exec-attest":     "chamber exec --attest",
+	"exec-outcome":    "chamber exec --report-outcome",
+	"export":          "chamber export --format json",
+	"export-metadata": "chamber export --format json --with-metadata",
+	"find":            "chamber find --output json",
+	"history":         "chamber history --output json",
+	"lint":            "chamber lint --output json",
+	"list":            "chamber list --output json",
+	"list-services":   "chamber list-services --output json",
+	"read":            "chamber read --output json",
+	"scorecard":       "chamber scorecard --format json",
+	"watch":           "each line printed by chamber watch",
+	"watch-webhook":   "chamber watch --webhook",
+	"whoami":          "chamber whoami --output json",
+}
+
+// jsonSchema is the subset of JSON Schema needed to describe chamber's outputs
+type jsonSchema struct {
+	Schema               string                `json:"$schema,omitempty"`
+	Title                string                `json:"title,omitempty"`
+	Type                 string                `json:"type,omitempty"`
+	Format               string                `json:"format,omitempty"`
+	Properties           map[string]jsonSchema `json:"properties,omitempty"`
+	Required             []string              `json:"required,omitempty"`
+	AdditionalProperties *jsonSchema           `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema           `json:"items,omitempty"`
+}
+
+func init() {
+	RootCmd.AddCommand(schemaCmd)
+}
+
+// withExportSources adds the __source object written by export
+// --annotate-source to s
+func withExportSources(s jsonSchema) jsonSchema {
+	s.Properties = map[string]jsonSchema{"__source": schemaOf(reflect.TypeOf(map[string]string{}))}
+	return s
+}
+
+func schemaRun(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		names := make([]string, 0, len(outputSchemas))
+		for name := range outputSchemas {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+		fmt.Fprintln(w, "Schema\tOutput")
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%s\n", name, outputDescriptions[name])
+		}
+		w.Flush()
+		return nil
+	}
+
+	schemaFn, ok := outputSchemas[args[0]]
+	if !ok {
+		return fmt.Errorf("No schema for %s", args[0])
+	}
+	s := schemaFn()
+	s.Schema = "https://json-schema.org/draft/2020-12/schema"
+	s.Title = outputDescriptions[args[0]]
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaOf derives the schema of the JSON encoding of t from its json tags
+func schemaOf(t reflect.Type) jsonSchema {
+	switch {
+	case t == timeType:
+		return jsonSchema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return jsonSchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return jsonSchema{Type: "string"}
+	case reflect.Bool:
+		return jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return jsonSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		items := schemaOf(t.Elem())
+		return jsonSchema{Type: "array", Items: &items}
+	case reflect.Map:
+		values := schemaOf(t.Elem())
+		return jsonSchema{Type: "object", AdditionalProperties: &values}
+	case reflect.Struct:
+		s := jsonSchema{Type: "object", Properties: map[string]jsonSchema{}, Required: []string{}}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			s.Properties[name] = schemaOf(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				s.Required = append(s.Required, name)
+			}
+		}
+		return s
+	}
+	return jsonSchema{}
+}
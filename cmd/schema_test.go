@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaOf(t *testing.T) {
+	type item struct {
+		Name    string    `json:"name"`
+		Created time.Time `json:"created"`
+		Note    string    `json:"note,omitempty"`
+		Ignored string    `json:"-"`
+	}
+	type doc struct {
+		Items  []item         `json:"items"`
+		Counts map[string]int `json:"counts"`
+	}
+
+	out, err := json.Marshal(schemaOf(reflect.TypeOf(doc{})))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"items": {
+				"type": "array",
+				"items": {
+					"type": "object",
+					"properties": {
+						"name": {"type": "string"},
+						"created": {"type": "string", "format": "date-time"},
+						"note": {"type": "string"}
+					},
+					"required": ["name", "created"]
+				}
+			},
+			"counts": {"type": "object", "additionalProperties": {"type": "integer"}}
+		},
+		"required": ["items", "counts"]
+	}`, string(out))
+}
+
+func TestOutputSchemasAreDescribed(t *testing.T) {
+	for name, schemaFn := range outputSchemas {
+		assert.Contains(t, outputDescriptions, name)
+		assert.NotEmpty(t, schemaFn().Type, name)
+	}
+	// every command taking --output json has a schema
+	for _, name := range []string{"audit", "find", "history", "lint", "list", "list-services", "read", "whoami"} {
+		assert.Contains(t, outputSchemas, name)
+	}
+}
@@ -0,0 +1,340 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// awsManagedSSMKey is the KMS key Parameter Store uses when none is given,
+// which can't be restricted with a key policy
+const awsManagedSSMKey = "alias/aws/ssm"
+
+// The checks making up a scorecard, in the order they are reported
+const (
+	checkRotation     = "rotation"
+	checkKMS          = "kms"
+	checkTags         = "tags"
+	checkPlaceholders = "placeholders"
+	checkPolicy       = "policy"
+)
+
+var scorecardChecks = []string{checkRotation, checkKMS, checkTags, checkPlaceholders, checkPolicy}
+
+var (
+	// scorecardCmd represents the scorecard command
+	scorecardCmd = &cobra.Command{
+		Use:   "scorecard [prefix]",
+		Short: "Score the hygiene of the secrets of every service",
+		Long: `Score the hygiene of the secrets of every service under prefix, from 0 to
+100, as the average of these checks, each the percentage of keys passing it:
+
+	rotation       changed within --max-age
+	kms            encrypted with a customer managed KMS key, or --kms-key
+	               (SSM backend only)
+	tags           carrying every tag of --required-tags (backends with tags)
+	placeholders   not holding a placeholder value like changeme
+	policy         matching the manifest of the service (see chamber manifest)
+
+Checks that don't apply to a service, like policy for a service without a
+manifest, are left out of its score. The overall score is the average of the
+scores of the services.`,
+		Example: `
+	$ chamber scorecard --required-tags owner > scorecard.md
+	$ chamber scorecard prod --format json | jq .score`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runScorecard,
+	}
+	scorecardFormat       string
+	scorecardMaxAge       time.Duration
+	scorecardRequiredTags []string
+	scorecardKMSKey       string
+)
+
+func init() {
+	scorecardCmd.Flags().StringVar(&scorecardFormat, "format", "markdown", "output format: markdown or json")
+	scorecardCmd.Flags().DurationVar(&scorecardMaxAge, "max-age", 90*24*time.Hour, "how recently a secret must have changed to count as rotated")
+	scorecardCmd.Flags().StringSliceVar(&scorecardRequiredTags, "required-tags", nil, "comma separated tags every secret should carry, like owner")
+	scorecardCmd.Flags().StringVar(&scorecardKMSKey, "kms-key", "", "KMS key every secret should be encrypted with; by default any key but the AWS managed "+awsManagedSSMKey+" passes")
+	RootCmd.AddCommand(scorecardCmd)
+}
+
+// scorecard is the document printed by chamber scorecard
+type scorecard struct {
+	Generated time.Time      `json:"generated"`
+	Prefix    string         `json:"prefix"`
+	Score     int            `json:"score"`
+	Services  []serviceScore `json:"services"`
+}
+
+// serviceScore is the score of a service, and of each check that applies to it
+type serviceScore struct {
+	Service string           `json:"service"`
+	Score   int              `json:"score"`
+	Keys    int              `json:"keys"`
+	Checks  []scorecardCheck `json:"checks"`
+}
+
+// scorecardCheck counts the keys of a service passing a check
+type scorecardCheck struct {
+	Name    string   `json:"name"`
+	Score   int      `json:"score"`
+	Passed  int      `json:"passed"`
+	Total   int      `json:"total"`
+	Failing []string `json:"failing,omitempty"`
+}
+
+// scorecardOptions are the thresholds services are scored against
+type scorecardOptions struct {
+	Now          time.Time
+	MaxAge       time.Duration
+	RequiredTags []string
+	KMSKey       string
+}
+
+// serviceFacts is what is known about a service for scoring. Facts the
+// backend can't provide are nil, so that their checks are left out.
+type serviceFacts struct {
+	Service string
+	Secrets []store.Secret
+	// tags of each key, when the backend has tags
+	Tags map[string]map[string]string
+	// whether the backend reports the KMS key of each secret
+	ReportsKMSKeys bool
+	// problems found against the manifest, when the service has one
+	HasManifest      bool
+	ManifestProblems []manifestProblem
+}
+
+func runScorecard(cmd *cobra.Command, args []string) error {
+	prefix := ""
+	if len(args) == 1 {
+		prefix = utils.NormalizeService(args[0])
+	}
+	if scorecardFormat != "markdown" && scorecardFormat != "json" {
+		return fmt.Errorf("Unsupported output format: %s", scorecardFormat)
+	}
+	if scorecardMaxAge <= 0 {
+		return errors.New("--max-age must be positive")
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "scorecard").
+				Set("chamber-version", chamberVersion).
+				Set("prefix", prefix).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	_, reportsKMSKeys := store.Unwrap(secretStore).(*store.SSMStore)
+	withTags := secretStore.Capabilities().Tags && len(scorecardRequiredTags) > 0
+
+	services, err := listUntrashedServices(secretStore, prefix, false)
+	if err != nil {
+		return fmt.Errorf("Failed to list services: %w", err)
+	}
+	sort.Strings(services)
+
+	opts := scorecardOptions{
+		Now:          time.Now(),
+		MaxAge:       scorecardMaxAge,
+		RequiredTags: scorecardRequiredTags,
+		KMSKey:       scorecardKMSKey,
+	}
+	card := scorecard{Generated: opts.Now.UTC(), Prefix: prefix, Services: []serviceScore{}}
+	for _, service := range services {
+		facts := serviceFacts{Service: service, ReportsKMSKeys: reportsKMSKeys}
+		if facts.Secrets, err = secretStore.List(service, true); err != nil {
+			return fmt.Errorf("Failed to list store contents for %s: %w", service, err)
+		}
+		if len(facts.Secrets) == 0 {
+			continue
+		}
+		if withTags {
+			facts.Tags = map[string]map[string]string{}
+			for _, secret := range facts.Secrets {
+				k := key(secret.Meta.Key)
+				tags, err := secretStore.ReadTags(store.SecretId{Service: service, Key: k})
+				if err != nil {
+					return fmt.Errorf("Failed to read tags of %s/%s: %w", service, k, err)
+				}
+				facts.Tags[k] = tags
+			}
+		}
+		m, err := readManifest(secretStore, service)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			values := map[string]string{}
+			for _, secret := range facts.Secrets {
+				if secret.Value != nil {
+					values[key(secret.Meta.Key)] = *secret.Value
+				}
+			}
+			facts.HasManifest = true
+			facts.ManifestProblems = checkManifest(m, values, false)
+		}
+
+		card.Services = append(card.Services, scoreService(facts, opts))
+	}
+	card.Score = averageScore(card.Services)
+
+	if scorecardFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(card)
+	}
+	return writeScorecardMarkdown(os.Stdout, card)
+}
+
+// scoreService runs every check that applies to a service
+func scoreService(facts serviceFacts, opts scorecardOptions) serviceScore {
+	keys := make([]string, 0, len(facts.Secrets))
+	secrets := map[string]store.Secret{}
+	for _, secret := range facts.Secrets {
+		k := key(secret.Meta.Key)
+		keys = append(keys, k)
+		secrets[k] = secret
+	}
+	sort.Strings(keys)
+
+	check := func(name string, keys []string, passes func(k string) bool) scorecardCheck {
+		c := scorecardCheck{Name: name, Total: len(keys), Score: 100}
+		for _, k := range keys {
+			if passes(k) {
+				c.Passed++
+			} else {
+				c.Failing = append(c.Failing, k)
+			}
+		}
+		if c.Total > 0 {
+			c.Score = c.Passed * 100 / c.Total
+		}
+		return c
+	}
+
+	var checks []scorecardCheck
+	checks = append(checks, check(checkRotation, keys, func(k string) bool {
+		return opts.Now.Sub(secrets[k].Meta.Created) <= opts.MaxAge
+	}))
+	if facts.ReportsKMSKeys {
+		checks = append(checks, check(checkKMS, keys, func(k string) bool {
+			kmsKey := secrets[k].Meta.KMSKey
+			if opts.KMSKey != "" {
+				return kmsKey == opts.KMSKey
+			}
+			return kmsKey != "" && kmsKey != awsManagedSSMKey
+		}))
+	}
+	if facts.Tags != nil && len(opts.RequiredTags) > 0 {
+		checks = append(checks, check(checkTags, keys, func(k string) bool {
+			for _, tag := range opts.RequiredTags {
+				if facts.Tags[k][tag] == "" {
+					return false
+				}
+			}
+			return true
+		}))
+	}
+	checks = append(checks, check(checkPlaceholders, keys, func(k string) bool {
+		value := secrets[k].Value
+		return value == nil || !isPlaceholder(*value)
+	}))
+	if facts.HasManifest {
+		// keys the manifest requires but are missing count too
+		failing := map[string]bool{}
+		policyKeys := append([]string{}, keys...)
+		for _, p := range facts.ManifestProblems {
+			if _, ok := secrets[p.Key]; !ok && !failing[p.Key] {
+				policyKeys = append(policyKeys, p.Key)
+			}
+			failing[p.Key] = true
+		}
+		sort.Strings(policyKeys)
+		checks = append(checks, check(checkPolicy, policyKeys, func(k string) bool {
+			return !failing[k]
+		}))
+	}
+
+	total := 0
+	for _, c := range checks {
+		total += c.Score
+	}
+	return serviceScore{
+		Service: facts.Service,
+		Score:   total / len(checks),
+		Keys:    len(keys),
+		Checks:  checks,
+	}
+}
+
+// averageScore is the average score of services, or 100 without any
+func averageScore(services []serviceScore) int {
+	if len(services) == 0 {
+		return 100
+	}
+	total := 0
+	for _, s := range services {
+		total += s.Score
+	}
+	return total / len(services)
+}
+
+// writeScorecardMarkdown writes card as a markdown table, followed by the
+// keys failing each check
+func writeScorecardMarkdown(w io.Writer, card scorecard) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Secret scorecard\n\n")
+	fmt.Fprintf(&b, "Overall score: **%d/100** across %d services, generated %s.\n\n", card.Score, len(card.Services), card.Generated.Format(time.RFC3339))
+	fmt.Fprintf(&b, "| Service | Score | Keys | %s |\n", strings.Join(scorecardChecks, " | "))
+	fmt.Fprintf(&b, "|---|---|---|%s\n", strings.Repeat("---|", len(scorecardChecks)))
+	for _, s := range card.Services {
+		byName := map[string]scorecardCheck{}
+		for _, c := range s.Checks {
+			byName[c.Name] = c
+		}
+		fmt.Fprintf(&b, "| %s | %d | %d |", s.Service, s.Score, s.Keys)
+		for _, name := range scorecardChecks {
+			if c, ok := byName[name]; ok {
+				fmt.Fprintf(&b, " %d |", c.Score)
+			} else {
+				fmt.Fprintf(&b, " n/a |")
+			}
+		}
+		fmt.Fprintln(&b)
+	}
+
+	var failing []string
+	for _, s := range card.Services {
+		for _, c := range s.Checks {
+			if len(c.Failing) > 0 {
+				failing = append(failing, fmt.Sprintf("- %s, %s: %s", s.Service, c.Name, strings.Join(c.Failing, ", ")))
+			}
+		}
+	}
+	if len(failing) > 0 {
+		fmt.Fprintf(&b, "\n## Failing keys\n\n%s\n", strings.Join(failing, "\n"))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
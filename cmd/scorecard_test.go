@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScoreService(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	secret := func(k, value, kmsKey string, age time.Duration) store.Secret {
+		return store.Secret{
+			Value: &value,
+			Meta:  store.SecretMetadata{Key: "/app/" + k, Created: now.Add(-age), KMSKey: kmsKey},
+		}
+	}
+	facts := serviceFacts{
+		Service: "app",
+		Secrets: []store.Secret{
+			secret("api_token", "abc", "alias/parameter_store_key", time.Hour),
+			secret("db_password", "changeme", "alias/aws/ssm", 200*24*time.Hour),
+			secret("db_user", "app", "alias/parameter_store_key", time.Hour),
+			secret("region", "us-east-1", "", time.Hour),
+		},
+		Tags: map[string]map[string]string{
+			"api_token":   {"owner": "payments"},
+			"db_password": {"owner": "payments"},
+			"db_user":     {},
+			"region":      {"owner": "platform"},
+		},
+		ReportsKMSKeys:   true,
+		HasManifest:      true,
+		ManifestProblems: []manifestProblem{{Key: "db_port", Problem: "missing"}, {Key: "region", Problem: "not declared in the manifest"}},
+	}
+	opts := scorecardOptions{Now: now, MaxAge: 90 * 24 * time.Hour, RequiredTags: []string{"owner"}}
+
+	score := scoreService(facts, opts)
+	assert.Equal(t, "app", score.Service)
+	assert.Equal(t, 4, score.Keys)
+	assert.Equal(t, []scorecardCheck{
+		{Name: checkRotation, Score: 75, Passed: 3, Total: 4, Failing: []string{"db_password"}},
+		{Name: checkKMS, Score: 50, Passed: 2, Total: 4, Failing: []string{"db_password", "region"}},
+		{Name: checkTags, Score: 75, Passed: 3, Total: 4, Failing: []string{"db_user"}},
+		{Name: checkPlaceholders, Score: 75, Passed: 3, Total: 4, Failing: []string{"db_password"}},
+		{Name: checkPolicy, Score: 60, Passed: 3, Total: 5, Failing: []string{"db_port", "region"}},
+	}, score.Checks)
+	assert.Equal(t, 67, score.Score)
+
+	t.Run("checks that don't apply are left out", func(t *testing.T) {
+		score := scoreService(serviceFacts{Service: "app", Secrets: facts.Secrets[:1]}, opts)
+		assert.Equal(t, []scorecardCheck{
+			{Name: checkRotation, Score: 100, Passed: 1, Total: 1},
+			{Name: checkPlaceholders, Score: 100, Passed: 1, Total: 1},
+		}, score.Checks)
+		assert.Equal(t, 100, score.Score)
+	})
+}
+
+func TestWriteScorecardMarkdown(t *testing.T) {
+	card := scorecard{
+		Generated: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+		Score:     83,
+		Services: []serviceScore{
+			{Service: "api", Score: 100, Keys: 2, Checks: []scorecardCheck{
+				{Name: checkRotation, Score: 100, Passed: 2, Total: 2},
+				{Name: checkPlaceholders, Score: 100, Passed: 2, Total: 2},
+			}},
+			{Service: "app", Score: 66, Keys: 3, Checks: []scorecardCheck{
+				{Name: checkRotation, Score: 66, Passed: 2, Total: 3, Failing: []string{"db_password"}},
+				{Name: checkPlaceholders, Score: 66, Passed: 2, Total: 3, Failing: []string{"token"}},
+			}},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, writeScorecardMarkdown(buf, card))
+	assert.Equal(t, `# Secret scorecard
+
+Overall score: **83/100** across 2 services, generated 2020-06-01T00:00:00Z.
+
+| Service | Score | Keys | rotation | kms | tags | placeholders | policy |
+|---|---|---|---|---|---|---|---|
+| api | 100 | 2 | 100 | n/a | n/a | 100 | n/a |
+| app | 66 | 3 | 66 | n/a | n/a | 66 | n/a |
+
+## Failing keys
+
+- app, rotation: db_password
+- app, placeholders: token
+`, buf.String())
+}
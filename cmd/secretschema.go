@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/segmentio/chamber/v2/utils"
+)
+
+// secretSchema is the subset of JSON Schema that validate --schema, and the
+// --validate flag of write and import, check the secrets of a service with.
+// The schema describes the service as an object whose properties are its
+// keys. Keywords outside of this subset are ignored.
+type secretSchema struct {
+	Required   []string                     `json:"required"`
+	Properties map[string]secretValueSchema `json:"properties"`
+	// AdditionalProperties is false when only the properties may be set;
+	// schemas are not supported
+	AdditionalProperties *bool `json:"additionalProperties"`
+}
+
+// secretValueSchema describes the value of one key. Values are strings, so
+// a type other than string requires that they parse as one.
+type secretValueSchema struct {
+	Type      string        `json:"type"`
+	Pattern   string        `json:"pattern"`
+	Enum      []interface{} `json:"enum"`
+	Format    string        `json:"format"`
+	MinLength *int          `json:"minLength"`
+	MaxLength *int          `json:"maxLength"`
+	Minimum   *float64      `json:"minimum"`
+	Maximum   *float64      `json:"maximum"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes check that values parse as the JSON Schema type they are
+// declared with
+var schemaTypes = map[string]func(string) bool{
+	"string": func(string) bool { return true },
+	"integer": func(v string) bool {
+		_, err := strconv.ParseInt(v, 10, 64)
+		return err == nil
+	},
+	"number": func(v string) bool {
+		_, err := strconv.ParseFloat(v, 64)
+		return err == nil
+	},
+	"boolean": func(v string) bool {
+		return v == "true" || v == "false"
+	},
+	"object": func(v string) bool {
+		var o map[string]interface{}
+		return json.Unmarshal([]byte(v), &o) == nil
+	},
+	"array": func(v string) bool {
+		var a []interface{}
+		return json.Unmarshal([]byte(v), &a) == nil
+	},
+}
+
+// schemaFormats check the formats of JSON Schema that values may have
+var schemaFormats = map[string]func(string) bool{
+	"uri": func(v string) bool {
+		u, err := url.Parse(v)
+		return err == nil && u.Scheme != ""
+	},
+	"email": func(v string) bool {
+		a, err := mail.ParseAddress(v)
+		return err == nil && a.Address == v
+	},
+	"date-time": func(v string) bool {
+		_, err := time.Parse(time.RFC3339, v)
+		return err == nil
+	},
+	"uuid":     regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`).MatchString,
+	"hostname": regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`).MatchString,
+}
+
+// readSecretSchema reads and checks a schema file
+func readSecretSchema(path string) (*secretSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read schema: %w", err)
+	}
+	s, err := parseSecretSchema(data)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid schema %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// parseSecretSchema decodes a schema, normalizing its keys and compiling its
+// patterns
+func parseSecretSchema(data []byte) (*secretSchema, error) {
+	var s secretSchema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	properties := make(map[string]secretValueSchema, len(s.Properties))
+	for k, v := range s.Properties {
+		normalized := utils.NormalizeKey(k)
+		if err := validateKey(normalized); err != nil {
+			return nil, err
+		}
+		if v.Type == "" {
+			v.Type = "string"
+		}
+		if _, ok := schemaTypes[v.Type]; !ok {
+			return nil, fmt.Errorf("key %s has unsupported type %q", k, v.Type)
+		}
+		if _, ok := schemaFormats[v.Format]; v.Format != "" && !ok {
+			return nil, fmt.Errorf("key %s has unsupported format %q", k, v.Format)
+		}
+		if v.Pattern != "" {
+			re, err := regexp.Compile(v.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("key %s has an invalid pattern: %w", k, err)
+			}
+			v.pattern = re
+		}
+		properties[normalized] = v
+	}
+	s.Properties = properties
+	for i, k := range s.Required {
+		s.Required[i] = utils.NormalizeKey(k)
+	}
+	return &s, nil
+}
+
+// checkSchema checks the secrets of a whole service against s
+func checkSchema(s *secretSchema, secrets map[string]string) []manifestProblem {
+	problems := []manifestProblem{}
+	for _, k := range s.Required {
+		if _, ok := secrets[k]; !ok {
+			problems = append(problems, manifestProblem{k, "missing"})
+		}
+	}
+	for k, v := range secrets {
+		// chamber's own keys
+		if pruneProtected[k] {
+			continue
+		}
+		if problem := checkSchemaValue(s, k, v); problem != "" {
+			problems = append(problems, manifestProblem{k, problem})
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Key < problems[j].Key })
+	return problems
+}
+
+// checkSchemaValue checks the value of one key against s, returning what is
+// wrong with it, if anything
+func checkSchemaValue(s *secretSchema, k, v string) string {
+	spec, ok := s.Properties[k]
+	if !ok {
+		if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+			return "not declared in the schema"
+		}
+		return ""
+	}
+	if !schemaTypes[spec.Type](v) {
+		return "not a valid " + spec.Type
+	}
+	length := utf8.RuneCountInString(v)
+	switch {
+	case spec.MinLength != nil && length < *spec.MinLength:
+		return fmt.Sprintf("shorter than %d characters", *spec.MinLength)
+	case spec.MaxLength != nil && length > *spec.MaxLength:
+		return fmt.Sprintf("longer than %d characters", *spec.MaxLength)
+	case spec.pattern != nil && !spec.pattern.MatchString(v):
+		return "does not match " + spec.Pattern
+	case spec.Format != "" && !schemaFormats[spec.Format](v):
+		return "not a valid " + spec.Format
+	}
+	if spec.Type == "integer" || spec.Type == "number" {
+		n, _ := strconv.ParseFloat(v, 64)
+		if spec.Minimum != nil && n < *spec.Minimum {
+			return fmt.Sprintf("less than %v", *spec.Minimum)
+		}
+		if spec.Maximum != nil && n > *spec.Maximum {
+			return fmt.Sprintf("more than %v", *spec.Maximum)
+		}
+	}
+	if len(spec.Enum) > 0 {
+		allowed := make([]string, 0, len(spec.Enum))
+		for _, e := range spec.Enum {
+			if fmt.Sprint(e) == v {
+				return ""
+			}
+			allowed = append(allowed, fmt.Sprint(e))
+		}
+		return "not one of " + strings.Join(allowed, ", ")
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecretSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "required": ["DB_PASSWORD", "db_host", "port"],
+  "properties": {
+    "db_password": {"minLength": 16},
+    "db_host": {"format": "hostname"},
+    "port": {"type": "integer", "minimum": 1, "maximum": 65535},
+    "log_level": {"enum": ["debug", "info", "warn"]},
+    "api_key": {"pattern": "^sk_(live|test)_[0-9a-z]+$"},
+    "callback_url": {"format": "uri"}
+  },
+  "additionalProperties": false
+}`
+
+func TestCheckSchema(t *testing.T) {
+	schema, err := parseSecretSchema([]byte(testSecretSchema))
+	require.NoError(t, err)
+
+	problems := checkSchema(schema, map[string]string{
+		"db_password":  "short",
+		"port":         "80000",
+		"log_level":    "trace",
+		"api_key":      "pk_live_abc",
+		"callback_url": "example.com/callback",
+		"extra":        "value",
+		ManifestKey:    "keys: {}",
+	})
+	assert.Equal(t, []manifestProblem{
+		{"api_key", "does not match ^sk_(live|test)_[0-9a-z]+$"},
+		{"callback_url", "not a valid uri"},
+		{"db_host", "missing"},
+		{"db_password", "shorter than 16 characters"},
+		{"extra", "not declared in the schema"},
+		{"log_level", "not one of debug, info, warn"},
+		{"port", "more than 65535"},
+	}, problems)
+
+	assert.Empty(t, checkSchema(schema, map[string]string{
+		"db_password": "0123456789abcdef",
+		"db_host":     "db.example.com",
+		"port":        "5432",
+		"log_level":   "info",
+		"api_key":     "sk_test_abc123",
+	}))
+	assert.Equal(t, "not a valid integer", checkSchemaValue(schema, "port", "54x"))
+}
+
+func TestParseSecretSchema(t *testing.T) {
+	for _, data := range []string{
+		`{"properties": {"a": {"type": "date"}}}`,
+		`{"properties": {"a": {"format": "ipv9"}}}`,
+		`{"properties": {"a": {"pattern": "("}}}`,
+		`{"properties": {"bad key": {}}}`,
+		`{"properties": []}`,
+	} {
+		_, err := parseSecretSchema([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// ServerTokenEnvVar holds the bearer token clients of chamber server must
+// send. It is only read from the environment so that it never shows up in
+// process lists.
+const ServerTokenEnvVar = "CHAMBER_SERVER_TOKEN"
+
+var (
+	// serverCmd represents the server command
+	serverCmd = &cobra.Command{
+		Use:   "server",
+		Short: "Serve secrets read-only over a local HTTP API",
+		Long: `Serve secrets read-only over a local HTTP API, so tools that cannot link
+chamber can share its backends.
+
+Every request must send the token in $CHAMBER_SERVER_TOKEN as a bearer token.
+The endpoints are:
+
+	GET /v1/services/<service>/keys         the keys of a service, as a JSON array
+	GET /v1/services/<service>/keys/<key>   a key and its value, as a JSON object
+
+The secrets of a service are cached for --cache-ttl after they are read.`,
+		Example: `
+	$ export CHAMBER_SERVER_TOKEN=$(openssl rand -hex 32)
+	$ chamber server --listen 127.0.0.1:8555 &
+	$ curl -H "Authorization: Bearer $CHAMBER_SERVER_TOKEN" http://127.0.0.1:8555/v1/services/app/keys/db_password
+	{"service":"app","key":"db_password","value":"hunter22"}`,
+		Args: cobra.NoArgs,
+		RunE: runServer,
+	}
+	serverListen   string
+	serverCacheTTL time.Duration
+)
+
+func init() {
+	serverCmd.Flags().StringVar(&serverListen, "listen", "127.0.0.1:8555", "address to listen on")
+	serverCmd.Flags().DurationVar(&serverCacheTTL, "cache-ttl", 30*time.Second, "how long to cache the secrets of a service; 0 disables caching")
+	RootCmd.AddCommand(serverCmd)
+}
+
+func runServer(cmd *cobra.Command, args []string) error {
+	token := os.Getenv(ServerTokenEnvVar)
+	if token == "" {
+		return fmt.Errorf("$%s must be set to authenticate clients", ServerTokenEnvVar)
+	}
+	if serverCacheTTL < 0 {
+		return errors.New("--cache-ttl must not be negative")
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "server").
+				Set("chamber-version", chamberVersion).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+
+	server := newSecretServer(secretStore, token, serverCacheTTL)
+	fmt.Fprintf(os.Stderr, "chamber: serving secrets on http://%s\n", serverListen)
+	return http.ListenAndServe(serverListen, server)
+}
+
+// secretServer serves the secrets of a store read-only over HTTP
+type secretServer struct {
+	store store.Store
+	token string
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedService
+}
+
+type cachedService struct {
+	secrets map[string]string
+	expires time.Time
+}
+
+// serverKey is the response for a single key
+type serverKey struct {
+	Service string `json:"service"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+}
+
+// serverError is the response for a failed request
+type serverError struct {
+	Error string `json:"error"`
+}
+
+func newSecretServer(s store.Store, token string, ttl time.Duration) *secretServer {
+	return &secretServer{
+		store: s,
+		token: token,
+		ttl:   ttl,
+		cache: map[string]cachedService{},
+	}
+}
+
+func (s *secretServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(s.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeServerJSON(w, http.StatusUnauthorized, serverError{"missing or invalid token"})
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeServerJSON(w, http.StatusMethodNotAllowed, serverError{"only GET is supported"})
+		return
+	}
+
+	// services may contain slashes, so the path is split at its last keys
+	// segment
+	rest := strings.TrimPrefix(r.URL.Path, "/v1/services/")
+	if rest == r.URL.Path {
+		writeServerJSON(w, http.StatusNotFound, serverError{"not found"})
+		return
+	}
+	var service, k string
+	if strings.HasSuffix(rest, "/keys") {
+		service = strings.TrimSuffix(rest, "/keys")
+	} else if i := strings.LastIndex(rest, "/keys/"); i != -1 {
+		service, k = rest[:i], rest[i+len("/keys/"):]
+	}
+	if service == "" || strings.Contains(k, "/") {
+		writeServerJSON(w, http.StatusNotFound, serverError{"not found"})
+		return
+	}
+	service = utils.NormalizeService(service)
+	if err := validateServiceWithLabel(service); err != nil {
+		writeServerJSON(w, http.StatusBadRequest, serverError{err.Error()})
+		return
+	}
+
+	secrets, err := s.secrets(service)
+	if err != nil {
+		writeServerJSON(w, http.StatusBadGateway, serverError{err.Error()})
+		return
+	}
+
+	if k == "" {
+		writeServerJSON(w, http.StatusOK, sortedKeys(secrets))
+		return
+	}
+	value, ok := secrets[utils.NormalizeKey(k)]
+	if !ok {
+		writeServerJSON(w, http.StatusNotFound, serverError{fmt.Sprintf("%s has no key %s", service, k)})
+		return
+	}
+	writeServerJSON(w, http.StatusOK, serverKey{Service: service, Key: utils.NormalizeKey(k), Value: value})
+}
+
+// secrets returns the secrets of service, from the cache while they are fresh
+func (s *secretServer) secrets(service string) (map[string]string, error) {
+	s.mu.Lock()
+	cached, ok := s.cache[service]
+	s.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.secrets, nil
+	}
+	return s.reload(service)
+}
+
+// reload reads the secrets of service from the store, replacing the cached
+// ones
+func (s *secretServer) reload(service string) (map[string]string, error) {
+	rawSecrets, err := s.store.ListRaw(service)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list store contents: %w", err)
+	}
+	secrets := map[string]string{}
+	for _, rawSecret := range rawSecrets {
+		secrets[key(rawSecret.Key)] = rawSecret.Value
+	}
+	if s.ttl > 0 {
+		s.mu.Lock()
+		s.cache[service] = cachedService{secrets: secrets, expires: time.Now().Add(s.ttl)}
+		s.mu.Unlock()
+	}
+	return secrets, nil
+}
+
+func writeServerJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore counts the calls to ListRaw
+type countingStore struct {
+	*store.MemoryStore
+	listed int
+}
+
+func (s *countingStore) ListRaw(service string) ([]store.RawSecret, error) {
+	s.listed++
+	return s.MemoryStore.ListRaw(service)
+}
+
+func TestSecretServer(t *testing.T) {
+	s := &countingStore{MemoryStore: newFakeStore(map[string]map[string]string{
+		"app":        {"db_password": "hunter22", "db_user": "root"},
+		"team/other": {"api_key": "abc"},
+	})}
+	server := newSecretServer(s, "sekrit", time.Minute)
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	testCases := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+		body   string
+	}{
+		{"lists keys", "/v1/services/app/keys", "sekrit", http.StatusOK, `["db_password","db_user"]`},
+		{"reads a key", "/v1/services/app/keys/DB_PASSWORD", "sekrit", http.StatusOK, `{"service":"app","key":"db_password","value":"hunter22"}`},
+		{"reads a nested service", "/v1/services/team/other/keys/api_key", "sekrit", http.StatusOK, `{"service":"team/other","key":"api_key","value":"abc"}`},
+		{"rejects a missing token", "/v1/services/app/keys", "", http.StatusUnauthorized, `{"error":"missing or invalid token"}`},
+		{"rejects a wrong token", "/v1/services/app/keys", "guess", http.StatusUnauthorized, `{"error":"missing or invalid token"}`},
+		{"reports unknown keys", "/v1/services/app/keys/nope", "sekrit", http.StatusNotFound, `{"error":"app has no key nope"}`},
+		{"reports unknown paths", "/v1/other", "sekrit", http.StatusNotFound, `{"error":"not found"}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := get(tc.path, tc.token)
+			assert.Equal(t, tc.status, w.Code)
+			assert.JSONEq(t, tc.body, w.Body.String())
+		})
+	}
+
+	assert.Equal(t, 2, s.listed, "services are cached")
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/services/app/keys", nil)
+	r.Header.Set("Authorization", "Bearer sekrit")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
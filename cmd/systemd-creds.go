@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// systemdCredsCmd represents the systemd-creds command
+	systemdCredsCmd = &cobra.Command{
+		Use:   "systemd-creds <service>",
+		Short: "Provide the secrets of a service as systemd credentials",
+		Long: `Provide the secrets of a service as systemd credentials, so services read
+them from $CREDENTIALS_DIRECTORY rather than from their environment.
+
+By default, SetCredential= lines are printed for a unit drop-in. With --dir,
+each secret is instead written to a file of that directory, named after its
+key and readable only by its owner, e.g. from a oneshot unit ordered before
+the service. --print-load then prints the LoadCredential= lines to load
+them, and /run/credstore is searched by systemd 254 and later without them.`,
+		Example: `
+	$ chamber systemd-creds app > /etc/systemd/system/app.service.d/credentials.conf
+	$ chamber systemd-creds app --dir /run/credstore --print-load
+
+	# app-credentials.service
+	[Service]
+	Type=oneshot
+	ExecStart=/usr/local/bin/chamber systemd-creds app --dir /run/credstore`,
+		Args: cobra.ExactArgs(1),
+		RunE: runSystemdCreds,
+	}
+	systemdCredsDir       string
+	systemdCredsPrintLoad bool
+)
+
+func init() {
+	systemdCredsCmd.Flags().StringVar(&systemdCredsDir, "dir", "", "write each secret to a file in this directory instead of printing SetCredential= lines")
+	systemdCredsCmd.Flags().BoolVar(&systemdCredsPrintLoad, "print-load", false, "with --dir, print LoadCredential= lines for the written files")
+	RootCmd.AddCommand(systemdCredsCmd)
+}
+
+func runSystemdCreds(cmd *cobra.Command, args []string) error {
+	service := utils.NormalizeService(args[0])
+	if err := validateServiceWithLabel(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+	if systemdCredsPrintLoad && systemdCredsDir == "" {
+		return fmt.Errorf("--print-load requires --dir")
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "systemd-creds").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("backend", backend),
+		})
+	}
+
+	secrets, err := serviceSecrets(service)
+	if err != nil {
+		return err
+	}
+
+	if systemdCredsDir == "" {
+		return writeSetCredentials(os.Stdout, secrets)
+	}
+
+	if err := os.MkdirAll(systemdCredsDir, 0700); err != nil {
+		return fmt.Errorf("Failed to create credentials directory: %w", err)
+	}
+	for _, k := range sortedKeys(secrets) {
+		path := filepath.Join(systemdCredsDir, k)
+		if err := writeFileAtomically(path, []byte(secrets[k]), 0400); err != nil {
+			return fmt.Errorf("Failed to write credential %s: %w", k, err)
+		}
+		if systemdCredsPrintLoad {
+			fmt.Fprintf(os.Stdout, "LoadCredential=%s:%s\n", k, path)
+		}
+	}
+	return nil
+}
+
+// writeSetCredentials writes a SetCredential= line for every secret
+func writeSetCredentials(w io.Writer, secrets map[string]string) error {
+	for _, k := range sortedKeys(secrets) {
+		if _, err := fmt.Fprintf(w, "SetCredential=%s:%s\n", k, systemdEscape(secrets[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// systemdEscape escapes a value for a unit file setting: specifiers are
+// doubled, and backslashes, control characters and surrounding whitespace,
+// which unit files would strip, are written as C escapes
+func systemdEscape(value string) string {
+	var b strings.Builder
+	lead := len(value) - len(strings.TrimLeft(value, " \t"))
+	trail := len(strings.TrimRight(value, " \t"))
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\':
+			b.WriteString(`\\`)
+		case c == '%':
+			b.WriteString("%%")
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\t' && (i < lead || i >= trail):
+			b.WriteString(`\t`)
+		case c == ' ' && (i < lead || i >= trail):
+			b.WriteString(`\x20`)
+		case c < 0x20 && c != '\t' || c == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
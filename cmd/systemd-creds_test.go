@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemdEscape(t *testing.T) {
+	testCases := []struct {
+		value   string
+		escaped string
+	}{
+		{"hunter22", "hunter22"},
+		{"50% off", "50%% off"},
+		{`C:\path`, `C:\\path`},
+		{"line1\nline2", `line1\nline2`},
+		{" padded\t", `\x20padded\t`},
+		{"a\tb", "a\tb"},
+		{"bell\a", `bell\x07`},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.escaped, systemdEscape(tc.value), tc.value)
+	}
+}
+
+func TestWriteSetCredentials(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := writeSetCredentials(out, map[string]string{"db_password": "hunter22", "api_key": "a%b"})
+	assert.NoError(t, err)
+	assert.Equal(t, "SetCredential=api_key:a%%b\nSetCredential=db_password:hunter22\n", out.String())
+}
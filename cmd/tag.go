@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// tagCmd represents the tag command
+	tagCmd = &cobra.Command{
+		Use:   "tag <service> <key> [<tag>=<value>...]",
+		Short: "Set, remove or show the tags of a secret",
+		Long: `Set the tags of an existing secret, as write --tag does when writing it, so
+that tooling keyed off resource tags can find it. Other tags are kept.
+--rm removes tags, and without any tags to set or remove, the tags of the
+secret are shown. chamber list --filter-tag lists the secrets with given
+tags.`,
+		Example: `
+	$ chamber tag app db_password team=payments env=prod
+	$ chamber tag app db_password --rm env
+	$ chamber tag app db_password
+	Tag   Value
+	team  payments`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: runTag,
+	}
+	tagRemove []string
+)
+
+func init() {
+	tagCmd.Flags().StringSliceVar(&tagRemove, "rm", nil, "tags to remove; may be repeated or comma separated")
+	RootCmd.AddCommand(tagCmd)
+}
+
+func runTag(cmd *cobra.Command, args []string) error {
+	service := utils.NormalizeService(args[0])
+	if err := validateService(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+	key := utils.NormalizeKey(args[1])
+	if err := validateKey(key); err != nil {
+		return fmt.Errorf("Failed to validate key: %w", err)
+	}
+	tags, err := parseTagFlags(args[2:])
+	if err != nil {
+		return err
+	}
+	for _, k := range tagRemove {
+		if _, ok := tags[k]; ok {
+			return fmt.Errorf("Tag %s is both set and removed", k)
+		}
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "tag").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("key", key).
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	if !secretStore.Capabilities().Tags {
+		return fmt.Errorf("The %s backend does not support tags", backend)
+	}
+	secretId := store.SecretId{Service: service, Key: key}
+
+	if len(tags) == 0 && len(tagRemove) == 0 {
+		current, err := secretStore.ReadTags(secretId)
+		if err != nil {
+			return fmt.Errorf("Failed to read tags of %s: %w", key, err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+		fmt.Fprintln(w, "Tag\tValue")
+		for _, k := range sortedKeys(current) {
+			fmt.Fprintf(w, "%s\t%s\n", k, current[k])
+		}
+		return w.Flush()
+	}
+	return updateTags(secretStore, secretId, tags, tagRemove)
+}
+
+// updateTags sets tags on the secret id and removes the tags in remove. The
+// secret must exist.
+func updateTags(s store.Store, id store.SecretId, tags map[string]string, remove []string) error {
+	if _, err := s.Read(id, -1); err != nil {
+		if errors.Is(err, store.ErrSecretNotFound) {
+			return fmt.Errorf("%s/%s doesn't exist", id.Service, id.Key)
+		}
+		return fmt.Errorf("Failed to read %s: %w", id.Key, err)
+	}
+	if len(tags) > 0 {
+		if err := s.WriteTags(id, tags); err != nil {
+			return fmt.Errorf("Failed to tag %s: %w", id.Key, err)
+		}
+	}
+	if len(remove) > 0 {
+		if err := s.DeleteTags(id, remove); err != nil {
+			return fmt.Errorf("Failed to remove tags of %s: %w", id.Key, err)
+		}
+	}
+	return nil
+}
+
+// parseTagFilters parses the key=value tags of list --filter-tag
+func parseTagFilters(filters []string) (map[string]string, error) {
+	tags := make(map[string]string, len(filters))
+	for _, filter := range filters {
+		k, v, ok := strings.Cut(filter, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("Invalid --filter-tag %q: must be key=value", filter)
+		}
+		if prev, ok := tags[k]; ok && prev != v {
+			return nil, fmt.Errorf("--filter-tag %s is given different values", k)
+		}
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+// filterByTags returns the secrets of service carrying every tag of filters
+func filterByTags(s store.Store, service string, secrets []store.Secret, filters map[string]string) ([]store.Secret, error) {
+	filtered := make([]store.Secret, 0, len(secrets))
+	for _, secret := range secrets {
+		k := key(secret.Meta.Key)
+		tags, err := s.ReadTags(store.SecretId{Service: service, Key: k})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read tags of %s: %w", k, err)
+		}
+		matched := true
+		for name, value := range filters {
+			if v, ok := tags[name]; !ok || v != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			filtered = append(filtered, secret)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateTags(t *testing.T) {
+	s := store.NewMemoryStore()
+	id := store.SecretId{Service: "app", Key: "db_password"}
+	require.NoError(t, s.Write(id, "hunter2"))
+	require.NoError(t, s.WriteTags(id, map[string]string{"owner": "alice", "env": "dev"}))
+
+	require.NoError(t, updateTags(s, id, map[string]string{"team": "payments", "env": "prod"}, nil))
+	tags, err := s.ReadTags(id)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"owner": "alice", "team": "payments", "env": "prod"}, tags)
+
+	require.NoError(t, updateTags(s, id, nil, []string{"owner", "missing"}))
+	tags, err = s.ReadTags(id)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "payments", "env": "prod"}, tags)
+
+	err = updateTags(s, store.SecretId{Service: "app", Key: "missing"}, map[string]string{"team": "payments"}, nil)
+	assert.EqualError(t, err, "app/missing doesn't exist")
+}
+
+func TestParseTagFilters(t *testing.T) {
+	filters, err := parseTagFilters([]string{"team=payments", "env=", "team=payments"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "payments", "env": ""}, filters)
+
+	for _, bad := range [][]string{{"team"}, {"=payments"}, {"team=a", "team=b"}} {
+		_, err := parseTagFilters(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestFilterByTags(t *testing.T) {
+	s := store.NewMemoryStore()
+	for k, tags := range map[string]map[string]string{
+		"a": {"team": "payments", "env": "prod"},
+		"b": {"team": "payments"},
+		"c": {"team": "search", "env": "prod"},
+		"d": nil,
+	} {
+		id := store.SecretId{Service: "app", Key: k}
+		require.NoError(t, s.Write(id, "value"))
+		require.NoError(t, s.WriteTags(id, tags))
+	}
+	secrets, err := s.List("app", false)
+	require.NoError(t, err)
+
+	keys := func(filters map[string]string) []string {
+		filtered, err := filterByTags(s, "app", secrets, filters)
+		require.NoError(t, err)
+		var keys []string
+		for _, secret := range filtered {
+			keys = append(keys, key(secret.Meta.Key))
+		}
+		return keys
+	}
+	assert.Equal(t, []string{"a", "b"}, keys(map[string]string{"team": "payments"}))
+	assert.Equal(t, []string{"a"}, keys(map[string]string{"team": "payments", "env": "prod"}))
+	assert.Empty(t, keys(map[string]string{"team": "other"}))
+}
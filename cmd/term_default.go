@@ -0,0 +1,17 @@
+//go:build !linux && !darwin
+
+package cmd
+
+import "errors"
+
+func makeRaw(fd int) (func() error, error) {
+	return nil, errors.New("terminal control is not supported on this platform")
+}
+
+func terminalHeight(fd int) int {
+	return 24
+}
+
+func readNoEcho(fd int) (string, error) {
+	return "", errors.New("reading without echo is not supported on this platform")
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// testserverCmd represents the testserver command
+	testserverCmd = &cobra.Command{
+		Use:   "testserver",
+		Short: "Serve seed secrets from memory over the chamber server API, for integration tests",
+		Long: `Serve seed secrets from memory over the chamber server API, for integration
+tests of tools that read secrets through it, without AWS.
+
+The seed file is YAML mapping services to their keys and values. Once
+listening, the URL and token are printed as shell variable assignments, in a
+single write. The server keeps running, so to use them, run it in the
+background with its output redirected to a file, and source the file once it
+isn't empty. The token is $CHAMBER_SERVER_TOKEN when set, and random
+otherwise. Listening on port 0 picks a free port.`,
+		Example: `
+	$ cat seed.yaml
+	app:
+	  db_password: hunter22
+	  port: 5432
+	$ chamber testserver --seed seed.yaml --listen 127.0.0.1:0 > server.env &
+	$ until [ -s server.env ]; do sleep 0.1; done; . ./server.env
+	$ curl -H "Authorization: Bearer $CHAMBER_SERVER_TOKEN" $CHAMBER_SERVER_URL/v1/services/app/keys`,
+		Args: cobra.NoArgs,
+		RunE: runTestserver,
+	}
+	testserverSeed   string
+	testserverListen string
+)
+
+func init() {
+	testserverCmd.Flags().StringVar(&testserverSeed, "seed", "", "YAML file of services, keys and values to serve")
+	testserverCmd.Flags().StringVar(&testserverListen, "listen", "127.0.0.1:8555", "address to listen on")
+	RootCmd.AddCommand(testserverCmd)
+}
+
+func runTestserver(cmd *cobra.Command, args []string) error {
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "testserver").
+				Set("chamber-version", chamberVersion),
+		})
+	}
+
+	memoryStore := store.NewMemoryStore()
+	if testserverSeed != "" {
+		f, err := os.Open(testserverSeed)
+		if err != nil {
+			return fmt.Errorf("Failed to open seed file: %w", err)
+		}
+		err = seedMemoryStore(memoryStore, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("Failed to seed secrets: %w", err)
+		}
+	}
+
+	token := os.Getenv(ServerTokenEnvVar)
+	if token == "" {
+		random := make([]byte, 16)
+		if _, err := rand.Read(random); err != nil {
+			return err
+		}
+		token = hex.EncodeToString(random)
+	}
+
+	listener, err := net.Listen("tcp", testserverListen)
+	if err != nil {
+		return fmt.Errorf("Failed to listen: %w", err)
+	}
+	fmt.Fprintf(os.Stdout, "CHAMBER_SERVER_URL=http://%s\n%s=%s\n", listener.Addr(), ServerTokenEnvVar, token)
+	return http.Serve(listener, newSecretServer(memoryStore, token, 0))
+}
+
+// seedMemoryStore writes the secrets of a YAML seed file to s
+func seedMemoryStore(s *store.MemoryStore, r io.Reader) error {
+	var seed map[string]map[string]string
+	if err := yaml.NewDecoder(r).Decode(&seed); err != nil && err != io.EOF {
+		return err
+	}
+	for service, secrets := range seed {
+		service = utils.NormalizeService(service)
+		if err := validateService(service); err != nil {
+			return err
+		}
+		for k, v := range secrets {
+			k = utils.NormalizeKey(k)
+			if err := validateKey(k); err != nil {
+				return err
+			}
+			if err := s.Write(store.SecretId{Service: service, Key: k}, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
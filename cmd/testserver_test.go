@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeedMemoryStore(t *testing.T) {
+	s := store.NewMemoryStore()
+	err := seedMemoryStore(s, strings.NewReader(`
+App:
+  DB_Password: hunter22
+  port: 5432
+team/worker:
+  token: abc
+`))
+	assert.NoError(t, err)
+
+	rawSecrets, err := s.ListRaw("app")
+	assert.NoError(t, err)
+	assert.Equal(t, []store.RawSecret{
+		{Key: "/app/db_password", Value: "hunter22"},
+		{Key: "/app/port", Value: "5432"},
+	}, rawSecrets)
+
+	server := newSecretServer(s, "sekrit", 0)
+	r := httptest.NewRequest(http.MethodGet, "/v1/services/team/worker/keys/token", nil)
+	r.Header.Set("Authorization", "Bearer sekrit")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"service":"team/worker","key":"token","value":"abc"}`, w.Body.String())
+
+	assert.Error(t, seedMemoryStore(s, strings.NewReader("bad service!:\n  key: value\n")))
+	assert.NoError(t, seedMemoryStore(s, strings.NewReader("")))
+}
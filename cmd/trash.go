@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// TrashService is the namespace delete --soft moves secrets to, under a
+// service of the same name: app-prod/db_password is kept as
+// _trash/app-prod/db_password until it is restored or purged
+const TrashService = "_trash"
+
+// SoftDeleteEnvVar makes delete move secrets to the trash by default
+const SoftDeleteEnvVar = "CHAMBER_SOFT_DELETE"
+
+// DefaultTrashRetention is how long purge keeps secrets in the trash
+const DefaultTrashRetention = "30d"
+
+var (
+	// restoreCmd represents the restore command
+	restoreCmd = &cobra.Command{
+		Use:   "restore <service> <key> | --from <archive> [<service>...]",
+		Short: "Restore a secret deleted with delete --soft, or secrets from a backup",
+		Long: `Restore a secret deleted with delete --soft from the trash.
+
+With --from, restore secrets from an archive written by chamber backup instead,
+decrypting and decompressing it as needed: those of the services given, which
+may be globs like app-*, or of every service in the archive, and only keys
+matching --keys if given. Secrets that already have the value in the archive
+are left alone, and --on-conflict decides what happens to those with another
+value. --history restores every version kept in the archive, oldest first, of
+secrets that don't exist anymore; others only get their latest value.`,
+		Example: `
+	$ chamber restore app-prod db_password
+	$ chamber restore --from backup.json app-prod --keys 'db_*' --dry-run
+	$ chamber restore --from backup.json.gz.kms 'app-*' --on-conflict keep --history`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if restoreFrom != "" {
+				return nil
+			}
+			return cobra.ExactArgs(2)(cmd, args)
+		},
+		RunE: restore,
+	}
+
+	// purgeCmd represents the purge command
+	purgeCmd = &cobra.Command{
+		Use:   "purge [<service>]",
+		Short: "Permanently delete secrets kept in the trash by delete --soft",
+		Long: `Permanently delete the secrets delete --soft moved to the trash more than
+--older-than ago, of every service or only of the one given.`,
+		Example: `
+	$ chamber purge
+	$ chamber purge app-prod --older-than 0`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: purge,
+	}
+
+	restoreOverwrite   bool
+	restoreFrom        string
+	restoreRegion      string
+	restoreKeys        []string
+	restoreOnConflict  string
+	restoreHistory     bool
+	restoreDryRun      bool
+	restoreConcurrency int
+	purgeOlderThan     string
+)
+
+func init() {
+	restoreCmd.Flags().BoolVar(&restoreOverwrite, "overwrite", false, "Restore the secret even if the service has a secret of that name again; with --from, the same as --on-conflict replace")
+	restoreCmd.Flags().StringVar(&restoreFrom, "from", "", "restore from an archive written by chamber backup, or - for standard input")
+	restoreCmd.Flags().StringVar(&restoreRegion, "region", "", "with --from, the region section of the archive to restore, if it has several")
+	restoreCmd.Flags().StringSliceVar(&restoreKeys, "keys", nil, "with --from, only restore keys matching these globs")
+	restoreCmd.Flags().StringVar(&restoreOnConflict, "on-conflict", ConflictAbort, "with --from, what to do with existing keys that have another value: replace, keep (or skip), abort, or prompt for each key")
+	restoreCmd.Flags().BoolVar(&restoreHistory, "history", false, "with --from, restore every version kept in the archive of secrets that don't exist anymore")
+	restoreCmd.Flags().BoolVar(&restoreDryRun, "dry-run", false, "with --from, list the secrets that would be restored without writing anything")
+	restoreCmd.Flags().IntVar(&restoreConcurrency, "concurrency", DefaultConcurrency, "with --from, how many secrets to write at once; Secrets Manager and S3 are always written one at a time")
+	purgeCmd.Flags().StringVar(&purgeOlderThan, "older-than", DefaultTrashRetention, "Only purge secrets deleted longer ago than this, e.g. 30d or 12h; 0 purges them all")
+	RootCmd.AddCommand(restoreCmd)
+	RootCmd.AddCommand(purgeCmd)
+}
+
+// softDelete reports whether delete moves secrets to the trash, as set by
+// --soft or otherwise by $CHAMBER_SOFT_DELETE
+func softDelete(cmd *cobra.Command) bool {
+	if cmd.Flags().Changed("soft") {
+		return deleteSoft
+	}
+	enabled, _ := strconv.ParseBool(os.Getenv(SoftDeleteEnvVar))
+	return enabled
+}
+
+// isTrashService reports whether service is the trash or one of the services
+// in it
+func isTrashService(service string) bool {
+	return service == TrashService || strings.HasPrefix(service, TrashService+"/")
+}
+
+// listUntrashedServices lists the services under prefix, or the names of their
+// secrets, like s.ListServices, leaving out the trash: only restore and purge
+// look into it
+func listUntrashedServices(s store.Store, prefix string, includeSecretName bool) ([]string, error) {
+	names, err := s.ListServices(prefix, includeSecretName)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]string, 0, len(names))
+	for _, name := range names {
+		if !isTrashService(strings.TrimPrefix(name, "/")) {
+			kept = append(kept, name)
+		}
+	}
+	return kept, nil
+}
+
+// trashId returns where the secret id is kept in the trash
+func trashId(id store.SecretId) store.SecretId {
+	return store.SecretId{Service: TrashService + "/" + id.Service, Key: id.Key}
+}
+
+// trashSecret moves the secret id to the trash. Only its latest value is
+// kept.
+func trashSecret(s store.Store, id store.SecretId) error {
+	if _, noPaths := os.LookupEnv("CHAMBER_NO_PATHS"); noPaths {
+		return errors.New("Soft delete needs paths, and isn't available with CHAMBER_NO_PATHS")
+	}
+	if isTrashService(id.Service) {
+		return fmt.Errorf("%s/%s is already in the trash; chamber purge deletes it", id.Service, id.Key)
+	}
+	secret, err := s.Read(id, -1)
+	if err != nil {
+		return err
+	}
+	if err := s.Write(trashId(id), *secret.Value); err != nil {
+		return fmt.Errorf("Failed to move %s/%s to the trash: %w", id.Service, id.Key, err)
+	}
+	return s.Delete(id)
+}
+
+// restoreSecret moves the secret id back from the trash. Unless overwrite is
+// set, it fails if the service has a secret of that name again.
+func restoreSecret(s store.Store, id store.SecretId, overwrite bool) error {
+	trashed, err := s.Read(trashId(id), -1)
+	if errors.Is(err, store.ErrSecretNotFound) {
+		return fmt.Errorf("%s/%s is not in the trash", id.Service, id.Key)
+	}
+	if err != nil {
+		return err
+	}
+	if !overwrite {
+		current, err := s.Read(id, -1)
+		if err == nil {
+			return fmt.Errorf("%s/%s was written again by %s at %s; pass --overwrite to restore it anyway",
+				id.Service, id.Key, current.Meta.CreatedBy, current.Meta.Created.Local().Format(ShortTimeFormat))
+		}
+		if !errors.Is(err, store.ErrSecretNotFound) {
+			return err
+		}
+	}
+	if err := s.Write(id, *trashed.Value); err != nil {
+		return err
+	}
+	return s.Delete(trashId(id))
+}
+
+// purgeTrash permanently deletes the secrets moved to the trash before
+// cutoff, of the services under service, returning how many were deleted
+func purgeTrash(s store.Store, service string, cutoff time.Time) (int, error) {
+	prefix := TrashService + "/"
+	if service != "" {
+		prefix += service
+	}
+	services, err := s.ListServices(prefix, false)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to list the trash: %w", err)
+	}
+	purged := 0
+	for _, trashed := range services {
+		trashed = strings.TrimPrefix(trashed, "/")
+		if service != "" && trashed != prefix && !strings.HasPrefix(trashed, prefix+"/") {
+			// another service sharing the prefix
+			continue
+		}
+		secrets, err := s.List(trashed, false)
+		if err != nil {
+			return purged, fmt.Errorf("Failed to list the trash of %s: %w", strings.TrimPrefix(trashed, TrashService+"/"), err)
+		}
+		var keys []string
+		for _, secret := range secrets {
+			if secret.Meta.Created.Before(cutoff) {
+				keys = append(keys, key(secret.Meta.Key))
+			}
+		}
+		if err := store.DeleteBatch(s, trashed, keys); err != nil {
+			return purged, err
+		}
+		purged += len(keys)
+	}
+	return purged, nil
+}
+
+// parseRetention parses a period as a number of days, like 30d, or a
+// duration, like 12h
+func parseRetention(period string) (time.Duration, error) {
+	if strings.HasSuffix(period, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(period, "d"))
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("Invalid period %q: must be a number of days like 30d, or a duration like 12h", period)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("Invalid period %q: must be a number of days like 30d, or a duration like 12h", period)
+	}
+	return d, nil
+}
+
+func restore(cmd *cobra.Command, args []string) error {
+	if restoreFrom != "" {
+		return restoreBackup(args)
+	}
+	service := utils.NormalizeService(args[0])
+	if err := validateService(service); err != nil {
+		return fmt.Errorf("Failed to validate service: %w", err)
+	}
+	key := utils.NormalizeKey(args[1])
+	if err := validateKey(key); err != nil {
+		return fmt.Errorf("Failed to validate key: %w", err)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "restore").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("key", key).
+				Set("backend", backend),
+		})
+	}
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	// trashed manifests are restored and purged like any key
+	secretStore = withManifests(secretStore)
+	return restoreSecret(secretStore, store.SecretId{Service: service, Key: key}, restoreOverwrite)
+}
+
+func purge(cmd *cobra.Command, args []string) error {
+	var service string
+	if len(args) == 1 {
+		service = utils.NormalizeService(args[0])
+		if err := validateService(service); err != nil {
+			return fmt.Errorf("Failed to validate service: %w", err)
+		}
+	}
+	retention, err := parseRetention(purgeOlderThan)
+	if err != nil {
+		return fmt.Errorf("Invalid --older-than: %w", err)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "purge").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("backend", backend),
+		})
+	}
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	// trashed manifests are restored and purged like any key
+	secretStore = withManifests(secretStore)
+	purged, err := purgeTrash(secretStore, service, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "Purged %d secrets from the trash\n", purged)
+	return nil
+}
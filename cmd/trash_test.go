@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrash(t *testing.T) {
+	s := store.NewMemoryStore()
+	id := store.SecretId{Service: "app-prod", Key: "db_password"}
+	require.NoError(t, s.Write(id, "secret"))
+
+	require.NoError(t, trashSecret(s, id))
+	_, err := s.Read(id, -1)
+	assert.ErrorIs(t, err, store.ErrSecretNotFound)
+	trashed, err := s.Read(store.SecretId{Service: "_trash/app-prod", Key: "db_password"}, -1)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", *trashed.Value)
+	assert.Error(t, trashSecret(s, trashId(id)))
+
+	require.NoError(t, s.Write(id, "new"))
+	assert.Error(t, restoreSecret(s, id, false))
+	require.NoError(t, restoreSecret(s, id, true))
+	restored, err := s.Read(id, -1)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", *restored.Value)
+	assert.Error(t, restoreSecret(s, id, true), "no longer in the trash")
+}
+
+func TestPurgeTrash(t *testing.T) {
+	s := store.NewMemoryStore()
+	for _, id := range []store.SecretId{
+		{Service: "app", Key: "a"},
+		{Service: "app", Key: "b"},
+		{Service: "app-dev", Key: "a"},
+		{Service: "other", Key: "a"},
+	} {
+		require.NoError(t, s.Write(id, "value"))
+		require.NoError(t, trashSecret(s, id))
+	}
+
+	purged, err := purgeTrash(s, "app", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 0, purged, "too recent")
+
+	purged, err = purgeTrash(s, "app", time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+
+	purged, err = purgeTrash(s, "", time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+}
+
+func TestListUntrashedServices(t *testing.T) {
+	s := store.NewMemoryStore()
+	id := store.SecretId{Service: "app", Key: "a"}
+	require.NoError(t, s.Write(id, "value"))
+	require.NoError(t, s.Write(store.SecretId{Service: "app", Key: "b"}, "value"))
+	require.NoError(t, trashSecret(s, id))
+
+	services, err := listUntrashedServices(s, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app"}, services)
+	names, err := listUntrashedServices(s, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/app/b"}, names)
+
+	assert.Error(t, validateService("_trash"))
+	assert.Error(t, validateService("_trash/app"))
+	assert.Error(t, validateServiceWithLabel("_trash/app:prod"))
+	assert.NoError(t, validateService("_trashed"))
+}
+
+func TestParseRetention(t *testing.T) {
+	d, err := parseRetention("30d")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*24*time.Hour, d)
+	d, err = parseRetention("12h")
+	assert.NoError(t, err)
+	assert.Equal(t, 12*time.Hour, d)
+	d, err = parseRetention("0")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), d)
+
+	for _, period := range []string{"", "-1d", "xd", "-2h"} {
+		_, err := parseRetention(period)
+		assert.Error(t, err, period)
+	}
+}
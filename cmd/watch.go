@@ -0,0 +1,436 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	osexec "os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/segmentio/chamber/v2/utils"
+	"github.com/spf13/cobra"
+)
+
+// When true, exec restarts the command whenever the secrets of its services
+// change, checking every watchInterval
+var (
+	watch         bool
+	watchInterval time.Duration
+)
+
+// WatchWebhookEnvVar holds the URL watch notifies when --webhook isn't
+// given, since it often embeds a credential
+const WatchWebhookEnvVar = "CHAMBER_WATCH_WEBHOOK"
+
+// WatchEventsEnvVar tells the --on-change command what changed, as a JSON
+// array of events
+const WatchEventsEnvVar = "CHAMBER_WATCH_EVENTS"
+
+// The kinds of change chamber watch reports
+const (
+	WatchCreated = "created"
+	WatchUpdated = "updated"
+	WatchDeleted = "deleted"
+)
+
+var (
+	// watchCmd represents the watch command
+	watchCmd = &cobra.Command{
+		Use:   "watch <service...>",
+		Short: "Stream an event whenever a secret of services changes",
+		Long: `Print a line of JSON whenever a key of services is created, updated or
+deleted, until interrupted, to pipe into other tools or trigger reloads. Each
+event has the kind of change, the service, the key, its version, and when and
+by whom it was written; values are never printed.
+
+The backends are polled every --interval, since none of them notifies chamber
+of changes, so a key written several times between two polls is reported
+once, at its latest version.
+
+--on-change runs a command with the shell, and --webhook posts the events as
+JSON to a URL, or to $` + WatchWebhookEnvVar + ` with --webhook env. They are
+triggered once changes have settled for --debounce, with every event since
+the last trigger, and retried --retries times with a growing delay when they
+fail. The command gets the events in $` + WatchEventsEnvVar + `.`,
+		Example: `
+	$ chamber watch app global
+	{"event":"updated","service":"app","key":"db_password","version":4,"modified":"2026-10-16T09:00:00Z","user":"alice"}
+	$ chamber watch app --on-change 'systemctl reload app' --debounce 1m
+	$ chamber watch app --webhook env --retries 5`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runWatch,
+	}
+	watchEvery    time.Duration
+	watchOnChange string
+	watchWebhook  string
+	watchDebounce time.Duration
+	watchRetries  int
+	watchTimeout  time.Duration
+)
+
+// watchRetryDelay is how long watch waits before retrying a failed trigger
+// the first time, doubling every time after
+var watchRetryDelay = time.Second
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchEvery, "interval", 30*time.Second, "how often to check for changes")
+	watchCmd.Flags().StringVar(&watchOnChange, "on-change", "", "command to run with the shell when secrets change")
+	watchCmd.Flags().StringVar(&watchWebhook, "webhook", "", "URL to post the changes to as JSON, or env to use $"+WatchWebhookEnvVar)
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", 5*time.Second, "how long changes must settle before --on-change and --webhook are triggered")
+	watchCmd.Flags().IntVar(&watchRetries, "retries", 3, "how many times to retry --on-change and --webhook when they fail")
+	watchCmd.Flags().DurationVar(&watchTimeout, "webhook-timeout", 10*time.Second, "how long to wait for --webhook to respond before retrying")
+	RootCmd.AddCommand(watchCmd)
+}
+
+// watchEvent is a change chamber watch reports
+type watchEvent struct {
+	Event    string     `json:"event"`
+	Service  string     `json:"service"`
+	Key      string     `json:"key"`
+	Version  int        `json:"version"`
+	Modified *time.Time `json:"modified,omitempty"`
+	User     string     `json:"user,omitempty"`
+}
+
+// secretVersions returns the latest version of every key of services, by
+// service/key
+func secretVersions(s store.Store, services []string) (map[string]int, error) {
+	metadata, err := secretMetadata(s, services)
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]int, len(metadata))
+	for id, meta := range metadata {
+		versions[id] = meta.Version
+	}
+	return versions, nil
+}
+
+// diffVersions describes the keys added, removed or updated between two
+// results of secretVersions, without any values
+func diffVersions(before, after map[string]int) []string {
+	var changes []string
+	for k, v := range after {
+		old, ok := before[k]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("+ %s: added at version %d", k, v))
+		case old != v:
+			changes = append(changes, fmt.Sprintf("~ %s: version %d -> %d", k, old, v))
+		}
+	}
+	for k, v := range before {
+		if _, ok := after[k]; !ok {
+			changes = append(changes, fmt.Sprintf("- %s: removed at version %d", k, v))
+		}
+	}
+	// sort by key rather than by kind of change
+	sort.Slice(changes, func(i, j int) bool { return changes[i][2:] < changes[j][2:] })
+	return changes
+}
+
+// watchSecrets checks the secrets of services every interval, and closes the
+// returned channel once they differ from initial, after writing what changed
+// to out
+func watchSecrets(s store.Store, services []string, initial map[string]int, interval time.Duration, out io.Writer) <-chan struct{} {
+	changed := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			current, err := secretVersions(s, services)
+			if err != nil {
+				fmt.Fprintf(out, "warning: failed to check for secret changes: %s\n", err)
+				continue
+			}
+			if changes := diffVersions(initial, current); len(changes) > 0 {
+				fmt.Fprintf(out, "chamber: secrets changed, restarting command:\n")
+				for _, change := range changes {
+					fmt.Fprintf(out, "  %s\n", change)
+				}
+				close(changed)
+				return
+			}
+		}
+	}()
+	return changed
+}
+
+// secretMetadata returns the metadata of the latest version of every key of
+// services, by service/key
+func secretMetadata(s store.Store, services []string) (map[string]store.SecretMetadata, error) {
+	metadata := map[string]store.SecretMetadata{}
+	for _, service := range services {
+		secrets, err := s.List(service, false)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list store contents for %s: %w", service, err)
+		}
+		for _, secret := range secrets {
+			metadata[service+"/"+key(secret.Meta.Key)] = secret.Meta
+		}
+	}
+	return metadata, nil
+}
+
+// watchEvents returns the changes between two results of secretMetadata,
+// sorted by key
+func watchEvents(before, after map[string]store.SecretMetadata) []watchEvent {
+	var events []watchEvent
+	add := func(kind, id string, meta store.SecretMetadata) {
+		i := strings.LastIndex(id, "/")
+		event := watchEvent{Event: kind, Service: id[:i], Key: id[i+1:], Version: meta.Version}
+		if kind != WatchDeleted {
+			modified := meta.Created
+			event.Modified, event.User = &modified, meta.CreatedBy
+		}
+		events = append(events, event)
+	}
+	for id, meta := range after {
+		old, ok := before[id]
+		switch {
+		case !ok:
+			add(WatchCreated, id, meta)
+		case old.Version != meta.Version:
+			add(WatchUpdated, id, meta)
+		}
+	}
+	for id, meta := range before {
+		if _, ok := after[id]; !ok {
+			add(WatchDeleted, id, meta)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Service != events[j].Service {
+			return events[i].Service < events[j].Service
+		}
+		return events[i].Key < events[j].Key
+	})
+	return events
+}
+
+// watchTrigger is what watch triggers once changes have settled
+type watchTrigger struct {
+	command string
+	webhook string
+	client  *http.Client
+	retries int
+}
+
+// watchNotification is posted to the webhook when secrets change
+type watchNotification struct {
+	Text   string       `json:"text"`
+	Events []watchEvent `json:"events"`
+}
+
+// fire runs the command and notifies the webhook of events, retrying each on
+// failure
+func (t *watchTrigger) fire(events []watchEvent) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	var errs []string
+	if t.command != "" {
+		err := t.retry(func() error {
+			return runWatchCommand(t.command, string(data))
+		})
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if t.webhook != "" {
+		err := t.retry(func() error {
+			return postWatchNotification(t.client, t.webhook, events)
+		})
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// retry calls f until it succeeds, at most retries times more, doubling the
+// delay between attempts
+func (t *watchTrigger) retry(f func() error) error {
+	delay := watchRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil || attempt == t.retries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// runWatchCommand runs command with the shell, telling it what changed
+// through the environment
+func runWatchCommand(command, events string) error {
+	shell := os.Getenv(ShellEnvVar)
+	if shell == "" {
+		shell = defaultShell()
+	}
+	name, args := shellCommand(shell, []string{command})
+	c := osexec.Command(name, args...)
+	c.Env = append(os.Environ(), WatchEventsEnvVar+"="+events)
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", command, err)
+	}
+	return nil
+}
+
+// postWatchNotification posts events to a webhook
+func postWatchNotification(client *http.Client, webhook string, events []watchEvent) error {
+	changes := make([]string, 0, len(events))
+	for _, event := range events {
+		changes = append(changes, fmt.Sprintf("%s %s/%s at version %d", event.Event, event.Service, event.Key, event.Version))
+	}
+	text := fmt.Sprintf("chamber: %d secrets changed:\n%s", len(events), strings.Join(changes, "\n"))
+	body, err := json.Marshal(watchNotification{Text: text, Events: events})
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// the URL often holds a credential, so leave it out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("Failed to notify webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Failed to notify webhook: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// streamChanges writes an event to out for every change to the secrets of
+// services since initial, checking every interval until stop is closed.
+// Failed checks are reported to errOut and tried again at the next one.
+// Unless trigger is nil, it is fired with the events seen once no change was
+// seen for debounce.
+func streamChanges(s store.Store, services []string, initial map[string]store.SecretMetadata, interval time.Duration, out, errOut io.Writer, stop <-chan struct{}, trigger *watchTrigger, debounce time.Duration) error {
+	last := initial
+	encoder := json.NewEncoder(out)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var pending []watchEvent
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-settled:
+			if err := trigger.fire(pending); err != nil {
+				fmt.Fprintf(errOut, "warning: failed to trigger on change: %s\n", err)
+			}
+			pending, settled = nil, nil
+			continue
+		case <-ticker.C:
+		}
+		current, err := secretMetadata(s, services)
+		if err != nil {
+			fmt.Fprintf(errOut, "warning: failed to check for secret changes: %s\n", err)
+			continue
+		}
+		events := watchEvents(last, current)
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+		if trigger != nil && len(events) > 0 {
+			pending = append(pending, events...)
+			settled = time.After(debounce)
+		}
+		last = current
+	}
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	if watchEvery <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	if watchDebounce < 0 || watchRetries < 0 {
+		return errors.New("--debounce and --retries cannot be negative")
+	}
+	if watchTimeout <= 0 {
+		return errors.New("--webhook-timeout must be positive")
+	}
+	var trigger *watchTrigger
+	if watchOnChange != "" || watchWebhook != "" {
+		trigger = &watchTrigger{command: watchOnChange, webhook: watchWebhook, retries: watchRetries}
+	}
+	if watchWebhook == "env" {
+		if trigger.webhook = os.Getenv(WatchWebhookEnvVar); trigger.webhook == "" {
+			return fmt.Errorf("$%s must be set to use --webhook env", WatchWebhookEnvVar)
+		}
+	}
+	services := make([]string, 0, len(args))
+	for _, arg := range args {
+		service := utils.NormalizeService(arg)
+		if err := validateService(service); err != nil {
+			return fmt.Errorf("Failed to validate service: %w", err)
+		}
+		services = append(services, service)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "watch").
+				Set("chamber-version", chamberVersion).
+				Set("services", services).
+				Set("on-change", watchOnChange != "").
+				Set("webhook", watchWebhook != "").
+				Set("backend", backend),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	if trigger != nil {
+		// through --https-proxy and trusting --ca-bundle, once they are set
+		trigger.client = store.NewHTTPClient(watchTimeout)
+	}
+	initial, err := secretMetadata(secretStore, services)
+	if err != nil {
+		return err
+	}
+	return streamChanges(secretStore, services, initial, watchEvery, os.Stdout, os.Stderr, nil, trigger, watchDebounce)
+}
+
+// restartSelf runs chamber again with the same arguments and environment, so
+// that secrets are fetched and the command started afresh
+func restartSelf(dir string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Failed to find chamber executable: %w", err)
+	}
+	// options like --chdir are relative to where chamber was started
+	if err := os.Chdir(dir); err != nil {
+		return fmt.Errorf("Failed to change directory: %w", err)
+	}
+	return exec(self, os.Args[1:], os.Environ())
+}
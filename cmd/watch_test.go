@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffVersions(t *testing.T) {
+	before := map[string]int{"app/a": 1, "app/b": 3, "app/c": 2}
+	after := map[string]int{"app/a": 1, "app/b": 4, "app/d": 1}
+
+	assert.Equal(t, []string{
+		"~ app/b: version 3 -> 4",
+		"- app/c: removed at version 2",
+		"+ app/d: added at version 1",
+	}, diffVersions(before, after))
+	assert.Empty(t, diffVersions(before, before))
+}
+
+func TestWatchSecrets(t *testing.T) {
+	s := newFakeStore(map[string]map[string]string{
+		"app":    {"db_password": "hunter22", "db_user": "root"},
+		"global": {"region": "us-east-1"},
+	})
+	services := []string{"app", "global"}
+
+	initial, err := secretVersions(s, services)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"app/db_password": 1, "app/db_user": 1, "global/region": 1}, initial)
+
+	s.Write(store.SecretId{Service: "app", Key: "db_password"}, "hunter23")
+
+	out := &bytes.Buffer{}
+	select {
+	case <-watchSecrets(s, services, initial, time.Millisecond, out):
+	case <-time.After(5 * time.Second):
+		t.Fatal("change was not noticed")
+	}
+	assert.Equal(t, "chamber: secrets changed, restarting command:\n  ~ app/db_password: version 1 -> 2\n", out.String())
+	assert.NotContains(t, out.String(), "hunter")
+}
+
+func TestWatchEvents(t *testing.T) {
+	created := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	before := map[string]store.SecretMetadata{
+		"app/a":     {Version: 1},
+		"app/b":     {Version: 3},
+		"team/db/c": {Version: 2},
+	}
+	after := map[string]store.SecretMetadata{
+		"app/a": {Version: 1},
+		"app/b": {Version: 4, Created: created, CreatedBy: "alice"},
+		"app/d": {Version: 1, Created: created, CreatedBy: "bob"},
+	}
+
+	assert.Equal(t, []watchEvent{
+		{Event: WatchUpdated, Service: "app", Key: "b", Version: 4, Modified: &created, User: "alice"},
+		{Event: WatchCreated, Service: "app", Key: "d", Version: 1, Modified: &created, User: "bob"},
+		{Event: WatchDeleted, Service: "team/db", Key: "c", Version: 2},
+	}, watchEvents(before, after))
+	assert.Empty(t, watchEvents(before, before))
+}
+
+func TestStreamChanges(t *testing.T) {
+	s := store.NewMemoryStore()
+	s.Write(store.SecretId{Service: "app", Key: "db_password"}, "hunter22")
+
+	initial, err := secretMetadata(s, []string{"app"})
+	assert.NoError(t, err)
+
+	r, w := io.Pipe()
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- streamChanges(s, []string{"app"}, initial, time.Millisecond, w, io.Discard, stop, nil, 0)
+	}()
+	s.Write(store.SecretId{Service: "app", Key: "db_password"}, "hunter23")
+
+	line, err := bufio.NewReader(r).ReadString('\n')
+	assert.NoError(t, err)
+	var event watchEvent
+	assert.NoError(t, json.Unmarshal([]byte(line), &event))
+	assert.Equal(t, WatchUpdated, event.Event)
+	assert.Equal(t, "db_password", event.Key)
+	assert.Equal(t, 2, event.Version)
+	assert.NotContains(t, line, "hunter")
+
+	close(stop)
+	go io.Copy(io.Discard, r)
+	assert.NoError(t, <-done)
+}
+
+func TestWatchTrigger(t *testing.T) {
+	delay := watchRetryDelay
+	watchRetryDelay = time.Millisecond
+	defer func() { watchRetryDelay = delay }()
+
+	var mu sync.Mutex
+	var posted []watchNotification
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		var n watchNotification
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&n))
+		posted = append(posted, n)
+	}))
+	defer server.Close()
+
+	trigger := &watchTrigger{webhook: server.URL, client: server.Client(), retries: 2}
+	eventsFile := filepath.Join(t.TempDir(), "events")
+	if runtime.GOOS != "windows" {
+		trigger.command = "printf %s \"$" + WatchEventsEnvVar + "\" > " + eventsFile
+	}
+
+	s := store.NewMemoryStore()
+	s.Write(store.SecretId{Service: "app", Key: "db_password"}, "hunter22")
+	initial, err := secretMetadata(s, []string{"app"})
+	assert.NoError(t, err)
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- streamChanges(s, []string{"app"}, initial, time.Millisecond, io.Discard, io.Discard, stop, trigger, 200*time.Millisecond)
+	}()
+	s.Write(store.SecretId{Service: "app", Key: "db_password"}, "hunter23")
+	time.Sleep(10 * time.Millisecond)
+	s.Write(store.SecretId{Service: "app", Key: "api_key"}, "abc")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(posted)
+		mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+	assert.NoError(t, <-done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, posted, 1)
+	assert.Equal(t, 2, calls)
+	assert.Len(t, posted[0].Events, 2)
+	assert.Contains(t, posted[0].Text, "updated app/db_password at version 2")
+	if trigger.command != "" {
+		data, err := os.ReadFile(eventsFile)
+		require.NoError(t, err)
+		var events []watchEvent
+		require.NoError(t, json.Unmarshal(data, &events))
+		assert.Equal(t, posted[0].Events, events)
+	}
+}
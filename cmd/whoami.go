@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	analytics "github.com/segmentio/analytics-go/v3"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// whoamiCmd represents the whoami command
+	whoamiCmd = &cobra.Command{
+		Use:   "whoami",
+		Short: "Print the AWS identity and configuration chamber resolves",
+		Long: `Print the AWS identity and configuration chamber resolves: the caller
+identity, the region and where it came from, the backend, the KMS key, the
+retries and any endpoint overrides. With --output json or yaml, it prints
+them structured.`,
+		Example: `
+	$ chamber whoami
+	account       123456789012
+	arn           arn:aws:sts::123456789012:assumed-role/developer/alice
+	user id       AROAEXAMPLE:alice
+	profile       dev
+	region        us-east-1 (CHAMBER_AWS_REGION)
+	backend       ssm
+	kms key       alias/parameter_store_key
+	retries       10, at least 500ms after throttling
+	ssm endpoint  https://ssm.internal:443`,
+		Args: cobra.NoArgs,
+		RunE: runWhoami,
+	}
+)
+
+func init() {
+	RootCmd.AddCommand(whoamiCmd)
+}
+
+// whoamiInfo is what whoami prints
+type whoamiInfo struct {
+	Account          string `json:"account,omitempty" yaml:"account,omitempty"`
+	Arn              string `json:"arn,omitempty" yaml:"arn,omitempty"`
+	UserID           string `json:"user_id,omitempty" yaml:"user_id,omitempty"`
+	IdentityError    string `json:"identity_error,omitempty" yaml:"identity_error,omitempty"`
+	Profile          string `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Region           string `json:"region" yaml:"region"`
+	RegionSource     string `json:"region_source" yaml:"region_source"`
+	Backend          string `json:"backend" yaml:"backend"`
+	KMSKey           string `json:"kms_key,omitempty" yaml:"kms_key,omitempty"`
+	Bucket           string `json:"bucket,omitempty" yaml:"bucket,omitempty"`
+	Prefix           string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	Retries          int    `json:"retries" yaml:"retries"`
+	MinThrottleDelay string `json:"min_throttle_delay,omitempty" yaml:"min_throttle_delay,omitempty"`
+	SSMEndpoint      string `json:"ssm_endpoint,omitempty" yaml:"ssm_endpoint,omitempty"`
+	HTTPSProxy       string `json:"https_proxy,omitempty" yaml:"https_proxy,omitempty"`
+	CABundle         string `json:"ca_bundle,omitempty" yaml:"ca_bundle,omitempty"`
+}
+
+func runWhoami(cmd *cobra.Command, args []string) error {
+	structured, err := structuredOutput()
+	if err != nil {
+		return err
+	}
+	if _, err := getSecretStore(); err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "whoami").
+				Set("chamber-version", chamberVersion).
+				Set("backend", backend),
+		})
+	}
+
+	info := resolveWhoami()
+	var identityErr error
+	if backend != NullBackend {
+		clients, err := newAWSClients()
+		if err != nil {
+			return fmt.Errorf("Failed to create AWS session: %w", err)
+		}
+		info.Region = clients.region
+		identityErr = resolveIdentity(&info, clients.sts)
+	}
+
+	if structured {
+		err = writeStructured(os.Stdout, info)
+	} else {
+		err = writeWhoami(os.Stdout, info)
+	}
+	if err != nil {
+		return err
+	}
+	return identityErr
+}
+
+// resolveWhoami returns the configuration chamber resolves from its flags
+// and the environment
+func resolveWhoami() whoamiInfo {
+	info := whoamiInfo{
+		Profile:      os.Getenv("AWS_PROFILE"),
+		RegionSource: whoamiRegionSource(),
+		Backend:      strings.ToLower(backend),
+		KMSKey:       doctorKMSKey(),
+		Retries:      numRetries,
+		SSMEndpoint:  os.Getenv(store.CustomSSMEndpointEnvVar),
+		HTTPSProxy:   httpsProxy(),
+		CABundle:     caBundle(),
+	}
+	switch backend {
+	case SSMBackend:
+		info.Prefix = os.Getenv(store.PrefixEnvVar)
+		info.MinThrottleDelay = minThrottleDelay.String()
+	case S3Backend, S3KMSBackend:
+		info.Bucket = backendS3Bucket()
+	}
+	return info
+}
+
+// whoamiRegionSource returns where the region comes from, following the
+// order the AWS session looks in
+func whoamiRegionSource() string {
+	for _, name := range []string{store.RegionEnvVar, "AWS_REGION"} {
+		if _, ok := os.LookupEnv(name); ok {
+			return name
+		}
+	}
+	return "AWS config or instance metadata"
+}
+
+// resolveIdentity fills in the caller identity, recording why it couldn't
+// be found if it can't
+func resolveIdentity(info *whoamiInfo, svc callerSTS) error {
+	identity, err := svc.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		info.IdentityError = err.Error()
+		return fmt.Errorf("Failed to get caller identity: %w", err)
+	}
+	info.Account = aws.StringValue(identity.Account)
+	info.Arn = aws.StringValue(identity.Arn)
+	info.UserID = aws.StringValue(identity.UserId)
+	return nil
+}
+
+// writeWhoami writes info as a table of the fields that are set
+func writeWhoami(w io.Writer, info whoamiInfo) error {
+	region := info.Region
+	if region == "" {
+		region = "none"
+	}
+	retries := fmt.Sprintf("%d", info.Retries)
+	if info.MinThrottleDelay != "" {
+		retries += fmt.Sprintf(", at least %s after throttling", info.MinThrottleDelay)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, '\t', 0)
+	for _, row := range [][2]string{
+		{"account", info.Account},
+		{"arn", info.Arn},
+		{"user id", info.UserID},
+		{"identity error", info.IdentityError},
+		{"profile", info.Profile},
+		{"region", fmt.Sprintf("%s (%s)", region, info.RegionSource)},
+		{"backend", info.Backend},
+		{"kms key", info.KMSKey},
+		{"bucket", info.Bucket},
+		{"prefix", info.Prefix},
+		{"retries", retries},
+		{"ssm endpoint", info.SSMEndpoint},
+		{"https proxy", info.HTTPSProxy},
+		{"ca bundle", info.CABundle},
+	} {
+		if row[1] != "" {
+			fmt.Fprintf(tw, "%s\t%s\n", row[0], row[1])
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveIdentity(t *testing.T) {
+	var info whoamiInfo
+	require.NoError(t, resolveIdentity(&info, &fakeSTS{arn: "arn:aws:iam::123456789012:user/alice"}))
+	assert.Equal(t, "arn:aws:iam::123456789012:user/alice", info.Arn)
+	assert.Empty(t, info.IdentityError)
+
+	info = whoamiInfo{}
+	assert.Error(t, resolveIdentity(&info, &fakeSTS{err: errors.New("NoCredentialProviders: no valid providers in chain")}))
+	assert.Equal(t, "NoCredentialProviders: no valid providers in chain", info.IdentityError)
+	assert.Empty(t, info.Arn)
+}
+
+func TestWhoamiRegionSource(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-west-2")
+	assert.Equal(t, "AWS_REGION", whoamiRegionSource())
+	t.Setenv(store.RegionEnvVar, "us-east-1")
+	assert.Equal(t, store.RegionEnvVar, whoamiRegionSource())
+}
+
+func TestWriteWhoami(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, writeWhoami(&b, whoamiInfo{
+		Arn:              "arn:aws:iam::123456789012:user/alice",
+		Region:           "us-east-1",
+		RegionSource:     "AWS_REGION",
+		Backend:          "ssm",
+		Retries:          10,
+		MinThrottleDelay: "500ms",
+	}))
+	assert.Equal(t, "arn\t\tarn:aws:iam::123456789012:user/alice\nregion\t\tus-east-1 (AWS_REGION)\nbackend\t\tssm\nretries\t\t10, at least 500ms after throttling\n", b.String())
+}
@@ -2,10 +2,15 @@ package cmd
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	analytics "github.com/segmentio/analytics-go/v3"
 	"github.com/segmentio/chamber/v2/store"
@@ -13,22 +18,118 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// RejectPlaceholdersEnvVar opts in to refusing writes of well-known
+// placeholder values
+const RejectPlaceholdersEnvVar = "CHAMBER_REJECT_PLACEHOLDERS"
+
+// DescriptionTagKey is the tag holding the description given with
+// write --description
+const DescriptionTagKey = "chamber:description"
+
+// The types of values write can write
+const (
+	TypeSecureString = "securestring"
+	TypeStringList   = "stringlist"
+)
+
+// placeholderValues are values that are obviously not real secrets. They are
+// compared case-insensitively after trimming surrounding whitespace.
+var placeholderValues = []string{
+	"changeme",
+	"change_me",
+	"change-me",
+	"todo",
+	"tbd",
+	"fixme",
+	"placeholder",
+	strictValueDefault,
+}
+
 var (
-	singleline    bool
-	skipUnchanged bool
+	singleline       bool
+	skipUnchanged    bool
+	allowPlaceholder bool
+	writeTTL         time.Duration
+	writeCompress    bool
+	stdinPairs       bool
+	writeFromFile    string
+	writeDescription string
+	writeTagFlags    []string
+	writeIfNotExists bool
+	writeExpectedVer int
+	writeKMSKey      string
+	writeExpires     string
+	writeNotify      string
+	writeType        string
+	writeValidate    string
+	writePrompt      bool
+
+	// writePolicies are the policies of --expires and --notify-no-change;
+	// the expiry of --ttl is added as each secret is written
+	writePolicies store.WritePolicies
+
+	// writeTags are the tags of --tag and --description, written along with
+	// every value
+	writeTags map[string]string
 
 	// writeCmd represents the write command
 	writeCmd = &cobra.Command{
 		Use:   "write <service> <key> [--] <value|->",
 		Short: "write a secret",
-		Args:  cobra.ExactArgs(3),
-		RunE:  write,
+		Long: `Write a secret.
+
+The value can also be read from standard input by giving - as the value, or
+from a file with --from-file instead of a value, e.g. for PEM keys or JSON
+documents spanning several lines. Both are stored exactly as read, trailing
+newlines included.
+
+With --stdin-pairs, only the service is given, and any number of secrets are
+read from standard input, one per line, either as key=value or as a JSON
+object of keys and values, which can hold values spanning several lines.
+Blank lines and lines starting with # are ignored. Every line is checked
+before anything is written, and secrets are then written one at a time
+through a single session, pausing for longer while the backend throttles
+writes.
+
+With --prompt, the value is typed on the terminal, without echo, and typed
+again to confirm it, so that it lands in neither the shell history nor the
+arguments other processes can see.`,
+		Example: `
+	$ chamber write app db_password hunter22
+	$ chamber write app tls_key --from-file server.key
+	$ chamber write app db_password --prompt
+	$ printf 'db_user=app\ndb_password=hunter22\n{"tls_key": "-----BEGIN KEY-----\\n..."}\n' | chamber write app --stdin-pairs`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if stdinPairs {
+				return cobra.ExactArgs(1)(cmd, args)
+			}
+			if writeFromFile != "" || writePrompt {
+				return cobra.ExactArgs(2)(cmd, args)
+			}
+			return cobra.ExactArgs(3)(cmd, args)
+		},
+		RunE: write,
 	}
 )
 
 func init() {
 	writeCmd.Flags().BoolVarP(&singleline, "singleline", "s", false, "Insert single line parameter (end with \\n)")
 	writeCmd.Flags().BoolVarP(&skipUnchanged, "skip-unchanged", "", false, "Skip writing secret if value is unchanged")
+	writeCmd.Flags().BoolVar(&allowPlaceholder, "allow-placeholder", false, "Allow writing placeholder values such as 'changeme' when $"+RejectPlaceholdersEnvVar+" is set")
+	writeCmd.Flags().DurationVar(&writeTTL, "ttl", 0, "delete the secret automatically once this long has passed, e.g. 2h; requires the SSM backend and uses the billed advanced parameter tier")
+	writeCmd.Flags().StringVar(&writeExpires, "expires", "", "delete the secret automatically at this time, e.g. 2025-12-31T00:00:00Z; requires the SSM backend and uses the billed advanced parameter tier")
+	writeCmd.Flags().StringVar(&writeNotify, "notify-no-change", "", "have the backend notify, through EventBridge, once the secret has gone unchanged this long, e.g. 30d or 12h; requires the SSM backend and uses the billed advanced parameter tier")
+	writeCmd.Flags().StringVar(&writeType, "type", TypeSecureString, "type of the value: securestring, or stringlist for a comma separated list, which the SSM backend stores unencrypted as a StringList parameter")
+	writeCmd.Flags().BoolVar(&writeCompress, "compress", false, "gzip the value, so that larger values fit within the size limits of the backend, as values too large for it are anyway; every command reading it decompresses it")
+	writeCmd.Flags().StringVar(&writeValidate, "validate", "", "refuse to write values that don't match their key in this JSON Schema file, as checked by chamber validate --schema")
+	writeCmd.Flags().BoolVar(&stdinPairs, "stdin-pairs", false, "read secrets to write from standard input, one per line as key=value or a JSON object, instead of a key and value")
+	writeCmd.Flags().StringVar(&writeFromFile, "from-file", "", "read the value from this file, exactly as it is, instead of giving it as an argument; - reads standard input")
+	writeCmd.Flags().BoolVar(&writePrompt, "prompt", false, "type the value on the terminal, without echo and twice to confirm it, instead of giving it as an argument")
+	writeCmd.Flags().BoolVar(&writeIfNotExists, "if-not-exists", false, "fail if the key already exists, rather than overwriting it; atomic on the SSM backend, and a best-effort check right before writing on others")
+	writeCmd.Flags().IntVar(&writeExpectedVer, "expected-version", 0, "fail unless the current version of the key is this one, so that changes made since it was read aren't overwritten; a best-effort check right before writing")
+	writeCmd.Flags().StringVar(&writeKMSKey, "kms-key", "", "KMS key alias, ID or ARN to encrypt the secret with, rather than the one $"+KMSKeysEnvVar+" maps the service to, or $"+KMSKeyEnvVar)
+	writeCmd.Flags().StringVar(&writeDescription, "description", "", "describe the secret; stored as the "+DescriptionTagKey+" tag, and shown by list --with-tags")
+	writeCmd.Flags().StringArrayVar(&writeTagFlags, "tag", nil, "tag the secret, as key=value, e.g. for cost allocation or ownership; may be repeated")
 	RootCmd.AddCommand(writeCmd)
 }
 
@@ -38,11 +139,49 @@ func write(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("Failed to validate service: %w", err)
 	}
 
+	var err error
+	if writeTags, err = parseTagFlags(writeTagFlags); err != nil {
+		return err
+	}
+	if writeDescription != "" {
+		writeTags[DescriptionTagKey] = writeDescription
+	}
+
+	if writeIfNotExists && writeExpectedVer != 0 {
+		return errors.New("--if-not-exists and --expected-version are mutually exclusive")
+	}
+	if writeExpectedVer < 0 {
+		return errors.New("--expected-version must be positive")
+	}
+	if writePrompt && writeFromFile != "" {
+		return errors.New("--prompt and --from-file are mutually exclusive")
+	}
+
+	if stdinPairs {
+		if writeFromFile != "" {
+			return errors.New("--from-file cannot be used with --stdin-pairs")
+		}
+		if writePrompt {
+			return errors.New("--prompt cannot be used with --stdin-pairs")
+		}
+		if writeExpectedVer != 0 {
+			return errors.New("--expected-version cannot be used with --stdin-pairs")
+		}
+		return writeStdinPairs(service)
+	}
+
 	key := utils.NormalizeKey(args[1])
 	if err := validateKey(key); err != nil {
 		return fmt.Errorf("Failed to validate key: %w", err)
 	}
 
+	if writePolicies, err = parseWritePolicies(writeTTL, writeExpires, writeNotify, time.Now()); err != nil {
+		return err
+	}
+	if err := validateWriteType(writeType); err != nil {
+		return err
+	}
+
 	if analyticsEnabled && analyticsClient != nil {
 		analyticsClient.Enqueue(analytics.Track{
 			UserId: username,
@@ -56,41 +195,506 @@ func write(cmd *cobra.Command, args []string) error {
 		})
 	}
 
-	value := args[2]
-	if value == "-" {
-		// Read value from standard input
-		if singleline {
-			buf := bufio.NewReader(os.Stdin)
-			v, err := buf.ReadString('\n')
-			if err != nil {
-				return err
-			}
-			value = strings.TrimSuffix(v, "\n")
-		} else {
-			v, err := ioutil.ReadAll(os.Stdin)
-			if err != nil {
-				return err
-			}
-			value = string(v)
-		}
+	var value string
+	if writePrompt {
+		fd := int(os.Stdin.Fd())
+		value, err = promptValue(key, func() (string, error) { return readNoEcho(fd) }, os.Stderr)
+	} else {
+		value, err = readWriteValue(args, os.Stdin)
+	}
+	if err != nil {
+		return err
+	}
+
+	if rejectPlaceholders() && !allowPlaceholder && isPlaceholder(value) {
+		return fmt.Errorf("Refusing to write placeholder value for key '%s'; pass --allow-placeholder to write it anyway", key)
+	}
+	if err := checkWriteSchema(writeValidate, []secretPair{{Key: key, Value: value}}); err != nil {
+		return err
 	}
 
 	secretStore, err := getSecretStore()
 	if err != nil {
 		return fmt.Errorf("Failed to get secret store: %w", err)
 	}
+	if secretStore, err = withKMSKey(secretStore, service, writeKMSKey); err != nil {
+		return err
+	}
+	if len(writeTags) > 0 && !secretStore.Capabilities().Tags {
+		return fmt.Errorf("The %s backend does not support tags, so --tag and --description cannot be used", backend)
+	}
 
 	secretId := store.SecretId{
 		Service: service,
 		Key:     key,
 	}
+	return writeValue(secretStore, secretId, value)
+}
+
+// writeValue writes value to secretId as set up by the flags of write
+func writeValue(secretStore store.Store, secretId store.SecretId, value string) error {
+	if creator, ok := store.Unwrap(secretStore).(store.Creator); ok && writeIfNotExists && writeType == TypeSecureString &&
+		writeTTL == 0 && writePolicies.IsZero() {
+		return createValue(secretStore, creator, secretId, value)
+	}
+	if err := checkWriteCondition(secretStore, secretId); err != nil {
+		return err
+	}
 
+	var err error
 	if skipUnchanged {
+		// compare values as they are read, whether or not either is compressed
 		currentSecret, err := secretStore.Read(secretId, -1)
 		if err == nil && value == *currentSecret.Value {
-			return nil
+			return writeValueTags(secretStore, secretId)
+		}
+	}
+
+	if writeType == TypeStringList {
+		listStore, ok := store.Unwrap(secretStore).(store.StringListStore)
+		if !ok {
+			return fmt.Errorf("The %s backend does not support --type %s", backend, TypeStringList)
+		}
+		if err := listStore.WriteStringList(secretId, strings.Split(value, ",")); err != nil {
+			return err
 		}
+		return writeValueTags(secretStore, secretId)
 	}
 
-	return secretStore.Write(secretId, value)
+	if writeCompress {
+		if value, err = store.CompressValue(value); err != nil {
+			return fmt.Errorf("Failed to compress value: %w", err)
+		}
+	}
+
+	policies := writePolicies
+	if writeTTL > 0 {
+		policies.Expires = time.Now().Add(writeTTL)
+	}
+	if policies.IsZero() {
+		err = secretStore.Write(secretId, value)
+	} else {
+		policyStore, ok := store.Unwrap(secretStore).(store.PolicyStore)
+		if !ok {
+			flag := "--ttl"
+			if policies.NotifyNoChange > 0 {
+				flag = "--notify-no-change"
+			}
+			return fmt.Errorf("The %s backend does not support %s", backend, flag)
+		}
+		err = policyStore.WriteWithPolicies(secretId, value, policies)
+	}
+	if err != nil {
+		return err
+	}
+	if !policies.Expires.IsZero() {
+		fmt.Fprintf(os.Stderr, "%s/%s expires at %s\n", secretId.Service, secretId.Key, policies.Expires.Local().Format(ShortTimeFormat))
+	}
+	return writeValueTags(secretStore, secretId)
+}
+
+// checkWriteSchema checks the values of pairs against the schema file of
+// --validate, if one is given
+func checkWriteSchema(path string, pairs []secretPair) error {
+	if path == "" {
+		return nil
+	}
+	schema, err := readSecretSchema(path)
+	if err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		if problem := checkSchemaValue(schema, pair.Key, pair.Value); problem != "" {
+			return fmt.Errorf("Refusing to write key '%s': %s, according to %s", pair.Key, problem, path)
+		}
+	}
+	return nil
+}
+
+// validateWriteType checks --type, and that lists aren't written with options
+// they don't support
+func validateWriteType(typ string) error {
+	switch typ {
+	case TypeSecureString:
+		return nil
+	case TypeStringList:
+		if writeCompress || writeTTL != 0 || !writePolicies.IsZero() {
+			return fmt.Errorf("--type %s cannot be used with --compress, --ttl, --expires or --notify-no-change", TypeStringList)
+		}
+		return nil
+	default:
+		return fmt.Errorf("Invalid --type %q: must be %s or %s", typ, TypeSecureString, TypeStringList)
+	}
+}
+
+// parseWritePolicies checks --ttl, and parses --expires and
+// --notify-no-change. The period of --notify-no-change is a number of days,
+// like 30d, or a duration of whole hours, like 12h.
+func parseWritePolicies(ttl time.Duration, expires, notify string, now time.Time) (store.WritePolicies, error) {
+	var policies store.WritePolicies
+	if ttl < 0 {
+		return policies, errors.New("--ttl must be positive")
+	}
+	if expires != "" {
+		if ttl > 0 {
+			return policies, errors.New("--ttl and --expires are mutually exclusive")
+		}
+		t, err := time.Parse(time.RFC3339, expires)
+		if err != nil {
+			return policies, fmt.Errorf("Invalid --expires %q: must be a time like 2025-12-31T00:00:00Z", expires)
+		}
+		if !t.After(now) {
+			return policies, fmt.Errorf("Invalid --expires %q: must be in the future", expires)
+		}
+		policies.Expires = t
+	}
+	if notify != "" {
+		var period time.Duration
+		if strings.HasSuffix(notify, "d") {
+			n, err := strconv.Atoi(strings.TrimSuffix(notify, "d"))
+			if err != nil {
+				return policies, fmt.Errorf("Invalid --notify-no-change %q: must be a number of days like 30d, or of hours like 12h", notify)
+			}
+			period = time.Duration(n) * 24 * time.Hour
+		} else {
+			var err error
+			if period, err = time.ParseDuration(notify); err != nil {
+				return policies, fmt.Errorf("Invalid --notify-no-change %q: must be a number of days like 30d, or of hours like 12h", notify)
+			}
+		}
+		if period <= 0 || period%time.Hour != 0 {
+			return policies, fmt.Errorf("Invalid --notify-no-change %q: must be a positive number of days or hours", notify)
+		}
+		policies.NotifyNoChange = period
+	}
+	return policies, nil
+}
+
+// createValue writes value to secretId with --if-not-exists on a backend
+// that checks whether the secret exists as it writes it
+func createValue(secretStore store.Store, creator store.Creator, secretId store.SecretId, value string) error {
+	// compressed as writing through secretStore would
+	if max := secretStore.Capabilities().MaxValueSize; writeCompress || (max > 0 && len(value) > max) {
+		var err error
+		if value, err = store.CompressValue(value); err != nil {
+			return fmt.Errorf("Failed to compress value: %w", err)
+		}
+	}
+	err := creator.Create(secretId, value)
+	if errors.Is(err, store.ErrSecretExists) {
+		return fmt.Errorf("%s/%s already exists", secretId.Service, secretId.Key)
+	}
+	if err != nil {
+		return err
+	}
+	return writeValueTags(secretStore, secretId)
+}
+
+// checkWriteCondition enforces --if-not-exists and --expected-version. Other
+// than for --if-not-exists on SSM, the backends can't compare and set
+// atomically, so the current version is checked right before writing, and a
+// change made in between is overwritten.
+func checkWriteCondition(secretStore store.Store, secretId store.SecretId) error {
+	if !writeIfNotExists && writeExpectedVer == 0 {
+		return nil
+	}
+	current, err := secretStore.Read(secretId, -1)
+	exists := err == nil
+	if err != nil && !errors.Is(err, store.ErrSecretNotFound) {
+		return fmt.Errorf("Failed to read current version: %w", err)
+	}
+
+	switch {
+	case writeIfNotExists && exists:
+		return fmt.Errorf("%s/%s already exists, at version %d", secretId.Service, secretId.Key, current.Meta.Version)
+	case writeExpectedVer != 0 && !exists:
+		return fmt.Errorf("%s/%s doesn't exist, rather than being at version %d", secretId.Service, secretId.Key, writeExpectedVer)
+	case writeExpectedVer != 0 && current.Meta.Version != writeExpectedVer:
+		return fmt.Errorf("%s/%s is at version %d, not %d; it was changed by %s at %s",
+			secretId.Service, secretId.Key, current.Meta.Version, writeExpectedVer,
+			current.Meta.CreatedBy, current.Meta.Created.Local().Format(ShortTimeFormat))
+	}
+	return nil
+}
+
+// writeValueTags tags a secret just written with the tags of --tag and
+// --description
+func writeValueTags(secretStore store.Store, secretId store.SecretId) error {
+	if len(writeTags) == 0 {
+		return nil
+	}
+	if err := secretStore.WriteTags(secretId, writeTags); err != nil {
+		return fmt.Errorf("Failed to tag %s: %w", secretId.Key, err)
+	}
+	return nil
+}
+
+// parseTagFlags parses key=value tags. A tag given twice is an error.
+func parseTagFlags(flags []string) (map[string]string, error) {
+	tags := make(map[string]string, len(flags))
+	for _, flag := range flags {
+		k, v, ok := strings.Cut(flag, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("Invalid tag %q: must be key=value", flag)
+		}
+		if k == DescriptionTagKey {
+			return nil, fmt.Errorf("Invalid tag %q: use --description to set %s", flag, DescriptionTagKey)
+		}
+		if _, ok := tags[k]; ok {
+			return nil, fmt.Errorf("Tag %s is given more than once", k)
+		}
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+func writeStdinPairs(service string) error {
+	var err error
+	if writePolicies, err = parseWritePolicies(writeTTL, writeExpires, writeNotify, time.Now()); err != nil {
+		return err
+	}
+	if err := validateWriteType(writeType); err != nil {
+		return err
+	}
+
+	pairs, err := parseStdinPairs(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("Failed to read secrets from standard input: %w", err)
+	}
+	if rejectPlaceholders() && !allowPlaceholder {
+		for _, pair := range pairs {
+			if isPlaceholder(pair.Value) {
+				return fmt.Errorf("Refusing to write placeholder value for key '%s'; pass --allow-placeholder to write it anyway", pair.Key)
+			}
+		}
+	}
+	if err := checkWriteSchema(writeValidate, pairs); err != nil {
+		return err
+	}
+
+	if analyticsEnabled && analyticsClient != nil {
+		analyticsClient.Enqueue(analytics.Track{
+			UserId: username,
+			Event:  "Ran Command",
+			Properties: analytics.NewProperties().
+				Set("command", "write").
+				Set("chamber-version", chamberVersion).
+				Set("service", service).
+				Set("backend", backend).
+				Set("keys", len(pairs)),
+		})
+	}
+
+	secretStore, err := getSecretStore()
+	if err != nil {
+		return fmt.Errorf("Failed to get secret store: %w", err)
+	}
+	if secretStore, err = withKMSKey(secretStore, service, writeKMSKey); err != nil {
+		return err
+	}
+	if len(writeTags) > 0 && !secretStore.Capabilities().Tags {
+		return fmt.Errorf("The %s backend does not support tags, so --tag and --description cannot be used", backend)
+	}
+
+	written, err := writePairs(secretStore, service, pairs)
+	fmt.Fprintf(os.Stderr, "Wrote %d of %d secrets\n", written, len(pairs))
+	return err
+}
+
+// secretPair is a key and the value to write to it
+type secretPair struct {
+	Key   string
+	Value string
+}
+
+// parseStdinPairs parses key=value lines and lines holding JSON objects of
+// keys and values, normalizing and validating keys. A key given twice is an
+// error, rather than silently writing only one of its values.
+func parseStdinPairs(r io.Reader) ([]secretPair, error) {
+	var pairs []secretPair
+	seen := map[string]int{}
+	add := func(lineNo int, k, v string) error {
+		k = utils.NormalizeKey(k)
+		if err := validateKey(k); err != nil {
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if previous, ok := seen[k]; ok {
+			return fmt.Errorf("line %d: key %s was already given on line %d", lineNo, k, previous)
+		}
+		seen[k] = lineNo
+		pairs = append(pairs, secretPair{Key: k, Value: v})
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	// values up to the largest the backends accept
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			continue
+		case strings.HasPrefix(trimmed, "{"):
+			var object map[string]string
+			if err := json.Unmarshal([]byte(trimmed), &object); err != nil {
+				return nil, fmt.Errorf("line %d: must be a JSON object of string values: %w", lineNo, err)
+			}
+			for _, k := range sortedKeys(object) {
+				if err := add(lineNo, k, object[k]); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			k, v, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: must be key=value or a JSON object", lineNo)
+			}
+			if err := add(lineNo, strings.TrimSpace(k), v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		return nil, errors.New("no secrets given")
+	}
+	return pairs, nil
+}
+
+// writePairs writes pairs to service one at a time, pausing for longer each
+// time the backend throttles a write, and stops at the first failure. It
+// returns how many secrets were written.
+func writePairs(secretStore store.Store, service string, pairs []secretPair) (int, error) {
+	pause := newThrottlePause()
+	for i, pair := range pairs {
+		err := retryThrottled(pause, func() error {
+			return writeValue(secretStore, store.SecretId{Service: service, Key: pair.Key}, pair.Value)
+		})
+		if err != nil {
+			return i, fmt.Errorf("Failed to write secrets: %s: %w", pair.Key, err)
+		}
+	}
+	return len(pairs), nil
+}
+
+// readWriteValue returns the value to write: the last argument, standard
+// input for -, or the file given with --from-file. Values read are kept
+// exactly as they are, unless --singleline is set for standard input.
+func readWriteValue(args []string, stdin io.Reader) (string, error) {
+	source := writeFromFile
+	if source == "" {
+		if args[2] != "-" {
+			return args[2], nil
+		}
+		source = "-"
+	}
+
+	if source != "-" {
+		v, err := os.ReadFile(source)
+		if err != nil {
+			return "", fmt.Errorf("Failed to read value: %w", err)
+		}
+		return string(v), nil
+	}
+
+	// Read value from standard input
+	if singleline {
+		buf := bufio.NewReader(stdin)
+		v, err := buf.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(v, "\n"), nil
+	}
+	v, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		return "", err
+	}
+	return string(v), nil
+}
+
+// promptValue asks for the value of key, reading it with readLine, then
+// asks for it again to confirm it
+func promptValue(key string, readLine func() (string, error), prompt io.Writer) (string, error) {
+	fmt.Fprintf(prompt, "Value for %s: ", key)
+	value, err := readLine()
+	fmt.Fprintln(prompt)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read value; --prompt needs a terminal: %w", err)
+	}
+	if value == "" {
+		return "", errors.New("No value entered")
+	}
+	fmt.Fprintf(prompt, "Confirm value for %s: ", key)
+	confirmation, err := readLine()
+	fmt.Fprintln(prompt)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read value; --prompt needs a terminal: %w", err)
+	}
+	if confirmation != value {
+		return "", errors.New("Values don't match")
+	}
+	return value, nil
+}
+
+// readTerminalLine reads a line from r a byte at a time, without the line
+// ending, so that nothing past it is read
+func readTerminalLine(r io.Reader) (string, error) {
+	var line []byte
+	var b [1]byte
+	for {
+		n, err := r.Read(b[:])
+		if n == 1 {
+			switch b[0] {
+			case '\n':
+				return strings.TrimSuffix(string(line), "\r"), nil
+			case 0x7f, 0x08:
+				if len(line) > 0 {
+					line = line[:len(line)-1]
+				}
+			default:
+				line = append(line, b[0])
+			}
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			return string(line), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// rejectPlaceholders reports whether placeholder checking has been enabled
+// through the environment.
+func rejectPlaceholders() bool {
+	v, ok := os.LookupEnv(RejectPlaceholdersEnvVar)
+	if !ok {
+		return false
+	}
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		// any non-boolean value is treated as opting in
+		return v != ""
+	}
+	return enabled
+}
+
+// isPlaceholder reports whether value is one of the well-known placeholder
+// values that should never reach a real environment.
+func isPlaceholder(value string) bool {
+	v := strings.ToLower(strings.TrimSpace(value))
+	for _, p := range placeholderValues {
+		if v == p {
+			return true
+		}
+	}
+	return false
 }
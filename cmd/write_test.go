@@ -0,0 +1,359 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/segmentio/chamber/v2/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPlaceholder(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{value: "changeme", expected: true},
+		{value: "  ChangeMe\n", expected: true},
+		{value: "TODO", expected: true},
+		{value: "chamberme", expected: true},
+		{value: "hunter22", expected: false},
+		{value: "", expected: false},
+		{value: "todo-list-api-key", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isPlaceholder(tt.value))
+		})
+	}
+}
+
+func TestRejectPlaceholders(t *testing.T) {
+	os.Unsetenv(RejectPlaceholdersEnvVar)
+	assert.False(t, rejectPlaceholders())
+
+	os.Setenv(RejectPlaceholdersEnvVar, "true")
+	assert.True(t, rejectPlaceholders())
+
+	os.Setenv(RejectPlaceholdersEnvVar, "0")
+	assert.False(t, rejectPlaceholders())
+
+	os.Setenv(RejectPlaceholdersEnvVar, "yes")
+	assert.True(t, rejectPlaceholders())
+
+	os.Unsetenv(RejectPlaceholdersEnvVar)
+}
+
+func TestParseStdinPairs(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []secretPair
+		err      string
+	}{
+		{
+			name:  "key=value lines",
+			input: "# database\nDB_User=app\n\ndb_password=hunter=22\r\n",
+			expected: []secretPair{
+				{Key: "db_user", Value: "app"},
+				{Key: "db_password", Value: "hunter=22"},
+			},
+		},
+		{
+			name:  "JSON lines",
+			input: `{"tls_key": "line one\nline two", "api_token": "abc"}` + "\nregion=us-east-1\n",
+			expected: []secretPair{
+				{Key: "api_token", Value: "abc"},
+				{Key: "tls_key", Value: "line one\nline two"},
+				{Key: "region", Value: "us-east-1"},
+			},
+		},
+		{name: "duplicate key", input: "a=1\n{\"A\": \"2\"}\n", err: "line 2: key a was already given on line 1"},
+		{name: "not a pair", input: "a=1\njust a value\n", err: "line 2: must be key=value"},
+		{name: "invalid JSON", input: `{"a": 1}`, err: "line 1: must be a JSON object of string values"},
+		{name: "empty", input: "# nothing\n", err: "no secrets given"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pairs, err := parseStdinPairs(strings.NewReader(tt.input))
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, pairs)
+		})
+	}
+}
+
+// failingWriteStore fails to write one key
+type failingWriteStore struct {
+	store.Store
+	failKey string
+}
+
+func (s failingWriteStore) Write(id store.SecretId, value string) error {
+	if id.Key == s.failKey {
+		return errors.New("throttled")
+	}
+	return s.Store.Write(id, value)
+}
+
+func TestWritePairs(t *testing.T) {
+	pairs := []secretPair{{"a", "1"}, {"b", "2"}, {"c", "3"}, {"d", "4"}, {"e", "5"}}
+
+	s := store.NewMemoryStore()
+	written, err := writePairs(s, "app", pairs)
+	require.NoError(t, err)
+	assert.Equal(t, 5, written)
+	secret, err := s.Read(store.SecretId{Service: "app", Key: "e"}, -1)
+	require.NoError(t, err)
+	assert.Equal(t, "5", *secret.Value)
+
+	// no secret after the failure is written
+	s = store.NewMemoryStore()
+	written, err = writePairs(failingWriteStore{Store: s, failKey: "c"}, "app", pairs)
+	assert.EqualError(t, err, "Failed to write secrets: c: throttled")
+	assert.Equal(t, 2, written)
+	_, err = s.Read(store.SecretId{Service: "app", Key: "d"}, -1)
+	assert.Error(t, err)
+
+	// throttled writes are retried after a pause
+	defer func(d time.Duration) { minThrottleDelay = d }(minThrottleDelay)
+	minThrottleDelay = time.Millisecond
+	throttling := &throttlingWriteStore{Store: store.NewMemoryStore(), throttles: 2}
+	written, err = writePairs(throttling, "app", pairs)
+	require.NoError(t, err)
+	assert.Equal(t, 5, written)
+	assert.Equal(t, 0, throttling.throttles)
+}
+
+// throttlingWriteStore throttles its first writes
+type throttlingWriteStore struct {
+	store.Store
+	throttles int
+}
+
+func (s *throttlingWriteStore) Write(id store.SecretId, value string) error {
+	if s.throttles > 0 {
+		s.throttles--
+		return awserr.New("ThrottlingException", "Rate exceeded", nil)
+	}
+	return s.Store.Write(id, value)
+}
+
+func TestReadWriteValue(t *testing.T) {
+	defer func() { writeFromFile, singleline = "", false }()
+	pem := "-----BEGIN KEY-----\nabc\n-----END KEY-----\n\n"
+	path := filepath.Join(t.TempDir(), "server.key")
+	require.NoError(t, os.WriteFile(path, []byte(pem), 0600))
+
+	value, err := readWriteValue([]string{"app", "key", "value"}, strings.NewReader("ignored"))
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+
+	value, err = readWriteValue([]string{"app", "key", "-"}, strings.NewReader(pem))
+	assert.NoError(t, err)
+	assert.Equal(t, pem, value, "standard input is kept exactly")
+
+	writeFromFile = path
+	value, err = readWriteValue([]string{"app", "key"}, strings.NewReader("ignored"))
+	assert.NoError(t, err)
+	assert.Equal(t, pem, value, "files are kept exactly")
+
+	writeFromFile = "-"
+	value, err = readWriteValue([]string{"app", "key"}, strings.NewReader(pem))
+	assert.NoError(t, err)
+	assert.Equal(t, pem, value)
+
+	singleline = true
+	value, err = readWriteValue([]string{"app", "key"}, strings.NewReader(pem))
+	assert.NoError(t, err)
+	assert.Equal(t, "-----BEGIN KEY-----", value)
+	singleline = false
+
+	writeFromFile = filepath.Join(t.TempDir(), "missing")
+	_, err = readWriteValue([]string{"app", "key"}, strings.NewReader(""))
+	assert.Error(t, err)
+}
+
+func TestPromptValue(t *testing.T) {
+	lines := func(typed ...string) func() (string, error) {
+		return func() (string, error) {
+			if len(typed) == 0 {
+				return "", errors.New("inappropriate ioctl for device")
+			}
+			line := typed[0]
+			typed = typed[1:]
+			return line, nil
+		}
+	}
+
+	var prompt strings.Builder
+	value, err := promptValue("db_password", lines("hunter22", "hunter22"), &prompt)
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter22", value)
+	assert.Equal(t, "Value for db_password: \nConfirm value for db_password: \n", prompt.String())
+
+	_, err = promptValue("db_password", lines("hunter22", "hunter23"), &strings.Builder{})
+	assert.EqualError(t, err, "Values don't match")
+	_, err = promptValue("db_password", lines(""), &strings.Builder{})
+	assert.EqualError(t, err, "No value entered")
+	_, err = promptValue("db_password", lines(), &strings.Builder{})
+	assert.ErrorContains(t, err, "needs a terminal")
+}
+
+func TestReadTerminalLine(t *testing.T) {
+	r := strings.NewReader("hunter22\r\nsecond\nlast")
+	for _, expected := range []string{"hunter22", "second", "last"} {
+		line, err := readTerminalLine(r)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, line)
+	}
+	_, err := readTerminalLine(r)
+	assert.Error(t, err)
+}
+
+func TestParseTagFlags(t *testing.T) {
+	tags, err := parseTagFlags([]string{"owner=payments", "cost-center=1234", "empty="})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"owner": "payments", "cost-center": "1234", "empty": ""}, tags)
+
+	for _, flags := range [][]string{
+		{"owner"},
+		{"=payments"},
+		{"owner=a", "owner=b"},
+		{DescriptionTagKey + "=x"},
+	} {
+		_, err := parseTagFlags(flags)
+		assert.Error(t, err, flags)
+	}
+}
+
+func TestWriteValueTags(t *testing.T) {
+	defer func() { writeTags, skipUnchanged = nil, false }()
+	s := store.NewMemoryStore()
+	id := store.SecretId{Service: "app", Key: "db_password"}
+
+	writeTags = map[string]string{"owner": "payments", DescriptionTagKey: "primary database"}
+	require.NoError(t, writeValue(s, id, "hunter2"))
+	tags, err := s.ReadTags(id)
+	require.NoError(t, err)
+	assert.Equal(t, writeTags, tags)
+
+	// tags are updated even when an unchanged value is skipped
+	skipUnchanged = true
+	writeTags = map[string]string{"owner": "identity"}
+	require.NoError(t, writeValue(s, id, "hunter2"))
+	tags, err = s.ReadTags(id)
+	require.NoError(t, err)
+	assert.Equal(t, "identity", tags["owner"])
+
+	description, others := formatTags(tags)
+	assert.Equal(t, "primary database", description)
+	assert.Equal(t, "owner=identity", others)
+}
+
+func TestCheckWriteCondition(t *testing.T) {
+	defer func() { writeIfNotExists, writeExpectedVer = false, 0 }()
+	s := store.NewMemoryStore()
+	id := store.SecretId{Service: "app", Key: "db_password"}
+
+	writeIfNotExists = true
+	require.NoError(t, writeValue(s, id, "hunter2"))
+	assert.Error(t, writeValue(s, id, "hunter3"))
+
+	writeIfNotExists, writeExpectedVer = false, 1
+	require.NoError(t, writeValue(s, id, "hunter3"))
+	// someone else's change is at version 2 now
+	err := writeValue(s, id, "hunter4")
+	assert.ErrorContains(t, err, "is at version 2, not 1")
+
+	current, err := s.Read(id, -1)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter3", *current.Value)
+
+	writeExpectedVer = 1
+	err = writeValue(s, store.SecretId{Service: "app", Key: "missing"}, "value")
+	assert.ErrorContains(t, err, "doesn't exist")
+}
+
+// creatingStore creates secrets atomically, recording those it created
+type creatingStore struct {
+	*store.MemoryStore
+	created []string
+}
+
+func (s *creatingStore) Create(id store.SecretId, value string) error {
+	if _, err := s.Read(id, -1); err == nil {
+		return store.ErrSecretExists
+	}
+	s.created = append(s.created, id.Key)
+	return s.Write(id, value)
+}
+
+func TestWriteValueCreates(t *testing.T) {
+	defer func() { writeIfNotExists = false }()
+	s := &creatingStore{MemoryStore: store.NewMemoryStore()}
+	id := store.SecretId{Service: "app", Key: "db_password"}
+
+	writeIfNotExists = true
+	require.NoError(t, writeValue(readableStore(s), id, "hunter2"))
+	err := writeValue(readableStore(s), id, "hunter3")
+	assert.EqualError(t, err, "app/db_password already exists")
+	assert.Equal(t, []string{"db_password"}, s.created)
+
+	current, err := s.Read(id, -1)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", *current.Value)
+}
+
+func TestParseWritePolicies(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	policies, err := parseWritePolicies(0, "2025-12-31T00:00:00Z", "30d", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC), policies.Expires)
+	assert.Equal(t, 30*24*time.Hour, policies.NotifyNoChange)
+
+	policies, err = parseWritePolicies(2*time.Hour, "", "12h", now)
+	require.NoError(t, err)
+	assert.True(t, policies.Expires.IsZero())
+	assert.Equal(t, 12*time.Hour, policies.NotifyNoChange)
+
+	for _, tc := range []struct {
+		ttl             time.Duration
+		expires, notify string
+	}{
+		{ttl: -time.Hour},
+		{ttl: time.Hour, expires: "2025-12-31T00:00:00Z"},
+		{expires: "2025-12-31"},
+		{expires: "2025-01-01T00:00:00Z"},
+		{notify: "30"},
+		{notify: "0d"},
+		{notify: "90m"},
+		{notify: "xd"},
+	} {
+		_, err := parseWritePolicies(tc.ttl, tc.expires, tc.notify, now)
+		assert.Error(t, err, tc)
+	}
+}
+
+func TestValidateWriteType(t *testing.T) {
+	defer func() { writeCompress = false }()
+	assert.NoError(t, validateWriteType(TypeSecureString))
+	assert.NoError(t, validateWriteType(TypeStringList))
+	assert.Error(t, validateWriteType("string"))
+
+	writeCompress = true
+	assert.Error(t, validateWriteType(TypeStringList))
+}
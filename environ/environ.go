@@ -1,7 +1,10 @@
 package environ
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/segmentio/chamber/v2/store"
@@ -133,13 +136,32 @@ func (e *Environ) LoadStrictNoPaths(s store.Store, valueExpected string, pristin
 	return e.loadStrict(s, valueExpected, pristine, true, services...)
 }
 
+// LoadStrictMatching is like LoadStrict, but substitutes env vars in e whose value matches expected,
+// for example to accept several sentinel values.
+func (e *Environ) LoadStrictMatching(s store.Store, expected *regexp.Regexp, pristine bool, services ...string) error {
+	return e.loadStrictMatching(s, expected, expected.String(), pristine, false, services...)
+}
+
+// LoadStrictMatchingNoPaths is identical to LoadStrictMatching, but uses v1-style "."-separated paths
+//
+// Deprecated like all noPaths functionality
+func (e *Environ) LoadStrictMatchingNoPaths(s store.Store, expected *regexp.Regexp, pristine bool, services ...string) error {
+	return e.loadStrictMatching(s, expected, expected.String(), pristine, true, services...)
+}
+
 func (e *Environ) loadStrict(s store.Store, valueExpected string, pristine bool, noPaths bool, services ...string) error {
+	return e.loadStrictMatching(s, exactly(valueExpected), valueExpected, pristine, noPaths, services...)
+}
+
+// loadStrictMatching loads services in strict mode, substituting env vars whose value matches expected.
+// valueExpected describes expected in errors.
+func (e *Environ) loadStrictMatching(s store.Store, expected *regexp.Regexp, valueExpected string, pristine bool, noPaths bool, services ...string) error {
 	for _, service := range services {
 		rawSecrets, err := s.ListRaw(utils.NormalizeService(service))
 		if err != nil {
 			return err
 		}
-		err = e.loadStrictOne(rawSecrets, valueExpected, pristine, noPaths)
+		err = e.loadStrictOneMatching(rawSecrets, expected, valueExpected, pristine, noPaths)
 		if err != nil {
 			return err
 		}
@@ -147,19 +169,38 @@ func (e *Environ) loadStrict(s store.Store, valueExpected string, pristine bool,
 	return nil
 }
 
+// exactly returns a regexp matching only value
+func exactly(value string) *regexp.Regexp {
+	return regexp.MustCompile("^" + regexp.QuoteMeta(value) + "$")
+}
+
 func (e *Environ) loadStrictOne(rawSecrets []store.RawSecret, valueExpected string, pristine bool, noPaths bool) error {
+	return e.loadStrictOneMatching(rawSecrets, exactly(valueExpected), valueExpected, pristine, noPaths)
+}
+
+func (e *Environ) loadStrictOneMatching(rawSecrets []store.RawSecret, expected *regexp.Regexp, valueExpected string, pristine bool, noPaths bool) error {
 	parentMap := e.Map()
+	parentKeys := make([]string, 0, len(parentMap))
+	for k := range parentMap {
+		parentKeys = append(parentKeys, k)
+	}
+	sort.Strings(parentKeys)
+
+	problems := []error{}
 	parentExpects := map[string]struct{}{}
-	for k, v := range parentMap {
-		if v == valueExpected {
+	for _, k := range parentKeys {
+		if expected.MatchString(parentMap[k]) {
 			if k != normalizeEnvVarName(k) {
-				return ErrExpectedKeyUnnormalized{Key: k, ValueExpected: valueExpected}
+				problems = append(problems, ErrExpectedKeyUnnormalized{Key: k, ValueExpected: valueExpected})
+				continue
 			}
 			// TODO: what if this key isn't chamber-compatible but could collide? MY_cool_var vs my-cool-var
 			parentExpects[k] = struct{}{}
 		}
 	}
 
+	unexpected := []ErrStoreUnexpectedValue{}
+	reported := map[string]struct{}{}
 	envVarKeysAdded := map[string]struct{}{}
 	for _, rawSecret := range rawSecrets {
 		envVarKey := secretKeyToEnvVarName(rawSecret.Key, noPaths)
@@ -170,14 +211,29 @@ func (e *Environ) loadStrictOne(rawSecrets []store.RawSecret, valueExpected stri
 			continue
 		}
 		delete(parentExpects, envVarKey)
-		if parentVal != valueExpected {
-			return ErrStoreUnexpectedValue{Key: envVarKey, ValueExpected: valueExpected, ValueActual: parentVal}
+		if !expected.MatchString(parentVal) {
+			// a key provided by several services is only reported once
+			if _, ok := reported[envVarKey]; !ok {
+				reported[envVarKey] = struct{}{}
+				unexpected = append(unexpected, ErrStoreUnexpectedValue{Key: envVarKey, ValueExpected: valueExpected, ValueActual: parentVal})
+			}
+			continue
 		}
 		envVarKeysAdded[envVarKey] = struct{}{}
 		e.Set(envVarKey, rawSecret.Value)
 	}
-	for k := range parentExpects {
-		return ErrStoreMissingKey{Key: k, ValueExpected: valueExpected}
+	sort.Slice(unexpected, func(i, j int) bool { return unexpected[i].Key < unexpected[j].Key })
+	for _, u := range unexpected {
+		problems = append(problems, u)
+	}
+	for _, k := range parentKeys {
+		if _, ok := parentExpects[k]; ok {
+			problems = append(problems, ErrStoreMissingKey{Key: k, ValueExpected: valueExpected})
+		}
+	}
+
+	if err := strictError(problems); err != nil {
+		return err
 	}
 
 	if pristine {
@@ -192,6 +248,169 @@ func (e *Environ) loadStrictOne(rawSecrets []store.RawSecret, valueExpected stri
 	return nil
 }
 
+// StrictTemplatePrefix starts the value of env vars naming the secret to
+// substitute in template mode, like chamber://service/key
+const StrictTemplatePrefix = "chamber://"
+
+// LoadStrictTemplate loads secrets in strict template mode: only env vars in e with a value like
+// chamber://service/key are substituted, each with the secret it names. This lets one environment mix
+// secrets from several services under any names. Referenced services must be among services, and it is
+// an error for a referenced key to not be in s.
+func (e *Environ) LoadStrictTemplate(s store.Store, pristine bool, services ...string) error {
+	return e.loadStrictTemplate(s, pristine, false, services...)
+}
+
+// LoadStrictTemplateNoPaths is identical to LoadStrictTemplate, but uses v1-style "."-separated paths
+//
+// Deprecated like all noPaths functionality
+func (e *Environ) LoadStrictTemplateNoPaths(s store.Store, pristine bool, services ...string) error {
+	return e.loadStrictTemplate(s, pristine, true, services...)
+}
+
+func (e *Environ) loadStrictTemplate(s store.Store, pristine bool, noPaths bool, services ...string) error {
+	// referenced services are looked up without their label
+	requested := map[string]string{}
+	for _, service := range services {
+		name := strings.SplitN(service, ":", 2)[0]
+		requested[utils.NormalizeService(name)] = utils.NormalizeService(service)
+	}
+
+	parentMap := e.Map()
+	parentKeys := make([]string, 0, len(parentMap))
+	for k := range parentMap {
+		parentKeys = append(parentKeys, k)
+	}
+	sort.Strings(parentKeys)
+
+	problems := []error{}
+	listed := map[string]map[string]string{}
+	envVarKeysAdded := map[string]struct{}{}
+	for _, k := range parentKeys {
+		ref := parentMap[k]
+		if !strings.HasPrefix(ref, StrictTemplatePrefix) {
+			continue
+		}
+		path := strings.TrimPrefix(ref, StrictTemplatePrefix)
+		i := strings.LastIndex(path, "/")
+		if i <= 0 || i == len(path)-1 {
+			problems = append(problems, ErrTemplateInvalid{Key: k, Value: ref})
+			continue
+		}
+		service, secretKey := utils.NormalizeService(path[:i]), utils.NormalizeKey(path[i+1:])
+
+		fullService, ok := requested[service]
+		if !ok {
+			problems = append(problems, ErrTemplateUnknownService{Key: k, Value: ref, Service: service})
+			continue
+		}
+		secrets, ok := listed[service]
+		if !ok {
+			rawSecrets, err := s.ListRaw(fullService)
+			if err != nil {
+				return err
+			}
+			secrets = map[string]string{}
+			for _, rawSecret := range rawSecrets {
+				secrets[key(rawSecret.Key, noPaths)] = rawSecret.Value
+			}
+			listed[service] = secrets
+		}
+
+		value, ok := secrets[secretKey]
+		if !ok {
+			problems = append(problems, ErrStoreMissingKey{Key: k, ValueExpected: ref})
+			continue
+		}
+		envVarKeysAdded[k] = struct{}{}
+		e.Set(k, value)
+	}
+
+	if err := strictError(problems); err != nil {
+		return err
+	}
+
+	if pristine {
+		for k := range parentMap {
+			if _, ok := envVarKeysAdded[k]; !ok {
+				e.Unset(k)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ErrStrictProblems holds every problem found while loading in strict mode,
+// each of them one of ErrExpectedKeyUnnormalized, ErrStoreUnexpectedValue or
+// ErrStoreMissingKey, or, in template mode, ErrTemplateInvalid or
+// ErrTemplateUnknownService.
+type ErrStrictProblems struct {
+	Problems []error
+}
+
+func (e ErrStrictProblems) Error() string {
+	if len(e.Problems) == 1 {
+		return e.Problems[0].Error()
+	}
+	lines := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		lines = append(lines, "  "+p.Error())
+	}
+	return fmt.Sprintf("%d problems in strict mode:\n%s", len(e.Problems), strings.Join(lines, "\n"))
+}
+
+// strictError returns nil when there are no problems, the problem itself when
+// there is one, and ErrStrictProblems holding them all otherwise
+func strictError(problems []error) error {
+	switch len(problems) {
+	case 0:
+		return nil
+	case 1:
+		return problems[0]
+	}
+	return ErrStrictProblems{Problems: problems}
+}
+
+// StrictProblems returns the problems reported by err, an error returned
+// when loading in strict mode, whether it holds one problem or several. It
+// returns false for any other error.
+func StrictProblems(err error) (ErrStrictProblems, bool) {
+	var problems ErrStrictProblems
+	if errors.As(err, &problems) {
+		return problems, true
+	}
+	if err != nil && problemKey(err) != "" {
+		return ErrStrictProblems{Problems: []error{err}}, true
+	}
+	return ErrStrictProblems{}, false
+}
+
+// SortByKey orders the problems by the key they are about, using compare,
+// instead of grouping them by kind. Problems about the same key keep their
+// order.
+func (e ErrStrictProblems) SortByKey(compare func(a, b string) int) {
+	sort.SliceStable(e.Problems, func(i, j int) bool {
+		return compare(problemKey(e.Problems[i]), problemKey(e.Problems[j])) < 0
+	})
+}
+
+// problemKey returns the key a problem found in strict mode is about
+func problemKey(err error) string {
+	switch p := err.(type) {
+	case ErrStoreUnexpectedValue:
+		return p.Key
+	case ErrStoreMissingKey:
+		return p.Key
+	case ErrExpectedKeyUnnormalized:
+		return p.Key
+	case ErrTemplateInvalid:
+		return p.Key
+	case ErrTemplateUnknownService:
+		return p.Key
+	}
+	return ""
+}
+
 type ErrStoreUnexpectedValue struct {
 	// store-style key
 	Key           string
@@ -222,3 +441,24 @@ func (e ErrExpectedKeyUnnormalized) Error() string {
 	return fmt.Sprintf("parent env has key `%s` with expected value `%s`, but key is not normalized like `%s`, so would never get substituted",
 		e.Key, e.ValueExpected, normalizeEnvVarName(e.Key))
 }
+
+type ErrTemplateInvalid struct {
+	// env-style key
+	Key   string
+	Value string
+}
+
+func (e ErrTemplateInvalid) Error() string {
+	return fmt.Sprintf("parent env has %s=%s, which is not of the form %sservice/key", e.Key, e.Value, StrictTemplatePrefix)
+}
+
+type ErrTemplateUnknownService struct {
+	// env-style key
+	Key     string
+	Value   string
+	Service string
+}
+
+func (e ErrTemplateUnknownService) Error() string {
+	return fmt.Sprintf("parent env has %s=%s, but service %s was not requested", e.Key, e.Value, e.Service)
+}
@@ -1,7 +1,10 @@
 package environ
 
 import (
+	"errors"
+	"regexp"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/segmentio/chamber/v2/store"
@@ -84,6 +87,27 @@ func TestEnvironStrict(t *testing.T) {
 			},
 			expectedErr: ErrExpectedKeyUnnormalized{Key: "DB_username", ValueExpected: "chamberme"},
 		},
+
+		{
+			name: "all problems are reported together",
+			e: fromMap(map[string]string{
+				"HOME":        "/tmp",
+				"DB_username": "chamberme",
+				"DB_PASSWORD": "hunter2",
+				"API_KEY":     "chamberme",
+				"EXTRA":       "chamberme",
+			}),
+			secrets: map[string]string{
+				"db_username": "root",
+				"db_password": "hunter22",
+			},
+			expectedErr: ErrStrictProblems{Problems: []error{
+				ErrExpectedKeyUnnormalized{Key: "DB_username", ValueExpected: "chamberme"},
+				ErrStoreUnexpectedValue{Key: "DB_PASSWORD", ValueExpected: "chamberme", ValueActual: "hunter2"},
+				ErrStoreMissingKey{Key: "API_KEY", ValueExpected: "chamberme"},
+				ErrStoreMissingKey{Key: "EXTRA", ValueExpected: "chamberme"},
+			}},
+		},
 	}
 
 	for _, tc := range cases {
@@ -109,6 +133,76 @@ func TestEnvironStrict(t *testing.T) {
 	}
 }
 
+func TestEnvironStrictMatching(t *testing.T) {
+	e := fromMap(map[string]string{
+		"HOME":        "/tmp",
+		"DB_USERNAME": "chamberme",
+		"DB_PASSWORD": "CHAMBER_PASSWORD",
+	})
+	rawSecrets := []store.RawSecret{
+		{Key: "/app/db_username", Value: "root"},
+		{Key: "/app/db_password", Value: "hunter22"},
+	}
+	expected := regexp.MustCompile(`^(?:chamberme|CHAMBER(.*))$`)
+
+	err := e.loadStrictOneMatching(rawSecrets, expected, expected.String(), false, false)
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]string{
+		"HOME":        "/tmp",
+		"DB_USERNAME": "root",
+		"DB_PASSWORD": "hunter22",
+	}, e.Map())
+}
+
+// fakeStore serves ListRaw from secrets, keyed by service and then key
+type fakeStore struct {
+	store.Store
+	secrets map[string]map[string]string
+}
+
+func (s *fakeStore) ListRaw(service string) ([]store.RawSecret, error) {
+	rawSecrets := []store.RawSecret{}
+	for k, v := range s.secrets[service] {
+		rawSecrets = append(rawSecrets, store.RawSecret{Key: "/" + service + "/" + k, Value: v})
+	}
+	return rawSecrets, nil
+}
+
+func TestEnvironStrictTemplate(t *testing.T) {
+	s := &fakeStore{secrets: map[string]map[string]string{
+		"db":  {"password": "hunter22"},
+		"api": {"token": "abc123"},
+	}}
+
+	t.Run("references are substituted across services", func(t *testing.T) {
+		e := fromMap(map[string]string{
+			"HOME":       "/tmp",
+			"PGPASSWORD": "chamber://db/password",
+			"API_TOKEN":  "chamber://api/token",
+		})
+		err := e.LoadStrictTemplate(s, true, "db", "api")
+		assert.Nil(t, err)
+		assert.EqualValues(t, map[string]string{
+			"PGPASSWORD": "hunter22",
+			"API_TOKEN":  "abc123",
+		}, e.Map())
+	})
+
+	t.Run("all problems are reported", func(t *testing.T) {
+		e := fromMap(map[string]string{
+			"PGPASSWORD": "chamber://db/nope",
+			"API_TOKEN":  "chamber://api/token",
+			"BROKEN":     "chamber://token",
+		})
+		err := e.LoadStrictTemplate(s, false, "db")
+		assert.EqualValues(t, ErrStrictProblems{Problems: []error{
+			ErrTemplateUnknownService{Key: "API_TOKEN", Value: "chamber://api/token", Service: "api"},
+			ErrTemplateInvalid{Key: "BROKEN", Value: "chamber://token"},
+			ErrStoreMissingKey{Key: "PGPASSWORD", ValueExpected: "chamber://db/nope"},
+		}}, err)
+	})
+}
+
 func TestMap(t *testing.T) {
 	cases := []struct {
 		name string
@@ -184,3 +278,59 @@ func TestFromMap(t *testing.T) {
 		})
 	}
 }
+
+func TestErrStrictProblemsSortByKey(t *testing.T) {
+	problems := ErrStrictProblems{Problems: []error{
+		ErrExpectedKeyUnnormalized{Key: "b-key", ValueExpected: "chamberme"},
+		ErrStoreUnexpectedValue{Key: "C_KEY", ValueExpected: "chamberme", ValueActual: "x"},
+		ErrStoreMissingKey{Key: "A_KEY", ValueExpected: "chamberme"},
+		ErrStoreMissingKey{Key: "C_KEY", ValueExpected: "chamberme"},
+	}}
+	problems.SortByKey(strings.Compare)
+	assert.Equal(t, []error{
+		ErrStoreMissingKey{Key: "A_KEY", ValueExpected: "chamberme"},
+		ErrStoreUnexpectedValue{Key: "C_KEY", ValueExpected: "chamberme", ValueActual: "x"},
+		ErrStoreMissingKey{Key: "C_KEY", ValueExpected: "chamberme"},
+		ErrExpectedKeyUnnormalized{Key: "b-key", ValueExpected: "chamberme"},
+	}, problems.Problems)
+}
+
+func TestStrictProblems(t *testing.T) {
+	single := ErrStoreMissingKey{Key: "EXTRA", ValueExpected: "chamberme"}
+	problems, ok := StrictProblems(single)
+	assert.True(t, ok)
+	assert.Equal(t, []error{single}, problems.Problems)
+
+	several := ErrStrictProblems{Problems: []error{
+		single,
+		ErrStoreMissingKey{Key: "OTHER", ValueExpected: "chamberme"},
+	}}
+	problems, ok = StrictProblems(several)
+	assert.True(t, ok)
+	assert.Equal(t, several, problems)
+
+	_, ok = StrictProblems(errors.New("access denied"))
+	assert.False(t, ok)
+	_, ok = StrictProblems(nil)
+	assert.False(t, ok)
+}
+
+func TestEnvironStrictServices(t *testing.T) {
+	s := &fakeStore{secrets: map[string]map[string]string{
+		"app":    {"db_username": "root", "db_password": "hunter22"},
+		"shared": {"api_key": "abc123"},
+	}}
+	e := fromMap(map[string]string{
+		"DB_USERNAME": "chamberme",
+		"API_KEY":     "chamberme",
+		"EXTRA":       "chamberme",
+	})
+
+	// each service is checked in turn, and the problems of the first one
+	// failing are reported together
+	err := e.LoadStrict(s, "chamberme", false, "app", "shared")
+	assert.EqualValues(t, ErrStrictProblems{Problems: []error{
+		ErrStoreMissingKey{Key: "API_KEY", ValueExpected: "chamberme"},
+		ErrStoreMissingKey{Key: "EXTRA", ValueExpected: "chamberme"},
+	}}, err)
+}
@@ -0,0 +1,149 @@
+// Package generator creates new secret values, for chamber generate and for
+// rotating secrets. Besides the built-in generators, any executable on the
+// PATH named chamber-generator-<name> can be used as generator <name>.
+package generator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PluginPrefix is the prefix of the executables providing plugin generators
+const PluginPrefix = "chamber-generator-"
+
+// ParamEnvPrefix is the prefix of the environment variables passing
+// parameters to plugin generators, like CHAMBER_GENERATOR_PARAM_LENGTH
+const ParamEnvPrefix = "CHAMBER_GENERATOR_PARAM_"
+
+// Generator creates a new secret value. params configure the value, for
+// example its length; each generator documents the ones it accepts.
+type Generator interface {
+	Generate(params map[string]string) (string, error)
+}
+
+// Func adapts a function to the Generator interface
+type Func func(params map[string]string) (string, error)
+
+// Generate calls f
+func (f Func) Generate(params map[string]string) (string, error) {
+	return f(params)
+}
+
+var builtins = map[string]Generator{
+	"random":     Func(Random),
+	"hex":        Func(Hex),
+	"uuid":       Func(UUID),
+	"passphrase": Func(Passphrase),
+	"rsa":        Func(RSAKey),
+	"ec":         Func(ECKey),
+	"htpasswd":   Func(Htpasswd),
+}
+
+// Builtins returns the names of the built-in generators
+func Builtins() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the built-in generator called name, or else the plugin
+// generator of that name
+func Lookup(name string) (Generator, error) {
+	if g, ok := builtins[name]; ok {
+		return g, nil
+	}
+	path, err := exec.LookPath(PluginPrefix + name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown generator %s: not built in, and no %s%s found on the PATH", name, PluginPrefix, name)
+	}
+	return Exec{Command: path}, nil
+}
+
+// Entropy returns how many bits of entropy the values of the built-in
+// generator name have with params. It fails for generators whose values
+// aren't chosen uniformly, such as keys, and for plugins.
+func Entropy(name string, params map[string]string) (float64, error) {
+	switch name {
+	case "random":
+		length, err := intParam(params, "length", 32)
+		if err != nil {
+			return 0, err
+		}
+		charset, err := randomCharset(params)
+		if err != nil {
+			return 0, err
+		}
+		return float64(length) * math.Log2(float64(len(charset))), nil
+	case "hex":
+		n, err := intParam(params, "bytes", 32)
+		return float64(8 * n), err
+	case "uuid":
+		return 122, nil
+	case "passphrase":
+		n, err := intParam(params, "words", 8)
+		return float64(n) * math.Log2(float64(len(wordlist))), err
+	default:
+		return 0, fmt.Errorf("can't tell the entropy of values of generator %s", name)
+	}
+}
+
+// Exec is a generator running an external program, which must print the new
+// value on its standard output. Parameters are passed as environment
+// variables prefixed with ParamEnvPrefix.
+type Exec struct {
+	Command string
+	Args    []string
+}
+
+// Generate runs the program and returns its output, without the trailing
+// newline
+func (e Exec) Generate(params map[string]string) (string, error) {
+	cmd := exec.Command(e.Command, e.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range params {
+		cmd.Env = append(cmd.Env, ParamEnvPrefix+strings.ToUpper(k)+"="+v)
+	}
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("generator %s failed: %w", e.Command, err)
+	}
+	value := string(bytes.TrimSuffix(bytes.TrimSuffix(out, []byte("\n")), []byte("\r")))
+	if value == "" {
+		return "", fmt.Errorf("generator %s printed nothing", e.Command)
+	}
+	return value, nil
+}
+
+// intParam returns the integer parameter name, or def when it isn't set
+func intParam(params map[string]string, name string, def int) (int, error) {
+	v, ok := params[name]
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("parameter %s must be a positive integer, not %q", name, v)
+	}
+	return n, nil
+}
+
+// requiredParam returns the parameter name, failing when it isn't set
+func requiredParam(params map[string]string, name string) (string, error) {
+	v, ok := params[name]
+	if !ok || v == "" {
+		return "", errors.New("parameter " + name + " is required")
+	}
+	return v, nil
+}
@@ -0,0 +1,102 @@
+package generator
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltins(t *testing.T) {
+	cases := []struct {
+		name    string
+		params  map[string]string
+		pattern string
+	}{
+		{"random", nil, `^[A-Za-z0-9]{32}$`},
+		{"random", map[string]string{"length": "12"}, `^[A-Za-z0-9]{12}$`},
+		{"random", map[string]string{"length": "6", "charset": "numeric"}, `^[0-9]{6}$`},
+		{"random", map[string]string{"charset": "lower"}, `^[a-z]{32}$`},
+		{"hex", map[string]string{"bytes": "4"}, `^[0-9a-f]{8}$`},
+		{"uuid", nil, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{"passphrase", map[string]string{"words": "3", "separator": " "}, `^[a-z]+ [a-z]+ [a-z]+$`},
+		{"htpasswd", map[string]string{"user": "admin", "password": "hunter22"}, `^admin:\$apr1\$[./0-9A-Za-z]{8}\$[./0-9A-Za-z]{22}$`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := Lookup(tc.name)
+			assert.NoError(t, err)
+			value, err := g.Generate(tc.params)
+			assert.NoError(t, err)
+			assert.Regexp(t, regexp.MustCompile(tc.pattern), value)
+		})
+	}
+}
+
+func TestInvalidParams(t *testing.T) {
+	_, err := Random(map[string]string{"length": "-1"})
+	assert.Error(t, err)
+	_, err = Random(map[string]string{"charset": "emoji"})
+	assert.Error(t, err)
+	_, err = Htpasswd(map[string]string{"user": "admin"})
+	assert.EqualError(t, err, "parameter password is required")
+	_, err = ECKey(map[string]string{"curve": "P999"})
+	assert.Error(t, err)
+}
+
+func TestEntropy(t *testing.T) {
+	bits, err := Entropy("random", map[string]string{"length": "40", "charset": "hex"})
+	assert.NoError(t, err)
+	assert.Equal(t, 160.0, bits)
+	bits, err = Entropy("random", nil)
+	assert.NoError(t, err)
+	assert.InDelta(t, 190.5, bits, 0.1)
+	bits, err = Entropy("passphrase", map[string]string{"words": "5"})
+	assert.NoError(t, err)
+	assert.Equal(t, 40.0, bits)
+
+	_, err = Entropy("rsa", nil)
+	assert.Error(t, err)
+	_, err = Entropy("random", map[string]string{"charset": "emoji"})
+	assert.Error(t, err)
+}
+
+func TestECKey(t *testing.T) {
+	value, err := ECKey(nil)
+	assert.NoError(t, err)
+	block, _ := pem.Decode([]byte(value))
+	assert.NotNil(t, block)
+	_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	assert.NoError(t, err)
+}
+
+func TestApr1(t *testing.T) {
+	// openssl passwd -apr1 -salt saltsalt hunter22
+	assert.Equal(t, "$apr1$saltsalt$8XeAS.ua4rpINl8yYdAiV.", apr1("hunter22", "saltsalt"))
+}
+
+func TestPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin script relies on sh")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"token-$CHAMBER_GENERATOR_PARAM_PREFIX\"\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, PluginPrefix+"token"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	g, err := Lookup("token")
+	assert.NoError(t, err)
+	value, err := g.Generate(map[string]string{"prefix": "abc"})
+	assert.NoError(t, err)
+	assert.Equal(t, "token-abc", value)
+
+	_, err = Lookup("nope")
+	assert.True(t, strings.HasPrefix(err.Error(), "unknown generator nope"))
+}
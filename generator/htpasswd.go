@@ -0,0 +1,91 @@
+package generator
+
+import (
+	"crypto/md5"
+)
+
+// apr1Alphabet is the alphabet of the crypt(3) flavour of base64
+const apr1Alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Htpasswd generates an htpasswd line for user with password, hashed with the
+// Apache MD5 (apr1) scheme that htpasswd uses by default.
+func Htpasswd(params map[string]string) (string, error) {
+	user, err := requiredParam(params, "user")
+	if err != nil {
+		return "", err
+	}
+	password, err := requiredParam(params, "password")
+	if err != nil {
+		return "", err
+	}
+	salt, err := randomString(apr1Alphabet, 8)
+	if err != nil {
+		return "", err
+	}
+	return user + ":" + apr1(password, salt), nil
+}
+
+// apr1 hashes password with salt using the Apache variant of MD5-crypt
+func apr1(password, salt string) string {
+	const magic = "$apr1$"
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password))
+
+	ctx := md5.New()
+	ctx.Write(pw)
+	ctx.Write([]byte(magic + salt))
+	for i := len(pw); i > 0; i -= 16 {
+		n := i
+		if n > 16 {
+			n = 16
+		}
+		ctx.Write(alt[:n])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	final := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write(pw)
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 != 0 {
+			round.Write(final)
+		} else {
+			round.Write(pw)
+		}
+		final = round.Sum(nil)
+	}
+
+	out := make([]byte, 0, 22)
+	encode := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			out = append(out, apr1Alphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	f := func(i int) uint32 { return uint32(final[i]) }
+	encode(f(0)<<16|f(6)<<8|f(12), 4)
+	encode(f(1)<<16|f(7)<<8|f(13), 4)
+	encode(f(2)<<16|f(8)<<8|f(14), 4)
+	encode(f(3)<<16|f(9)<<8|f(15), 4)
+	encode(f(4)<<16|f(10)<<8|f(5), 4)
+	encode(f(11), 2)
+
+	return magic + salt + "$" + string(out)
+}
@@ -0,0 +1,60 @@
+package generator
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// RSAKey generates an RSA private key of bits bits (default 4096), PEM
+// encoded in PKCS #8 form. The public key can be derived from it.
+func RSAKey(params map[string]string) (string, error) {
+	bits, err := intParam(params, "bits", 4096)
+	if err != nil {
+		return "", err
+	}
+	if bits < 2048 {
+		return "", fmt.Errorf("parameter bits must be at least 2048, not %d", bits)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return "", err
+	}
+	return encodePrivateKey(key)
+}
+
+// ECKey generates an ECDSA private key on curve (P256 by default, or P384 or
+// P521), PEM encoded in PKCS #8 form.
+func ECKey(params map[string]string) (string, error) {
+	curves := map[string]elliptic.Curve{
+		"P256": elliptic.P256(),
+		"P384": elliptic.P384(),
+		"P521": elliptic.P521(),
+	}
+	name, ok := params["curve"]
+	if !ok {
+		name = "P256"
+	}
+	curve, ok := curves[name]
+	if !ok {
+		return "", fmt.Errorf("parameter curve must be one of P256, P384 or P521, not %q", name)
+	}
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return encodePrivateKey(key)
+}
+
+func encodePrivateKey(key crypto.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
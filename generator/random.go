@@ -0,0 +1,125 @@
+package generator
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+const (
+	alphanumeric = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	symbols      = "!#%+,-.:=?@^_~"
+)
+
+// Charsets are the character sets random values can be drawn from
+var Charsets = map[string]string{
+	"alnum":   alphanumeric,
+	"alpha":   alphanumeric[:52],
+	"lower":   alphanumeric[26:52],
+	"numeric": alphanumeric[52:],
+	"hex":     "0123456789abcdef",
+	"symbols": alphanumeric + symbols,
+}
+
+// CharsetNames returns the names of Charsets
+func CharsetNames() []string {
+	names := make([]string, 0, len(Charsets))
+	for name := range Charsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Random generates a random string of length characters (default 32), from
+// charset (default alnum), or letters and digits plus symbols when
+// symbols=true.
+func Random(params map[string]string) (string, error) {
+	length, err := intParam(params, "length", 32)
+	if err != nil {
+		return "", err
+	}
+	charset, err := randomCharset(params)
+	if err != nil {
+		return "", err
+	}
+	return randomString(charset, length)
+}
+
+// randomCharset returns the characters Random draws from
+func randomCharset(params map[string]string) (string, error) {
+	name, ok := params["charset"]
+	if !ok {
+		if params["symbols"] == "true" {
+			return Charsets["symbols"], nil
+		}
+		return alphanumeric, nil
+	}
+	charset, ok := Charsets[name]
+	if !ok {
+		return "", fmt.Errorf("parameter charset must be one of %s, not %q", strings.Join(CharsetNames(), ", "), name)
+	}
+	return charset, nil
+}
+
+// Hex generates bytes random bytes (default 32), hex encoded.
+func Hex(params map[string]string) (string, error) {
+	n, err := intParam(params, "bytes", 32)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// UUID generates a random (version 4) UUID.
+func UUID(params map[string]string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// Passphrase generates words random words (default 8) joined by separator
+// (default "-"). Each word adds 8 bits of entropy.
+func Passphrase(params map[string]string) (string, error) {
+	n, err := intParam(params, "words", 8)
+	if err != nil {
+		return "", err
+	}
+	separator, ok := params["separator"]
+	if !ok {
+		separator = "-"
+	}
+	words := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(len(wordlist))))
+		if err != nil {
+			return "", err
+		}
+		words = append(words, wordlist[j.Int64()])
+	}
+	return strings.Join(words, separator), nil
+}
+
+func randomString(charset string, length int) (string, error) {
+	out := make([]byte, length)
+	max := big.NewInt(int64(len(charset)))
+	for i := range out {
+		j, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		out[i] = charset[j.Int64()]
+	}
+	return string(out), nil
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ensure DecompressingStore confirms to Store interface
+var _ Store = &DecompressingStore{}
+
+// CompressedPrefix marks a value written by CompressValue. Backends only hold
+// text, so the gzipped value is base64 encoded after it.
+const CompressedPrefix = "chamber-gzip:"
+
+// CompressValue gzips value, so that large values fit within the size limits
+// of a backend. Values are compressed the same way every time, so compressed
+// values can be compared.
+func CompressValue(value string) (string, error) {
+	buf := &bytes.Buffer{}
+	w, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(w, value); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return CompressedPrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecompressValue reverses CompressValue, returning values that were not
+// compressed as they are
+func DecompressValue(value string) (string, error) {
+	if !strings.HasPrefix(value, CompressedPrefix) {
+		return value, nil
+	}
+	compressed, err := base64.StdEncoding.DecodeString(value[len(CompressedPrefix):])
+	if err != nil {
+		return "", fmt.Errorf("invalid compressed value: %w", err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", fmt.Errorf("invalid compressed value: %w", err)
+	}
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("invalid compressed value: %w", err)
+	}
+	return string(decompressed), nil
+}
+
+// DecompressingStore wraps a Store so that values written with CompressValue
+// are read decompressed. Values too large for the backend are written
+// compressed, so that values read can be written back, e.g. when copied.
+type DecompressingStore struct {
+	Store
+}
+
+// NewDecompressingStore creates a new DecompressingStore wrapping s
+func NewDecompressingStore(s Store) *DecompressingStore {
+	return &DecompressingStore{Store: s}
+}
+
+// Unwrap returns the wrapped store
+func (s *DecompressingStore) Unwrap() Store {
+	return s.Store
+}
+
+// Write writes a secret, compressed if it is larger than the backend accepts
+func (s *DecompressingStore) Write(id SecretId, value string) error {
+	if max := s.Store.Capabilities().MaxValueSize; max > 0 && len(value) > max {
+		compressed, err := CompressValue(value)
+		if err != nil {
+			return err
+		}
+		value = compressed
+	}
+	return s.Store.Write(id, value)
+}
+
+// ReadBatch reads the latest values of the keys of service, decompressed
+func (s *DecompressingStore) ReadBatch(service string, keys []string) (map[string]string, error) {
+	values, err := ReadBatch(s.Store, service, keys)
+	if err != nil {
+		return nil, err
+	}
+	for k, value := range values {
+		if values[k], err = DecompressValue(value); err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+	}
+	return values, nil
+}
+
+// Read reads a secret, decompressing its value
+func (s *DecompressingStore) Read(id SecretId, version int) (Secret, error) {
+	secret, err := s.Store.Read(id, version)
+	if err != nil || secret.Value == nil {
+		return secret, err
+	}
+	value, err := DecompressValue(*secret.Value)
+	if err != nil {
+		return Secret{}, fmt.Errorf("%s/%s: %w", id.Service, id.Key, err)
+	}
+	secret.Value = &value
+	return secret, nil
+}
+
+// List lists the secrets of a service, decompressing their values
+func (s *DecompressingStore) List(service string, includeValues bool) ([]Secret, error) {
+	secrets, err := s.Store.List(service, includeValues)
+	if err != nil || !includeValues {
+		return secrets, err
+	}
+	for i, secret := range secrets {
+		if secret.Value == nil {
+			continue
+		}
+		value, err := DecompressValue(*secret.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", secret.Meta.Key, err)
+		}
+		secrets[i].Value = &value
+	}
+	return secrets, nil
+}
+
+// ListRaw lists all secrets keys and values for a given service,
+// decompressing values
+func (s *DecompressingStore) ListRaw(service string) ([]RawSecret, error) {
+	rawSecrets, err := s.Store.ListRaw(service)
+	if err != nil {
+		return nil, err
+	}
+	for i, rawSecret := range rawSecrets {
+		value, err := DecompressValue(rawSecret.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", rawSecret.Key, err)
+		}
+		rawSecrets[i].Value = value
+	}
+	return rawSecrets, nil
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressValue(t *testing.T) {
+	value := strings.Repeat(`{"feature":"enabled","rollout":100}`, 200)
+	compressed, err := CompressValue(value)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(compressed, CompressedPrefix))
+	assert.Less(t, len(compressed), len(value)/10)
+
+	again, err := CompressValue(value)
+	assert.NoError(t, err)
+	assert.Equal(t, compressed, again, "compression is deterministic")
+
+	decompressed, err := DecompressValue(compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, value, decompressed)
+
+	plain, err := DecompressValue("not compressed")
+	assert.NoError(t, err)
+	assert.Equal(t, "not compressed", plain)
+
+	_, err = DecompressValue(CompressedPrefix + "bm90IGd6aXA=")
+	assert.Error(t, err)
+}
+
+func TestDecompressingStore(t *testing.T) {
+	mock := &mockSSMClient{parameters: map[string]mockParameter{}}
+	ssmStore := NewTestSSMStoreWithPaths(mock)
+	compressed, err := CompressValue("large config")
+	assert.NoError(t, err)
+	ssmStore.Write(SecretId{Service: "app", Key: "config"}, compressed)
+	ssmStore.Write(SecretId{Service: "app", Key: "token"}, "plain")
+
+	s := NewDecompressingStore(ssmStore)
+
+	secret, err := s.Read(SecretId{Service: "app", Key: "config"}, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, "large config", *secret.Value)
+
+	rawSecrets, err := s.ListRaw("app")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []RawSecret{
+		{Key: "/app/config", Value: "large config"},
+		{Key: "/app/token", Value: "plain"},
+	}, rawSecrets)
+
+	secrets, err := s.List("app", true)
+	assert.NoError(t, err)
+	values := []string{}
+	for _, secret := range secrets {
+		values = append(values, *secret.Value)
+	}
+	assert.ElementsMatch(t, []string{"large config", "plain"}, values)
+
+	batch, err := ReadBatch(s, "app", []string{"config", "token"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"config": "large config", "token": "plain"}, batch)
+
+	assert.Equal(t, ssmStore, Unwrap(s))
+	assert.Equal(t, ssmStore, Unwrap(NewDecompressingStore(s)))
+
+	// values too large for the backend are written compressed
+	large := strings.Repeat("feature=enabled\n", 500)
+	assert.NoError(t, s.Write(SecretId{Service: "app", Key: "large"}, large))
+	raw, err := ssmStore.Read(SecretId{Service: "app", Key: "large"}, -1)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(*raw.Value, CompressedPrefix))
+	secret, err = s.Read(SecretId{Service: "app", Key: "large"}, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, large, *secret.Value)
+}
@@ -0,0 +1,93 @@
+package store
+
+// ensure ExcludingStore confirms to Store interface
+var _ Store = &ExcludingStore{}
+var _ BatchReader = &ExcludingStore{}
+
+// ExcludingStore wraps a Store so that reading and listing leave out keys that
+// hold chamber's own data rather than secrets, like service manifests
+type ExcludingStore struct {
+	Store
+	keys map[string]bool
+}
+
+// NewExcludingStore creates a new ExcludingStore wrapping s, leaving out keys
+func NewExcludingStore(s Store, keys ...string) *ExcludingStore {
+	excluded := map[string]bool{}
+	for _, k := range keys {
+		excluded[k] = true
+	}
+	return &ExcludingStore{Store: s, keys: excluded}
+}
+
+// Unwrap returns the store s reads, which includes the excluded keys
+func (s *ExcludingStore) Unwrap() Store {
+	return s.Store
+}
+
+// Read reads a secret, as if the excluded keys didn't exist
+func (s *ExcludingStore) Read(id SecretId, version int) (Secret, error) {
+	if s.keys[id.Key] {
+		return Secret{}, ErrSecretNotFound
+	}
+	return s.Store.Read(id, version)
+}
+
+// ReadBatch reads the latest values of keys of service, leaving out the
+// excluded keys
+func (s *ExcludingStore) ReadBatch(service string, keys []string) (map[string]string, error) {
+	kept := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if !s.keys[k] {
+			kept = append(kept, k)
+		}
+	}
+	return ReadBatch(s.Store, service, kept)
+}
+
+// List lists the secrets of a given service, except the excluded keys
+func (s *ExcludingStore) List(service string, includeValues bool) ([]Secret, error) {
+	secrets, err := s.Store.List(service, includeValues)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]Secret, 0, len(secrets))
+	for _, secret := range secrets {
+		if !s.keys[shortKey(secret.Meta.Key)] {
+			kept = append(kept, secret)
+		}
+	}
+	return kept, nil
+}
+
+// ListRaw lists all secrets keys and values for a given service, except the
+// excluded keys
+func (s *ExcludingStore) ListRaw(service string) ([]RawSecret, error) {
+	rawSecrets, err := s.Store.ListRaw(service)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]RawSecret, 0, len(rawSecrets))
+	for _, rawSecret := range rawSecrets {
+		if !s.keys[shortKey(rawSecret.Key)] {
+			kept = append(kept, rawSecret)
+		}
+	}
+	return kept, nil
+}
+
+// ListServices lists the services under service, leaving out the excluded
+// keys when secret names are included
+func (s *ExcludingStore) ListServices(service string, includeSecretName bool) ([]string, error) {
+	services, err := s.Store.ListServices(service, includeSecretName)
+	if err != nil || !includeSecretName {
+		return services, err
+	}
+	kept := make([]string, 0, len(services))
+	for _, name := range services {
+		if !s.keys[shortKey(name)] {
+			kept = append(kept, name)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// ensure InterpolatingStore confirms to Store interface
+var _ Store = &InterpolatingStore{}
+
+// InterpolatingStore wraps a Store so that ListRaw resolves Go template
+// references between the values of a service. A value such as
+// `postgres://{{ .db_user }}:{{ .db_password }}@host/db` is rendered using the
+// other keys of the same service, so derived values never go stale when the
+// secrets they are built from are rotated.
+type InterpolatingStore struct {
+	Store
+}
+
+// NewInterpolatingStore creates a new InterpolatingStore wrapping s
+func NewInterpolatingStore(s Store) *InterpolatingStore {
+	return &InterpolatingStore{Store: s}
+}
+
+// ListRaw lists all secrets keys and values for a given service, with
+// references between values resolved.
+func (s *InterpolatingStore) ListRaw(service string) ([]RawSecret, error) {
+	rawSecrets, err := s.Store.ListRaw(service)
+	if err != nil {
+		return nil, err
+	}
+	return interpolateSecrets(rawSecrets)
+}
+
+// interpolateSecrets renders every value that contains a template action.
+// References are by key name without the service prefix, and may themselves
+// contain references; cycles are reported as errors.
+func interpolateSecrets(rawSecrets []RawSecret) ([]RawSecret, error) {
+	raw := map[string]string{}
+	for _, rawSecret := range rawSecrets {
+		raw[shortKey(rawSecret.Key)] = rawSecret.Value
+	}
+
+	r := &interpolator{raw: raw, resolved: map[string]string{}, resolving: map[string]bool{}}
+	out := make([]RawSecret, 0, len(rawSecrets))
+	for _, rawSecret := range rawSecrets {
+		value, err := r.resolve(shortKey(rawSecret.Key))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, RawSecret{Key: rawSecret.Key, Value: value})
+	}
+	return out, nil
+}
+
+type interpolator struct {
+	raw       map[string]string
+	resolved  map[string]string
+	resolving map[string]bool
+}
+
+func (r *interpolator) resolve(key string) (string, error) {
+	if v, ok := r.resolved[key]; ok {
+		return v, nil
+	}
+	value := r.raw[key]
+	if !strings.Contains(value, "{{") {
+		r.resolved[key] = value
+		return value, nil
+	}
+	if r.resolving[key] {
+		return "", fmt.Errorf("circular reference while interpolating %s", key)
+	}
+	r.resolving[key] = true
+	defer delete(r.resolving, key)
+
+	tmpl, err := template.New(key).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s for interpolation: %w", key, err)
+	}
+
+	// only resolve the keys this template refers to, so unrelated broken
+	// templates don't prevent rendering
+	refs := map[string]bool{}
+	templateRefs(tmpl.Tree.Root, refs)
+	data := map[string]string{}
+	for name := range refs {
+		if _, ok := r.raw[name]; !ok {
+			continue
+		}
+		v, err := r.resolve(name)
+		if err != nil {
+			return "", err
+		}
+		data[name] = v
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to interpolate %s: %w", key, err)
+	}
+	r.resolved[key] = b.String()
+	return r.resolved[key], nil
+}
+
+// templateRefs collects the names a template may look up: the first
+// identifier of field references like .db_user, and string arguments such as
+// the key in index . "db-user".
+func templateRefs(node parse.Node, refs map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			templateRefs(c, refs)
+		}
+	case *parse.ActionNode:
+		templateRefs(n.Pipe, refs)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			templateRefs(c, refs)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			templateRefs(a, refs)
+		}
+	case *parse.FieldNode:
+		refs[n.Ident[0]] = true
+	case *parse.StringNode:
+		refs[n.Text] = true
+	case *parse.IfNode:
+		templateRefs(n.Pipe, refs)
+		templateRefs(n.List, refs)
+		templateRefs(n.ElseList, refs)
+	case *parse.RangeNode:
+		templateRefs(n.Pipe, refs)
+		templateRefs(n.List, refs)
+		templateRefs(n.ElseList, refs)
+	case *parse.WithNode:
+		templateRefs(n.Pipe, refs)
+		templateRefs(n.List, refs)
+		templateRefs(n.ElseList, refs)
+	}
+}
+
+// shortKey strips the service from a raw secret key, the same way exec derives
+// variable names.
+func shortKey(key string) string {
+	sep := "/"
+	if _, noPaths := os.LookupEnv("CHAMBER_NO_PATHS"); noPaths {
+		sep = "."
+	}
+	return key[strings.LastIndex(key, sep)+1:]
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ensure JSONExpandingStore confirms to Store interface
+var _ Store = &JSONExpandingStore{}
+
+// invalidSubKeyChars matches characters that cannot be used in a flattened key
+var invalidSubKeyChars = regexp.MustCompile(`[^\w\-]`)
+
+// JSONExpandingStore wraps a Store so that ListRaw flattens any secret whose
+// value is a JSON object into one secret per leaf, named <key>_<subkey>. This
+// is useful for Secrets Manager secrets created by RDS rotation, which store
+// all connection details in a single JSON blob.
+type JSONExpandingStore struct {
+	Store
+}
+
+// NewJSONExpandingStore creates a new JSONExpandingStore wrapping s
+func NewJSONExpandingStore(s Store) *JSONExpandingStore {
+	return &JSONExpandingStore{Store: s}
+}
+
+// ListRaw lists all secrets keys and values for a given service, expanding
+// JSON object values.
+func (s *JSONExpandingStore) ListRaw(service string) ([]RawSecret, error) {
+	rawSecrets, err := s.Store.ListRaw(service)
+	if err != nil {
+		return nil, err
+	}
+	return expandJSONSecrets(rawSecrets), nil
+}
+
+func expandJSONSecrets(rawSecrets []RawSecret) []RawSecret {
+	expanded := make([]RawSecret, 0, len(rawSecrets))
+	for _, rawSecret := range rawSecrets {
+		obj, ok := jsonObject(rawSecret.Value)
+		if !ok {
+			expanded = append(expanded, rawSecret)
+			continue
+		}
+		expanded = flattenJSON(expanded, rawSecret.Key, obj)
+	}
+	return expanded
+}
+
+// jsonObject decodes value if it holds a JSON object, preserving numbers as
+// they were written.
+func jsonObject(value string) (map[string]interface{}, bool) {
+	trimmed := strings.TrimSpace(value)
+	if !strings.HasPrefix(trimmed, "{") {
+		return nil, false
+	}
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	decoder.UseNumber()
+	var obj map[string]interface{}
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, false
+	}
+	return obj, true
+}
+
+func flattenJSON(out []RawSecret, prefix string, obj map[string]interface{}) []RawSecret {
+	subKeys := make([]string, 0, len(obj))
+	for k := range obj {
+		subKeys = append(subKeys, k)
+	}
+	sort.Strings(subKeys)
+
+	for _, subKey := range subKeys {
+		key := prefix + "_" + invalidSubKeyChars.ReplaceAllString(subKey, "_")
+		switch v := obj[subKey].(type) {
+		case map[string]interface{}:
+			out = flattenJSON(out, key, v)
+		case string:
+			out = append(out, RawSecret{Key: key, Value: v})
+		case json.Number:
+			out = append(out, RawSecret{Key: key, Value: v.String()})
+		case bool:
+			if v {
+				out = append(out, RawSecret{Key: key, Value: "true"})
+			} else {
+				out = append(out, RawSecret{Key: key, Value: "false"})
+			}
+		case nil:
+			out = append(out, RawSecret{Key: key, Value: ""})
+		default:
+			// arrays are passed through as JSON
+			buf := &bytes.Buffer{}
+			encoder := json.NewEncoder(buf)
+			encoder.SetEscapeHTML(false)
+			encoder.Encode(v)
+			out = append(out, RawSecret{Key: key, Value: strings.TrimSuffix(buf.String(), "\n")})
+		}
+	}
+	return out
+}
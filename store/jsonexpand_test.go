@@ -0,0 +1,32 @@
+package store
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandJSONSecrets(t *testing.T) {
+	rawSecrets := []RawSecret{
+		{Key: "/app/plain", Value: "hunter22"},
+		{Key: "/app/array", Value: `["a", "b"]`},
+		{Key: "/app/broken", Value: `{"not": json`},
+		{Key: "/app/db", Value: `{"username": "root", "port": 5432, "ssl": true, "nested": {"host.name": "db"}, "tags": ["a", "b"], "extra": null}`},
+	}
+
+	expanded := expandJSONSecrets(rawSecrets)
+	sort.Sort(ByKeyRaw(expanded))
+
+	assert.Equal(t, []RawSecret{
+		{Key: "/app/array", Value: `["a", "b"]`},
+		{Key: "/app/broken", Value: `{"not": json`},
+		{Key: "/app/db_extra", Value: ""},
+		{Key: "/app/db_nested_host_name", Value: "db"},
+		{Key: "/app/db_port", Value: "5432"},
+		{Key: "/app/db_ssl", Value: "true"},
+		{Key: "/app/db_tags", Value: `["a","b"]`},
+		{Key: "/app/db_username", Value: "root"},
+		{Key: "/app/plain", Value: "hunter22"},
+	}, expanded)
+}
@@ -0,0 +1,234 @@
+package store
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Store = &MemoryStore{}
+
+// MemoryStore keeps secrets in memory, for tests and local development. It
+// keeps every version of a secret, and supports tags.
+type MemoryStore struct {
+	mu sync.Mutex
+	// service -> key -> versions, oldest first
+	secrets map[string]map[string][]memoryVersion
+	// service -> key -> tags
+	tags map[string]map[string]map[string]string
+}
+
+type memoryVersion struct {
+	value   string
+	created time.Time
+}
+
+// memoryStoreUser is recorded as the author of every version
+const memoryStoreUser = "chamber"
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		secrets: map[string]map[string][]memoryVersion{},
+		tags:    map[string]map[string]map[string]string{},
+	}
+}
+
+func (s *MemoryStore) Write(id SecretId, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.secrets[id.Service]; !ok {
+		s.secrets[id.Service] = map[string][]memoryVersion{}
+	}
+	s.secrets[id.Service][id.Key] = append(s.secrets[id.Service][id.Key], memoryVersion{value: value, created: time.Now()})
+	return nil
+}
+
+func (s *MemoryStore) Capabilities() Capabilities {
+	return Capabilities{History: true, Tags: true, ConcurrentWrites: true}
+}
+
+func (s *MemoryStore) Read(id SecretId, version int) (Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions, ok := s.secrets[id.Service][id.Key]
+	if !ok {
+		return Secret{}, ErrSecretNotFound
+	}
+	if version == -1 {
+		version = len(versions)
+	}
+	if version < 1 || version > len(versions) {
+		return Secret{}, ErrSecretNotFound
+	}
+	v := versions[version-1]
+	value := v.value
+	return Secret{
+		Value: &value,
+		Meta: SecretMetadata{
+			Created:   v.created,
+			CreatedBy: memoryStoreUser,
+			Version:   version,
+			Key:       memoryName(id),
+		},
+	}, nil
+}
+
+func (s *MemoryStore) List(service string, includeValues bool) ([]Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secrets := []Secret{}
+	for _, k := range s.sortedKeys(service) {
+		versions := s.secrets[service][k]
+		latest := versions[len(versions)-1]
+		secret := Secret{Meta: SecretMetadata{
+			Created:   latest.created,
+			CreatedBy: memoryStoreUser,
+			Version:   len(versions),
+			Key:       memoryName(SecretId{Service: service, Key: k}),
+		}}
+		if includeValues {
+			value := latest.value
+			secret.Value = &value
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
+
+func (s *MemoryStore) ListRaw(service string) ([]RawSecret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secrets := []RawSecret{}
+	for _, k := range s.sortedKeys(service) {
+		versions := s.secrets[service][k]
+		secrets = append(secrets, RawSecret{
+			Key:   memoryName(SecretId{Service: service, Key: k}),
+			Value: versions[len(versions)-1].value,
+		})
+	}
+	return secrets, nil
+}
+
+// ListServices lists the services starting with service, or the names of
+// their secrets when includeSecretName is true
+func (s *MemoryStore) ListServices(service string, includeSecretName bool) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := []string{}
+	for name := range s.secrets {
+		if !strings.HasPrefix(name, service) || len(s.secrets[name]) == 0 {
+			continue
+		}
+		if !includeSecretName {
+			names = append(names, name)
+			continue
+		}
+		for _, k := range s.sortedKeys(name) {
+			names = append(names, memoryName(SecretId{Service: name, Key: k}))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *MemoryStore) History(id SecretId) ([]ChangeEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions, ok := s.secrets[id.Service][id.Key]
+	if !ok {
+		return []ChangeEvent{}, ErrSecretNotFound
+	}
+	events := make([]ChangeEvent, 0, len(versions))
+	for i, v := range versions {
+		eventType := Updated
+		if i == 0 {
+			eventType = Created
+		}
+		events = append(events, ChangeEvent{Type: eventType, Time: v.created, User: memoryStoreUser, Version: i + 1})
+	}
+	return events, nil
+}
+
+func (s *MemoryStore) Delete(id SecretId) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.secrets[id.Service][id.Key]; !ok {
+		return ErrSecretNotFound
+	}
+	delete(s.secrets[id.Service], id.Key)
+	delete(s.tags[id.Service], id.Key)
+	return nil
+}
+
+func (s *MemoryStore) ReadTags(id SecretId) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.secrets[id.Service][id.Key]; !ok {
+		return nil, ErrSecretNotFound
+	}
+	tags := map[string]string{}
+	for k, v := range s.tags[id.Service][id.Key] {
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+func (s *MemoryStore) WriteTags(id SecretId, tags map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.secrets[id.Service][id.Key]; !ok {
+		return ErrSecretNotFound
+	}
+	if _, ok := s.tags[id.Service]; !ok {
+		s.tags[id.Service] = map[string]map[string]string{}
+	}
+	if _, ok := s.tags[id.Service][id.Key]; !ok {
+		s.tags[id.Service][id.Key] = map[string]string{}
+	}
+	for k, v := range tags {
+		s.tags[id.Service][id.Key][k] = v
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteTags(id SecretId, tagKeys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.secrets[id.Service][id.Key]; !ok {
+		return ErrSecretNotFound
+	}
+	for _, k := range tagKeys {
+		delete(s.tags[id.Service][id.Key], k)
+	}
+	return nil
+}
+
+func (s *MemoryStore) sortedKeys(service string) []string {
+	keys := make([]string, 0, len(s.secrets[service]))
+	for k := range s.secrets[service] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// memoryName names a secret the way the SSM backend would, so that commands
+// parse it the same way
+func memoryName(id SecretId) string {
+	if _, noPaths := os.LookupEnv("CHAMBER_NO_PATHS"); noPaths {
+		return id.Service + "." + id.Key
+	}
+	return "/" + id.Service + "/" + id.Key
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	id := SecretId{Service: "app", Key: "db_password"}
+	assert.NoError(t, s.Write(id, "first"))
+	assert.NoError(t, s.Write(id, "second"))
+	assert.NoError(t, s.Write(SecretId{Service: "app/worker", Key: "token"}, "abc"))
+
+	secret, err := s.Read(id, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", *secret.Value)
+	assert.Equal(t, 2, secret.Meta.Version)
+	assert.Equal(t, "/app/db_password", secret.Meta.Key)
+
+	secret, err = s.Read(id, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", *secret.Value)
+	_, err = s.Read(id, 3)
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	events, err := s.History(id)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, Created, events[0].Type)
+	assert.Equal(t, Updated, events[1].Type)
+
+	services, err := s.ListServices("app", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app", "app/worker"}, services)
+	names, err := s.ListServices("app/", true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/app/worker/token"}, names)
+
+	assert.NoError(t, s.WriteTags(id, map[string]string{"owner": "payments"}))
+	tags, err := s.ReadTags(id)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"owner": "payments"}, tags)
+	assert.NoError(t, s.DeleteTags(id, []string{"owner"}))
+	tags, err = s.ReadTags(id)
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+
+	assert.NoError(t, s.Delete(id))
+	assert.ErrorIs(t, s.Delete(id), ErrSecretNotFound)
+	rawSecrets, err := s.ListRaw("app")
+	assert.NoError(t, err)
+	assert.Empty(t, rawSecrets)
+}
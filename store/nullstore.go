@@ -16,6 +16,10 @@ func (s *NullStore) Write(id SecretId, value string) error {
 	return errors.New("Write is not implemented for Null Store")
 }
 
+func (s *NullStore) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
 func (s *NullStore) Read(id SecretId, version int) (Secret, error) {
 	return Secret{}, errors.New("Not implemented for Null Store")
 }
@@ -39,3 +43,15 @@ func (s *NullStore) History(id SecretId) ([]ChangeEvent, error) {
 func (s *NullStore) Delete(id SecretId) error {
 	return errors.New("Not implemented for Null Store")
 }
+
+func (s *NullStore) ReadTags(id SecretId) (map[string]string, error) {
+	return nil, errors.New("Not implemented for Null Store")
+}
+
+func (s *NullStore) WriteTags(id SecretId, tags map[string]string) error {
+	return errors.New("Not implemented for Null Store")
+}
+
+func (s *NullStore) DeleteTags(id SecretId, tagKeys []string) error {
+	return errors.New("Not implemented for Null Store")
+}
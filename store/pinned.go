@@ -0,0 +1,70 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ensure VersionPinnedStore confirms to Store interface
+var _ Store = &VersionPinnedStore{}
+
+// VersionPinnedStore wraps a Store so that ListRaw returns pinned keys as they
+// were at a given version, rather than their latest value. Versions are per
+// key, as every secret is versioned on its own.
+type VersionPinnedStore struct {
+	Store
+	versions map[string]map[string]int
+}
+
+// NewVersionPinnedStore creates a new VersionPinnedStore wrapping s. versions
+// maps service names to the keys to pin and the version to read them at.
+func NewVersionPinnedStore(s Store, versions map[string]map[string]int) *VersionPinnedStore {
+	return &VersionPinnedStore{Store: s, versions: versions}
+}
+
+// ListRaw lists all secrets keys and values for a given service, reading
+// pinned keys at their version. It is an error for a pinned key to not have
+// that version.
+func (s *VersionPinnedStore) ListRaw(service string) ([]RawSecret, error) {
+	pins, ok := s.versions[service]
+	if !ok {
+		return s.Store.ListRaw(service)
+	}
+
+	rawSecrets, err := s.Store.ListRaw(service)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]bool{}
+	for i, rawSecret := range rawSecrets {
+		k := shortKey(rawSecret.Key)
+		version, pinned := pins[k]
+		if !pinned {
+			continue
+		}
+		secret, err := s.Store.Read(SecretId{Service: service, Key: k}, version)
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rawSecrets[i].Value = *secret.Value
+		found[k] = true
+	}
+
+	missing := []string{}
+	for k, version := range pins {
+		if !found[k] {
+			missing = append(missing, fmt.Sprintf("%s@%d", k, version))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("pinned versions not found in %s: %s", service, strings.Join(missing, ", "))
+	}
+	return rawSecrets, nil
+}
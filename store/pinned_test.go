@@ -0,0 +1,42 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionPinnedStore(t *testing.T) {
+	mock := &mockSSMClient{parameters: map[string]mockParameter{}}
+	ssmStore := NewTestSSMStoreWithPaths(mock)
+	ssmStore.Write(SecretId{Service: "app", Key: "db_password"}, "first")
+	ssmStore.Write(SecretId{Service: "app", Key: "db_password"}, "second")
+	ssmStore.Write(SecretId{Service: "app", Key: "db_password"}, "third")
+	ssmStore.Write(SecretId{Service: "app", Key: "api_key"}, "first")
+	ssmStore.Write(SecretId{Service: "app", Key: "api_key"}, "second")
+	ssmStore.Write(SecretId{Service: "worker", Key: "token"}, "first")
+	ssmStore.Write(SecretId{Service: "worker", Key: "token"}, "second")
+
+	t.Run("pinned keys are read at their own version", func(t *testing.T) {
+		s := NewVersionPinnedStore(ssmStore, map[string]map[string]int{"app": {"db_password": 2}})
+		secrets, err := s.ListRaw("app")
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, []RawSecret{
+			{Key: "/app/db_password", Value: "second"},
+			{Key: "/app/api_key", Value: "second"},
+		}, secrets)
+	})
+
+	t.Run("other services are read at their latest version", func(t *testing.T) {
+		s := NewVersionPinnedStore(ssmStore, map[string]map[string]int{"app": {"db_password": 1}})
+		secrets, err := s.ListRaw("worker")
+		assert.Nil(t, err)
+		assert.Equal(t, []RawSecret{{Key: "/worker/token", Value: "second"}}, secrets)
+	})
+
+	t.Run("pins without the version are an error", func(t *testing.T) {
+		s := NewVersionPinnedStore(ssmStore, map[string]map[string]int{"app": {"db_password": 3, "api_key": 3, "missing": 1}})
+		_, err := s.ListRaw("app")
+		assert.EqualError(t, err, "pinned versions not found in app: api_key@3, missing@1")
+	})
+}
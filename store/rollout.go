@@ -0,0 +1,121 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// ensure RolloutStore confirms to Store interface
+var _ Store = &RolloutStore{}
+
+// RolloutKey is the key of the JSON object holding the candidates of a
+// rollout value, like
+//
+//	{"chamber_rollout": [{"value": "new", "weight": 10}, {"value": "old", "weight": 90}]}
+const RolloutKey = "chamber_rollout"
+
+// RolloutCandidate is one of the values of a rollout, chosen for about
+// Weight / (sum of all weights) of hosts
+type RolloutCandidate struct {
+	Value  string `json:"value"`
+	Weight int    `json:"weight"`
+}
+
+// RolloutStore wraps a Store so that ListRaw resolves rollout values to one
+// of their candidates. The candidate is chosen deterministically from the
+// identity of the host, so that a given host always gets the same value and a
+// new credential or endpoint can be rolled out to a growing share of a fleet.
+type RolloutStore struct {
+	Store
+	id string
+}
+
+// NewRolloutStore creates a new RolloutStore wrapping s, choosing values for
+// the host identified by id, e.g. an instance ID
+func NewRolloutStore(s Store, id string) *RolloutStore {
+	return &RolloutStore{Store: s, id: id}
+}
+
+// ListRaw lists all secrets keys and values for a given service, with rollout
+// values resolved.
+func (s *RolloutStore) ListRaw(service string) ([]RawSecret, error) {
+	rawSecrets, err := s.Store.ListRaw(service)
+	if err != nil {
+		return nil, err
+	}
+	return resolveRollouts(rawSecrets, s.id)
+}
+
+func resolveRollouts(rawSecrets []RawSecret, id string) ([]RawSecret, error) {
+	resolved := make([]RawSecret, 0, len(rawSecrets))
+	for _, rawSecret := range rawSecrets {
+		candidates, ok, err := rolloutCandidates(rawSecret.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rollout in %s: %w", rawSecret.Key, err)
+		}
+		if ok {
+			rawSecret.Value = chooseCandidate(candidates, id)
+		}
+		resolved = append(resolved, rawSecret)
+	}
+	return resolved, nil
+}
+
+// rolloutCandidates decodes value if it holds a rollout
+func rolloutCandidates(value string) ([]RolloutCandidate, bool, error) {
+	trimmed := strings.TrimSpace(value)
+	if !strings.HasPrefix(trimmed, "{") || !strings.Contains(trimmed, RolloutKey) {
+		return nil, false, nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(trimmed), &obj); err != nil {
+		return nil, false, nil
+	}
+	raw, ok := obj[RolloutKey]
+	if !ok || len(obj) != 1 {
+		return nil, false, nil
+	}
+
+	var candidates []RolloutCandidate
+	if err := json.Unmarshal(raw, &candidates); err != nil {
+		return nil, false, err
+	}
+	total := 0
+	for _, c := range candidates {
+		if c.Weight < 0 {
+			return nil, false, errors.New("weights must not be negative")
+		}
+		total += c.Weight
+	}
+	if total == 0 {
+		return nil, false, errors.New("weights must add up to more than 0")
+	}
+	return candidates, true, nil
+}
+
+// chooseCandidate picks a candidate from where the hash of id falls among the
+// cumulated weights. Every key uses the same point for a host, so related
+// values rolled out together are switched together, and increasing the
+// weight of the first candidate only moves hosts to it.
+func chooseCandidate(candidates []RolloutCandidate, id string) string {
+	total := 0
+	for _, c := range candidates {
+		total += c.Weight
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	point := float64(h.Sum64()%1000000) / 1000000 * float64(total)
+
+	cumulated := 0
+	for _, c := range candidates {
+		cumulated += c.Weight
+		if point < float64(cumulated) {
+			return c.Value
+		}
+	}
+	return candidates[len(candidates)-1].Value
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveRollouts(t *testing.T) {
+	rawSecrets := []RawSecret{
+		{Key: "/app/plain", Value: "hunter22"},
+		{Key: "/app/json", Value: `{"chamber_rollout": "not alone", "other": 1}`},
+		{Key: "/app/all", Value: `{"chamber_rollout": [{"value": "new", "weight": 1}, {"value": "old", "weight": 0}]}`},
+		{Key: "/app/none", Value: `{"chamber_rollout": [{"value": "new", "weight": 0}, {"value": "old", "weight": 5}]}`},
+	}
+
+	resolved, err := resolveRollouts(rawSecrets, "i-0123456789abcdef0")
+	assert.NoError(t, err)
+	assert.Equal(t, []RawSecret{
+		{Key: "/app/plain", Value: "hunter22"},
+		{Key: "/app/json", Value: `{"chamber_rollout": "not alone", "other": 1}`},
+		{Key: "/app/all", Value: "new"},
+		{Key: "/app/none", Value: "old"},
+	}, resolved)
+
+	for _, value := range []string{
+		`{"chamber_rollout": "new"}`,
+		`{"chamber_rollout": []}`,
+		`{"chamber_rollout": [{"value": "new", "weight": -1}, {"value": "old", "weight": 2}]}`,
+	} {
+		_, err := resolveRollouts([]RawSecret{{Key: "/app/bad", Value: value}}, "host")
+		assert.Error(t, err, value)
+	}
+}
+
+func TestChooseCandidate(t *testing.T) {
+	candidates := []RolloutCandidate{{Value: "new", Weight: 10}, {Value: "old", Weight: 90}}
+
+	chosen := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		id := fmt.Sprintf("i-%d", i)
+		value := chooseCandidate(candidates, id)
+		assert.Equal(t, value, chooseCandidate(candidates, id), "choices are deterministic")
+		chosen[value]++
+	}
+	assert.InDelta(t, 1000, chosen["new"], 150)
+	assert.InDelta(t, 9000, chosen["old"], 150)
+
+	t.Run("increasing the weight of the first candidate only moves hosts to it", func(t *testing.T) {
+		more := []RolloutCandidate{{Value: "new", Weight: 50}, {Value: "old", Weight: 50}}
+		for i := 0; i < 1000; i++ {
+			id := fmt.Sprintf("i-%d", i)
+			if chooseCandidate(candidates, id) == "new" {
+				assert.Equal(t, "new", chooseCandidate(more, id))
+			}
+		}
+	})
+}
@@ -1,3 +1,5 @@
+//go:build !nos3
+
 package store
 
 import (
@@ -299,6 +301,24 @@ func (s *S3Store) getCurrentUser() (string, error) {
 	return *resp.Arn, nil
 }
 
+func (s *S3Store) ReadTags(id SecretId) (map[string]string, error) {
+	return nil, fmt.Errorf("S3 Backend is experimental and does not implement tags")
+}
+
+func (s *S3Store) WriteTags(id SecretId, tags map[string]string) error {
+	return fmt.Errorf("S3 Backend is experimental and does not implement tags")
+}
+
+func (s *S3Store) DeleteTags(id SecretId, tagKeys []string) error {
+	return fmt.Errorf("S3 Backend is experimental and does not implement tags")
+}
+
+// Capabilities reports the features of the S3 backends, which keep the
+// history of each secret in its object
+func (s *S3Store) Capabilities() Capabilities {
+	return Capabilities{History: true}
+}
+
 func (s *S3Store) deleteObjectById(id SecretId) error {
 	path := getObjectPath(id)
 	return s.deleteObject(path)
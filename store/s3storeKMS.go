@@ -1,7 +1,10 @@
+//go:build !nos3
+
 package store
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -30,7 +33,8 @@ type LatestValue struct {
 	KMSAlias string `json:"KMSAlias"`
 }
 
-var _ Store = &S3KMSStore{}
+var _ EncryptionContextStore = &S3KMSStore{}
+var _ KMSKeyStore = &S3KMSStore{}
 
 type S3KMSStore struct {
 	S3Store
@@ -38,6 +42,9 @@ type S3KMSStore struct {
 	stsSvc      *sts.STS
 	bucket      string
 	kmsKeyAlias string
+	// serviceContext is whether objects are encrypted with the encryption
+	// context of their service
+	serviceContext bool
 }
 
 func NewS3KMSStore(numRetries int, bucket string, kmsKeyAlias string) (*S3KMSStore, error) {
@@ -75,6 +82,39 @@ func NewS3KMSStore(numRetries int, bucket string, kmsKeyAlias string) (*S3KMSSto
 	}, nil
 }
 
+// WithKMSKey returns a copy of s writing secrets with the KMS key key rather
+// than the one it was created with. As with any key, secrets already written
+// with another key can't be overwritten.
+func (s *S3KMSStore) WithKMSKey(key string) Store {
+	withKey := *s
+	withKey.kmsKeyAlias = NormalizeKMSKey(key)
+	return &withKey
+}
+
+// WithServiceEncryptionContext returns a copy of s encrypting the objects of
+// a service, its secrets and their index, with the encryption context
+// {"service": "<service>"}. S3 decrypts them with the context they were
+// written with, so key policies conditioned on kms:EncryptionContext:service
+// refuse to decrypt the objects of other services, or written without it.
+func (s *S3KMSStore) WithServiceEncryptionContext() Store {
+	withContext := *s
+	withContext.serviceContext = true
+	return &withContext
+}
+
+// encryptionContext returns the encryption context header of the objects of
+// service, or nil when they aren't encrypted with one
+func (s *S3KMSStore) encryptionContext(service string) (*string, error) {
+	if !s.serviceContext {
+		return nil, nil
+	}
+	context, err := json.Marshal(map[string]string{EncryptionContextKey: service})
+	if err != nil {
+		return nil, err
+	}
+	return aws.String(base64.StdEncoding.EncodeToString(context)), nil
+}
+
 func (s *S3KMSStore) Write(id SecretId, value string) error {
 	index, err := s.readLatest(id.Service)
 	if err != nil {
@@ -120,13 +160,18 @@ func (s *S3KMSStore) Write(id SecretId, value string) error {
 	if err != nil {
 		return err
 	}
+	context, err := s.encryptionContext(id.Service)
+	if err != nil {
+		return err
+	}
 
 	putObjectInput := &s3.PutObjectInput{
-		Bucket:               aws.String(s.bucket),
-		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
-		SSEKMSKeyId:          aws.String(s.kmsKeyAlias),
-		Key:                  aws.String(objPath),
-		Body:                 bytes.NewReader(contents),
+		Bucket:                  aws.String(s.bucket),
+		ServerSideEncryption:    aws.String(s3.ServerSideEncryptionAwsKms),
+		SSEKMSKeyId:             aws.String(s.kmsKeyAlias),
+		SSEKMSEncryptionContext: context,
+		Key:                     aws.String(objPath),
+		Body:                    bytes.NewReader(contents),
 	}
 
 	_, err = s.svc.PutObject(putObjectInput)
@@ -268,16 +313,21 @@ func (s *S3KMSStore) readObject(path string) (secretObject, bool, error) {
 
 }
 
-func (s *S3KMSStore) puts3raw(path string, contents []byte) error {
+func (s *S3KMSStore) puts3raw(service, path string, contents []byte) error {
+	context, err := s.encryptionContext(service)
+	if err != nil {
+		return err
+	}
 	putObjectInput := &s3.PutObjectInput{
-		Bucket:               aws.String(s.bucket),
-		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
-		SSEKMSKeyId:          aws.String(s.kmsKeyAlias),
-		Key:                  aws.String(path),
-		Body:                 bytes.NewReader(contents),
+		Bucket:                  aws.String(s.bucket),
+		ServerSideEncryption:    aws.String(s3.ServerSideEncryptionAwsKms),
+		SSEKMSKeyId:             aws.String(s.kmsKeyAlias),
+		SSEKMSEncryptionContext: context,
+		Key:                     aws.String(path),
+		Body:                    bytes.NewReader(contents),
 	}
 
-	_, err := s.svc.PutObject(putObjectInput)
+	_, err = s.svc.PutObject(putObjectInput)
 	return err
 }
 
@@ -386,5 +436,5 @@ func (s *S3KMSStore) writeLatest(service string, index LatestIndexFile) error {
 		return err
 	}
 
-	return s.puts3raw(path, raw)
+	return s.puts3raw(service, path, raw)
 }
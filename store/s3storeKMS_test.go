@@ -0,0 +1,33 @@
+//go:build !nos3
+
+package store
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3KMSEncryptionContext(t *testing.T) {
+	s := &S3KMSStore{kmsKeyAlias: DefaultKeyID}
+	context, err := s.encryptionContext("billing")
+	require.NoError(t, err)
+	assert.Nil(t, context)
+
+	withContext := s.WithServiceEncryptionContext().(*S3KMSStore)
+	context, err = withContext.encryptionContext("billing")
+	require.NoError(t, err)
+	decoded, err := base64.StdEncoding.DecodeString(*context)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"service":"billing"}`, string(decoded))
+	assert.False(t, s.serviceContext)
+}
+
+func TestS3KMSWithKMSKey(t *testing.T) {
+	s := &S3KMSStore{kmsKeyAlias: DefaultKeyID}
+	withKey := s.WithKMSKey("billing_key").(*S3KMSStore)
+	assert.Equal(t, "alias/billing_key", withKey.kmsKeyAlias)
+	assert.Equal(t, DefaultKeyID, s.kmsKeyAlias)
+}
@@ -1,3 +1,5 @@
+//go:build !nosecretsmanager
+
 // Secrets Manager Store is maintained by Dan MacTough https://github.com/danmactough. Thanks Dan!
 package store
 
@@ -104,20 +106,30 @@ func NewSecretsManagerStore(numRetries int) (*SecretsManagerStore, error) {
 // Write writes a given value to a secret identified by id. If the secret
 // already exists, then write a new version.
 func (s *SecretsManagerStore) Write(id SecretId, value string) error {
+	if len(value) == 0 {
+		return s.WriteBatch(id.Service, nil, []string{id.Key})
+	}
+	return s.WriteBatch(id.Service, map[string]string{id.Key: value}, nil)
+}
+
+// WriteBatch sets the keys of values and deletes the keys of deleted in a
+// single new version of the secret of service, so either every change is
+// made or none is.
+func (s *SecretsManagerStore) WriteBatch(service string, values map[string]string, deleted []string) error {
 	version := 1
 	// first read to get the current version
-	latest, err := s.readLatest(id.Service)
+	latest, err := s.readLatest(service)
 	mustCreate := false
-	deleteKeyFromSecret := len(value) == 0
+	onlyDeletes := len(values) == 0
 
 	// Failure to readLatest may be a true error or an expected error.
 	// We expect that when we write a secret that it may not already exist:
 	// that's the secretsmanager.ErrCodeResourceNotFoundException.
 	if err != nil {
-		// However, if the operation is to deleteKeyFromSecret and there's either
-		// a true error or the secret does not yet exist, that's true error because
-		// we cannot delete something that does not exist.
-		if deleteKeyFromSecret {
+		// However, if the operation only deletes keys and there's either a
+		// true error or the secret does not yet exist, that's true error
+		// because we cannot delete something that does not exist.
+		if onlyDeletes {
 			return err
 		}
 		if err != ErrSecretNotFound {
@@ -133,54 +145,49 @@ func (s *SecretsManagerStore) Write(id SecretId, value string) error {
 		}
 	}
 
-	if deleteKeyFromSecret {
-		if _, ok := latest[id.Key]; ok {
-			delete(latest, id.Key)
-		} else {
+	metadata, err := getHydratedMetadata(&latest)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range deleted {
+		if _, ok := latest[key]; !ok {
 			return ErrSecretNotFound
 		}
-		metadata, err := getHydratedMetadata(&latest)
-		if err != nil {
-			return err
-		}
-		if _, ok := metadata[id.Key]; ok {
-			delete(metadata, id.Key)
-		}
+		delete(latest, key)
+		delete(metadata, key)
+	}
 
-		rawMetadata, err := dehydrateMetadata(&metadata)
-		if err != nil {
-			return err
-		}
-		latest[metadataKey] = rawMetadata
-	} else {
+	if len(values) > 0 {
 		user, err := s.getCurrentUser()
 		if err != nil {
 			return err
 		}
 
-		metadata, err := getHydratedMetadata(&latest)
-		if err != nil {
-			return err
-		}
-
-		if keyMetadata, ok := metadata[id.Key]; ok {
-			version = keyMetadata.Version + 1
-		}
-
-		metadata[id.Key] = secretMetadata{
-			Version:   version,
-			Created:   time.Now().UTC(),
-			CreatedBy: user,
-		}
+		for key, value := range values {
+			keyVersion := 1
+			if keyMetadata, ok := metadata[key]; ok {
+				keyVersion = keyMetadata.Version + 1
+			}
+			// the new version is staged with the highest version written
+			if keyVersion > version {
+				version = keyVersion
+			}
 
-		rawMetadata, err := dehydrateMetadata(&metadata)
-		if err != nil {
-			return err
+			metadata[key] = secretMetadata{
+				Version:   keyVersion,
+				Created:   time.Now().UTC(),
+				CreatedBy: user,
+			}
+			latest[key] = value
 		}
+	}
 
-		latest[id.Key] = value
-		latest[metadataKey] = rawMetadata
+	rawMetadata, err := dehydrateMetadata(&metadata)
+	if err != nil {
+		return err
 	}
+	latest[metadataKey] = rawMetadata
 
 	contents, err := json.Marshal(latest)
 	if err != nil {
@@ -189,7 +196,7 @@ func (s *SecretsManagerStore) Write(id SecretId, value string) error {
 
 	if mustCreate {
 		createSecretValueInput := &secretsmanager.CreateSecretInput{
-			Name:         aws.String(id.Service),
+			Name:         aws.String(service),
 			SecretString: aws.String(string(contents)),
 		}
 		_, err = s.svc.CreateSecret(createSecretValueInput)
@@ -200,7 +207,7 @@ func (s *SecretsManagerStore) Write(id SecretId, value string) error {
 		// Check that rotation is not enabled. We refuse to write to secrets with
 		// rotation enabled.
 		describeSecretInput := &secretsmanager.DescribeSecretInput{
-			SecretId: aws.String(id.Service),
+			SecretId: aws.String(service),
 		}
 		details, err := s.svc.DescribeSecret(describeSecretInput)
 		if err != nil {
@@ -211,7 +218,7 @@ func (s *SecretsManagerStore) Write(id SecretId, value string) error {
 		}
 
 		putSecretValueInput := &secretsmanager.PutSecretValueInput{
-			SecretId:      aws.String(id.Service),
+			SecretId:      aws.String(service),
 			SecretString:  aws.String(string(contents)),
 			VersionStages: []*string{aws.String("AWSCURRENT"), aws.String("CHAMBER" + fmt.Sprint(version))},
 		}
@@ -409,6 +416,9 @@ func (s *SecretsManagerStore) List(serviceName string, includeValues bool) ([]Se
 func (s *SecretsManagerStore) ListRaw(serviceName string) ([]RawSecret, error) {
 	latest, err := s.readLatest(serviceName)
 	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+			return nil, ErrSecretNotFound
+		}
 		return nil, err
 	}
 
@@ -505,6 +515,30 @@ func (s *SecretsManagerStore) History(id SecretId) ([]ChangeEvent, error) {
 	return events, nil
 }
 
+// Capabilities reports the features of the Secrets Manager backend. Since all
+// keys of a service share one secret, the size limit applies to the whole
+// service rather than to each value.
+func (s *SecretsManagerStore) Capabilities() Capabilities {
+	return Capabilities{
+		History:      true,
+		MaxValueSize: 65536,
+	}
+}
+
+// ReadTags is not supported, since Secrets Manager tags apply to a whole
+// service rather than to individual keys.
+func (s *SecretsManagerStore) ReadTags(id SecretId) (map[string]string, error) {
+	return nil, fmt.Errorf("Secrets Manager Backend is experimental and does not implement tags")
+}
+
+func (s *SecretsManagerStore) WriteTags(id SecretId, tags map[string]string) error {
+	return fmt.Errorf("Secrets Manager Backend is experimental and does not implement tags")
+}
+
+func (s *SecretsManagerStore) DeleteTags(id SecretId, tagKeys []string) error {
+	return fmt.Errorf("Secrets Manager Backend is experimental and does not implement tags")
+}
+
 func (s *SecretsManagerStore) getCurrentUser() (string, error) {
 	resp, err := s.stsSvc.GetCallerIdentity(&sts.GetCallerIdentityInput{})
 	if err != nil {
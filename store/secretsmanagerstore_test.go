@@ -1,3 +1,5 @@
+//go:build !nosecretsmanager
+
 package store
 
 import (
@@ -17,6 +19,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type mockSecretsManagerClient struct {
@@ -252,6 +255,28 @@ func TestSecretsManagerWrite(t *testing.T) {
 	})
 }
 
+func TestSecretsManagerWriteBatch(t *testing.T) {
+	mock := &mockSecretsManagerClient{secrets: map[string]mockSecret{}, outputs: map[string]secretsmanager.DescribeSecretOutput{}}
+	store := NewTestSecretsManagerStore(mock)
+	require.NoError(t, store.WriteBatch("test", map[string]string{"a": "1", "b": "2", "c": "3"}, nil))
+	assert.Equal(t, 1, len(mock.secrets["test"].history))
+
+	require.NoError(t, store.WriteBatch("test", map[string]string{"a": "10", "d": "4"}, []string{"b"}))
+	current := *mock.secrets["test"].currentSecret
+	assert.Equal(t, 2, len(mock.secrets["test"].history))
+	assert.Equal(t, "10", current["a"])
+	assert.NotContains(t, current, "b")
+	assert.Equal(t, "3", current["c"])
+	assert.Equal(t, "4", current["d"])
+	key := "a"
+	keyMetadata, err := getHydratedKeyMetadata(&current, &key)
+	require.NoError(t, err)
+	assert.Equal(t, 2, keyMetadata.Version)
+
+	assert.Equal(t, ErrSecretNotFound, store.WriteBatch("test", nil, []string{"missing"}))
+	assert.Equal(t, 2, len(mock.secrets["test"].history))
+}
+
 func TestSecretsManagerRead(t *testing.T) {
 	mock := &mockSecretsManagerClient{secrets: map[string]mockSecret{}}
 	store := NewTestSecretsManagerStore(mock)
@@ -1,7 +1,14 @@
 package store
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
@@ -14,6 +21,63 @@ const (
 	CustomSSMEndpointEnvVar = "CHAMBER_AWS_SSM_ENDPOINT"
 )
 
+// httpClient is used by every AWS client when set by SetHTTPOptions
+var httpClient *http.Client
+
+// SetHTTPOptions makes every backend send its requests through proxy, when
+// not empty, and trust the PEM certificates in the caBundle file, when not
+// empty, as well as the system ones. It must be called before creating stores.
+func SetHTTPOptions(proxy, caBundle string) error {
+	if proxy == "" && caBundle == "" {
+		httpClient = nil
+		return nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.Host == "" {
+			return fmt.Errorf("invalid proxy URL %q", proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if caBundle != "" {
+		pem, err := os.ReadFile(caBundle)
+		if err != nil {
+			return fmt.Errorf("Failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("CA bundle contains no PEM certificates")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	httpClient = &http.Client{Transport: transport}
+	return nil
+}
+
+// NewHTTPClient returns a client for requests to services other than AWS,
+// sent through the proxy and trusting the CA bundle of SetHTTPOptions like
+// the backends, and giving up after timeout
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if httpClient != nil {
+		client.Transport = httpClient.Transport
+	}
+	return client
+}
+
+// NewSession creates an AWS session configured the same way as the backends,
+// for commands that need to talk to AWS services other than the store itself.
+// The returned region is the one resolved from the environment, if any.
+func NewSession(numRetries int) (*session.Session, *string, error) {
+	return getSession(numRetries)
+}
+
 func getSession(numRetries int) (*session.Session, *string, error) {
 	var region *string
 
@@ -37,6 +101,7 @@ func getSession(numRetries int) (*session.Session, *string, error) {
 				Region:           region,
 				MaxRetries:       aws.Int(numRetries),
 				EndpointResolver: endpoints.ResolverFunc(endpointResolver),
+				HTTPClient:       httpClient,
 			},
 			SharedConfigState: session.SharedConfigEnable,
 		},
@@ -57,6 +122,12 @@ func getSession(numRetries int) (*session.Session, *string, error) {
 	return retSession, region, nil
 }
 
+// InstanceID returns the ID of the EC2 instance chamber runs on, from the
+// instance metadata service
+func InstanceID() (string, error) {
+	return ec2metadata.New(session.New()).GetMetadata("instance-id")
+}
+
 func uniqueStringSlice(slice []string) []string {
 	unique := make(map[string]struct{}, len(slice))
 	j := 0
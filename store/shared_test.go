@@ -0,0 +1,85 @@
+package store
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetHTTPOptions(t *testing.T) {
+	defer SetHTTPOptions("", "")
+
+	t.Run("no options uses the default client", func(t *testing.T) {
+		assert.NoError(t, SetHTTPOptions("", ""))
+		assert.Nil(t, httpClient)
+	})
+
+	t.Run("requests go through the proxy", func(t *testing.T) {
+		var proxied string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxied = r.URL.String()
+		}))
+		defer proxy.Close()
+
+		assert.NoError(t, SetHTTPOptions(proxy.URL, ""))
+		resp, err := httpClient.Get("http://ssm.example.invalid/path")
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, "http://ssm.example.invalid/path", proxied)
+	})
+
+	t.Run("certificates in the CA bundle are trusted", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		bundle := filepath.Join(t.TempDir(), "ca.pem")
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		assert.NoError(t, os.WriteFile(bundle, certPEM, 0600))
+
+		assert.NoError(t, SetHTTPOptions("", ""))
+		_, err := http.DefaultClient.Get(server.URL)
+		assert.Error(t, err)
+
+		assert.NoError(t, SetHTTPOptions("", bundle))
+		resp, err := httpClient.Get(server.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	})
+
+	t.Run("invalid options are rejected", func(t *testing.T) {
+		assert.Error(t, SetHTTPOptions("not a url", ""))
+
+		empty := filepath.Join(t.TempDir(), "empty.pem")
+		assert.NoError(t, os.WriteFile(empty, []byte("nothing here"), 0600))
+		assert.EqualError(t, SetHTTPOptions("", empty), "CA bundle contains no PEM certificates")
+
+		assert.Error(t, SetHTTPOptions("", filepath.Join(t.TempDir(), "missing.pem")))
+	})
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	defer SetHTTPOptions("", "")
+
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	assert.NoError(t, SetHTTPOptions(proxy.URL, ""))
+	client := NewHTTPClient(time.Second)
+	assert.Equal(t, time.Second, client.Timeout)
+	resp, err := client.Post("http://hooks.example.invalid/notify", "application/json", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "http://hooks.example.invalid/notify", proxied)
+
+	assert.NoError(t, SetHTTPOptions("", ""))
+	assert.Nil(t, NewHTTPClient(time.Second).Transport)
+}
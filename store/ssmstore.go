@@ -1,6 +1,8 @@
 package store
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
@@ -21,6 +23,10 @@ const (
 
 	// DefaultMinThrottleDelay is the default delay before retrying throttled requests
 	DefaultMinThrottleDelay = client.DefaultRetryerMinThrottleDelay
+
+	// PrefixEnvVar is the environment variable holding a path that all
+	// services are stored under, so several teams can share an account
+	PrefixEnvVar = "CHAMBER_PREFIX"
 )
 
 // validPathKeyFormat is the format that is expected for key names inside parameter store
@@ -32,7 +38,11 @@ var validPathKeyFormat = regexp.MustCompile(`^(\/[\w\-\.]+)+$`)
 var validKeyFormat = regexp.MustCompile(`^[\w\-\.]+$`)
 
 // ensure SSMStore confirms to Store interface
-var _ Store = &SSMStore{}
+var _ KMSKeyStore = &SSMStore{}
+var _ PolicyStore = &SSMStore{}
+var _ StringListStore = &SSMStore{}
+var _ BatchReader = &SSMStore{}
+var _ Creator = &SSMStore{}
 
 // label check regexp
 var labelMatchRegex = regexp.MustCompile(`^(\/[\w\-\.]+)+:(.+)$`)
@@ -42,24 +52,42 @@ var labelMatchRegex = regexp.MustCompile(`^(\/[\w\-\.]+)+:(.+)$`)
 type SSMStore struct {
 	svc      ssmiface.SSMAPI
 	usePaths bool
+	prefix   string
+	// kmsKey, if set, overrides CHAMBER_KMS_KEY_ALIAS
+	kmsKey string
+	// listSeparator, if set, joins the values of StringList parameters
+	// instead of ssmListSeparator
+	listSeparator string
 }
 
+// ssmListSeparator separates the values of StringList parameters
+const ssmListSeparator = ","
+
 // NewSSMStore creates a new SSMStore
 func NewSSMStore(numRetries int) (*SSMStore, error) {
-	return ssmStoreUsingRetryer(numRetries, DefaultMinThrottleDelay)
+	return ssmStoreUsingRetryer(numRetries, DefaultMinThrottleDelay, "")
 }
 
 // NewSSMStoreWithMinThrottleDelay creates a new SSMStore with the aws sdk max retries and min throttle delay are configured.
 func NewSSMStoreWithMinThrottleDelay(numRetries int, minThrottleDelay time.Duration) (*SSMStore, error) {
-	return ssmStoreUsingRetryer(numRetries, minThrottleDelay)
+	return ssmStoreUsingRetryer(numRetries, minThrottleDelay, "")
+}
+
+// NewSSMStoreInRegion creates a new SSMStore talking to the given region
+// rather than the one configured in the environment.
+func NewSSMStoreInRegion(numRetries int, minThrottleDelay time.Duration, region string) (*SSMStore, error) {
+	return ssmStoreUsingRetryer(numRetries, minThrottleDelay, region)
 }
 
-func ssmStoreUsingRetryer(numRetries int, minThrottleDelay time.Duration) (*SSMStore, error) {
+func ssmStoreUsingRetryer(numRetries int, minThrottleDelay time.Duration, regionOverride string) (*SSMStore, error) {
 	ssmSession, region, err := getSession(numRetries)
 
 	if err != nil {
 		return nil, err
 	}
+	if regionOverride != "" {
+		region = aws.String(regionOverride)
+	}
 
 	retryer := client.DefaultRetryer{NumMaxRetries: numRetries, MinThrottleDelay: minThrottleDelay}
 
@@ -74,13 +102,50 @@ func ssmStoreUsingRetryer(numRetries int, minThrottleDelay time.Duration) (*SSMS
 		Region:  region,
 	})
 
-	return &SSMStore{
+	ssmStore := &SSMStore{
 		svc:      svc,
 		usePaths: usePaths,
-	}, nil
+	}
+	return ssmStore.WithPrefix(os.Getenv(PrefixEnvVar))
+}
+
+// WithPrefix returns a copy of s that stores all services under prefix, such
+// as /chamber/team. Keys returned by the copy do not include the prefix. An
+// empty prefix stores services at the root.
+func (s *SSMStore) WithPrefix(prefix string) (*SSMStore, error) {
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		if !s.usePaths {
+			return nil, fmt.Errorf("%s cannot be used with CHAMBER_NO_PATHS", PrefixEnvVar)
+		}
+		prefix = "/" + prefix
+		if !validPathKeyFormat.MatchString(prefix) {
+			return nil, fmt.Errorf("invalid %s '%s'", PrefixEnvVar, prefix)
+		}
+	}
+	withPrefix := *s
+	withPrefix.prefix = prefix
+	return &withPrefix, nil
+}
+
+// Prefix returns the path all services are stored under, if any
+func (s *SSMStore) Prefix() string {
+	return s.prefix
+}
+
+// WithKMSKey returns a copy of s writing secrets with the KMS key key rather
+// than the one in CHAMBER_KMS_KEY_ALIAS
+func (s *SSMStore) WithKMSKey(key string) Store {
+	withKey := *s
+	withKey.kmsKey = NormalizeKMSKey(key)
+	return &withKey
 }
 
+// KMSKey returns the KMS key secrets are written with
 func (s *SSMStore) KMSKey() string {
+	if s.kmsKey != "" {
+		return s.kmsKey
+	}
 	fromEnv, ok := os.LookupEnv("CHAMBER_KMS_KEY_ALIAS")
 	if !ok {
 		return DefaultKeyID
@@ -95,6 +160,87 @@ func (s *SSMStore) KMSKey() string {
 // Write writes a given value to a secret identified by id.  If the secret
 // already exists, then write a new version.
 func (s *SSMStore) Write(id SecretId, value string) error {
+	return s.write(id, value, ssm.ParameterTypeSecureString, WritePolicies{})
+}
+
+// Create writes the first version of a secret, without overwriting it if it
+// already exists, which Parameter Store checks atomically.
+func (s *SSMStore) Create(id SecretId, value string) error {
+	_, err := s.svc.PutParameter(&ssm.PutParameterInput{
+		Name:        aws.String(s.idToName(id)),
+		Type:        aws.String(ssm.ParameterTypeSecureString),
+		Value:       aws.String(value),
+		KeyId:       aws.String(s.KMSKey()),
+		Overwrite:   aws.Bool(false),
+		Description: aws.String("1"),
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == ssm.ErrCodeParameterAlreadyExists {
+		return ErrSecretExists
+	}
+	return err
+}
+
+// WriteStringList writes values as a StringList parameter. Unlike other
+// secrets, StringList parameters are not encrypted.
+func (s *SSMStore) WriteStringList(id SecretId, values []string) error {
+	if len(values) == 0 {
+		return errors.New("a list needs at least one value")
+	}
+	for _, v := range values {
+		if v == "" || strings.Contains(v, ssmListSeparator) {
+			return fmt.Errorf("invalid list value %q: values cannot be empty or contain %s", v, ssmListSeparator)
+		}
+	}
+	return s.write(id, strings.Join(values, ssmListSeparator), ssm.ParameterTypeStringList, WritePolicies{})
+}
+
+// WithListSeparator returns a copy of s joining the values of StringList
+// parameters with sep, rather than a comma, when reading them
+func (s *SSMStore) WithListSeparator(sep string) Store {
+	withSeparator := *s
+	withSeparator.listSeparator = sep
+	return &withSeparator
+}
+
+// readValue returns the value of a parameter of type paramType as it is read,
+// joining the values of lists with the list separator
+func (s *SSMStore) readValue(paramType, value *string) *string {
+	if value == nil || aws.StringValue(paramType) != ssm.ParameterTypeStringList || s.listSeparator == "" {
+		return value
+	}
+	return aws.String(strings.ReplaceAll(*value, ssmListSeparator, s.listSeparator))
+}
+
+// WriteWithPolicies writes a secret with parameter policies, which require
+// the advanced parameter tier, which is billed. An Expiration policy makes
+// Parameter Store delete the secret once policies.Expires has passed, and a
+// NoChangeNotification policy makes
+// EventBridge notify once the secret has gone unchanged for
+// policies.NotifyNoChange.
+func (s *SSMStore) WriteWithPolicies(id SecretId, value string, policies WritePolicies) error {
+	if policies.NotifyNoChange < 0 || policies.NotifyNoChange%time.Hour != 0 {
+		return fmt.Errorf("invalid no change notification period %s: must be a positive number of hours", policies.NotifyNoChange)
+	}
+	return s.write(id, value, ssm.ParameterTypeSecureString, policies)
+}
+
+// ssmMaxValueSize is the largest value of a standard tier parameter
+const ssmMaxValueSize = 4096
+
+// Capabilities reports the features of Parameter Store. Labels are only
+// supported when services are stored as paths.
+func (s *SSMStore) Capabilities() Capabilities {
+	return Capabilities{
+		History:          true,
+		Labels:           s.usePaths,
+		Tags:             true,
+		Expiry:           true,
+		MaxValueSize:     ssmMaxValueSize,
+		ConcurrentWrites: true,
+	}
+}
+
+func (s *SSMStore) write(id SecretId, value, paramType string, policies WritePolicies) error {
 	version := 1
 	// first read to get the current version
 	current, err := s.Read(id, -1)
@@ -106,13 +252,19 @@ func (s *SSMStore) Write(id SecretId, value string) error {
 	}
 
 	putParameterInput := &ssm.PutParameterInput{
-		KeyId:       aws.String(s.KMSKey()),
 		Name:        aws.String(s.idToName(id)),
-		Type:        aws.String("SecureString"),
+		Type:        aws.String(paramType),
 		Value:       aws.String(value),
 		Overwrite:   aws.Bool(true),
 		Description: aws.String(strconv.Itoa(version)),
 	}
+	if paramType == ssm.ParameterTypeSecureString {
+		putParameterInput.KeyId = aws.String(s.KMSKey())
+	}
+	if !policies.IsZero() {
+		putParameterInput.Tier = aws.String(ssm.ParameterTierAdvanced)
+		putParameterInput.Policies = aws.String(parameterPolicies(policies))
+	}
 
 	// This API call returns an empty struct
 	_, err = s.svc.PutParameter(putParameterInput)
@@ -123,6 +275,48 @@ func (s *SSMStore) Write(id SecretId, value string) error {
 	return nil
 }
 
+// parameterPolicies returns the parameter policies of p: an Expiration policy
+// deleting a parameter at p.Expires, and a NoChangeNotification policy
+// notifying after p.NotifyNoChange, in days when it is whole days
+func parameterPolicies(p WritePolicies) string {
+	var policies []string
+	if !p.Expires.IsZero() {
+		policies = append(policies, fmt.Sprintf(`{"Type":"Expiration","Version":"1.0","Attributes":{"Timestamp":"%s"}}`,
+			p.Expires.UTC().Format(time.RFC3339)))
+	}
+	if p.NotifyNoChange > 0 {
+		after, unit := int(p.NotifyNoChange/time.Hour), "Hours"
+		if after%24 == 0 {
+			after, unit = after/24, "Days"
+		}
+		policies = append(policies, fmt.Sprintf(`{"Type":"NoChangeNotification","Version":"1.0","Attributes":{"After":"%d","Unit":"%s"}}`,
+			after, unit))
+	}
+	return "[" + strings.Join(policies, ",") + "]"
+}
+
+// secretPolicies parses the parameter policies in effect on a parameter.
+// Each policy's text is usually a single policy, but may be a list of them.
+func secretPolicies(inline []*ssm.ParameterInlinePolicy) []SecretPolicy {
+	var policies []SecretPolicy
+	for _, p := range inline {
+		if aws.StringValue(p.PolicyStatus) == "Finished" {
+			continue
+		}
+		text := strings.TrimSpace(aws.StringValue(p.PolicyText))
+		if !strings.HasPrefix(text, "[") {
+			text = "[" + text + "]"
+		}
+		var parsed []SecretPolicy
+		if err := json.Unmarshal([]byte(text), &parsed); err != nil {
+			// report the policy even if its attributes can't be read
+			parsed = []SecretPolicy{{Type: aws.StringValue(p.PolicyType)}}
+		}
+		policies = append(policies, parsed...)
+	}
+	return policies
+}
+
 // Read reads a secret from the parameter store at a specific version.
 // To grab the latest version, use -1 as the version number.
 func (s *SSMStore) Read(id SecretId, version int) (Secret, error) {
@@ -169,12 +363,13 @@ func (s *SSMStore) readVersion(id SecretId, version int) (Secret, error) {
 			}
 			if thisVersion == version {
 				result = Secret{
-					Value: history.Value,
+					Value: s.readValue(history.Type, history.Value),
 					Meta: SecretMetadata{
 						Created:   *history.LastModifiedDate,
 						CreatedBy: *history.LastModifiedUser,
 						Version:   thisVersion,
-						Key:       *history.Name,
+						Key:       s.stripPrefix(*history.Name),
+						Type:      aws.StringValue(history.Type),
 					},
 				}
 				return false
@@ -252,13 +447,116 @@ func (s *SSMStore) readLatest(id SecretId) (Secret, error) {
 	}
 
 	secretMeta := parameterMetaToSecretMeta(parameter)
+	secretMeta.Key = s.stripPrefix(secretMeta.Key)
 
 	return Secret{
-		Value: param.Value,
+		Value: s.readValue(param.Type, param.Value),
 		Meta:  secretMeta,
 	}, nil
 }
 
+// ssmMaxGetParameters is the most parameters GetParameters reads at once
+const ssmMaxGetParameters = 10
+
+// ReadBatch reads the latest values of keys with GetParameters, ten at a
+// time, rather than reading their metadata too as Read does
+func (s *SSMStore) ReadBatch(service string, keys []string) (map[string]string, error) {
+	names := make(map[string]string, len(keys))
+	for _, key := range keys {
+		names[s.idToName(SecretId{Service: service, Key: key})] = key
+	}
+	values := make(map[string]string, len(keys))
+	for start := 0; start < len(keys); start += ssmMaxGetParameters {
+		end := start + ssmMaxGetParameters
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := make([]*string, 0, end-start)
+		for _, key := range keys[start:end] {
+			batch = append(batch, aws.String(s.idToName(SecretId{Service: service, Key: key})))
+		}
+		resp, err := s.svc.GetParameters(&ssm.GetParametersInput{
+			Names:          batch,
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, param := range resp.Parameters {
+			if key, ok := names[aws.StringValue(param.Name)]; ok {
+				values[key] = aws.StringValue(s.readValue(param.Type, param.Value))
+			}
+		}
+	}
+	return values, nil
+}
+
+// ssmMaxDeleteParameters is the most parameters DeleteParameters deletes at
+// once
+const ssmMaxDeleteParameters = 10
+
+// DeleteBatch deletes keys with DeleteParameters, ten at a time. Parameters
+// SSM reports as invalid no longer exist, and are ignored.
+func (s *SSMStore) DeleteBatch(service string, keys []string) error {
+	for start := 0; start < len(keys); start += ssmMaxDeleteParameters {
+		end := start + ssmMaxDeleteParameters
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := make([]*string, 0, end-start)
+		for _, key := range keys[start:end] {
+			batch = append(batch, aws.String(s.idToName(SecretId{Service: service, Key: key})))
+		}
+		if _, err := s.svc.DeleteParameters(&ssm.DeleteParametersInput{Names: batch}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneVersions removes the labels of the versions of id older than the
+// latest keep. Parameter Store can't delete single versions: it deletes the
+// oldest itself once a parameter has 100, but refuses new versions instead
+// when the oldest is labeled. Once unlabeled, old versions are deleted as new
+// ones are written. It returns how many versions were unlabeled.
+func (s *SSMStore) PruneVersions(id SecretId, keep int) (int, error) {
+	name := s.idToName(id)
+	var history []*ssm.ParameterHistory
+	err := s.svc.GetParameterHistoryPages(&ssm.GetParameterHistoryInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(false),
+	}, func(o *ssm.GetParameterHistoryOutput, lastPage bool) bool {
+		history = append(history, o.Parameters...)
+		return true
+	})
+	if err != nil {
+		return 0, ErrSecretNotFound
+	}
+
+	var latest int64
+	for _, h := range history {
+		if v := aws.Int64Value(h.Version); v > latest {
+			latest = v
+		}
+	}
+	unlabeled := 0
+	for _, h := range history {
+		if aws.Int64Value(h.Version) > latest-int64(keep) || len(h.Labels) == 0 {
+			continue
+		}
+		_, err := s.svc.UnlabelParameterVersion(&ssm.UnlabelParameterVersionInput{
+			Name:             aws.String(name),
+			ParameterVersion: h.Version,
+			Labels:           h.Labels,
+		})
+		if err != nil {
+			return unlabeled, err
+		}
+		unlabeled++
+	}
+	return unlabeled, nil
+}
+
 func (s *SSMStore) ListServices(service string, includeSecretName bool) ([]string, error) {
 	secrets := map[string]Secret{}
 	var describeParametersInput *ssm.DescribeParametersInput
@@ -270,7 +568,7 @@ func (s *SSMStore) ListServices(service string, includeSecretName bool) ([]strin
 				{
 					Key:    aws.String("Name"),
 					Option: aws.String("BeginsWith"),
-					Values: []*string{aws.String("/" + service)},
+					Values: []*string{aws.String(s.servicePath(service))},
 				},
 			},
 		}
@@ -292,6 +590,7 @@ func (s *SSMStore) ListServices(service string, includeSecretName bool) ([]strin
 				continue
 			}
 			secretMeta := parameterMetaToSecretMeta(meta)
+			secretMeta.Key = s.stripPrefix(secretMeta.Key)
 			secrets[secretMeta.Key] = Secret{
 				Value: nil,
 				Meta:  secretMeta,
@@ -331,7 +630,7 @@ func (s *SSMStore) List(serviceName string, includeValues bool) ([]Secret, error
 				{
 					Key:    aws.String("Path"),
 					Option: aws.String("OneLevel"),
-					Values: []*string{aws.String("/" + service)},
+					Values: []*string{aws.String(s.servicePath(service))},
 				},
 			},
 		}
@@ -384,13 +683,17 @@ func (s *SSMStore) List(serviceName string, includeValues bool) ([]Secret, error
 
 			for _, param := range resp.Parameters {
 				secret := secrets[*param.Name]
-				secret.Value = param.Value
+				secret.Value = s.readValue(param.Type, param.Value)
 				secrets[*param.Name] = secret
 			}
 		}
 	}
 
-	return values(secrets), nil
+	listed := values(secrets)
+	for i := range listed {
+		listed[i].Meta.Key = s.stripPrefix(listed[i].Meta.Key)
+	}
+	return listed, nil
 }
 
 // ListRaw lists all secrets keys and values for a given service. Does not include any
@@ -401,7 +704,7 @@ func (s *SSMStore) ListRaw(serviceName string) ([]RawSecret, error) {
 	if s.usePaths {
 		secrets := map[string]RawSecret{}
 		getParametersByPathInput := &ssm.GetParametersByPathInput{
-			Path:           aws.String("/" + service + "/"),
+			Path:           aws.String(s.servicePath(service) + "/"),
 			WithDecryption: aws.Bool(true),
 		}
 		if label != "" {
@@ -421,8 +724,8 @@ func (s *SSMStore) ListRaw(serviceName string) ([]RawSecret, error) {
 				}
 
 				secrets[*param.Name] = RawSecret{
-					Value: *param.Value,
-					Key:   *param.Name,
+					Value: *s.readValue(param.Type, param.Value),
+					Key:   s.stripPrefix(*param.Name),
 				}
 			}
 			return true
@@ -495,6 +798,66 @@ func (s *SSMStore) History(id SecretId) ([]ChangeEvent, error) {
 	return events, nil
 }
 
+// ReadTags returns the tags attached to a secret.
+func (s *SSMStore) ReadTags(id SecretId) (map[string]string, error) {
+	listTagsForResourceInput := &ssm.ListTagsForResourceInput{
+		ResourceId:   aws.String(s.idToName(id)),
+		ResourceType: aws.String(ssm.ResourceTypeForTaggingParameter),
+	}
+
+	resp, err := s.svc.ListTagsForResource(listTagsForResourceInput)
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == ssm.ErrCodeInvalidResourceId {
+			return nil, ErrSecretNotFound
+		}
+		return nil, err
+	}
+
+	tags := make(map[string]string, len(resp.TagList))
+	for _, tag := range resp.TagList {
+		tags[*tag.Key] = *tag.Value
+	}
+	return tags, nil
+}
+
+// WriteTags adds tags to a secret, replacing the values of any tags that
+// already exist with the same keys.
+func (s *SSMStore) WriteTags(id SecretId, tags map[string]string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	ssmTags := make([]*ssm.Tag, 0, len(tags))
+	for k, v := range tags {
+		ssmTags = append(ssmTags, &ssm.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+
+	addTagsToResourceInput := &ssm.AddTagsToResourceInput{
+		ResourceId:   aws.String(s.idToName(id)),
+		ResourceType: aws.String(ssm.ResourceTypeForTaggingParameter),
+		Tags:         ssmTags,
+	}
+
+	_, err := s.svc.AddTagsToResource(addTagsToResourceInput)
+	return err
+}
+
+// DeleteTags removes the tags with the given keys from a secret.
+func (s *SSMStore) DeleteTags(id SecretId, tagKeys []string) error {
+	if len(tagKeys) == 0 {
+		return nil
+	}
+
+	removeTagsFromResourceInput := &ssm.RemoveTagsFromResourceInput{
+		ResourceId:   aws.String(s.idToName(id)),
+		ResourceType: aws.String(ssm.ResourceTypeForTaggingParameter),
+		TagKeys:      stringsToAWSStrings(tagKeys),
+	}
+
+	_, err := s.svc.RemoveTagsFromResource(removeTagsFromResourceInput)
+	return err
+}
+
 func (s *SSMStore) listRawViaList(service string) ([]RawSecret, error) {
 	// Delegate to List
 	secrets, err := s.List(service, true)
@@ -519,12 +882,22 @@ func (s *SSMStore) listRawViaList(service string) ([]RawSecret, error) {
 
 func (s *SSMStore) idToName(id SecretId) string {
 	if s.usePaths {
-		return fmt.Sprintf("/%s/%s", id.Service, id.Key)
+		return fmt.Sprintf("%s/%s", s.servicePath(id.Service), id.Key)
 	}
 
 	return fmt.Sprintf("%s.%s", id.Service, id.Key)
 }
 
+// servicePath returns the path of service, including the prefix if any
+func (s *SSMStore) servicePath(service string) string {
+	return s.prefix + "/" + service
+}
+
+// stripPrefix removes the prefix from a parameter name
+func (s *SSMStore) stripPrefix(name string) string {
+	return strings.TrimPrefix(name, s.prefix)
+}
+
 func (s *SSMStore) validateName(name string) bool {
 	if s.usePaths {
 		return validPathKeyFormat.MatchString(name)
@@ -560,6 +933,9 @@ func parameterMetaToSecretMeta(p *ssm.ParameterMetadata) SecretMetadata {
 		CreatedBy: *p.LastModifiedUser,
 		Version:   version,
 		Key:       *p.Name,
+		KMSKey:    aws.StringValue(p.KeyId),
+		Policies:  secretPolicies(p.Policies),
+		Type:      aws.StringValue(p.Type),
 	}
 }
 
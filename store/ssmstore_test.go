@@ -4,11 +4,13 @@ import (
 	"errors"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/service/ssm"
@@ -25,10 +27,14 @@ type mockParameter struct {
 	currentParam *ssm.Parameter
 	history      []*ssm.ParameterHistory
 	meta         *ssm.ParameterMetadata
+	tags         map[string]string
 }
 
 func (m *mockSSMClient) PutParameter(i *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
 	current, ok := m.parameters[*i.Name]
+	if ok && !aws.BoolValue(i.Overwrite) {
+		return nil, awserr.New(ssm.ErrCodeParameterAlreadyExists, "The parameter already exists.", nil)
+	}
 	if !ok {
 		current = mockParameter{
 			history: []*ssm.ParameterHistory{},
@@ -47,8 +53,13 @@ func (m *mockSSMClient) PutParameter(i *ssm.PutParameterInput) (*ssm.PutParamete
 		LastModifiedUser: aws.String("test"),
 		Name:             i.Name,
 		Type:             i.Type,
+		Tier:             i.Tier,
+	}
+	if i.Policies != nil {
+		current.meta.Policies = []*ssm.ParameterInlinePolicy{{PolicyText: i.Policies}}
 	}
 	history := &ssm.ParameterHistory{
+		Version:          aws.Int64(int64(len(current.history) + 1)),
 		Description:      current.meta.Description,
 		KeyId:            current.meta.KeyId,
 		LastModifiedDate: current.meta.LastModifiedDate,
@@ -65,6 +76,9 @@ func (m *mockSSMClient) PutParameter(i *ssm.PutParameterInput) (*ssm.PutParamete
 }
 
 func (m *mockSSMClient) GetParameters(i *ssm.GetParametersInput) (*ssm.GetParametersOutput, error) {
+	if len(i.Names) > 10 {
+		return nil, errors.New("ValidationException: at most 10 names can be given")
+	}
 	parameters := []*ssm.Parameter{}
 
 	for _, param := range m.parameters {
@@ -111,6 +125,8 @@ func (m *mockSSMClient) GetParameterHistory(i *ssm.GetParameterHistoryInput) (*s
 
 	for _, hist := range param.history {
 		history = append(history, &ssm.ParameterHistory{
+			Version:          hist.Version,
+			Labels:           hist.Labels,
 			Description:      hist.Description,
 			KeyId:            hist.KeyId,
 			LastModifiedDate: hist.LastModifiedDate,
@@ -211,6 +227,88 @@ func (m *mockSSMClient) DeleteParameter(i *ssm.DeleteParameterInput) (*ssm.Delet
 	return &ssm.DeleteParameterOutput{}, nil
 }
 
+func (m *mockSSMClient) DeleteParameters(i *ssm.DeleteParametersInput) (*ssm.DeleteParametersOutput, error) {
+	if len(i.Names) > 10 {
+		return nil, errors.New("ValidationException: at most 10 names can be given")
+	}
+	o := &ssm.DeleteParametersOutput{}
+	for _, name := range i.Names {
+		if _, ok := m.parameters[*name]; !ok {
+			o.InvalidParameters = append(o.InvalidParameters, name)
+			continue
+		}
+		delete(m.parameters, *name)
+		o.DeletedParameters = append(o.DeletedParameters, name)
+	}
+	return o, nil
+}
+
+func (m *mockSSMClient) UnlabelParameterVersion(i *ssm.UnlabelParameterVersionInput) (*ssm.UnlabelParameterVersionOutput, error) {
+	param, ok := m.parameters[*i.Name]
+	if !ok {
+		return nil, errors.New("parameter not found")
+	}
+	for _, hist := range param.history {
+		if *hist.Version != *i.ParameterVersion {
+			continue
+		}
+		var kept []*string
+		for _, label := range hist.Labels {
+			removed := false
+			for _, l := range i.Labels {
+				removed = removed || *l == *label
+			}
+			if !removed {
+				kept = append(kept, label)
+			}
+		}
+		hist.Labels = kept
+		return &ssm.UnlabelParameterVersionOutput{RemovedLabels: i.Labels}, nil
+	}
+	return nil, errors.New("version not found")
+}
+
+func (m *mockSSMClient) ListTagsForResource(i *ssm.ListTagsForResourceInput) (*ssm.ListTagsForResourceOutput, error) {
+	param, ok := m.parameters[*i.ResourceId]
+	if !ok {
+		return &ssm.ListTagsForResourceOutput{}, awserr.New(ssm.ErrCodeInvalidResourceId, "not found", nil)
+	}
+
+	tags := []*ssm.Tag{}
+	for k, v := range param.tags {
+		tags = append(tags, &ssm.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	return &ssm.ListTagsForResourceOutput{TagList: tags}, nil
+}
+
+func (m *mockSSMClient) AddTagsToResource(i *ssm.AddTagsToResourceInput) (*ssm.AddTagsToResourceOutput, error) {
+	param, ok := m.parameters[*i.ResourceId]
+	if !ok {
+		return &ssm.AddTagsToResourceOutput{}, awserr.New(ssm.ErrCodeInvalidResourceId, "not found", nil)
+	}
+
+	if param.tags == nil {
+		param.tags = map[string]string{}
+	}
+	for _, tag := range i.Tags {
+		param.tags[*tag.Key] = *tag.Value
+	}
+	m.parameters[*i.ResourceId] = param
+	return &ssm.AddTagsToResourceOutput{}, nil
+}
+
+func (m *mockSSMClient) RemoveTagsFromResource(i *ssm.RemoveTagsFromResourceInput) (*ssm.RemoveTagsFromResourceOutput, error) {
+	param, ok := m.parameters[*i.ResourceId]
+	if !ok {
+		return &ssm.RemoveTagsFromResourceOutput{}, awserr.New(ssm.ErrCodeInvalidResourceId, "not found", nil)
+	}
+
+	for _, k := range i.TagKeys {
+		delete(param.tags, *k)
+	}
+	return &ssm.RemoveTagsFromResourceOutput{}, nil
+}
+
 func paramNameInSlice(name *string, slice []*string) bool {
 	for _, val := range slice {
 		if *val == *name {
@@ -229,20 +327,6 @@ func prefixInSlice(val *string, prefixes []*string) bool {
 	return false
 }
 
-func pathInSlice(val *string, paths []*string) bool {
-	tokens := strings.Split(*val, "/")
-	if len(tokens) < 2 {
-		return false
-	}
-	matchPath := "/" + tokens[1]
-	for _, path := range paths {
-		if matchPath == *path {
-			return true
-		}
-	}
-	return false
-}
-
 func matchFilters(filters []*ssm.ParametersFilter, param mockParameter) (bool, error) {
 	for _, filter := range filters {
 		var compareTo *string
@@ -265,16 +349,21 @@ func matchFilters(filters []*ssm.ParametersFilter, param mockParameter) (bool, e
 
 func matchStringFilters(filters []*ssm.ParameterStringFilter, param mockParameter) (bool, error) {
 	for _, filter := range filters {
-		var compareTo *string
 		switch *filter.Key {
 		case "Path":
 			tokens := strings.Split(*param.meta.Name, "/")
 			if len(tokens) < 2 {
 				return false, errors.New("path filter used on non path value")
 			}
-			compareTo = aws.String("/" + tokens[1] + "/")
-
-			if !pathInSlice(compareTo, filter.Values) {
+			// OneLevel matches parameters directly under the path
+			parent := basePath(*param.meta.Name)
+			result := false
+			for _, value := range filter.Values {
+				if strings.TrimSuffix(*value, "/") == parent {
+					result = true
+				}
+			}
+			if !result {
 				return false, nil
 			}
 
@@ -387,6 +476,52 @@ func TestWrite(t *testing.T) {
 		assert.Equal(t, "2", *mock.parameters[store.idToName(secretId)].meta.Description)
 		assert.Equal(t, 2, len(mock.parameters[store.idToName(secretId)].history))
 	})
+
+	t.Run("Setting a key with an expiry should add an expiration policy", func(t *testing.T) {
+		secretId := SecretId{Service: "test", Key: "expiring"}
+		expires := time.Date(2030, 1, 2, 15, 4, 5, 0, time.FixedZone("", 3600))
+		err := store.WriteWithPolicies(secretId, "value", WritePolicies{Expires: expires})
+		assert.Nil(t, err)
+
+		meta := mock.parameters[store.idToName(secretId)].meta
+		assert.Equal(t, ssm.ParameterTierAdvanced, aws.StringValue(meta.Tier))
+		assert.Len(t, meta.Policies, 1)
+		assert.JSONEq(t,
+			`[{"Type":"Expiration","Version":"1.0","Attributes":{"Timestamp":"2030-01-02T14:04:05Z"}}]`,
+			aws.StringValue(meta.Policies[0].PolicyText))
+		assert.Equal(t, "1", *meta.Description)
+	})
+
+	t.Run("Setting a key with policies should add each of them", func(t *testing.T) {
+		secretId := SecretId{Service: "test", Key: "rotated"}
+		expires := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+		err := store.WriteWithPolicies(secretId, "value", WritePolicies{Expires: expires, NotifyNoChange: 30 * 24 * time.Hour})
+		assert.Nil(t, err)
+
+		meta := mock.parameters[store.idToName(secretId)].meta
+		assert.Equal(t, ssm.ParameterTierAdvanced, aws.StringValue(meta.Tier))
+		assert.JSONEq(t,
+			`[{"Type":"Expiration","Version":"1.0","Attributes":{"Timestamp":"2030-01-02T15:04:05Z"}},`+
+				`{"Type":"NoChangeNotification","Version":"1.0","Attributes":{"After":"30","Unit":"Days"}}]`,
+			aws.StringValue(meta.Policies[0].PolicyText))
+
+		secrets, err := store.List("test", false)
+		assert.Nil(t, err)
+		found := false
+		for _, secret := range secrets {
+			if secret.Meta.Key == store.idToName(secretId) {
+				found = true
+				assert.Equal(t, []SecretPolicy{
+					{Type: "Expiration", Attributes: map[string]string{"Timestamp": "2030-01-02T15:04:05Z"}},
+					{Type: "NoChangeNotification", Attributes: map[string]string{"After": "30", "Unit": "Days"}},
+				}, secret.Meta.Policies)
+			}
+		}
+		assert.True(t, found)
+
+		err = store.WriteWithPolicies(secretId, "value", WritePolicies{NotifyNoChange: 90 * time.Minute})
+		assert.Error(t, err)
+	})
 }
 
 func TestRead(t *testing.T) {
@@ -467,6 +602,14 @@ func TestList(t *testing.T) {
 		}
 	})
 
+	t.Run("List should report the KMS key of each secret", func(t *testing.T) {
+		s, err := store.List("test", false)
+		assert.Nil(t, err)
+		for _, secret := range s {
+			assert.Equal(t, store.KMSKey(), secret.Meta.KMSKey)
+		}
+	})
+
 	t.Run("List should only return exact matches on service name", func(t *testing.T) {
 		store.Write(SecretId{Service: "match", Key: "a"}, "val")
 		store.Write(SecretId{Service: "matchlonger", Key: "a"}, "val")
@@ -598,6 +741,21 @@ func NewTestSSMStoreWithPaths(mock ssmiface.SSMAPI) *SSMStore {
 	}
 }
 
+func TestCapabilities(t *testing.T) {
+	mock := &mockSSMClient{parameters: map[string]mockParameter{}}
+	assert.False(t, NewTestSSMStore(mock).Capabilities().Labels)
+
+	capabilities := NewJSONExpandingStore(NewTestSSMStoreWithPaths(mock)).Capabilities()
+	assert.Equal(t, Capabilities{
+		History:          true,
+		Labels:           true,
+		Tags:             true,
+		Expiry:           true,
+		MaxValueSize:     4096,
+		ConcurrentWrites: true,
+	}, capabilities)
+}
+
 func TestWritePaths(t *testing.T) {
 	mock := &mockSSMClient{parameters: map[string]mockParameter{}}
 	store := NewTestSSMStoreWithPaths(mock)
@@ -752,6 +910,55 @@ func TestHistoryPaths(t *testing.T) {
 	})
 }
 
+func TestPrefix(t *testing.T) {
+	mock := &mockSSMClient{parameters: map[string]mockParameter{}}
+	store, err := NewTestSSMStoreWithPaths(mock).WithPrefix("chamber/team/")
+	assert.Nil(t, err)
+	assert.Equal(t, "/chamber/team", store.Prefix())
+
+	secretId := SecretId{Service: "test", Key: "key"}
+	assert.Nil(t, store.Write(secretId, "value"))
+	assert.Contains(t, mock.parameters, "/chamber/team/test/key")
+
+	t.Run("Read should not include the prefix in keys", func(t *testing.T) {
+		s, err := store.Read(secretId, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "/test/key", s.Meta.Key)
+	})
+
+	t.Run("List should not include the prefix in keys", func(t *testing.T) {
+		s, err := store.List("test", true)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(s))
+		assert.Equal(t, "/test/key", s[0].Meta.Key)
+		assert.Equal(t, "value", *s[0].Value)
+	})
+
+	t.Run("ListRaw should not include the prefix in keys", func(t *testing.T) {
+		s, err := store.ListRaw("test")
+		assert.Nil(t, err)
+		assert.Equal(t, []RawSecret{{Key: "/test/key", Value: "value"}}, s)
+	})
+
+	t.Run("ListServices should not include the prefix", func(t *testing.T) {
+		s, err := store.ListServices("", false)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"test"}, s)
+	})
+
+	t.Run("Services outside the prefix are not visible", func(t *testing.T) {
+		unprefixed := NewTestSSMStoreWithPaths(mock)
+		s, err := unprefixed.ListRaw("test")
+		assert.Nil(t, err)
+		assert.Empty(t, s)
+	})
+
+	t.Run("A prefix requires paths", func(t *testing.T) {
+		_, err := NewTestSSMStore(mock).WithPrefix("chamber")
+		assert.NotNil(t, err)
+	})
+}
+
 func TestDelete(t *testing.T) {
 	mock := &mockSSMClient{parameters: map[string]mockParameter{}}
 	store := NewTestSSMStore(mock)
@@ -772,6 +979,45 @@ func TestDelete(t *testing.T) {
 	})
 }
 
+func TestTags(t *testing.T) {
+	mock := &mockSSMClient{parameters: map[string]mockParameter{}}
+	store := NewTestSSMStoreWithPaths(mock)
+	secretId := SecretId{Service: "test", Key: "tagged"}
+	store.Write(secretId, "value")
+
+	t.Run("Writing tags should add them", func(t *testing.T) {
+		err := store.WriteTags(secretId, map[string]string{"team": "payments", "env": "prod"})
+		assert.Nil(t, err)
+
+		tags, err := store.ReadTags(secretId)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"team": "payments", "env": "prod"}, tags)
+	})
+
+	t.Run("Writing tags should overwrite existing ones", func(t *testing.T) {
+		err := store.WriteTags(secretId, map[string]string{"env": "staging"})
+		assert.Nil(t, err)
+
+		tags, err := store.ReadTags(secretId)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"team": "payments", "env": "staging"}, tags)
+	})
+
+	t.Run("Deleting tags should remove them", func(t *testing.T) {
+		err := store.DeleteTags(secretId, []string{"env"})
+		assert.Nil(t, err)
+
+		tags, err := store.ReadTags(secretId)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"team": "payments"}, tags)
+	})
+
+	t.Run("Reading tags of a non-existent key should give not found err", func(t *testing.T) {
+		_, err := store.ReadTags(SecretId{Service: "test", Key: "nope"})
+		assert.Equal(t, ErrSecretNotFound, err)
+	})
+}
+
 func TestValidations(t *testing.T) {
 	mock := &mockSSMClient{parameters: map[string]mockParameter{}}
 	pathStore := NewTestSSMStore(mock)
@@ -884,3 +1130,145 @@ type ByKeyRaw []RawSecret
 func (a ByKeyRaw) Len() int           { return len(a) }
 func (a ByKeyRaw) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByKeyRaw) Less(i, j int) bool { return a[i].Key < a[j].Key }
+
+func TestWriteWithKMSKey(t *testing.T) {
+	mock := &mockSSMClient{parameters: map[string]mockParameter{}}
+	store := NewTestSSMStore(mock)
+	secretId := SecretId{Service: "billing", Key: "api_key"}
+
+	withKey := store.WithKMSKey("team-billing").(*SSMStore)
+	assert.Equal(t, "alias/team-billing", withKey.KMSKey())
+	assert.Nil(t, withKey.Write(secretId, "value"))
+	assert.Equal(t, "alias/team-billing", aws.StringValue(mock.parameters[store.idToName(secretId)].meta.KeyId))
+
+	// the original store is unchanged
+	assert.Equal(t, DefaultKeyID, store.KMSKey())
+}
+
+func TestNormalizeKMSKey(t *testing.T) {
+	for key, expected := range map[string]string{
+		"team-billing":       "alias/team-billing",
+		"alias/team-billing": "alias/team-billing",
+		"arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab": "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab",
+		"1234abcd-12ab-34cd-56ef-1234567890ab":                                        "1234abcd-12ab-34cd-56ef-1234567890ab",
+		"mrk-1234abcd12ab34cd56ef1234567890ab":                                        "mrk-1234abcd12ab34cd56ef1234567890ab",
+	} {
+		assert.Equal(t, expected, NormalizeKMSKey(key), key)
+	}
+}
+
+func TestStringList(t *testing.T) {
+	mock := &mockSSMClient{parameters: map[string]mockParameter{}}
+	store := NewTestSSMStore(mock)
+	secretId := SecretId{Service: "test", Key: "hosts"}
+
+	assert.Nil(t, store.WriteStringList(secretId, []string{"a", "b", "c"}))
+	param := mock.parameters[store.idToName(secretId)]
+	assert.Equal(t, ssm.ParameterTypeStringList, aws.StringValue(param.meta.Type))
+	assert.Nil(t, param.meta.KeyId)
+	assert.Equal(t, "a,b,c", aws.StringValue(param.currentParam.Value))
+
+	secret, err := store.Read(secretId, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, "a,b,c", *secret.Value)
+	assert.Equal(t, ssm.ParameterTypeStringList, secret.Meta.Type)
+
+	withSeparator := store.WithListSeparator(":")
+	secret, err = withSeparator.Read(secretId, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, "a:b:c", *secret.Value)
+	raw, err := withSeparator.ListRaw("test")
+	assert.Nil(t, err)
+	assert.Equal(t, []RawSecret{{Key: store.idToName(secretId), Value: "a:b:c"}}, raw)
+
+	// other secrets are left alone
+	assert.Nil(t, store.Write(SecretId{Service: "other", Key: "csv"}, "x,y"))
+	secret, err = withSeparator.Read(SecretId{Service: "other", Key: "csv"}, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, "x,y", *secret.Value)
+
+	assert.Error(t, store.WriteStringList(secretId, []string{"a,b"}))
+	assert.Error(t, store.WriteStringList(secretId, []string{"a", ""}))
+	assert.Error(t, store.WriteStringList(secretId, nil))
+}
+
+func TestReadBatch(t *testing.T) {
+	mock := &mockSSMClient{parameters: map[string]mockParameter{}}
+	store := NewTestSSMStore(mock)
+	expected := map[string]string{}
+	keys := []string{"missing"}
+	for i := 0; i < 12; i++ {
+		key := "key" + strconv.Itoa(i)
+		assert.Nil(t, store.Write(SecretId{Service: "test", Key: key}, "value"+key))
+		expected[key] = "value" + key
+		keys = append(keys, key)
+	}
+
+	values, err := store.ReadBatch("test", keys)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, values)
+
+	values, err = ReadBatch(NewMemoryStore(), "test", keys)
+	assert.Nil(t, err)
+	assert.Empty(t, values)
+}
+
+func TestDeleteBatch(t *testing.T) {
+	mock := &mockSSMClient{parameters: map[string]mockParameter{}}
+	store := NewTestSSMStore(mock)
+	keys := []string{"missing"}
+	for i := 0; i < 12; i++ {
+		key := "key" + strconv.Itoa(i)
+		assert.Nil(t, store.Write(SecretId{Service: "test", Key: key}, "value"))
+		keys = append(keys, key)
+	}
+	assert.Nil(t, store.Write(SecretId{Service: "other", Key: "key0"}, "value"))
+
+	assert.Nil(t, store.DeleteBatch("test", keys))
+	assert.Equal(t, 1, len(mock.parameters))
+	_, err := store.Read(SecretId{Service: "other", Key: "key0"}, -1)
+	assert.Nil(t, err)
+
+	memory := NewMemoryStore()
+	assert.Nil(t, memory.Write(SecretId{Service: "test", Key: "key0"}, "value"))
+	assert.Nil(t, DeleteBatch(memory, "test", keys))
+	_, err = memory.Read(SecretId{Service: "test", Key: "key0"}, -1)
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+}
+
+func TestPruneVersions(t *testing.T) {
+	mock := &mockSSMClient{parameters: map[string]mockParameter{}}
+	store := NewTestSSMStoreWithPaths(mock)
+	id := SecretId{Service: "test", Key: "key"}
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, store.Write(id, "value"+strconv.Itoa(i)))
+	}
+	history := mock.parameters["/test/key"].history
+	history[0].Labels = aws.StringSlice([]string{"old"})
+	history[1].Labels = aws.StringSlice([]string{"blue", "green"})
+	history[3].Labels = aws.StringSlice([]string{"current"})
+
+	unlabeled, err := store.PruneVersions(id, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, unlabeled)
+	assert.Empty(t, history[0].Labels)
+	assert.Empty(t, history[1].Labels)
+	assert.Equal(t, []string{"current"}, aws.StringValueSlice(history[3].Labels))
+
+	_, err = store.PruneVersions(SecretId{Service: "test", Key: "missing"}, 3)
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+}
+
+func TestSSMCreate(t *testing.T) {
+	mock := &mockSSMClient{parameters: map[string]mockParameter{}}
+	s := NewTestSSMStore(mock)
+	id := SecretId{Service: "app", Key: "db_password"}
+
+	assert.NoError(t, s.Create(id, "hunter2"))
+	assert.ErrorIs(t, s.Create(id, "hunter3"), ErrSecretExists)
+
+	secret, err := s.Read(id, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", *secret.Value)
+	assert.Equal(t, 1, secret.Meta.Version)
+}
@@ -2,6 +2,8 @@ package store
 
 import (
 	"errors"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -26,6 +28,9 @@ var (
 	// ErrSecretNotFound is returned if the specified secret is not found in the
 	// parameter store
 	ErrSecretNotFound = errors.New("secret not found")
+
+	// ErrSecretExists is returned by Create if the secret already exists
+	ErrSecretExists = errors.New("secret already exists")
 )
 
 type SecretId struct {
@@ -49,6 +54,149 @@ type SecretMetadata struct {
 	CreatedBy string
 	Version   int
 	Key       string
+	// KMSKey is the key encrypting the secret, for backends that report it
+	KMSKey string
+	// Policies are the policies in effect on the secret, for backends that
+	// have them
+	Policies []SecretPolicy
+	// Type is the type of the value, for backends with several, like
+	// Parameter Store's SecureString and StringList
+	Type string
+}
+
+// SecretPolicy is a policy a backend applies to a secret, like Parameter
+// Store's Expiration and NoChangeNotification policies
+type SecretPolicy struct {
+	Type       string
+	Attributes map[string]string
+}
+
+// WritePolicies are the policies a secret can be written with
+type WritePolicies struct {
+	// Expires, if set, is when the backend deletes the secret
+	Expires time.Time
+	// NotifyNoChange, if set, is how long the secret can go without being
+	// changed before the backend notifies about it. It is a whole number of
+	// hours.
+	NotifyNoChange time.Duration
+}
+
+// IsZero reports whether p has no policy
+func (p WritePolicies) IsZero() bool {
+	return p.Expires.IsZero() && p.NotifyNoChange == 0
+}
+
+// StringListStore is implemented by stores that can hold lists of strings
+type StringListStore interface {
+	Store
+	// WriteStringList writes values as a list. Values cannot contain the
+	// list separator of the backend.
+	WriteStringList(id SecretId, values []string) error
+	// WithListSeparator returns a copy of the store joining the values of
+	// lists with sep when reading them
+	WithListSeparator(sep string) Store
+}
+
+// BatchReader is implemented by stores that can read the latest values of
+// several secrets of a service with fewer requests than reading each
+type BatchReader interface {
+	// ReadBatch returns the values of the keys of service that exist
+	ReadBatch(service string, keys []string) (map[string]string, error)
+}
+
+// ReadBatch reads the latest values of the keys of service, at once on
+// stores implementing BatchReader and one at a time otherwise. Keys that
+// don't exist are left out.
+func ReadBatch(s Store, service string, keys []string) (map[string]string, error) {
+	if r, ok := s.(BatchReader); ok {
+		return r.ReadBatch(service, keys)
+	}
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		secret, err := s.Read(SecretId{Service: service, Key: key}, -1)
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[key] = *secret.Value
+	}
+	return values, nil
+}
+
+// BatchDeleter is implemented by stores that can delete several secrets of a
+// service with fewer requests than deleting each
+type BatchDeleter interface {
+	// DeleteBatch deletes the keys of service, including all their versions.
+	// Keys that don't exist are ignored.
+	DeleteBatch(service string, keys []string) error
+}
+
+// DeleteBatch deletes the keys of service, at once on stores implementing
+// BatchDeleter and one at a time otherwise. Keys that don't exist are
+// ignored.
+func DeleteBatch(s Store, service string, keys []string) error {
+	if d, ok := Unwrap(s).(BatchDeleter); ok {
+		return d.DeleteBatch(service, keys)
+	}
+	for _, key := range keys {
+		err := s.Delete(SecretId{Service: service, Key: key})
+		if err != nil && !errors.Is(err, ErrSecretNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unwrapper is implemented by stores wrapping another one to change how it is
+// read, so that the features of the store they wrap can still be found
+type Unwrapper interface {
+	// Unwrap returns the wrapped store
+	Unwrap() Store
+}
+
+// Unwrap returns the store at the bottom of the stores wrapping s, or s
+// itself when it wraps none
+func Unwrap(s Store) Store {
+	for {
+		u, ok := s.(Unwrapper)
+		if !ok {
+			return s
+		}
+		s = u.Unwrap()
+	}
+}
+
+// BatchWriter is implemented by stores that can change several secrets of a
+// service in a single write
+type BatchWriter interface {
+	// WriteBatch sets the keys of values and deletes the keys of deleted,
+	// all at once, so either every change is made or none is
+	WriteBatch(service string, values map[string]string, deleted []string) error
+}
+
+// Creator is implemented by stores that can write a secret only if it
+// doesn't exist yet, checking and writing atomically
+type Creator interface {
+	// Create writes the first version of id, failing with ErrSecretExists
+	// if it already exists
+	Create(id SecretId, value string) error
+}
+
+// VersionPruner is implemented by stores that limit how many versions of a
+// secret they keep
+type VersionPruner interface {
+	// PruneVersions lets go of every version of id but the latest keep ones,
+	// returning how many versions it changed
+	PruneVersions(id SecretId, keep int) (int, error)
+}
+
+// PolicyStore is implemented by stores that can write secrets with policies,
+// such as an expiry after which the backend deletes them by itself
+type PolicyStore interface {
+	Store
+	WriteWithPolicies(id SecretId, value string, policies WritePolicies) error
 }
 
 type ChangeEvent struct {
@@ -58,6 +206,63 @@ type ChangeEvent struct {
 	Version int
 }
 
+// Capabilities describes the optional features a backend supports, so that
+// callers can check for them before relying on them
+type Capabilities struct {
+	// History is whether past versions of secrets are kept
+	History bool `json:"history"`
+	// Labels is whether versions can be labeled, and services read at a label
+	Labels bool `json:"labels"`
+	// Tags is whether individual secrets can be tagged
+	Tags bool `json:"tags"`
+	// Expiry is whether secrets can be written with an expiry
+	Expiry bool `json:"expiry"`
+	// Binary is whether values may hold arbitrary bytes rather than text
+	Binary bool `json:"binary"`
+	// MaxValueSize is the largest value the backend accepts, in bytes, or 0
+	// when it has no limit of its own
+	MaxValueSize int `json:"max_value_size"`
+	// ConcurrentWrites is whether secrets of a service can be written at the
+	// same time. Backends holding a service in one object rewrite it on each
+	// write, so concurrent writes would undo each other.
+	ConcurrentWrites bool `json:"concurrent_writes"`
+}
+
+// KMSKeyStore is implemented by stores that can encrypt the secrets they
+// write with a KMS key chosen by the caller
+type KMSKeyStore interface {
+	Store
+	// WithKMSKey returns a copy of the store writing secrets with key, an
+	// alias, key ID or ARN
+	WithKMSKey(key string) Store
+}
+
+// NormalizeKMSKey prefixes key with alias/ unless it is already an alias, an
+// ARN or a key ID
+func NormalizeKMSKey(key string) string {
+	if strings.HasPrefix(key, "alias/") || strings.HasPrefix(key, "arn:") || kmsKeyIDFormat.MatchString(key) {
+		return key
+	}
+	return "alias/" + key
+}
+
+// kmsKeyIDFormat matches the IDs of KMS keys, including multi-region ones
+var kmsKeyIDFormat = regexp.MustCompile(`^(mrk-[0-9a-f]{32}|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$`)
+
+// EncryptionContextStore is implemented by stores that can bind the secrets
+// they write to their service with a KMS encryption context, so that key
+// policies can grant access service by service
+type EncryptionContextStore interface {
+	Store
+	// WithServiceEncryptionContext returns a copy of the store encrypting
+	// secrets with the encryption context {"service": "<service>"}
+	WithServiceEncryptionContext() Store
+}
+
+// EncryptionContextKey is the key of the encryption context holding the
+// service of a secret
+const EncryptionContextKey = "service"
+
 type Store interface {
 	Write(id SecretId, value string) error
 	Read(id SecretId, version int) (Secret, error)
@@ -66,4 +271,8 @@ type Store interface {
 	ListServices(service string, includeSecretName bool) ([]string, error)
 	History(id SecretId) ([]ChangeEvent, error)
 	Delete(id SecretId) error
+	ReadTags(id SecretId) (map[string]string, error)
+	WriteTags(id SecretId, tags map[string]string) error
+	DeleteTags(id SecretId, tagKeys []string) error
+	Capabilities() Capabilities
 }
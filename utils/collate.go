@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Collations for ordering keys in output. None of them depend on the locale,
+// so the same keys are ordered the same way on every machine.
+const (
+	// CollationBytewise orders keys by their bytes, as Go compares strings
+	CollationBytewise = "bytewise"
+	// CollationIgnoreCase orders keys ignoring case
+	CollationIgnoreCase = "ignore-case"
+	// CollationNatural orders runs of digits by their value, so that key2
+	// comes before key10
+	CollationNatural = "natural"
+)
+
+// Collations lists the supported collations
+var Collations = []string{CollationBytewise, CollationIgnoreCase, CollationNatural}
+
+// ValidateCollation returns an error if collation isn't supported
+func ValidateCollation(collation string) error {
+	for _, c := range Collations {
+		if collation == c {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported collation %q: must be one of %s", collation, strings.Join(Collations, ", "))
+}
+
+// CompareKeys compares a and b using collation, returning a negative number
+// when a sorts first, and a positive number when b does. Keys only compare
+// equal when they are identical, so that ordering is always deterministic.
+func CompareKeys(collation, a, b string) int {
+	c := 0
+	switch collation {
+	case CollationIgnoreCase:
+		c = strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	case CollationNatural:
+		c = compareNatural(a, b)
+	}
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// SortKeys sorts keys in place using collation
+func SortKeys(collation string, keys []string) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		return CompareKeys(collation, keys[i], keys[j]) < 0
+	})
+}
+
+// compareNatural compares a and b byte by byte, except that runs of digits
+// are compared by their value
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			na, restA := digitRun(a)
+			nb, restB := digitRun(b)
+			// without leading zeros, a longer run is a larger number
+			ta, tb := strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if len(ta) != len(tb) {
+				if len(ta) < len(tb) {
+					return -1
+				}
+				return 1
+			}
+			if c := strings.Compare(ta, tb); c != 0 {
+				return c
+			}
+			a, b = restA, restB
+			continue
+		}
+		if a[0] != b[0] {
+			if a[0] < b[0] {
+				return -1
+			}
+			return 1
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// digitRun splits the leading digits off s
+func digitRun(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
@@ -44,3 +44,26 @@ func TestNormalizeKey(t *testing.T) {
 		})
 	}
 }
+
+func TestSortKeys(t *testing.T) {
+	keys := []string{"key10", "Key2", "key2", "key02", "b", "A", "key1"}
+	testCases := []struct {
+		collation string
+		expected  []string
+	}{
+		{CollationBytewise, []string{"A", "Key2", "b", "key02", "key1", "key10", "key2"}},
+		{CollationIgnoreCase, []string{"A", "b", "key02", "key1", "key10", "Key2", "key2"}},
+		{CollationNatural, []string{"A", "Key2", "b", "key1", "key02", "key2", "key10"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.collation, func(t *testing.T) {
+			sorted := append([]string(nil), keys...)
+			SortKeys(testCase.collation, sorted)
+			assert.Equal(t, testCase.expected, sorted)
+		})
+	}
+
+	assert.NoError(t, ValidateCollation(CollationNatural))
+	assert.Error(t, ValidateCollation("en_US"))
+}